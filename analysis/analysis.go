@@ -0,0 +1,140 @@
+// Package analysis looks for likely mistakes in Monkey programs that the
+// parser accepts: bindings that are never read, code that can never run,
+// conditions that never change and declarations that hide others.
+//
+// Its findings are diagnostics, not errors: the program still runs the
+// same way. Names starting with an underscore are never reported as
+// unused or shadowing, and neither are the top-level bindings of a
+// program, which a module exports to its importers.
+package analysis
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/resolver"
+	"sort"
+	"strings"
+)
+
+// Diagnostic is one finding of Analyze.
+type Diagnostic struct {
+	Line   int
+	Column int
+
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s", d.Line, d.Column, d.Message)
+}
+
+// Analyze returns the diagnostics for program, ordered by position.
+func Analyze(program *ast.Program) []Diagnostic {
+	a := &analyzer{}
+
+	a.scope(resolver.Resolve(program).Global)
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Program:
+			a.statements(node.Statements)
+		case *ast.BlockStatement:
+			a.statements(node.Statements)
+		case *ast.IfExpression:
+			if value, ok := constant(node.Condition); ok {
+				a.report(node.Condition, "condition is always %t", object.IsTruthy(value))
+			}
+		}
+		return true
+	})
+
+	sort.SliceStable(a.diagnostics, func(i, j int) bool {
+		di, dj := a.diagnostics[i], a.diagnostics[j]
+		if di.Line != dj.Line {
+			return di.Line < dj.Line
+		}
+		return di.Column < dj.Column
+	})
+	return a.diagnostics
+}
+
+type analyzer struct {
+	diagnostics []Diagnostic
+}
+
+// scope reports the unused and shadowing declarations of s and of the
+// scopes inside it.
+func (a *analyzer) scope(s *resolver.Scope) {
+	_, exported := s.Node.(*ast.Program)
+
+	for _, decl := range s.Declarations {
+		if ignored(decl.Name) {
+			continue
+		}
+		if decl.Kind == resolver.Let && !exported && len(decl.Uses) == 0 {
+			a.report(decl.Ident, "%s declared and not used", decl.Name)
+		}
+		if shadowed := decl.Shadows; shadowed != nil && shadowed.Kind != resolver.Builtin {
+			a.report(decl.Ident, "declaration of %s shadows declaration at line %d",
+				decl.Name, shadowed.Ident.Token.Line)
+		}
+	}
+
+	for _, inner := range s.Inner {
+		a.scope(inner)
+	}
+}
+
+// statements reports the first statement of stmts that follows a return,
+// break or continue.
+func (a *analyzer) statements(stmts []ast.Statement) {
+	for i := 0; i+1 < len(stmts); i++ {
+		switch stmts[i].(type) {
+		case *ast.ReturnStatement, *ast.BreakStatement, *ast.ContinueStatement:
+			a.report(stmts[i+1], "unreachable code")
+			return
+		}
+	}
+}
+
+func (a *analyzer) report(node ast.Node, format string, args ...interface{}) {
+	tok := ast.Pos(node)
+	a.diagnostics = append(a.diagnostics, Diagnostic{
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func ignored(name string) bool {
+	return strings.HasPrefix(name, "_")
+}
+
+// constant returns the value of exp if it is made only of literals and
+// operators, and so is the same every time it runs.
+func constant(exp ast.Expression) (object.Object, bool) {
+	if !isConstant(exp) {
+		return nil, false
+	}
+
+	value := evaluator.Eval(exp, object.NewEnvironment())
+	if _, ok := value.(*object.Error); ok {
+		return nil, false
+	}
+	return value, true
+}
+
+func isConstant(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean:
+		return true
+	case *ast.PrefixExpression:
+		return isConstant(exp.Right)
+	case *ast.InfixExpression:
+		return isConstant(exp.Left) && isConstant(exp.Right)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,65 @@
+package analysis
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; x", nil},
+		// top-level bindings are exported
+		{"let x = 1;", nil},
+		{"fn() { let x = 1; }", []string{"1:12: x declared and not used"}},
+		{"fn() { let x = 1; x = 2; }", []string{"1:12: x declared and not used"}},
+		{"fn() { let x = 1; x += 2; }", nil},
+		{"fn() { let [a, b] = [1, 2]; a }", []string{"1:16: b declared and not used"}},
+		{"fn() { let _x = 1; }", nil},
+		// parameters, loop variables and catch parameters may go unused
+		{"fn(a) { for (k, v in []) {} try { 1 } catch (e) { 2 } }", nil},
+		{"for (x in [1]) { let y = x; }", []string{"1:22: y declared and not used"}},
+		// a function may use names declared after it
+		{"fn() { let f = fn() { g() }; let g = fn() { 1 }; f() }", nil},
+		{"fn() { let f = fn(n) { f(n - 1) }; }", nil},
+
+		{"fn() { return 1; 2; 3 }", []string{"1:18: unreachable code"}},
+		{"for (x in []) { break; x }", []string{"1:24: unreachable code"}},
+		{"for (x in []) { if (x) { continue } x }", nil},
+
+		{"if (true) { 1 }", []string{"1:5: condition is always true"}},
+		{"if (1 > 2) { 1 }", []string{"1:7: condition is always false"}},
+		{`if ("") { 1 }`, []string{"1:5: condition is always true"}},
+		{"if (!x) { 1 }", nil},
+		// a condition that fails at run time is left alone
+		{"if (1 / 0) { 1 }", nil},
+
+		{"let x = 1; fn(x) { x }", []string{"1:15: declaration of x shadows declaration at line 1"}},
+		{"let x = 1;\nfn() { let x = 2; x }", []string{"2:12: declaration of x shadows declaration at line 1"}},
+		{"let x = 1; for (x in []) {}", []string{"1:17: declaration of x shadows declaration at line 1"}},
+		// redeclaring a name in the same scope doesn't shadow it
+		{"let x = 1; let x = 2;", nil},
+		{"let _ = 1; fn(_) { _ }", nil},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, p.Errors())
+		}
+
+		var got []string
+		for _, d := range Analyze(program) {
+			got = append(got, d.String())
+		}
+
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong diagnostics for %q.\nwant=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -22,6 +22,10 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+
+	// Source is the text the program was parsed from, when the parser
+	// knows it.
+	Source string
 }
 
 func (p *Program) TokenLiteral() string {
@@ -46,16 +50,28 @@ type LetStatement struct {
 	Token token.Token
 	Name  *Identifier
 	Value Expression
+
+	// Pattern is set instead of Name for destructuring bindings such as
+	// `let [a, b] = pair;`.
+	Pattern *DestructurePattern
 }
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
 
+// IsConst reports whether the statement is a `const` binding, which
+// cannot be reassigned or redeclared in the same scope.
+func (ls *LetStatement) IsConst() bool { return ls.Token.Type == token.CONST }
+
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -0,0 +1,23 @@
+package ast
+
+import (
+	"monkey/token"
+)
+
+// FieldExpression reads a field of a struct instance, as in `p.name`. An
+// Optional one, written `p?.name`, gives null when the receiver is null.
+type FieldExpression struct {
+	Token    token.Token // the '.' or '?.' token
+	Receiver Expression
+	Field    *Identifier
+	Optional bool
+}
+
+func (fe *FieldExpression) expressionNode()      {}
+func (fe *FieldExpression) TokenLiteral() string { return fe.Token.Literal }
+func (fe *FieldExpression) String() string {
+	if fe.Optional {
+		return fe.Receiver.String() + "?." + fe.Field.String()
+	}
+	return fe.Receiver.String() + "." + fe.Field.String()
+}
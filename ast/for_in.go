@@ -0,0 +1,35 @@
+package ast
+
+import (
+	"bytes"
+	"monkey/token"
+)
+
+// ForInStatement is `for (value in iterable) { ... }` or, binding the
+// index or hash key as well, `for (key, value in iterable) { ... }`.
+type ForInStatement struct {
+	Token    token.Token // the 'for' token
+	Key      *Identifier // nil unless two names are given
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForInStatement) statementNode()       {}
+func (fs *ForInStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForInStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fs.Key != nil {
+		out.WriteString(fs.Key.String())
+		out.WriteString(", ")
+	}
+	out.WriteString(fs.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
@@ -0,0 +1,442 @@
+package ast
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// Operator precedences as seen by the parser, from loosest to tightest
+// binding. They decide where Format has to put parentheses.
+const (
+	_ int = iota
+	precLowest
+	precAssign
+	precCoalesce
+	precOr
+	precAnd
+	precEquals
+	precLessGreater
+	precRange
+	precSum
+	precProduct
+	precPrefix
+	precPower
+	precCall
+	precAtom
+)
+
+var infixPrecedences = map[string]int{
+	"??": precCoalesce,
+	"||": precOr,
+	"&&": precAnd,
+	"==": precEquals,
+	"!=": precEquals,
+	"<":  precLessGreater,
+	">":  precLessGreater,
+	"<=": precLessGreater,
+	">=": precLessGreater,
+	"..": precRange,
+	"+":  precSum,
+	"-":  precSum,
+	"*":  precProduct,
+	"/":  precProduct,
+	"%":  precProduct,
+	"**": precPower,
+}
+
+// Format renders node as canonical Monkey source: one statement per
+// line, blocks indented with tabs and only the parentheses needed to
+// preserve the tree's structure. Unlike String, its output parses back
+// into an equivalent program.
+func Format(node Node) string {
+	p := &printer{}
+	p.node(node)
+	return p.out.String()
+}
+
+type printer struct {
+	out    bytes.Buffer
+	indent int
+}
+
+func (p *printer) write(s string) {
+	p.out.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.out.WriteByte('\n')
+	p.out.WriteString(strings.Repeat("\t", p.indent))
+}
+
+func (p *printer) node(node Node) {
+	switch node := node.(type) {
+	case *Program:
+		for _, s := range node.Statements {
+			p.statement(s)
+			p.write("\n")
+		}
+	case Statement:
+		p.statement(node)
+	case Expression:
+		p.expression(node, precLowest)
+	}
+}
+
+func (p *printer) statement(stmt Statement) {
+	switch stmt := stmt.(type) {
+	case *LetStatement:
+		if stmt.IsConst() {
+			p.write("const ")
+		} else {
+			p.write("let ")
+		}
+		if stmt.Pattern != nil {
+			p.write(stmt.Pattern.String())
+		} else {
+			p.write(stmt.Name.Value)
+		}
+		p.write(" = ")
+		p.expression(stmt.Value, precLowest)
+		p.write(";")
+
+	case *ReturnStatement:
+		p.write("return")
+		if stmt.ReturnValue != nil {
+			p.write(" ")
+			p.expression(stmt.ReturnValue, precLowest)
+		}
+		p.write(";")
+
+	case *ExpressionStatement:
+		p.expression(stmt.Expression, precLowest)
+		switch stmt.Expression.(type) {
+		case *IfExpression, *TryExpression, *MatchExpression:
+		default:
+			p.write(";")
+		}
+
+	case *ForInStatement:
+		p.write("for (")
+		if stmt.Key != nil {
+			p.write(stmt.Key.Value + ", ")
+		}
+		p.write(stmt.Value.Value + " in ")
+		p.expression(stmt.Iterable, precLowest)
+		p.write(") ")
+		p.block(stmt.Body)
+
+	case *BreakStatement:
+		p.write("break;")
+
+	case *ContinueStatement:
+		p.write("continue;")
+
+	case *BlockStatement:
+		p.block(stmt)
+	}
+}
+
+func (p *printer) block(block *BlockStatement) {
+	if len(block.Statements) == 0 {
+		p.write("{}")
+		return
+	}
+
+	p.write("{")
+	p.indent++
+	for _, s := range block.Statements {
+		p.newline()
+		p.statement(s)
+	}
+	p.indent--
+	p.newline()
+	p.write("}")
+}
+
+// expression prints exp, wrapping it in parentheses if it binds looser
+// than min.
+func (p *printer) expression(exp Expression, min int) {
+	if exp == nil {
+		return
+	}
+
+	if precedenceOf(exp) < min {
+		p.write("(")
+		defer p.write(")")
+	}
+
+	switch exp := exp.(type) {
+	case *Identifier:
+		p.write(exp.Value)
+
+	case *IntegerLiteral:
+		if exp.Token.Literal != "" {
+			p.write(exp.Token.Literal)
+		} else {
+			p.write(strconv.FormatInt(exp.Value, 10))
+		}
+
+	case *FloatLiteral:
+		if exp.Token.Literal != "" {
+			p.write(exp.Token.Literal)
+		} else {
+			p.write(formatFloat(exp.Value))
+		}
+
+	case *StringLiteral:
+		p.write(`"` + escape(exp.Value) + `"`)
+
+	case *TemplateLiteral:
+		p.write(`"`)
+		for _, part := range exp.Parts {
+			if text, ok := part.(*StringLiteral); ok {
+				p.write(escape(text.Value))
+				continue
+			}
+			p.write("${")
+			p.expression(part, precLowest)
+			p.write("}")
+		}
+		p.write(`"`)
+
+	case *Boolean:
+		p.write(strconv.FormatBool(exp.Value))
+
+	case *PrefixExpression:
+		p.write(exp.Operator)
+		p.expression(exp.Right, precPrefix)
+
+	case *InfixExpression:
+		prec := precedenceOf(exp)
+		left, right := prec, prec+1
+		if exp.Operator == "**" {
+			left, right = prec+1, prec
+		}
+
+		p.expression(exp.Left, left)
+		if exp.Operator == ".." {
+			p.write(exp.Operator)
+		} else {
+			p.write(" " + exp.Operator + " ")
+		}
+		if _, ok := exp.Right.(*PrefixExpression); ok {
+			// a prefix operator starts a fresh operand, so it never
+			// needs to be grouped on the right-hand side
+			right = precLowest
+		}
+		p.expression(exp.Right, right)
+
+	case *AssignExpression:
+		p.write(exp.Name.Value)
+		p.write(" = ")
+		p.expression(exp.Value, precAssign)
+
+	case *IndexAssignExpression:
+		p.expression(exp.Left, precCall)
+		p.write("[")
+		p.expression(exp.Index, precLowest)
+		p.write("] = ")
+		p.expression(exp.Value, precAssign)
+
+	case *IfExpression:
+		p.write("if (")
+		p.expression(exp.Condition, precLowest)
+		p.write(") ")
+		p.block(exp.Consequence)
+		if exp.Alternative != nil {
+			p.write(" else ")
+			p.block(exp.Alternative)
+		}
+
+	case *TryExpression:
+		p.write("try ")
+		p.block(exp.Block)
+		p.write(" catch (" + exp.Param.Value + ") ")
+		p.block(exp.Handler)
+
+	case *MatchExpression:
+		p.write("match (")
+		p.expression(exp.Subject, precLowest)
+		p.write(") {")
+		p.indent++
+		for _, arm := range exp.Arms {
+			p.newline()
+			if arm.Pattern == nil {
+				p.write("_")
+			} else {
+				p.expression(arm.Pattern, precLowest)
+			}
+			p.write(" => ")
+			p.expression(arm.Body, precLowest)
+			p.write(",")
+		}
+		p.indent--
+		p.newline()
+		p.write("}")
+
+	case *FunctionLiteral:
+		params := []string{}
+		for _, param := range exp.Parameters {
+			params = append(params, param.Value)
+		}
+		if exp.Variadic {
+			params[len(params)-1] += "..."
+		}
+		p.write("fn(")
+		p.write(strings.Join(params, ", "))
+		p.write(") ")
+		p.block(exp.Body)
+
+	case *CallExpression:
+		p.expression(exp.Function, precCall)
+		p.write("(")
+		p.expressionList(exp.Arguments)
+		p.write(")")
+
+	case *MethodCallExpression:
+		p.expression(exp.Receiver, precCall)
+		if exp.Optional {
+			p.write("?.")
+		} else {
+			p.write(".")
+		}
+		p.write(exp.Method.Value)
+		p.write("(")
+		p.expressionList(exp.Arguments)
+		p.write(")")
+
+	case *FieldExpression:
+		p.expression(exp.Receiver, precCall)
+		if exp.Optional {
+			p.write("?.")
+		} else {
+			p.write(".")
+		}
+		p.write(exp.Field.Value)
+
+	case *StructLiteral:
+		fields := []string{}
+		for _, f := range exp.Fields {
+			fields = append(fields, f.Value)
+		}
+		p.write("struct {")
+		p.write(strings.Join(fields, ", "))
+		p.write("}")
+
+	case *SpreadExpression:
+		p.expression(exp.Value, precLowest)
+		p.write("...")
+
+	case *SpawnExpression:
+		p.write("spawn ")
+		p.expression(exp.Function, precPrefix)
+
+	case *ImportExpression:
+		p.write("import(")
+		p.expression(exp.Path, precLowest)
+		p.write(")")
+
+	case *ArrayLiteral:
+		p.write("[")
+		p.expressionList(exp.Elements)
+		p.write("]")
+
+	case *IndexExpression:
+		p.expression(exp.Left, precCall)
+		p.write("[")
+		p.expression(exp.Index, precLowest)
+		p.write("]")
+
+	case *SliceExpression:
+		p.expression(exp.Left, precCall)
+		p.write("[")
+		if exp.Start != nil {
+			p.expression(exp.Start, precLowest)
+		}
+		p.write(":")
+		if exp.End != nil {
+			p.expression(exp.End, precLowest)
+		}
+		p.write("]")
+
+	case *HashLiteral:
+		p.write("{")
+		for i, pair := range exp.Pairs {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(pair.Key, precLowest)
+			p.write(": ")
+			p.expression(pair.Value, precLowest)
+		}
+		p.write("}")
+
+	default:
+		p.write(exp.String())
+	}
+}
+
+func (p *printer) expressionList(exps []Expression) {
+	for i, e := range exps {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.expression(e, precLowest)
+	}
+}
+
+func precedenceOf(exp Expression) int {
+	switch exp := exp.(type) {
+	case *AssignExpression, *IndexAssignExpression:
+		return precAssign
+	case *InfixExpression:
+		if prec, ok := infixPrecedences[exp.Operator]; ok {
+			return prec
+		}
+		return precLowest
+	case *PrefixExpression, *SpawnExpression:
+		return precPrefix
+	case *CallExpression, *IndexExpression, *SliceExpression, *MethodCallExpression,
+		*FieldExpression:
+		return precCall
+	}
+	return precAtom
+}
+
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// escape prepares s for use inside a string literal, using only the
+// escapes the lexer understands.
+func escape(s string) string {
+	var out bytes.Buffer
+
+	for i, r := range s {
+		switch r {
+		case '$':
+			if strings.HasPrefix(s[i:], "${") {
+				out.WriteString(`\$`)
+			} else {
+				out.WriteRune(r)
+			}
+		case '"':
+			out.WriteString(`\"`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		default:
+			out.WriteRune(r)
+		}
+	}
+
+	return out.String()
+}
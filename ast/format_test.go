@@ -0,0 +1,80 @@
+package ast_test
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let   x=1+2*3", "let x = 1 + 2 * 3;\n"},
+		{"(1 + 2) * 3;", "(1 + 2) * 3;\n"},
+		{"1 - (2 - 3); (1 - 2) - 3", "1 - (2 - 3);\n1 - 2 - 3;\n"},
+		{"2 ** 3 ** 2; (2 ** 3) ** 2", "2 ** 3 ** 2;\n(2 ** 3) ** 2;\n"},
+		{"-2 ** 2; (-2) ** 2; 2 ** -1", "-2 ** 2;\n(-2) ** 2;\n2 ** -1;\n"},
+		{"-(a + b); !(-a)", "-(a + b);\n!-a;\n"},
+		{"a && (b || c); a || b && c", "a && (b || c);\na || b && c;\n"},
+		{"x = y = 1 + 2", "x = y = 1 + 2;\n"},
+		{"xs[ 0 ]=h[\"k\"]=1; m[i][j]+=1", "xs[0] = h[\"k\"] = 1;\nm[i][j] = m[i][j] + 1;\n"},
+		{"(a??b)||c; a??b||c; h[k] ?. trim()??\"\"", "(a ?? b) || c;\na ?? b || c;\nh[k]?.trim() ?? \"\";\n"},
+		{"let t=spawn fn(){send(ch,1)}; spawn (f)(x)", "let t = spawn fn() {\n\tsend(ch, 1);\n};\nspawn f(x);\n"},
+		{"let P=struct{ x,y, }; P(1,2) . x; p?.y", "let P = struct {x, y};\nP(1, 2).x;\np?.y;\n"},
+		{"x*=2+1; a+=b-=1", "x = x * (2 + 1);\na = a + (b = b - 1);\n"},
+		{"(a + b)(c)[0]", "(a + b)(c)[0];\n"},
+		{`"a\"b\n"`, "\"a\\\"b\\n\";\n"},
+		{`[1, 2.5, true, {"k": [1]}]`, "[1, 2.5, true, {\"k\": [1]}];\n"},
+		{"return; return x", "return;\nreturn x;\n"},
+		{
+			"let f = fn(a, b) { if (a > b) { a } else { b } };",
+			"let f = fn(a, b) {\n\tif (a > b) {\n\t\ta;\n\t} else {\n\t\tb;\n\t}\n};\n",
+		},
+		{"fn() {}", "fn() {};\n"},
+		{"const  k=1", "const k = 1;\n"},
+		{"for(k,v in h){k}", "for (k, v in h) {\n\tk;\n}\n"},
+		{"for(x in h){break continue}", "for (x in h) {\n\tbreak;\n\tcontinue;\n}\n"},
+		{`"a${ x+1 }\${b}"`, "\"a${x + 1}\\${b}\";\n"},
+		{`"\${b}"`, "\"\\${b}\";\n"},
+		{"if (x) { 1 }", "if (x) {\n\t1;\n}\n"},
+		{`let m=import( "m.monkey" )`, "let m = import(\"m.monkey\");\n"},
+		{"try{f()}catch(e){e}", "try {\n\tf();\n} catch (e) {\n\te;\n}\n"},
+		{"let [a,b]=xs", "let [a, b] = xs;\n"},
+		{"(a+b).len(); xs . map(f,)", "(a + b).len();\nxs.map(f);\n"},
+		{"fn(a,rest...){f(a+1,rest...)}", "fn(a, rest...) {\n\tf(a + 1, rest...);\n};\n"},
+		{"const {name,age,}=p", "const {name, age} = p;\n"},
+		{"for(i in 0 .. n-1){xs[i : ]}", "for (i in 0..n - 1) {\n\txs[i:];\n}\n"},
+		{"(0..3)[1]; s[:2]", "(0..3)[1];\ns[:2];\n"},
+		{"match(x){1=>\"a\",_=>x+1}", "match (x) {\n\t1 => \"a\",\n\t_ => x + 1,\n}\n"},
+	}
+
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+
+		formatted := ast.Format(program)
+		if formatted != tt.expected {
+			t.Errorf("Format(%q) wrong.\nwant=%q\ngot=%q", tt.input, tt.expected, formatted)
+			continue
+		}
+
+		reparsed := parseProgram(t, formatted)
+		if reparsed.String() != program.String() {
+			t.Errorf("formatted output parses differently.\nwant=%q\ngot=%q",
+				program.String(), reparsed.String())
+		}
+	}
+}
+
+func parseProgram(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
@@ -0,0 +1,16 @@
+package ast
+
+import "monkey/token"
+
+// ImportExpression is `import(path)`, which evaluates to the module
+// loaded from path.
+type ImportExpression struct {
+	Token token.Token // the 'import' token
+	Path  Expression
+}
+
+func (ie *ImportExpression) expressionNode()      {}
+func (ie *ImportExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *ImportExpression) String() string {
+	return "import(" + ie.Path.String() + ")"
+}
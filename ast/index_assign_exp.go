@@ -0,0 +1,31 @@
+package ast
+
+import (
+	"bytes"
+	"monkey/token"
+)
+
+// IndexAssignExpression is `left[index] = value`, which stores value in
+// the array or hash left evaluates to.
+type IndexAssignExpression struct {
+	Token token.Token // the '=' token
+	Left  Expression
+	Index Expression
+	Value Expression
+}
+
+func (ia *IndexAssignExpression) expressionNode()      {}
+func (ia *IndexAssignExpression) TokenLiteral() string { return ia.Token.Literal }
+func (ia *IndexAssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ia.Left.String())
+	out.WriteString("[")
+	out.WriteString(ia.Index.String())
+	out.WriteString("] = ")
+	out.WriteString(ia.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
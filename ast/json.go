@@ -0,0 +1,645 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"monkey/token"
+	"reflect"
+)
+
+// ToJSON serializes node and all of its children. Every node is encoded as
+// an object with a "node" field naming its Go type and a "token" field
+// holding the token it was parsed from, including its source position.
+func ToJSON(node Node) ([]byte, error) {
+	v, err := toJSONValue(node)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// FromJSON rebuilds an AST from the output of ToJSON.
+func FromJSON(data []byte) (Node, error) {
+	return nodeFromJSON(json.RawMessage(data))
+}
+
+type jsonToken struct {
+	Type    token.TokenType `json:"type"`
+	Literal string          `json:"literal"`
+	Line    int             `json:"line"`
+	Column  int             `json:"column"`
+}
+
+type jsonObject map[string]interface{}
+
+func newJSONObject(kind string, tok token.Token) jsonObject {
+	return jsonObject{
+		"node": kind,
+		"token": jsonToken{
+			Type:    tok.Type,
+			Literal: tok.Literal,
+			Line:    tok.Line,
+			Column:  tok.Column,
+		},
+	}
+}
+
+func toJSONValue(node Node) (interface{}, error) {
+	e := &encoder{}
+	v := e.node(node)
+	if e.err != nil {
+		return nil, e.err
+	}
+	return v, nil
+}
+
+// encoder converts nodes into plain JSON values, remembering the first
+// error so that the cases below can stay declarative.
+type encoder struct {
+	err error
+}
+
+func (e *encoder) node(node Node) interface{} {
+	if e.err != nil || isNilNode(node) {
+		return nil
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		return jsonObject{"node": "Program", "statements": e.statements(node.Statements)}
+
+	case *LetStatement:
+		obj := newJSONObject("LetStatement", node.Token)
+		obj["name"] = e.node(node.Name)
+		if node.Pattern != nil {
+			obj["pattern"] = e.node(node.Pattern)
+		}
+		obj["value"] = e.node(node.Value)
+		return obj
+
+	case *DestructurePattern:
+		names := []interface{}{}
+		for _, n := range node.Names {
+			names = append(names, e.node(n))
+		}
+		obj := newJSONObject("DestructurePattern", node.Token)
+		obj["names"] = names
+		return obj
+
+	case *ReturnStatement:
+		obj := newJSONObject("ReturnStatement", node.Token)
+		obj["returnValue"] = e.node(node.ReturnValue)
+		return obj
+
+	case *ExpressionStatement:
+		obj := newJSONObject("ExpressionStatement", node.Token)
+		obj["expression"] = e.node(node.Expression)
+		return obj
+
+	case *ForInStatement:
+		obj := newJSONObject("ForInStatement", node.Token)
+		obj["key"] = e.node(node.Key)
+		obj["value"] = e.node(node.Value)
+		obj["iterable"] = e.node(node.Iterable)
+		obj["body"] = e.node(node.Body)
+		return obj
+
+	case *BreakStatement:
+		return newJSONObject("BreakStatement", node.Token)
+
+	case *ContinueStatement:
+		return newJSONObject("ContinueStatement", node.Token)
+
+	case *BlockStatement:
+		obj := newJSONObject("BlockStatement", node.Token)
+		obj["statements"] = e.statements(node.Statements)
+		return obj
+
+	case *Identifier:
+		obj := newJSONObject("Identifier", node.Token)
+		obj["value"] = node.Value
+		return obj
+
+	case *IntegerLiteral:
+		obj := newJSONObject("IntegerLiteral", node.Token)
+		obj["value"] = node.Value
+		return obj
+
+	case *FloatLiteral:
+		obj := newJSONObject("FloatLiteral", node.Token)
+		obj["value"] = node.Value
+		return obj
+
+	case *StringLiteral:
+		obj := newJSONObject("StringLiteral", node.Token)
+		obj["value"] = node.Value
+		return obj
+
+	case *TemplateLiteral:
+		obj := newJSONObject("TemplateLiteral", node.Token)
+		obj["parts"] = e.expressions(node.Parts)
+		return obj
+
+	case *Boolean:
+		obj := newJSONObject("Boolean", node.Token)
+		obj["value"] = node.Value
+		return obj
+
+	case *PrefixExpression:
+		obj := newJSONObject("PrefixExpression", node.Token)
+		obj["operator"] = node.Operator
+		obj["right"] = e.node(node.Right)
+		return obj
+
+	case *InfixExpression:
+		obj := newJSONObject("InfixExpression", node.Token)
+		obj["operator"] = node.Operator
+		obj["left"] = e.node(node.Left)
+		obj["right"] = e.node(node.Right)
+		return obj
+
+	case *AssignExpression:
+		obj := newJSONObject("AssignExpression", node.Token)
+		obj["name"] = e.node(node.Name)
+		obj["value"] = e.node(node.Value)
+		return obj
+
+	case *IndexAssignExpression:
+		obj := newJSONObject("IndexAssignExpression", node.Token)
+		obj["left"] = e.node(node.Left)
+		obj["index"] = e.node(node.Index)
+		obj["value"] = e.node(node.Value)
+		return obj
+
+	case *IfExpression:
+		obj := newJSONObject("IfExpression", node.Token)
+		obj["condition"] = e.node(node.Condition)
+		obj["consequence"] = e.node(node.Consequence)
+		obj["alternative"] = e.node(node.Alternative)
+		return obj
+
+	case *TryExpression:
+		obj := newJSONObject("TryExpression", node.Token)
+		obj["block"] = e.node(node.Block)
+		obj["param"] = e.node(node.Param)
+		obj["handler"] = e.node(node.Handler)
+		return obj
+
+	case *MatchExpression:
+		arms := []interface{}{}
+		for _, arm := range node.Arms {
+			arms = append(arms, jsonObject{"pattern": e.node(arm.Pattern), "body": e.node(arm.Body)})
+		}
+		obj := newJSONObject("MatchExpression", node.Token)
+		obj["subject"] = e.node(node.Subject)
+		obj["arms"] = arms
+		return obj
+
+	case *FunctionLiteral:
+		params := []interface{}{}
+		for _, p := range node.Parameters {
+			params = append(params, e.node(p))
+		}
+		obj := newJSONObject("FunctionLiteral", node.Token)
+		obj["parameters"] = params
+		if node.Variadic {
+			obj["variadic"] = true
+		}
+		obj["body"] = e.node(node.Body)
+		return obj
+
+	case *CallExpression:
+		obj := newJSONObject("CallExpression", node.Token)
+		obj["function"] = e.node(node.Function)
+		obj["arguments"] = e.expressions(node.Arguments)
+		return obj
+
+	case *MethodCallExpression:
+		obj := newJSONObject("MethodCallExpression", node.Token)
+		obj["receiver"] = e.node(node.Receiver)
+		obj["method"] = e.node(node.Method)
+		obj["arguments"] = e.expressions(node.Arguments)
+		if node.Optional {
+			obj["optional"] = true
+		}
+		return obj
+
+	case *SpreadExpression:
+		obj := newJSONObject("SpreadExpression", node.Token)
+		obj["value"] = e.node(node.Value)
+		return obj
+
+	case *SpawnExpression:
+		obj := newJSONObject("SpawnExpression", node.Token)
+		obj["function"] = e.node(node.Function)
+		return obj
+
+	case *StructLiteral:
+		obj := newJSONObject("StructLiteral", node.Token)
+		fields := []interface{}{}
+		for _, f := range node.Fields {
+			fields = append(fields, e.node(f))
+		}
+		obj["fields"] = fields
+		return obj
+
+	case *FieldExpression:
+		obj := newJSONObject("FieldExpression", node.Token)
+		obj["receiver"] = e.node(node.Receiver)
+		obj["field"] = e.node(node.Field)
+		if node.Optional {
+			obj["optional"] = true
+		}
+		return obj
+
+	case *ImportExpression:
+		obj := newJSONObject("ImportExpression", node.Token)
+		obj["path"] = e.node(node.Path)
+		return obj
+
+	case *ArrayLiteral:
+		obj := newJSONObject("ArrayLiteral", node.Token)
+		obj["elements"] = e.expressions(node.Elements)
+		return obj
+
+	case *IndexExpression:
+		obj := newJSONObject("IndexExpression", node.Token)
+		obj["left"] = e.node(node.Left)
+		obj["index"] = e.node(node.Index)
+		return obj
+
+	case *SliceExpression:
+		obj := newJSONObject("SliceExpression", node.Token)
+		obj["left"] = e.node(node.Left)
+		obj["start"] = e.node(node.Start)
+		obj["end"] = e.node(node.End)
+		return obj
+
+	case *HashLiteral:
+		pairs := []interface{}{}
+		for _, pair := range node.Pairs {
+			pairs = append(pairs, jsonObject{"key": e.node(pair.Key), "value": e.node(pair.Value)})
+		}
+		obj := newJSONObject("HashLiteral", node.Token)
+		obj["pairs"] = pairs
+		return obj
+	}
+
+	e.err = fmt.Errorf("cannot serialize node of type %T", node)
+	return nil
+}
+
+func (e *encoder) statements(stmts []Statement) []interface{} {
+	out := []interface{}{}
+	for _, s := range stmts {
+		out = append(out, e.node(s))
+	}
+	return out
+}
+
+func (e *encoder) expressions(exps []Expression) []interface{} {
+	out := []interface{}{}
+	for _, exp := range exps {
+		out = append(out, e.node(exp))
+	}
+	return out
+}
+
+// isNilNode reports whether node is nil or a typed nil pointer, which the
+// parser leaves behind for optional parts such as a missing else branch.
+func isNilNode(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+type jsonFields map[string]json.RawMessage
+
+func nodeFromJSON(data json.RawMessage) (Node, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+
+	var fields jsonFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	var kind string
+	if err := json.Unmarshal(fields["node"], &kind); err != nil {
+		return nil, fmt.Errorf("missing node type: %w", err)
+	}
+
+	var tok token.Token
+	if raw, ok := fields["token"]; ok {
+		var jt jsonToken
+		if err := json.Unmarshal(raw, &jt); err != nil {
+			return nil, err
+		}
+		tok = token.Token{Type: jt.Type, Literal: jt.Literal, Line: jt.Line, Column: jt.Column}
+	}
+
+	d := &decoder{fields: fields}
+
+	var node Node
+
+	switch kind {
+	case "Program":
+		node = &Program{Statements: d.statements("statements")}
+	case "LetStatement":
+		node = &LetStatement{
+			Token:   tok,
+			Name:    d.identifier("name"),
+			Pattern: d.pattern("pattern"),
+			Value:   d.expression("value"),
+		}
+	case "DestructurePattern":
+		node = &DestructurePattern{Token: tok, Names: d.identifiers("names")}
+	case "ReturnStatement":
+		node = &ReturnStatement{Token: tok, ReturnValue: d.expression("returnValue")}
+	case "ExpressionStatement":
+		node = &ExpressionStatement{Token: tok, Expression: d.expression("expression")}
+	case "ForInStatement":
+		node = &ForInStatement{
+			Token:    tok,
+			Key:      d.identifier("key"),
+			Value:    d.identifier("value"),
+			Iterable: d.expression("iterable"),
+			Body:     d.block("body"),
+		}
+	case "BreakStatement":
+		node = &BreakStatement{Token: tok}
+	case "ContinueStatement":
+		node = &ContinueStatement{Token: tok}
+	case "BlockStatement":
+		node = &BlockStatement{Token: tok, Statements: d.statements("statements")}
+	case "Identifier":
+		ident := &Identifier{Token: tok}
+		d.value("value", &ident.Value)
+		node = ident
+	case "IntegerLiteral":
+		lit := &IntegerLiteral{Token: tok}
+		d.value("value", &lit.Value)
+		node = lit
+	case "FloatLiteral":
+		lit := &FloatLiteral{Token: tok}
+		d.value("value", &lit.Value)
+		node = lit
+	case "StringLiteral":
+		lit := &StringLiteral{Token: tok}
+		d.value("value", &lit.Value)
+		node = lit
+	case "TemplateLiteral":
+		node = &TemplateLiteral{Token: tok, Parts: d.expressions("parts")}
+	case "Boolean":
+		b := &Boolean{Token: tok}
+		d.value("value", &b.Value)
+		node = b
+	case "PrefixExpression":
+		exp := &PrefixExpression{Token: tok, Right: d.expression("right")}
+		d.value("operator", &exp.Operator)
+		node = exp
+	case "InfixExpression":
+		exp := &InfixExpression{Token: tok, Left: d.expression("left"), Right: d.expression("right")}
+		d.value("operator", &exp.Operator)
+		node = exp
+	case "AssignExpression":
+		node = &AssignExpression{Token: tok, Name: d.identifier("name"), Value: d.expression("value")}
+	case "IndexAssignExpression":
+		node = &IndexAssignExpression{Token: tok, Left: d.expression("left"), Index: d.expression("index"), Value: d.expression("value")}
+	case "IfExpression":
+		node = &IfExpression{
+			Token:       tok,
+			Condition:   d.expression("condition"),
+			Consequence: d.block("consequence"),
+			Alternative: d.block("alternative"),
+		}
+	case "TryExpression":
+		node = &TryExpression{
+			Token:   tok,
+			Block:   d.block("block"),
+			Param:   d.identifier("param"),
+			Handler: d.block("handler"),
+		}
+	case "MatchExpression":
+		node = &MatchExpression{Token: tok, Subject: d.expression("subject"), Arms: d.matchArms("arms")}
+	case "FunctionLiteral":
+		fn := &FunctionLiteral{Token: tok, Parameters: d.identifiers("parameters"), Body: d.block("body")}
+		d.value("variadic", &fn.Variadic)
+		node = fn
+	case "MethodCallExpression":
+		mc := &MethodCallExpression{
+			Token:     tok,
+			Receiver:  d.expression("receiver"),
+			Method:    d.identifier("method"),
+			Arguments: d.expressions("arguments"),
+		}
+		d.value("optional", &mc.Optional)
+		node = mc
+	case "SpreadExpression":
+		node = &SpreadExpression{Token: tok, Value: d.expression("value")}
+	case "SpawnExpression":
+		node = &SpawnExpression{Token: tok, Function: d.expression("function")}
+	case "StructLiteral":
+		node = &StructLiteral{Token: tok, Fields: d.identifiers("fields")}
+	case "FieldExpression":
+		fe := &FieldExpression{Token: tok, Receiver: d.expression("receiver"), Field: d.identifier("field")}
+		d.value("optional", &fe.Optional)
+		node = fe
+	case "ImportExpression":
+		node = &ImportExpression{Token: tok, Path: d.expression("path")}
+	case "CallExpression":
+		node = &CallExpression{Token: tok, Function: d.expression("function"), Arguments: d.expressions("arguments")}
+	case "ArrayLiteral":
+		node = &ArrayLiteral{Token: tok, Elements: d.expressions("elements")}
+	case "IndexExpression":
+		node = &IndexExpression{Token: tok, Left: d.expression("left"), Index: d.expression("index")}
+	case "SliceExpression":
+		node = &SliceExpression{Token: tok, Left: d.expression("left"), Start: d.expression("start"), End: d.expression("end")}
+	case "HashLiteral":
+		node = &HashLiteral{Token: tok, Pairs: d.hashPairs("pairs")}
+	default:
+		return nil, fmt.Errorf("unknown node type %q", kind)
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return node, nil
+}
+
+// decoder reads the fields of a single JSON node, remembering the first
+// error so that node construction above can stay declarative.
+type decoder struct {
+	fields jsonFields
+	err    error
+}
+
+func (d *decoder) value(key string, v interface{}) {
+	raw, ok := d.fields[key]
+	if !ok || d.err != nil {
+		return
+	}
+	d.err = json.Unmarshal(raw, v)
+}
+
+func (d *decoder) node(raw json.RawMessage) Node {
+	if d.err != nil {
+		return nil
+	}
+	node, err := nodeFromJSON(raw)
+	if err != nil {
+		d.err = err
+	}
+	return node
+}
+
+func (d *decoder) list(key string) []json.RawMessage {
+	var raws []json.RawMessage
+	d.value(key, &raws)
+	return raws
+}
+
+func (d *decoder) expression(key string) Expression {
+	node := d.node(d.fields[key])
+	if node == nil {
+		return nil
+	}
+
+	exp, ok := node.(Expression)
+	if !ok && d.err == nil {
+		d.err = fmt.Errorf("field %q: %T is not an expression", key, node)
+	}
+	return exp
+}
+
+func (d *decoder) identifier(key string) *Identifier {
+	exp := d.expression(key)
+	if exp == nil {
+		return nil
+	}
+
+	ident, ok := exp.(*Identifier)
+	if !ok && d.err == nil {
+		d.err = fmt.Errorf("field %q: %T is not an identifier", key, exp)
+	}
+	return ident
+}
+
+func (d *decoder) pattern(key string) *DestructurePattern {
+	node := d.node(d.fields[key])
+	if node == nil {
+		return nil
+	}
+
+	pattern, ok := node.(*DestructurePattern)
+	if !ok && d.err == nil {
+		d.err = fmt.Errorf("field %q: %T is not a destructure pattern", key, node)
+	}
+	return pattern
+}
+
+func (d *decoder) block(key string) *BlockStatement {
+	node := d.node(d.fields[key])
+	if node == nil {
+		return nil
+	}
+
+	block, ok := node.(*BlockStatement)
+	if !ok && d.err == nil {
+		d.err = fmt.Errorf("field %q: %T is not a block statement", key, node)
+	}
+	return block
+}
+
+func (d *decoder) statements(key string) []Statement {
+	stmts := []Statement{}
+	for _, raw := range d.list(key) {
+		node := d.node(raw)
+		stmt, ok := node.(Statement)
+		if !ok {
+			if d.err == nil {
+				d.err = fmt.Errorf("field %q: %T is not a statement", key, node)
+			}
+			return nil
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts
+}
+
+func (d *decoder) expressions(key string) []Expression {
+	exps := []Expression{}
+	for _, raw := range d.list(key) {
+		node := d.node(raw)
+		exp, ok := node.(Expression)
+		if !ok {
+			if d.err == nil {
+				d.err = fmt.Errorf("field %q: %T is not an expression", key, node)
+			}
+			return nil
+		}
+		exps = append(exps, exp)
+	}
+	return exps
+}
+
+func (d *decoder) identifiers(key string) []*Identifier {
+	idents := []*Identifier{}
+	for _, exp := range d.expressions(key) {
+		ident, ok := exp.(*Identifier)
+		if !ok {
+			if d.err == nil {
+				d.err = fmt.Errorf("field %q: %T is not an identifier", key, exp)
+			}
+			return nil
+		}
+		idents = append(idents, ident)
+	}
+	return idents
+}
+
+func (d *decoder) hashPairs(key string) []HashPair {
+	pairs := []HashPair{}
+	for _, raw := range d.list(key) {
+		sub := &decoder{}
+		if d.err == nil {
+			d.err = json.Unmarshal(raw, &sub.fields)
+		}
+		if d.err != nil {
+			return nil
+		}
+
+		pair := HashPair{Key: sub.expression("key"), Value: sub.expression("value")}
+		if sub.err != nil {
+			d.err = sub.err
+			return nil
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs
+}
+
+func (d *decoder) matchArms(key string) []MatchArm {
+	arms := []MatchArm{}
+	for _, raw := range d.list(key) {
+		sub := &decoder{}
+		if d.err == nil {
+			d.err = json.Unmarshal(raw, &sub.fields)
+		}
+		if d.err != nil {
+			return nil
+		}
+
+		arm := MatchArm{Pattern: sub.expression("pattern"), Body: sub.expression("body")}
+		if sub.err != nil {
+			d.err = sub.err
+			return nil
+		}
+		arms = append(arms, arm)
+	}
+	return arms
+}
@@ -0,0 +1,98 @@
+package ast_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	input := `
+let add = fn(a, b) { a + b };
+let x = if (add(1, 2.5) >= 3) { [1, "two", !true] } else { {"a": -1}[0] };
+x = x && y || z;
+"sum: ${add(x, 1)}";
+let m = import("lib/" + "m.monkey");
+let r = try { m["run"]() } catch (e) { e };
+let s = match (r) { 1 => "one", _ => "other" };
+let [a, b] = [1, 2];
+let {name} = {"name": a};
+let all = fn(first, rest...) { add(first, rest...) };
+"a".upper().split("", rest...);
+for (i in 0..3) { x[1:i]; x[:]; x[i] += 1 };
+x?.trim() ?? "";
+recv(spawn fn() { send(ch, 1) });
+let P = struct { x, y }; P(1, 2).x + p?.y;
+return;
+`
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	data, err := ast.ToJSON(program)
+	if err != nil {
+		t.Fatalf("ToJSON failed: %s", err)
+	}
+
+	node, err := ast.FromJSON(data)
+	if err != nil {
+		t.Fatalf("FromJSON failed: %s", err)
+	}
+
+	decoded, ok := node.(*ast.Program)
+	if !ok {
+		t.Fatalf("node is not *ast.Program. got=%T", node)
+	}
+
+	if decoded.String() != program.String() {
+		t.Errorf("round trip changed program.\nwant=%q\ngot=%q", program.String(), decoded.String())
+	}
+
+	again, err := ast.ToJSON(decoded)
+	if err != nil {
+		t.Fatalf("ToJSON failed on decoded program: %s", err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Errorf("JSON not stable across round trip.\nwant=%s\ngot=%s", data, again)
+	}
+}
+
+func TestJSONPositions(t *testing.T) {
+	p := parser.New(lexer.New("let x = 5;\n  y;"))
+	program := p.ParseProgram()
+
+	data, err := ast.ToJSON(program.Statements[1])
+	if err != nil {
+		t.Fatalf("ToJSON failed: %s", err)
+	}
+
+	var stmt struct {
+		Node  string `json:"node"`
+		Token struct {
+			Line   int `json:"line"`
+			Column int `json:"column"`
+		} `json:"token"`
+	}
+	if err := json.Unmarshal(data, &stmt); err != nil {
+		t.Fatalf("invalid JSON: %s", err)
+	}
+
+	if stmt.Node != "ExpressionStatement" {
+		t.Errorf("node tag wrong. want=%q, got=%q", "ExpressionStatement", stmt.Node)
+	}
+	if stmt.Token.Line != 2 || stmt.Token.Column != 3 {
+		t.Errorf("position wrong. want=2:3, got=%d:%d", stmt.Token.Line, stmt.Token.Column)
+	}
+}
+
+func TestFromJSONUnknownNode(t *testing.T) {
+	_, err := ast.FromJSON([]byte(`{"node": "WhileLoop"}`))
+	if err == nil {
+		t.Fatalf("expected error for unknown node type")
+	}
+}
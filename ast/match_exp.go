@@ -0,0 +1,45 @@
+package ast
+
+import (
+	"bytes"
+	"monkey/token"
+	"strings"
+)
+
+// MatchArm is a single arm of a match expression. A nil Pattern is the `_`
+// wildcard, which matches any value.
+type MatchArm struct {
+	Pattern Expression
+	Body    Expression
+}
+
+// MatchExpression evaluates to the Body of the first arm whose Pattern is
+// equal to Subject, or to null if no arm matches.
+type MatchExpression struct {
+	Token   token.Token // the 'match' token
+	Subject Expression
+	Arms    []MatchArm // in source order
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := []string{}
+	for _, arm := range me.Arms {
+		pattern := "_"
+		if arm.Pattern != nil {
+			pattern = arm.Pattern.String()
+		}
+		arms = append(arms, pattern+" => "+arm.Body.String())
+	}
+
+	out.WriteString("match (")
+	out.WriteString(me.Subject.String())
+	out.WriteString(") { ")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString(" }")
+
+	return out.String()
+}
@@ -0,0 +1,43 @@
+package ast
+
+import (
+	"bytes"
+	"monkey/token"
+	"strings"
+)
+
+// MethodCallExpression is a call such as `"hello".upper()`, which calls the
+// builtin named Method with Receiver as its first argument. An Optional
+// call, written `x?.upper()`, gives null without calling anything or
+// evaluating the arguments when the receiver is null.
+type MethodCallExpression struct {
+	Token     token.Token // the '.' or '?.' token
+	Receiver  Expression
+	Method    *Identifier
+	Arguments []Expression
+	Optional  bool
+}
+
+func (mc *MethodCallExpression) expressionNode()      {}
+func (mc *MethodCallExpression) TokenLiteral() string { return mc.Token.Literal }
+func (mc *MethodCallExpression) String() string {
+	var out bytes.Buffer
+
+	args := []string{}
+	for _, a := range mc.Arguments {
+		args = append(args, a.String())
+	}
+
+	out.WriteString(mc.Receiver.String())
+	if mc.Optional {
+		out.WriteString("?.")
+	} else {
+		out.WriteString(".")
+	}
+	out.WriteString(mc.Method.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+
+	return out.String()
+}
@@ -0,0 +1,41 @@
+package ast
+
+import (
+	"bytes"
+	"monkey/token"
+	"strings"
+)
+
+// DestructurePattern is the left side of a destructuring let statement.
+// `let [a, b] = ...` binds the elements of an array by position and
+// `let {name, age} = ...` binds the values of a hash by their string keys.
+type DestructurePattern struct {
+	Token token.Token // the '[' or '{' token
+	Names []*Identifier
+}
+
+func (dp *DestructurePattern) TokenLiteral() string { return dp.Token.Literal }
+
+// IsHash reports whether the pattern unpacks a hash rather than an array.
+func (dp *DestructurePattern) IsHash() bool { return dp.Token.Type == token.LBRACE }
+
+func (dp *DestructurePattern) String() string {
+	var out bytes.Buffer
+
+	names := []string{}
+	for _, n := range dp.Names {
+		names = append(names, n.String())
+	}
+
+	if dp.IsHash() {
+		out.WriteString("{")
+		out.WriteString(strings.Join(names, ", "))
+		out.WriteString("}")
+	} else {
+		out.WriteString("[")
+		out.WriteString(strings.Join(names, ", "))
+		out.WriteString("]")
+	}
+
+	return out.String()
+}
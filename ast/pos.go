@@ -0,0 +1,118 @@
+package ast
+
+import "monkey/token"
+
+// Pos returns the token that positions node in its source: the keyword
+// of a statement or of an expression like if, the operator of prefix and
+// infix expressions, the opening bracket of literals and calls, and the
+// first token of a program. It returns the zero token for a nil node or an
+// empty program.
+func Pos(node Node) token.Token {
+	if tok := tokenOf(node); tok != nil {
+		return *tok
+	}
+	return token.Token{}
+}
+
+// tokenOf returns a pointer to the token Pos reports for node, or nil if
+// there is none.
+func tokenOf(node Node) *token.Token {
+	switch node := node.(type) {
+	case *Program:
+		if len(node.Statements) > 0 {
+			return tokenOf(node.Statements[0])
+		}
+	case *LetStatement:
+		return &node.Token
+	case *DestructurePattern:
+		return &node.Token
+	case *ReturnStatement:
+		return &node.Token
+	case *ExpressionStatement:
+		return &node.Token
+	case *ForInStatement:
+		return &node.Token
+	case *BreakStatement:
+		return &node.Token
+	case *ContinueStatement:
+		return &node.Token
+	case *BlockStatement:
+		return &node.Token
+	case *Identifier:
+		return &node.Token
+	case *IntegerLiteral:
+		return &node.Token
+	case *FloatLiteral:
+		return &node.Token
+	case *StringLiteral:
+		return &node.Token
+	case *TemplateLiteral:
+		return &node.Token
+	case *Boolean:
+		return &node.Token
+	case *PrefixExpression:
+		return &node.Token
+	case *InfixExpression:
+		return &node.Token
+	case *AssignExpression:
+		return &node.Token
+	case *IndexAssignExpression:
+		return &node.Token
+	case *IfExpression:
+		return &node.Token
+	case *MatchExpression:
+		return &node.Token
+	case *TryExpression:
+		return &node.Token
+	case *FunctionLiteral:
+		return &node.Token
+	case *CallExpression:
+		return &node.Token
+	case *MethodCallExpression:
+		return &node.Token
+	case *SpreadExpression:
+		return &node.Token
+	case *SpawnExpression:
+		return &node.Token
+	case *StructLiteral:
+		return &node.Token
+	case *FieldExpression:
+		return &node.Token
+	case *ImportExpression:
+		return &node.Token
+	case *ArrayLiteral:
+		return &node.Token
+	case *IndexExpression:
+		return &node.Token
+	case *SliceExpression:
+		return &node.Token
+	case *HashLiteral:
+		return &node.Token
+	}
+	return nil
+}
+
+// Shift moves the tokens of node and of everything inside it, as after
+// an edit of the source that precedes them: tokens on the given line
+// move right by columns columns, then all of them move down by lines
+// lines. Either count may be negative.
+func Shift(node Node, line, lines, columns int) {
+	Walk(shifter{line, lines, columns}, node)
+}
+
+type shifter struct {
+	line, lines, columns int
+}
+
+func (s shifter) Visit(node Node) Visitor {
+	if _, ok := node.(*Program); ok {
+		return s
+	}
+	if tok := tokenOf(node); tok != nil {
+		if tok.Line == s.line {
+			tok.Column += s.columns
+		}
+		tok.Line += s.lines
+	}
+	return s
+}
@@ -0,0 +1,18 @@
+package ast
+
+import (
+	"monkey/token"
+)
+
+// SpawnExpression is `spawn fn() { ... }`, which runs the function its
+// Function evaluates to on a goroutine of its own.
+type SpawnExpression struct {
+	Token    token.Token // the 'spawn' token
+	Function Expression
+}
+
+func (se *SpawnExpression) expressionNode()      {}
+func (se *SpawnExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpawnExpression) String() string {
+	return "spawn " + se.Function.String()
+}
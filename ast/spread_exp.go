@@ -0,0 +1,18 @@
+package ast
+
+import (
+	"monkey/token"
+)
+
+// SpreadExpression is the last argument of a call such as `f(xs...)`, whose
+// Value is an array passed as separate arguments.
+type SpreadExpression struct {
+	Token token.Token // the '...' token
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) String() string {
+	return se.Value.String() + "..."
+}
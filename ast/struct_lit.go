@@ -0,0 +1,31 @@
+package ast
+
+import (
+	"bytes"
+	"monkey/token"
+	"strings"
+)
+
+// StructLiteral is `struct { name, age }`, which makes a struct type with
+// the given fields.
+type StructLiteral struct {
+	Token  token.Token // the 'struct' token
+	Fields []*Identifier
+}
+
+func (sl *StructLiteral) expressionNode()      {}
+func (sl *StructLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StructLiteral) String() string {
+	var out bytes.Buffer
+
+	fields := []string{}
+	for _, f := range sl.Fields {
+		fields = append(fields, f.String())
+	}
+
+	out.WriteString("struct {")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
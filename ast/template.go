@@ -0,0 +1,31 @@
+package ast
+
+import (
+	"bytes"
+	"monkey/token"
+)
+
+// TemplateLiteral is a string literal with `${...}` interpolations. Parts
+// alternate between *StringLiteral text and the embedded expressions.
+type TemplateLiteral struct {
+	Token token.Token // the token.TEMPLATE token
+	Parts []Expression
+}
+
+func (tl *TemplateLiteral) expressionNode()      {}
+func (tl *TemplateLiteral) TokenLiteral() string { return tl.Token.Literal }
+func (tl *TemplateLiteral) String() string {
+	var out bytes.Buffer
+
+	for _, part := range tl.Parts {
+		if text, ok := part.(*StringLiteral); ok {
+			out.WriteString(text.Value)
+			continue
+		}
+		out.WriteString("${")
+		out.WriteString(part.String())
+		out.WriteString("}")
+	}
+
+	return out.String()
+}
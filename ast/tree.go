@@ -0,0 +1,86 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Tree returns node as an indented tree, one node per line. Each line
+// names the field of the parent node holds, the node's type, the literal
+// and position of the token Pos reports for it and the flags set on it:
+//
+//	Program
+//	  Statements[0]: ExpressionStatement "if" 1:1
+//	    Expression: IfExpression "if" 1:1
+//	      Condition: InfixExpression ">" 1:7
+//	        Left: Identifier "x" 1:5
+//	        Right: IntegerLiteral "1" 1:9
+//	      Consequence: BlockStatement "{" 1:12
+//
+// Unlike String, it shows how the parser grouped the program.
+func Tree(node Node) string {
+	var out bytes.Buffer
+	writeTree(&out, 0, "", node)
+	return out.String()
+}
+
+var nodeType = reflect.TypeOf((*Node)(nil)).Elem()
+
+func writeTree(out *bytes.Buffer, depth int, label string, node Node) {
+	v := reflect.ValueOf(node).Elem()
+
+	writeLabel(out, depth, label)
+	out.WriteString(v.Type().Name())
+	if _, ok := node.(*Program); !ok {
+		tok := Pos(node)
+		fmt.Fprintf(out, " %q %d:%d", tok.Literal, tok.Line, tok.Column)
+	}
+	for i := 0; i < v.NumField(); i++ {
+		if f := v.Field(i); f.Kind() == reflect.Bool && f.Bool() {
+			out.WriteString(" " + strings.ToLower(v.Type().Field(i).Name))
+		}
+	}
+	out.WriteByte('\n')
+
+	writeFields(out, depth+1, v)
+}
+
+// writeFields writes the children of the node or the pair of nodes v is,
+// in the order of its fields.
+func writeFields(out *bytes.Buffer, depth int, v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		name, f := v.Type().Field(i).Name, v.Field(i)
+
+		switch {
+		case f.Type().Implements(nodeType):
+			writeChild(out, depth, name, f)
+		case f.Kind() == reflect.Slice:
+			for j := 0; j < f.Len(); j++ {
+				writeChild(out, depth, fmt.Sprintf("%s[%d]", name, j), f.Index(j))
+			}
+		}
+	}
+}
+
+func writeChild(out *bytes.Buffer, depth int, label string, v reflect.Value) {
+	switch {
+	case v.Type().Implements(nodeType):
+		if node, ok := v.Interface().(Node); ok && !isNilNode(node) {
+			writeTree(out, depth, label, node)
+		}
+	case v.Kind() == reflect.Struct:
+		// the pairs of hashes and the arms of matches
+		writeLabel(out, depth, label)
+		out.WriteString(v.Type().Name() + "\n")
+		writeFields(out, depth+1, v)
+	}
+}
+
+func writeLabel(out *bytes.Buffer, depth int, label string) {
+	out.WriteString(strings.Repeat("  ", depth))
+	if label != "" {
+		out.WriteString(label + ": ")
+	}
+}
@@ -0,0 +1,75 @@
+package ast_test
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"if (x > 1) { x } else { -2 }",
+			`Program
+  Statements[0]: ExpressionStatement "if" 1:1
+    Expression: IfExpression "if" 1:1
+      Condition: InfixExpression ">" 1:7
+        Left: Identifier "x" 1:5
+        Right: IntegerLiteral "1" 1:9
+      Consequence: BlockStatement "{" 1:12
+        Statements[0]: ExpressionStatement "x" 1:14
+          Expression: Identifier "x" 1:14
+      Alternative: BlockStatement "{" 1:23
+        Statements[0]: ExpressionStatement "-" 1:25
+          Expression: PrefixExpression "-" 1:25
+            Right: IntegerLiteral "2" 1:26
+`,
+		},
+		{
+			"let f = fn(a...) {\n  {a: 1}\n};",
+			`Program
+  Statements[0]: LetStatement "let" 1:1
+    Name: Identifier "f" 1:5
+    Value: FunctionLiteral "fn" 1:9 variadic
+      Parameters[0]: Identifier "a" 1:12
+      Body: BlockStatement "{" 1:18
+        Statements[0]: ExpressionStatement "{" 2:3
+          Expression: HashLiteral "{" 2:3
+            Pairs[0]: HashPair
+              Key: Identifier "a" 2:4
+              Value: IntegerLiteral "1" 2:7
+`,
+		},
+		{
+			"match (x) { 1 => a?.b, _ => 0 }",
+			`Program
+  Statements[0]: ExpressionStatement "match" 1:1
+    Expression: MatchExpression "match" 1:1
+      Subject: Identifier "x" 1:8
+      Arms[0]: MatchArm
+        Pattern: IntegerLiteral "1" 1:13
+        Body: FieldExpression "?." 1:19 optional
+          Receiver: Identifier "a" 1:18
+          Field: Identifier "b" 1:21
+      Arms[1]: MatchArm
+        Body: IntegerLiteral "0" 1:29
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, p.Errors())
+		}
+
+		if got := ast.Tree(program); got != tt.expected {
+			t.Errorf("wrong tree for %q.\nwant:\n%s\ngot:\n%s", tt.input, tt.expected, got)
+		}
+	}
+}
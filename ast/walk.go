@@ -0,0 +1,177 @@
+package ast
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order: It starts by calling
+// v.Visit(node); node must not be nil. If the visitor w returned by
+// v.Visit(node) is not nil, Walk is invoked recursively with visitor
+// w for each of the non-nil children of node, followed by a call of
+// w.Visit(nil).
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+
+	case *LetStatement:
+		walkIf(v, n.Name)
+		walkIf(v, n.Pattern)
+		walkIf(v, n.Value)
+
+	case *DestructurePattern:
+		for _, name := range n.Names {
+			Walk(v, name)
+		}
+
+	case *ReturnStatement:
+		walkIf(v, n.ReturnValue)
+
+	case *ExpressionStatement:
+		walkIf(v, n.Expression)
+
+	case *ForInStatement:
+		walkIf(v, n.Key)
+		walkIf(v, n.Value)
+		walkIf(v, n.Iterable)
+		walkIf(v, n.Body)
+
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+
+	case *BreakStatement, *ContinueStatement, *Identifier, *IntegerLiteral,
+		*FloatLiteral, *StringLiteral, *Boolean:
+		// nothing to do
+
+	case *TemplateLiteral:
+		walkExpressions(v, n.Parts)
+
+	case *PrefixExpression:
+		walkIf(v, n.Right)
+
+	case *InfixExpression:
+		walkIf(v, n.Left)
+		walkIf(v, n.Right)
+
+	case *AssignExpression:
+		walkIf(v, n.Name)
+		walkIf(v, n.Value)
+
+	case *IndexAssignExpression:
+		walkIf(v, n.Left)
+		walkIf(v, n.Index)
+		walkIf(v, n.Value)
+
+	case *IfExpression:
+		walkIf(v, n.Condition)
+		walkIf(v, n.Consequence)
+		walkIf(v, n.Alternative)
+
+	case *TryExpression:
+		walkIf(v, n.Block)
+		walkIf(v, n.Param)
+		walkIf(v, n.Handler)
+
+	case *MatchExpression:
+		walkIf(v, n.Subject)
+		for _, arm := range n.Arms {
+			walkIf(v, arm.Pattern)
+			walkIf(v, arm.Body)
+		}
+
+	case *FunctionLiteral:
+		for _, p := range n.Parameters {
+			walkIf(v, p)
+		}
+		walkIf(v, n.Body)
+
+	case *CallExpression:
+		walkIf(v, n.Function)
+		walkExpressions(v, n.Arguments)
+
+	case *MethodCallExpression:
+		walkIf(v, n.Receiver)
+		walkIf(v, n.Method)
+		walkExpressions(v, n.Arguments)
+
+	case *SpreadExpression:
+		walkIf(v, n.Value)
+
+	case *SpawnExpression:
+		walkIf(v, n.Function)
+
+	case *StructLiteral:
+		for _, f := range n.Fields {
+			walkIf(v, f)
+		}
+
+	case *FieldExpression:
+		walkIf(v, n.Receiver)
+		walkIf(v, n.Field)
+
+	case *ImportExpression:
+		walkIf(v, n.Path)
+
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+
+	case *IndexExpression:
+		walkIf(v, n.Left)
+		walkIf(v, n.Index)
+
+	case *SliceExpression:
+		walkIf(v, n.Left)
+		walkIf(v, n.Start)
+		walkIf(v, n.End)
+
+	case *HashLiteral:
+		for _, pair := range n.Pairs {
+			walkIf(v, pair.Key)
+			walkIf(v, pair.Value)
+		}
+	}
+
+	v.Visit(nil)
+}
+
+func walkIf(v Visitor, node Node) {
+	if !isNilNode(node) {
+		Walk(v, node)
+	}
+}
+
+func walkStatements(v Visitor, stmts []Statement) {
+	for _, s := range stmts {
+		walkIf(v, s)
+	}
+}
+
+func walkExpressions(v Visitor, exps []Expression) {
+	for _, e := range exps {
+		walkIf(v, e)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order: It starts by calling
+// f(node); node must not be nil. If f returns true, Inspect invokes f
+// recursively for each of the non-nil children of node, followed by a
+// call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
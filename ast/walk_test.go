@@ -0,0 +1,82 @@
+package ast_test
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	input := `let f = fn(x) { if (x > 1) { x * 2 } else { [x, {"k": x}] } }; f(3);`
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	var idents []string
+	ast.Inspect(program, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Identifier); ok {
+			idents = append(idents, ident.Value)
+		}
+		return true
+	})
+
+	expected := []string{"f", "x", "x", "x", "x", "x", "f"}
+	if len(idents) != len(expected) {
+		t.Fatalf("wrong identifiers. want=%v, got=%v", expected, idents)
+	}
+	for i, name := range expected {
+		if idents[i] != name {
+			t.Errorf("identifier %d wrong. want=%q, got=%q", i, name, idents[i])
+		}
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	p := parser.New(lexer.New(`let a = fn(b) { c }; d;`))
+	program := p.ParseProgram()
+
+	var idents []string
+	ast.Inspect(program, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Identifier); ok {
+			idents = append(idents, ident.Value)
+		}
+		_, isFn := n.(*ast.FunctionLiteral)
+		return !isFn
+	})
+
+	if len(idents) != 2 || idents[0] != "a" || idents[1] != "d" {
+		t.Errorf("function body should be skipped. got=%v", idents)
+	}
+}
+
+type countingVisitor struct {
+	enter, leave int
+}
+
+func (c *countingVisitor) Visit(n ast.Node) ast.Visitor {
+	if n == nil {
+		c.leave++
+	} else {
+		c.enter++
+	}
+	return c
+}
+
+func TestWalkBalancesVisits(t *testing.T) {
+	p := parser.New(lexer.New(`1 + 2 * -3;`))
+	program := p.ParseProgram()
+
+	v := &countingVisitor{}
+	ast.Walk(v, program)
+
+	// Program, ExpressionStatement, two infix, prefix and three integers.
+	if v.enter != 8 {
+		t.Errorf("wrong number of nodes visited. want=8, got=%d", v.enter)
+	}
+	if v.enter != v.leave {
+		t.Errorf("unbalanced visits. enter=%d, leave=%d", v.enter, v.leave)
+	}
+}
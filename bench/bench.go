@@ -0,0 +1,33 @@
+// Package bench holds the programs used to measure the performance of the
+// lexer, parser, evaluator and VM. Each stresses a different part of the
+// implementation, and all of them run on both engines.
+package bench
+
+import (
+	"embed"
+	"strings"
+)
+
+//go:embed *.monkey
+var files embed.FS
+
+// Program is one program of the corpus.
+type Program struct {
+	Name   string // the file name without the .monkey extension
+	Source string
+}
+
+// Programs returns the whole corpus, sorted by name.
+func Programs() []Program {
+	entries, _ := files.ReadDir(".")
+
+	programs := []Program{}
+	for _, e := range entries {
+		data, _ := files.ReadFile(e.Name())
+		programs = append(programs, Program{
+			Name:   strings.TrimSuffix(e.Name(), ".monkey"),
+			Source: string(data),
+		})
+	}
+	return programs
+}
@@ -0,0 +1,821 @@
+// Command monkey runs, inspects and formats Monkey source files.
+//
+// Usage:
+//
+//	monkey repl [-engine eval|vm]
+//	monkey file [arg...]
+//	monkey run [-engine eval|vm] [-O] [-profile] [-max-steps n] [-strict] file [-- arg...]
+//	monkey debug [-b line] file
+//	monkey cover [-lcov] [-o output] file
+//	monkey test [-v] [-cover] [-coverprofile output] [path...]
+//	monkey build [-target bytecode|go] [-o output] [-O] file
+//	monkey disasm [-O] file
+//	monkey parse [-json] file
+//	monkey tokens [-html] file
+//	monkey fmt [-w] file...
+//	monkey vet file...
+//	monkey bench [-n runs] [file...]
+//
+// A file name of "-" reads from standard input. Without a command, monkey
+// starts the REPL, and given a file instead it runs the file like run,
+// passing it the remaining arguments, so that a script starting with
+// "#!/usr/bin/env monkey" can be executed directly. Files ending in .mkb
+// hold bytecode written by build, which run executes on the VM without
+// compiling the program again and disasm lists as they are. With -target
+// go, build writes a Go program instead, to be built with the Go
+// toolchain in a module that can import monkey/transpiler/rt. run passes
+// the arguments after a "--" to the program, which gets them from args(),
+// and lets it read environment variables, run commands and exit with a
+// status of its choosing; -max-steps stops it with an error after that
+// many evaluation steps or instructions, and -strict makes conditions
+// that are not booleans an error. Syntax errors, and the errors
+// programs fail with on the evaluator, are shown with the line of source
+// they happened on, after which the evaluator lists the calls in progress;
+// the VM keeps no positions, and reports only the message. The -O flag optimizes programs before they run or
+// compile, and -profile reports to standard error where a program run on
+// the evaluator spent its time. bench times both engines on the
+// given programs, or on the built-in benchmark corpus without any. debug
+// runs a program on the evaluator under a debugger that reads its
+// commands from standard input; -b sets a breakpoint and may be repeated.
+// cover runs a program on the evaluator and lists its source with how often
+// each line ran, or writes an LCOV file with -lcov. test runs the test
+// functions in the _test.monkey files under the given paths, by default
+// the current directory, and fails if any of them does; -cover reports the
+// coverage of each file and -coverprofile writes it as an LCOV file. vet
+// lists unused bindings, unreachable code, constant conditions and
+// shadowed names, and fails if it finds any.
+//
+// The repository root holds the monkey package for embedding scripts in
+// Go programs, so the command is run from the root with
+//
+//	go run ./cmd/monkey [command] [arguments]
+//
+// or installed with go install ./cmd/monkey.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"monkey/analysis"
+	"monkey/ast"
+	"monkey/bench"
+	"monkey/compiler"
+	"monkey/coverage"
+	"monkey/debugger"
+	"monkey/diagnostics"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/optimizer"
+	"monkey/parser"
+	"monkey/profiler"
+	"monkey/repl"
+	"monkey/tester"
+	"monkey/token"
+	"monkey/transpiler"
+	"monkey/vm"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `usage: monkey <command> [arguments]
+       monkey file [arguments]
+
+commands:
+	repl    start an interactive session (the default)
+	run     execute a Monkey program
+	debug   step through a Monkey program
+	cover   report which lines of a program run
+	test    run the tests in _test.monkey files
+	build   compile a program to a .mkb bytecode file or to Go
+	disasm  print the bytecode of a program
+	parse   print the syntax tree of a program
+	tokens  print the token stream of a program
+	fmt     rewrite programs in canonical style
+	vet     report likely mistakes in programs
+	bench   compare the speed of the eval and vm engines
+`
+
+var commands = map[string]func(args []string) error{
+	"repl":   replCmd,
+	"run":    runCmd,
+	"debug":  debugCmd,
+	"cover":  coverCmd,
+	"test":   testCmd,
+	"build":  buildCmd,
+	"disasm": disasmCmd,
+	"parse":  parseCmd,
+	"tokens": tokensCmd,
+	"fmt":    fmtCmd,
+	"vet":    vetCmd,
+	"bench":  benchCmd,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		os.Args = append(os.Args, "repl")
+	}
+
+	name, args := os.Args[1], os.Args[2:]
+	cmd, ok := commands[name]
+	if !ok && isScript(name) {
+		// monkey file [arg...] runs the file, which is what a
+		// "#!/usr/bin/env monkey" line makes the shell do
+		name, cmd, ok = "run", runCmd, true
+		args = append([]string{os.Args[1], "--"}, args...)
+	}
+	if !ok {
+		fmt.Fprintf(os.Stderr, "monkey: unknown command %q\n\n%s", name, usage)
+		os.Exit(2)
+	}
+
+	if err := cmd(args); err != nil {
+		if exit, ok := err.(*object.ExitError); ok {
+			os.Exit(exit.Code)
+		}
+		fmt.Fprintf(os.Stderr, "monkey %s: %s\n", name, err)
+		os.Exit(1)
+	}
+}
+
+// isScript reports whether name, which is not a command, is a program to
+// run: standard input or an existing file.
+func isScript(name string) bool {
+	if name == "-" {
+		return true
+	}
+	info, err := os.Stat(name)
+	return err == nil && !info.IsDir()
+}
+
+func replCmd(args []string) error {
+	flags := flag.NewFlagSet("repl", flag.ExitOnError)
+	engine := flags.String("engine", repl.ENGINE_EVAL, "use 'vm' or 'eval'")
+	flags.Parse(args)
+
+	if *engine != repl.ENGINE_EVAL && *engine != repl.ENGINE_VM {
+		return fmt.Errorf("unknown engine %q, use 'vm' or 'eval'", *engine)
+	}
+
+	user, err := user.Current()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Hello %s! This is monkey!\n", user.Username)
+	fmt.Printf("Feel free to type in commands, :help lists the REPL commands\n")
+
+	repl.Run(repl.Config{
+		Engine: *engine,
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+
+		AllowFS: true,
+	})
+	return nil
+}
+
+func runCmd(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	engine := flags.String("engine", repl.ENGINE_EVAL, "use 'vm' or 'eval'")
+	optimize := flags.Bool("O", false, "fold constant expressions and drop dead branches")
+	profile := flags.Bool("profile", false, "report where the program spent its time")
+	maxSteps := flags.Int("max-steps", 0, "stop the program after `n` steps (0 means no limit)")
+	strict := flags.Bool("strict", false, "fail on conditions that are not booleans")
+	flags.Parse(args)
+
+	// the arguments of the program follow a "--"
+	var programArgs []string
+	if flags.NArg() > 1 && flags.Arg(1) == "--" {
+		programArgs = flags.Args()[2:]
+	} else if flags.NArg() != 1 {
+		return fmt.Errorf("expected exactly one file")
+	}
+	if *engine != repl.ENGINE_EVAL && *engine != repl.ENGINE_VM {
+		return fmt.Errorf("unknown engine %q, use 'vm' or 'eval'", *engine)
+	}
+	if *profile && (*engine == repl.ENGINE_VM || strings.HasSuffix(flags.Arg(0), ".mkb")) {
+		return fmt.Errorf("-profile needs the eval engine")
+	}
+
+	// imports are relative to the program's own directory
+	dir := ""
+	if flags.Arg(0) != "-" {
+		dir = filepath.Dir(flags.Arg(0))
+	}
+
+	if *engine == repl.ENGINE_VM || strings.HasSuffix(flags.Arg(0), ".mkb") {
+		bytecode, err := loadBytecode(flags.Arg(0), *optimize)
+		if err != nil {
+			return err
+		}
+		return runBytecode(bytecode, dir, programArgs, *maxSteps, *strict)
+	}
+
+	src, err := readSource(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	program, err := parseSource(flags.Arg(0), src)
+	if err != nil {
+		return err
+	}
+	if *optimize {
+		optimizer.Optimize(program)
+	}
+
+	env := object.NewEnvironment()
+	env.SetDir(dir)
+
+	// programs run from the command line may use the file system and the
+	// process they run in
+	config := evaluator.Config{
+		AllowFS:    true,
+		AllowEnv:   true,
+		AllowExec:  true,
+		AllowExit:  true,
+		Args:       programArgs,
+		MaxSteps:   *maxSteps,
+		StrictBool: *strict,
+	}
+
+	var result object.Object
+	if *profile {
+		p := profiler.New()
+		result = p.Run(program, env, config)
+		p.Report(os.Stderr)
+	} else {
+		result = evaluator.EvalWithConfig(context.Background(), program, env, config)
+	}
+	if errObj, ok := result.(*object.Error); ok {
+		if errObj.Exit != nil {
+			return errObj.Exit
+		}
+		msg := diagnostics.Render(flags.Arg(0), src, diagnostics.FromError(errObj))
+		return errors.New(strings.TrimSuffix(msg, "\n"))
+	}
+	return nil
+}
+
+func debugCmd(args []string) error {
+	var breakpoints lines
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	flags.Var(&breakpoints, "b", "set a breakpoint at `line`")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected exactly one file")
+	}
+	// standard input carries the debugger commands
+	if flags.Arg(0) == "-" {
+		return fmt.Errorf("cannot debug a program read from standard input")
+	}
+
+	src, err := readSource(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	program, err := parseSource(flags.Arg(0), src)
+	if err != nil {
+		return err
+	}
+
+	env := object.NewEnvironment()
+	env.SetDir(filepath.Dir(flags.Arg(0)))
+
+	d := debugger.New(src, os.Stdin, os.Stdout)
+	for _, line := range breakpoints {
+		d.SetBreakpoint(line)
+	}
+
+	result := d.Run(program, env, evaluator.Config{AllowFS: true})
+	if result == nil {
+		return nil
+	}
+	if errObj, ok := result.(*object.Error); ok {
+		return fmt.Errorf("%s", errObj.Trace())
+	}
+	fmt.Println("program finished")
+	return nil
+}
+
+func coverCmd(args []string) error {
+	flags := flag.NewFlagSet("cover", flag.ExitOnError)
+	lcov := flags.Bool("lcov", false, "write an LCOV file instead of a listing")
+	output := flags.String("o", "", "write the coverage to `file` instead of standard output")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected exactly one file")
+	}
+
+	src, err := readSource(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	program, err := parseSource(flags.Arg(0), src)
+	if err != nil {
+		return err
+	}
+
+	dir := ""
+	if flags.Arg(0) != "-" {
+		dir = filepath.Dir(flags.Arg(0))
+	}
+	env := object.NewEnvironment()
+	env.SetDir(dir)
+
+	cover := coverage.New(program)
+	config := evaluator.Config{AllowFS: true, Hook: cover}
+	result := evaluator.EvalWithConfig(context.Background(), program, env, config)
+
+	// a program that fails still has the coverage of what ran before
+	var out bytes.Buffer
+	if *lcov {
+		cover.WriteLCOV(&out, flags.Arg(0))
+	} else {
+		cover.WriteListing(&out, src)
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(out.Bytes())
+	} else {
+		err = os.WriteFile(*output, out.Bytes(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+
+	covered, total := cover.Covered()
+	fmt.Fprintf(os.Stderr, "coverage: %.1f%% of %d lines (%d run)\n", cover.Percent(), total, covered)
+
+	if errObj, ok := result.(*object.Error); ok {
+		return fmt.Errorf("%s", errObj.Trace())
+	}
+	return nil
+}
+
+func testCmd(args []string) error {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	verbose := flags.Bool("v", false, "list the tests that pass too")
+	cover := flags.Bool("cover", false, "report the coverage of each test file")
+	coverProfile := flags.String("coverprofile", "", "write the coverage to `file` in the LCOV format")
+	flags.Parse(args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	var files []string
+	for _, path := range paths {
+		found, err := tester.Find(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, found...)
+	}
+
+	var profile bytes.Buffer
+	passed, failed := 0, 0
+
+	for _, name := range files {
+		f, err := tester.Load(name)
+		if err != nil {
+			fmt.Printf("FAIL\t%s\n", err)
+			failed++
+			continue
+		}
+
+		config := evaluator.Config{AllowFS: true}
+		var fileCover *coverage.Coverage
+		if *cover || *coverProfile != "" {
+			fileCover = coverage.New(f.Program)
+			config.Hook = fileCover
+		}
+
+		start := time.Now()
+		results, err := f.Run(config)
+		if err != nil {
+			fmt.Printf("FAIL\t%s\n", err)
+			failed++
+			continue
+		}
+
+		fileFailed := 0
+		for _, r := range results {
+			if r.Passed() {
+				passed++
+				if *verbose {
+					fmt.Printf("--- PASS: %s (%s)\n", r.Name, r.Elapsed.Round(time.Microsecond))
+				}
+				continue
+			}
+			failed++
+			fileFailed++
+			fmt.Printf("--- FAIL: %s (%s)\n    %s\n", r.Name, r.Elapsed.Round(time.Microsecond), r.Err.Message)
+		}
+
+		status := "ok"
+		if fileFailed > 0 {
+			status = "FAIL"
+		}
+		fmt.Printf("%s\t%s\t%s", status, name, time.Since(start).Round(time.Microsecond))
+		if fileCover != nil {
+			fmt.Printf("\tcoverage: %.1f%% of lines", fileCover.Percent())
+			fileCover.WriteLCOV(&profile, name)
+		}
+		fmt.Println()
+	}
+
+	if *coverProfile != "" {
+		if err := os.WriteFile(*coverProfile, profile.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tests failed", failed, passed+failed)
+	}
+	return nil
+}
+
+// lines collects the values of a repeated line number flag.
+type lines []int
+
+func (l *lines) String() string {
+	return fmt.Sprint(*l)
+}
+
+func (l *lines) Set(value string) error {
+	line, err := strconv.Atoi(value)
+	if err != nil || line < 1 {
+		return fmt.Errorf("invalid line %q", value)
+	}
+	*l = append(*l, line)
+	return nil
+}
+
+func runBytecode(bytecode *compiler.Bytecode, dir string, args []string, maxSteps int, strict bool) error {
+	machine := vm.New(bytecode)
+	machine.SetDir(dir)
+	machine.SetAllowFS(true)
+	machine.SetAllowEnv(true)
+	machine.SetAllowExec(true)
+	machine.SetAllowExit(true)
+	machine.SetArgs(args)
+	machine.SetMaxSteps(maxSteps)
+	machine.SetStrictBool(strict)
+	err := machine.Run()
+	if exit, ok := err.(*object.ExitError); ok {
+		return exit
+	}
+	if err != nil {
+		return fmt.Errorf("executing bytecode failed: %s", err)
+	}
+	return nil
+}
+
+func buildCmd(args []string) error {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	target := flags.String("target", "bytecode", "what to compile to: 'bytecode' or 'go'")
+	output := flags.String("o", "", "output file (default: the input with a .mkb or .go extension)")
+	optimize := flags.Bool("O", false, "fold constant expressions and drop dead branches")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected exactly one file")
+	}
+	ext := ".mkb"
+	switch *target {
+	case "bytecode":
+	case "go":
+		ext = ".go"
+	default:
+		return fmt.Errorf("unknown target %q, use 'bytecode' or 'go'", *target)
+	}
+
+	name := flags.Arg(0)
+	if *output == "" {
+		if name == "-" {
+			return fmt.Errorf("-o is required when reading from standard input")
+		}
+		*output = strings.TrimSuffix(name, filepath.Ext(name)) + ext
+	}
+
+	if *target == "go" {
+		program, err := parseFile(name)
+		if err != nil {
+			return err
+		}
+		if *optimize {
+			optimizer.Optimize(program)
+		}
+		src, err := transpiler.Generate(program)
+		if err != nil {
+			return fmt.Errorf("%s:%s", name, err)
+		}
+		return os.WriteFile(*output, src, 0644)
+	}
+
+	bytecode, err := compile(name, *optimize)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := compiler.Encode(&buf, bytecode); err != nil {
+		return err
+	}
+	return os.WriteFile(*output, buf.Bytes(), 0644)
+}
+
+func disasmCmd(args []string) error {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	optimize := flags.Bool("O", false, "fold constant expressions and drop dead branches")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected exactly one file")
+	}
+
+	bytecode, err := loadBytecode(flags.Arg(0), *optimize)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(bytecode.Disassemble())
+	return nil
+}
+
+// loadBytecode decodes a .mkb file or compiles a source file.
+func loadBytecode(name string, optimize bool) (*compiler.Bytecode, error) {
+	if strings.HasSuffix(name, ".mkb") {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		bytecode, err := compiler.Decode(bufio.NewReader(f))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		return bytecode, nil
+	}
+
+	return compile(name, optimize)
+}
+
+func compile(name string, optimize bool) (*compiler.Bytecode, error) {
+	program, err := parseFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if optimize {
+		optimizer.Optimize(program)
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return nil, fmt.Errorf("compilation failed: %s", err)
+	}
+	return comp.Bytecode(), nil
+}
+
+func parseCmd(args []string) error {
+	flags := flag.NewFlagSet("parse", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the tree as JSON")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected exactly one file")
+	}
+
+	program, err := parseFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		data, err := ast.ToJSON(program)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	for _, stmt := range program.Statements {
+		fmt.Println(stmt.String())
+	}
+	return nil
+}
+
+func tokensCmd(args []string) error {
+	flags := flag.NewFlagSet("tokens", flag.ExitOnError)
+	asHTML := flags.Bool("html", false, "print the source as HTML with classes for syntax highlighting")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected exactly one file")
+	}
+
+	src, err := readSource(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *asHTML {
+		return lexer.WriteHTML(os.Stdout, src)
+	}
+
+	l := lexer.New(src)
+	for tok := l.NextToken(); ; tok = l.NextToken() {
+		fmt.Printf("%d:%d\t%s\t%q\n", tok.Line, tok.Column, tok.Type, tok.Literal)
+		if tok.Type == token.EOF {
+			return nil
+		}
+	}
+}
+
+func fmtCmd(args []string) error {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write result to the source file instead of stdout")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return fmt.Errorf("expected at least one file")
+	}
+
+	for _, name := range flags.Args() {
+		src, err := readSource(name)
+		if err != nil {
+			return err
+		}
+		program, err := parseSource(name, src)
+		if err != nil {
+			return err
+		}
+
+		formatted := ast.Format(program)
+		if strings.HasPrefix(src, "#!") {
+			// the lexer skips the shebang line, so put it back
+			shebang, _, _ := strings.Cut(src, "\n")
+			formatted = shebang + "\n" + formatted
+		}
+		if !*write || name == "-" {
+			fmt.Print(formatted)
+			continue
+		}
+
+		if err := os.WriteFile(name, []byte(formatted), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func vetCmd(args []string) error {
+	flags := flag.NewFlagSet("vet", flag.ExitOnError)
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return fmt.Errorf("expected at least one file")
+	}
+
+	found := 0
+	for _, name := range flags.Args() {
+		program, err := parseFile(name)
+		if err != nil {
+			return err
+		}
+
+		for _, d := range analysis.Analyze(program) {
+			fmt.Printf("%s:%s\n", name, d)
+			found++
+		}
+	}
+
+	if found > 0 {
+		return fmt.Errorf("found %d problems", found)
+	}
+	return nil
+}
+
+func benchCmd(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	runs := flags.Int("n", 5, "number of runs to average")
+	flags.Parse(args)
+
+	if *runs < 1 {
+		return fmt.Errorf("-n must be at least 1")
+	}
+
+	programs := bench.Programs()
+	if flags.NArg() > 0 {
+		programs = nil
+		for _, name := range flags.Args() {
+			src, err := readSource(name)
+			if err != nil {
+				return err
+			}
+			programs = append(programs, bench.Program{Name: name, Source: src})
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "program\teval\tvm\tspeedup\t")
+
+	for _, program := range programs {
+		p := parser.New(lexer.New(program.Source))
+		parsed := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return fmt.Errorf("%s: %s", program.Name, p.Errors()[0].Error())
+		}
+
+		evalTime, err := timeRuns(*runs, func() error {
+			result := evaluator.Eval(parsed, object.NewEnvironment())
+			if errObj, ok := result.(*object.Error); ok {
+				return fmt.Errorf("%s", errObj.Inspect())
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %s", program.Name, err)
+		}
+
+		// the VM's time includes compiling, which the evaluator skips
+		vmTime, err := timeRuns(*runs, func() error {
+			comp := compiler.New()
+			if err := comp.Compile(parsed); err != nil {
+				return err
+			}
+			return vm.New(comp.Bytecode()).Run()
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %s", program.Name, err)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.2fx\t\n", program.Name,
+			evalTime.Round(time.Microsecond), vmTime.Round(time.Microsecond),
+			float64(evalTime)/float64(vmTime))
+	}
+
+	return w.Flush()
+}
+
+// timeRuns returns the mean time taken by runs calls of f.
+func timeRuns(runs int, f func() error) (time.Duration, error) {
+	start := time.Now()
+	for i := 0; i < runs; i++ {
+		if err := f(); err != nil {
+			return 0, err
+		}
+	}
+	return time.Since(start) / time.Duration(runs), nil
+}
+
+func readSource(name string) (string, error) {
+	var data []byte
+	var err error
+
+	if name == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	return string(data), err
+}
+
+func parseFile(name string) (*ast.Program, error) {
+	src, err := readSource(name)
+	if err != nil {
+		return nil, err
+	}
+	return parseSource(name, src)
+}
+
+func parseSource(name, src string) (*ast.Program, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		var msgs []string
+		for _, err := range p.Errors() {
+			msgs = append(msgs, diagnostics.Render(name, src, diagnostics.FromParseError(err)))
+		}
+		return nil, fmt.Errorf("parser errors:\n%s", strings.Join(msgs, ""))
+	}
+	return program, nil
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain runs the command itself when a test starts the test binary as
+// a subprocess, so that tests can check what it prints and how it exits.
+func TestMain(m *testing.M) {
+	if os.Getenv("MONKEY_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// monkey runs the command with args and stdin, returning what it wrote
+// and its exit status.
+func monkey(t *testing.T, stdin string, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "MONKEY_TEST_MAIN=1")
+	cmd.Stdin = strings.NewReader(stdin)
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		code = exit.ExitCode()
+	} else if err != nil {
+		t.Fatalf("cannot run monkey %s: %s", strings.Join(args, " "), err)
+	}
+	return out.String(), errOut.String(), code
+}
+
+// writeFile writes src to a file called name in a temporary directory and
+// returns its path.
+func writeFile(t *testing.T, name, src string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunErrorTrace(t *testing.T) {
+	path := writeFile(t, "fail.monkey", `let f = fn(x) { x / 0 };
+let g = fn() { f(1) + 1 };
+g();
+`)
+
+	// the evaluator shows where the error happened and the calls it
+	// happened in
+	_, stderr, code := monkey(t, "", "run", path)
+	for _, want := range []string{
+		"error: division by zero",
+		"fail.monkey:1:19",
+		"in f, called at line 2, column 17",
+		"in g, called at line 3, column 2",
+	} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("eval: expected %q in:\n%s", want, stderr)
+		}
+	}
+	if code != 1 {
+		t.Errorf("eval: wrong exit status. want=1, got=%d", code)
+	}
+
+	// the VM keeps no positions
+	_, stderr, code = monkey(t, "", "run", "-engine", "vm", path)
+	if stderr != "monkey run: executing bytecode failed: division by zero\n" {
+		t.Errorf("vm: wrong error output:\n%s", stderr)
+	}
+	if code != 1 {
+		t.Errorf("vm: wrong exit status. want=1, got=%d", code)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	stdout, stderr, code := monkey(t, "", "nope")
+	if stdout != "" {
+		t.Errorf("unexpected output: %q", stdout)
+	}
+	if stderr != "monkey: unknown command \"nope\"\n\n"+usage {
+		t.Errorf("wrong error output:\n%s", stderr)
+	}
+	if code != 2 {
+		t.Errorf("wrong exit status. want=2, got=%d", code)
+	}
+}
+
+func TestArguments(t *testing.T) {
+	path := writeFile(t, "prog.monkey", "puts(1);\n")
+	missing := filepath.Join(filepath.Dir(path), "missing.monkey")
+
+	tests := []struct {
+		args   []string
+		stderr string
+		code   int
+	}{
+		{[]string{"run"}, "monkey run: expected exactly one file\n", 1},
+		{[]string{"run", path, path}, "monkey run: expected exactly one file\n", 1},
+		{[]string{"run", "-engine", "js", path}, "monkey run: unknown engine \"js\", use 'vm' or 'eval'\n", 1},
+		{[]string{"run", "-profile", "-engine", "vm", path}, "monkey run: -profile needs the eval engine\n", 1},
+		{[]string{"run", missing}, "monkey run: open " + missing + ": no such file or directory\n", 1},
+		{[]string{"repl", "-engine", "js"}, "monkey repl: unknown engine \"js\", use 'vm' or 'eval'\n", 1},
+		{[]string{"parse"}, "monkey parse: expected exactly one file\n", 1},
+		{[]string{"tokens", path, path}, "monkey tokens: expected exactly one file\n", 1},
+		{[]string{"fmt"}, "monkey fmt: expected at least one file\n", 1},
+		{[]string{"vet"}, "monkey vet: expected at least one file\n", 1},
+		{[]string{"build", "-target", "js", path}, "monkey build: unknown target \"js\", use 'bytecode' or 'go'\n", 1},
+		{[]string{"build", "-"}, "monkey build: -o is required when reading from standard input\n", 1},
+		{[]string{"debug", "-"}, "monkey debug: cannot debug a program read from standard input\n", 1},
+		{[]string{"bench", "-n", "0"}, "monkey bench: -n must be at least 1\n", 1},
+	}
+
+	for _, tt := range tests {
+		stdout, stderr, code := monkey(t, "", tt.args...)
+		if stdout != "" {
+			t.Errorf("%q: unexpected output: %q", tt.args, stdout)
+		}
+		if stderr != tt.stderr {
+			t.Errorf("%q: wrong error output. want=%q, got=%q", tt.args, tt.stderr, stderr)
+		}
+		if code != tt.code {
+			t.Errorf("%q: wrong exit status. want=%d, got=%d", tt.args, tt.code, code)
+		}
+	}
+}
+
+func TestBadFlags(t *testing.T) {
+	path := writeFile(t, "prog.monkey", "puts(1);\n")
+
+	for _, args := range [][]string{
+		{"run", "-nope", path},
+		{"run", "-max-steps", "many", path},
+		{"debug", "-b", "0", path},
+		{"fmt", "-x", path},
+	} {
+		stdout, stderr, code := monkey(t, "", args...)
+		if stdout != "" {
+			t.Errorf("%q: unexpected output: %q", args, stdout)
+		}
+		if !strings.Contains(stderr, "Usage of "+args[0]+":") {
+			t.Errorf("%q: no usage in:\n%s", args, stderr)
+		}
+		if code != 2 {
+			t.Errorf("%q: wrong exit status. want=2, got=%d", args, code)
+		}
+	}
+}
+
+func TestRunExitStatus(t *testing.T) {
+	tests := []struct {
+		src    string
+		stdout string
+		code   int
+	}{
+		{"puts(1 + 2);", "3\n", 0},
+		{"puts(1); exit(3); puts(2);", "1\n", 3},
+		{"exit(0); puts(1);", "", 0},
+		{"let f = fn() { exit(4) }; f();", "", 4},
+		{"1 / 0", "", 1},
+		{"let = 1;", "", 1},
+	}
+
+	for i, tt := range tests {
+		path := writeFile(t, "prog.monkey", tt.src)
+		for _, engine := range []string{"eval", "vm"} {
+			stdout, _, code := monkey(t, "", "run", "-engine", engine, path)
+			if stdout != tt.stdout {
+				t.Errorf("[%s] test %d: wrong output. want=%q, got=%q", engine, i, tt.stdout, stdout)
+			}
+			if code != tt.code {
+				t.Errorf("[%s] test %d: wrong exit status. want=%d, got=%d", engine, i, tt.code, code)
+			}
+		}
+	}
+}
+
+func TestRunFlags(t *testing.T) {
+	path := writeFile(t, "prog.monkey", "let x = 1 + 2; if (x) { puts(x) }\n")
+
+	tests := []struct {
+		args   []string
+		stdout string
+		stderr string
+		code   int
+	}{
+		{[]string{"-O"}, "3\n", "", 0},
+		{[]string{"-engine", "vm", "-O"}, "3\n", "", 0},
+		{[]string{"-max-steps", "2"}, "", "execution budget exceeded", 1},
+		{[]string{"-strict"}, "", "non-boolean condition: INTEGER", 1},
+		{[]string{"-engine", "vm", "-strict"}, "", "non-boolean condition: INTEGER", 1},
+		{[]string{"-profile"}, "3\n", "calls", 0},
+	}
+
+	for _, tt := range tests {
+		stdout, stderr, code := monkey(t, "", append(append([]string{"run"}, tt.args...), path)...)
+		if stdout != tt.stdout {
+			t.Errorf("%q: wrong output. want=%q, got=%q", tt.args, tt.stdout, stdout)
+		}
+		if !strings.Contains(stderr, tt.stderr) {
+			t.Errorf("%q: expected %q in:\n%s", tt.args, tt.stderr, stderr)
+		}
+		if code != tt.code {
+			t.Errorf("%q: wrong exit status. want=%d, got=%d", tt.args, tt.code, code)
+		}
+	}
+}
+
+func TestInspectCommands(t *testing.T) {
+	path := writeFile(t, "prog.monkey", "let x = 1 +   2;\nputs(x)\n")
+
+	tests := []struct {
+		args   []string
+		stdout string
+	}{
+		{[]string{"parse", path}, "let x = (1 + 2);\nputs(x)\n"},
+		{[]string{"fmt", path}, "let x = 1 + 2;\nputs(x);\n"},
+		{[]string{"tokens", path}, "1:1\tLET\t\"let\"\n" +
+			"1:5\tIDENT\t\"x\"\n" +
+			"1:7\t=\t\"=\"\n" +
+			"1:9\tINT\t\"1\"\n" +
+			"1:11\t+\t\"+\"\n" +
+			"1:15\tINT\t\"2\"\n" +
+			"1:16\t;\t\";\"\n" +
+			"2:1\tIDENT\t\"puts\"\n" +
+			"2:5\t(\t\"(\"\n" +
+			"2:6\tIDENT\t\"x\"\n" +
+			"2:7\t)\t\")\"\n" +
+			"3:1\tEOF\t\"\"\n"},
+	}
+
+	for _, tt := range tests {
+		stdout, stderr, code := monkey(t, "", tt.args...)
+		if stdout != tt.stdout {
+			t.Errorf("%q: wrong output. want=%q, got=%q", tt.args, tt.stdout, stdout)
+		}
+		if stderr != "" || code != 0 {
+			t.Errorf("%q: failed with status %d:\n%s", tt.args, code, stderr)
+		}
+	}
+
+	// -w rewrites the file in place
+	if stdout, stderr, code := monkey(t, "", "fmt", "-w", path); stdout != "" || stderr != "" || code != 0 {
+		t.Fatalf("fmt -w: failed with status %d: %q %q", code, stdout, stderr)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "let x = 1 + 2;\nputs(x);\n" {
+		t.Errorf("fmt -w: wrong file contents: %q", data)
+	}
+
+	// a syntax error fails every command that parses
+	bad := writeFile(t, "bad.monkey", "let = 1;\n")
+	for _, cmd := range []string{"run", "parse", "fmt"} {
+		_, stderr, code := monkey(t, "", cmd, bad)
+		if !strings.HasPrefix(stderr, "monkey "+cmd+": parser errors:\n") || !strings.Contains(stderr, "bad.monkey:1:5") {
+			t.Errorf("%s: wrong error output:\n%s", cmd, stderr)
+		}
+		if code != 1 {
+			t.Errorf("%s: wrong exit status. want=1, got=%d", cmd, code)
+		}
+	}
+}
+
+func TestScripts(t *testing.T) {
+	script := writeFile(t, "script.monkey", `#!/usr/bin/env monkey
+puts(args());
+exit(len(args()));
+`)
+
+	tests := []struct {
+		stdin  string
+		args   []string
+		stdout string
+		code   int
+	}{
+		// a file in place of a command runs with the arguments after it
+		{"", []string{script}, "[]\n", 0},
+		{"", []string{script, "a", "-b", "--"}, "[a, -b, --]\n", 3},
+		{"", []string{"run", script, "--", "a", "b"}, "[a, b]\n", 2},
+		{"", []string{"run", "-engine", "vm", script, "--", "a"}, "[a]\n", 1},
+		// so does standard input
+		{"puts(args()); exit(7)", []string{"-", "a"}, "[a]\n", 7},
+		{"puts(1 + 2)", []string{"run", "-"}, "3\n", 0},
+		{"puts(1 + 2)", []string{"run", "-engine", "vm", "-"}, "3\n", 0},
+		// the shebang line is kept by fmt
+		{"", []string{"fmt", script}, "#!/usr/bin/env monkey\nputs(args());\nexit(len(args()));\n", 0},
+	}
+
+	for _, tt := range tests {
+		stdout, stderr, code := monkey(t, tt.stdin, tt.args...)
+		if stdout != tt.stdout {
+			t.Errorf("%q: wrong output. want=%q, got=%q", tt.args, tt.stdout, stdout)
+		}
+		if code != tt.code {
+			t.Errorf("%q: wrong exit status. want=%d, got=%d:\n%s", tt.args, tt.code, code, stderr)
+		}
+	}
+
+	// a directory is not a script
+	dir := t.TempDir()
+	_, stderr, code := monkey(t, "", dir)
+	if !strings.HasPrefix(stderr, "monkey: unknown command \""+dir+"\"\n") || code != 2 {
+		t.Errorf("directory: wrong result, status %d:\n%s", code, stderr)
+	}
+}
+
+func TestScriptImports(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "lib.monkey"), []byte("let double = fn(x) { x * 2 };\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	main := filepath.Join(dir, "main.monkey")
+	if err := os.WriteFile(main, []byte("let lib = import(\"lib.monkey\");\nputs(lib[\"double\"](21));\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// imports are relative to the script, not the working directory
+	for _, args := range [][]string{
+		{main},
+		{"run", main},
+		{"run", "-engine", "vm", main},
+	} {
+		stdout, stderr, code := monkey(t, "", args...)
+		if stdout != "42\n" || code != 0 {
+			t.Errorf("%q: wrong result. want=%q, got=%q, status %d:\n%s", args, "42\n", stdout, code, stderr)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	return ins.Disassemble(nil)
+}
+
+// Disassemble lists the instructions like String, one per line with its
+// offset, and adds a comment saying what operands refer to: the target of
+// a jump, which is also marked with '>' where it occurs, and the constant
+// loaded by OpConstant or OpClosure, rendered by constant. A nil constant
+// leaves constants undescribed and turns off all annotations.
+func (ins Instructions) Disassemble(constant func(index int) string) string {
+	var out bytes.Buffer
+
+	targets := map[int]bool{}
+	if constant != nil {
+		for i := 0; i < len(ins); {
+			def, err := Lookup(ins[i])
+			if err != nil || !ins.complete(i, def) {
+				break
+			}
+			operands, read := ReadOperands(def, ins[i+1:])
+			if isJump(Opcode(ins[i])) {
+				targets[operands[0]] = true
+			}
+			i += 1 + read
+		}
+	}
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		if !ins.complete(i, def) {
+			fmt.Fprintf(&out, "ERROR: truncated instruction %s at %04d\n", def.Name, i)
+			break
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		line := fmt.Sprintf("%04d %s", i, ins.fmtInstruction(def, operands))
+
+		if constant != nil {
+			marker := "  "
+			if targets[i] {
+				marker = "> "
+			}
+
+			line = marker + line
+			switch op := Opcode(ins[i]); {
+			case isJump(op):
+				line = fmt.Sprintf("%-32s ; -> %04d", line, operands[0])
+			case op == OpConstant || op == OpClosure:
+				line = fmt.Sprintf("%-32s ; %s", line, constant(operands[0]))
+			}
+		}
+
+		fmt.Fprintln(&out, line)
+
+		i += 1 + read
+	}
+
+	// loops jump past their last instruction when they finish
+	if targets[len(ins)] {
+		fmt.Fprintf(&out, "> %04d end\n", len(ins))
+	}
+
+	return out.String()
+}
+
+// complete reports whether the instruction at offset i has all of its
+// operands.
+func (ins Instructions) complete(i int, def *Definition) bool {
+	width := 0
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	return i+1+width <= len(ins)
+}
+
+// isJump reports whether op jumps to the offset in its first operand.
+func isJump(op Opcode) bool {
+	return op == OpJump || op == OpJumpNotTruthy || op == OpJumpNotNull ||
+		op == OpIterNext || op == OpTry
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpPow
+
+	OpPop
+
+	OpTrue
+	OpFalse
+
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpGreaterThanOrEqual
+
+	OpMinus
+	OpBang
+
+	OpJumpNotTruthy
+	OpJump
+
+	OpIter
+	OpIterNext
+
+	OpNull
+
+	OpGetGlobal
+	OpSetGlobal
+
+	OpArray
+	OpHash
+	OpIndex
+	OpInterpolate
+
+	OpCall
+	OpReturnValue
+	OpReturn
+
+	OpGetLocal
+	OpSetLocal
+
+	OpClosure
+	OpGetFree
+
+	OpImport
+
+	OpTry
+	OpEndTry
+
+	OpUnpackArray
+	OpUnpackHash
+
+	OpCallSpread
+
+	OpRange
+	OpSlice
+
+	OpSetIndex
+
+	OpJumpNotNull
+
+	OpCurrentClosure
+
+	OpGetBuiltin
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+
+	OpAdd: {"OpAdd", []int{}},
+	OpSub: {"OpSub", []int{}},
+	OpMul: {"OpMul", []int{}},
+	OpDiv: {"OpDiv", []int{}},
+	OpMod: {"OpMod", []int{}},
+	OpPow: {"OpPow", []int{}},
+
+	OpPop: {"OpPop", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+
+	OpEqual:              {"OpEqual", []int{}},
+	OpNotEqual:           {"OpNotEqual", []int{}},
+	OpGreaterThan:        {"OpGreaterThan", []int{}},
+	OpGreaterThanOrEqual: {"OpGreaterThanOrEqual", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+
+	OpIter:     {"OpIter", []int{1}},
+	OpIterNext: {"OpIterNext", []int{2}},
+
+	OpNull: {"OpNull", []int{}},
+
+	OpGetGlobal: {"OpGetGlobal", []int{2}},
+	OpSetGlobal: {"OpSetGlobal", []int{2}},
+
+	OpArray:       {"OpArray", []int{2}},
+	OpHash:        {"OpHash", []int{2}},
+	OpIndex:       {"OpIndex", []int{}},
+	OpInterpolate: {"OpInterpolate", []int{2}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+
+	OpGetLocal: {"OpGetLocal", []int{1}},
+	OpSetLocal: {"OpSetLocal", []int{1}},
+
+	OpClosure: {"OpClosure", []int{2, 1}},
+	OpGetFree: {"OpGetFree", []int{1}},
+
+	OpImport: {"OpImport", []int{}},
+
+	OpTry:    {"OpTry", []int{2}},
+	OpEndTry: {"OpEndTry", []int{}},
+
+	OpUnpackArray: {"OpUnpackArray", []int{2}},
+	OpUnpackHash:  {"OpUnpackHash", []int{2}},
+
+	OpCallSpread: {"OpCallSpread", []int{1}},
+
+	OpRange: {"OpRange", []int{}},
+	OpSlice: {"OpSlice", []int{}},
+
+	OpSetIndex: {"OpSetIndex", []int{}},
+
+	OpJumpNotNull: {"OpJumpNotNull", []int{2}},
+
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+
+	OpGetBuiltin: {"OpGetBuiltin", []int{2}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Make encodes an instruction for op with the given operands.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction described by def
+// and returns them together with the number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 { return uint8(ins[0]) }
@@ -0,0 +1,966 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/evaluator"
+	"monkey/object"
+)
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+
+	// loops holds the loops being compiled in this scope, innermost last
+	loops []*loopContext
+
+	// tries counts the try blocks being compiled in this scope
+	tries int
+}
+
+// loopContext records where a loop starts, for continue, and the jumps
+// emitted for break that still need to be patched to the loop's end.
+type loopContext struct {
+	start  int
+	breaks []int
+
+	// tries is the number of try blocks open when the loop started
+	tries int
+}
+
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+}
+
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+}
+
+func New() *Compiler {
+	mainScope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: NewSymbolTable(),
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
+	}
+}
+
+// NewWithState creates a compiler that continues from the symbol table and
+// constants of a previous compilation, as the REPL does between lines.
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+
+	case *ast.ExpressionStatement:
+		err := c.Compile(node.Expression)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		if node.Pattern != nil {
+			return c.compileDestructuring(node)
+		}
+
+		if c.symbolTable.definedConst(node.Name.Value) {
+			return fmt.Errorf("cannot redeclare constant: %s", node.Name.Value)
+		}
+
+		var symbol Symbol
+		if node.IsConst() {
+			symbol = c.symbolTable.DefineConst(node.Name.Value)
+		} else {
+			symbol = c.symbolTable.Define(node.Name.Value)
+		}
+
+		var err error
+		if fl, ok := node.Value.(*ast.FunctionLiteral); ok && (symbol.Scope == LocalScope || symbol.inBlock) {
+			// A local function captures the variables it uses by value,
+			// when it is created, which is before it is bound to its
+			// name: it refers to itself through OpCurrentClosure instead.
+			// Globals are read when they are used, so global functions
+			// need no such care, unless they are defined in a block.
+			err = c.compileFunction(fl, &symbol)
+		} else {
+			err = c.Compile(node.Value)
+		}
+		if err != nil {
+			return err
+		}
+
+		c.storeSymbol(symbol)
+
+	case *ast.ForInStatement:
+		return c.compileForInStatement(node)
+
+	case *ast.BreakStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return fmt.Errorf("break outside of loop")
+		}
+		c.leaveTries(loop)
+		pos := c.emit(code.OpJump, 9999)
+		loop.breaks = append(loop.breaks, pos)
+
+	case *ast.ContinueStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return fmt.Errorf("continue outside of loop")
+		}
+		c.leaveTries(loop)
+		c.emit(code.OpJump, loop.start)
+
+	case *ast.ReturnStatement:
+		if node.ReturnValue == nil {
+			c.emit(code.OpReturn)
+			break
+		}
+
+		err := c.Compile(node.ReturnValue)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpReturnValue)
+
+	case *ast.Identifier:
+		symbol, ok := c.resolve(node.Value)
+		if !ok {
+			return fmt.Errorf("undefined variable %s", node.Value)
+		}
+
+		c.loadSymbol(symbol)
+
+	case *ast.AssignExpression:
+		symbol, ok := c.symbolTable.Resolve(node.Name.Value)
+		if !ok {
+			return fmt.Errorf("cannot assign to undeclared identifier: %s",
+				node.Name.Value)
+		}
+
+		if symbol.Const {
+			return fmt.Errorf("cannot assign to constant: %s", node.Name.Value)
+		}
+
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		switch symbol.Scope {
+		case GlobalScope:
+			c.emit(code.OpSetGlobal, symbol.Index)
+		case LocalScope:
+			c.emit(code.OpSetLocal, symbol.Index)
+		case BuiltinScope:
+			return fmt.Errorf("cannot assign to undeclared identifier: %s",
+				node.Name.Value)
+		default:
+			// Closures capture free variables by value, so an assignment
+			// could never be observed by the scope that owns the binding.
+			return fmt.Errorf("cannot assign to captured variable: %s",
+				node.Name.Value)
+		}
+
+		c.loadSymbol(symbol)
+
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+
+		if node.Operator == "??" {
+			return c.compileCoalesceExpression(node)
+		}
+
+		if node.Operator == "<" || node.Operator == "<=" {
+			err := c.Compile(node.Right)
+			if err != nil {
+				return err
+			}
+
+			err = c.Compile(node.Left)
+			if err != nil {
+				return err
+			}
+
+			if node.Operator == "<" {
+				c.emit(code.OpGreaterThan)
+			} else {
+				c.emit(code.OpGreaterThanOrEqual)
+			}
+			return nil
+		}
+
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "+":
+			c.emit(code.OpAdd)
+		case "-":
+			c.emit(code.OpSub)
+		case "*":
+			c.emit(code.OpMul)
+		case "/":
+			c.emit(code.OpDiv)
+		case "%":
+			c.emit(code.OpMod)
+		case "**":
+			c.emit(code.OpPow)
+		case ">":
+			c.emit(code.OpGreaterThan)
+		case ">=":
+			c.emit(code.OpGreaterThanOrEqual)
+		case "==":
+			c.emit(code.OpEqual)
+		case "!=":
+			c.emit(code.OpNotEqual)
+		case "..":
+			c.emit(code.OpRange)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.PrefixExpression:
+		err := c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.IfExpression:
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		// Emit an `OpJumpNotTruthy` with a bogus value
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		err = c.Compile(node.Consequence)
+		if err != nil {
+			return err
+		}
+
+		if c.lastInstructionIs(code.OpPop) {
+			c.removeLastPop()
+		} else {
+			c.emit(code.OpNull)
+		}
+
+		// Emit an `OpJump` with a bogus value
+		jumpPos := c.emit(code.OpJump, 9999)
+
+		afterConsequencePos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
+
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else {
+			err := c.Compile(node.Alternative)
+			if err != nil {
+				return err
+			}
+
+			if c.lastInstructionIs(code.OpPop) {
+				c.removeLastPop()
+			} else {
+				c.emit(code.OpNull)
+			}
+		}
+
+		afterAlternativePos := len(c.currentInstructions())
+		c.changeOperand(jumpPos, afterAlternativePos)
+
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
+
+	case *ast.MatchExpression:
+		return c.compileMatchExpression(node)
+
+	case *ast.IntegerLiteral:
+		integer := object.NewInt(node.Value)
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.TemplateLiteral:
+		for _, part := range node.Parts {
+			err := c.Compile(part)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpInterpolate, len(node.Parts))
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			err := c.Compile(el)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			err := c.Compile(pair.Key)
+			if err != nil {
+				return err
+			}
+
+			err = c.Compile(pair.Value)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpHash, len(node.Pairs)*2)
+
+	case *ast.IndexExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(node.Index)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpIndex)
+
+	case *ast.IndexAssignExpression:
+		for _, exp := range []ast.Expression{node.Left, node.Index, node.Value} {
+			err := c.Compile(exp)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpSetIndex)
+
+	case *ast.SliceExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		// an omitted bound is pushed as null
+		for _, bound := range []ast.Expression{node.Start, node.End} {
+			if bound == nil {
+				c.emit(code.OpNull)
+				continue
+			}
+			err := c.Compile(bound)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpSlice)
+
+	case *ast.ImportExpression:
+		err := c.Compile(node.Path)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpImport)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node, nil)
+
+	case *ast.MethodCallExpression:
+		// the builtin a method names depends on the receiver's type,
+		// which the VM does not check
+		return fmt.Errorf("method calls are not supported by the compiler: %s",
+			node.Method.Value)
+
+	case *ast.SpawnExpression:
+		return fmt.Errorf("spawn is not supported by the compiler")
+
+	case *ast.StructLiteral, *ast.FieldExpression:
+		return fmt.Errorf("structs are not supported by the compiler")
+
+	case *ast.CallExpression:
+		err := c.Compile(node.Function)
+		if err != nil {
+			return err
+		}
+
+		// a spread argument, always the last, is passed as the array
+		// that OpCallSpread unpacks
+		op := code.OpCall
+		for _, a := range node.Arguments {
+			if spread, ok := a.(*ast.SpreadExpression); ok {
+				a = spread.Value
+				op = code.OpCallSpread
+			}
+			err := c.Compile(a)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(op, len(node.Arguments))
+
+	default:
+		return fmt.Errorf("unsupported node %T", node)
+	}
+
+	return nil
+}
+
+// compileLogicalExpression compiles `&&` and `||` with jumps, so that the
+// right operand is skipped when the left one decides the result.
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+
+	// Jumps that are taken when the result is already known to be true
+	// or false respectively.
+	var trueJumps, falseJumps []int
+
+	if node.Operator == "&&" {
+		falseJumps = append(falseJumps, c.emit(code.OpJumpNotTruthy, 9999))
+	} else {
+		c.emit(code.OpBang)
+		trueJumps = append(trueJumps, c.emit(code.OpJumpNotTruthy, 9999))
+	}
+
+	err = c.Compile(node.Right)
+	if err != nil {
+		return err
+	}
+
+	falseJumps = append(falseJumps, c.emit(code.OpJumpNotTruthy, 9999))
+
+	for _, pos := range trueJumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	c.emit(code.OpTrue)
+	jumpEndPos := c.emit(code.OpJump, 9999)
+
+	for _, pos := range falseJumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	c.emit(code.OpFalse)
+
+	c.changeOperand(jumpEndPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// compileCoalesceExpression compiles `left ?? right`. OpJumpNotNull keeps
+// a non-null left operand as the result and skips the right one;
+// otherwise it drops the null and the right operand is evaluated instead.
+func (c *Compiler) compileCoalesceExpression(node *ast.InfixExpression) error {
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+
+	jumpPos := c.emit(code.OpJumpNotNull, 9999)
+
+	err = c.Compile(node.Right)
+	if err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	updatedInstructions := append(c.currentInstructions(), ins...)
+
+	c.scopes[c.scopeIndex].instructions = updatedInstructions
+
+	return posNewInstruction
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	old := c.currentInstructions()
+	new := old[:last.Position]
+
+	c.scopes[c.scopeIndex].instructions = new
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
+// compileForInStatement keeps the loop's iterator in a hidden variable
+// and, on every iteration, asks it for the next element until OpIterNext
+// jumps past the loop:
+//
+//	<iterable> OpIter; set $iter
+//	loop: get $iter; OpIterNext end; set key; set value; <body>; OpJump loop
+//	end:
+//
+// continue jumps back to loop and break jumps to end.
+func (c *Compiler) compileForInStatement(node *ast.ForInStatement) error {
+	err := c.Compile(node.Iterable)
+	if err != nil {
+		return err
+	}
+
+	numVars := 1
+	if node.Key != nil {
+		numVars = 2
+	}
+	c.emit(code.OpIter, numVars)
+
+	// the loop variables and the lets of the body are the loop's own, as
+	// on the evaluator, which binds them anew for each element
+	outer := c.symbolTable
+	c.symbolTable = NewBlockSymbolTable(outer)
+	defer func() { c.symbolTable = outer }()
+
+	// `$` can't appear in identifiers, so the name never clashes
+	iter := c.symbolTable.Define("$iter")
+	c.storeSymbol(iter)
+
+	loop := &loopContext{
+		start: len(c.currentInstructions()),
+		tries: c.scopes[c.scopeIndex].tries,
+	}
+	c.loadSymbol(iter)
+	iterNextPos := c.emit(code.OpIterNext, 9999)
+
+	names := []*ast.Identifier{node.Value}
+	if node.Key != nil {
+		names = append(names, node.Key)
+	}
+	for _, name := range names {
+		if c.symbolTable.definedConst(name.Value) {
+			return fmt.Errorf("cannot redeclare constant: %s", name.Value)
+		}
+		c.storeSymbol(c.symbolTable.Define(name.Value))
+	}
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, loop)
+	err = c.Compile(node.Body)
+	scope = &c.scopes[c.scopeIndex]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpJump, loop.start)
+
+	end := len(c.currentInstructions())
+	c.changeOperand(iterNextPos, end)
+	for _, pos := range loop.breaks {
+		c.changeOperand(pos, end)
+	}
+
+	return nil
+}
+
+// compileTryExpression installs a handler for the block with OpTry, which
+// the VM jumps to with the error's message on the stack when the block
+// fails, and removes it with OpEndTry once the block is done:
+//
+//	OpTry catch; <block>; OpEndTry; OpJump end
+//	catch: set param; <handler>
+//	end:
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	tryPos := c.emit(code.OpTry, 9999)
+
+	c.scopes[c.scopeIndex].tries++
+	err := c.compileBlockValue(node.Block)
+	c.scopes[c.scopeIndex].tries--
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpEndTry)
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+	if c.symbolTable.definedConst(node.Param.Value) {
+		return fmt.Errorf("cannot redeclare constant: %s", node.Param.Value)
+	}
+	c.storeSymbol(c.symbolTable.Define(node.Param.Value))
+
+	if err := c.compileBlockValue(node.Handler); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileMatchExpression keeps the subject in a hidden variable that each
+// arm's pattern is compared with, jumping to the next arm if they differ:
+//
+//	<subject>; set $match
+//	get $match; <pattern>; OpEqual; OpJumpNotTruthy next; <body>; OpJump end
+//	next: ...
+//	OpNull
+//	end:
+//
+// The `_` arm has no comparison, and null is the value when no arm matches.
+func (c *Compiler) compileMatchExpression(node *ast.MatchExpression) error {
+	if err := c.Compile(node.Subject); err != nil {
+		return err
+	}
+	subject := c.symbolTable.Define("$match")
+	c.storeSymbol(subject)
+
+	var jumps []int
+	for _, arm := range node.Arms {
+		next := -1
+		if arm.Pattern != nil {
+			c.loadSymbol(subject)
+			if err := c.Compile(arm.Pattern); err != nil {
+				return err
+			}
+			c.emit(code.OpEqual)
+			next = c.emit(code.OpJumpNotTruthy, 9999)
+		}
+
+		if err := c.Compile(arm.Body); err != nil {
+			return err
+		}
+		jumps = append(jumps, c.emit(code.OpJump, 9999))
+
+		if next != -1 {
+			c.changeOperand(next, len(c.currentInstructions()))
+		}
+	}
+
+	c.emit(code.OpNull)
+
+	for _, pos := range jumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// compileBlockValue compiles a block that leaves its value on the stack,
+// null for a block that does not end in an expression.
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+// leaveTries removes the handlers of the try blocks that break or
+// continue jumps out of.
+func (c *Compiler) leaveTries(loop *loopContext) {
+	for i := loop.tries; i < c.scopes[c.scopeIndex].tries; i++ {
+		c.emit(code.OpEndTry)
+	}
+}
+
+// currentLoop returns the innermost loop of the current scope, or nil
+// outside of a loop.
+func (c *Compiler) currentLoop() *loopContext {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
+// compileDestructuring compiles `let [a, b] = ...` and `let {a, b} = ...`.
+// OpUnpackArray and OpUnpackHash replace the value with the ones bound to
+// the names, the first on top, so that they are stored in order. A hash
+// is unpacked by the keys pushed after it.
+func (c *Compiler) compileDestructuring(ls *ast.LetStatement) error {
+	names := ls.Pattern.Names
+	for _, name := range names {
+		if c.symbolTable.definedConst(name.Value) {
+			return fmt.Errorf("cannot redeclare constant: %s", name.Value)
+		}
+	}
+
+	err := c.Compile(ls.Value)
+	if err != nil {
+		return err
+	}
+
+	if ls.Pattern.IsHash() {
+		for _, name := range names {
+			key := &object.String{Value: name.Value}
+			c.emit(code.OpConstant, c.addConstant(key))
+		}
+		c.emit(code.OpUnpackHash, len(names))
+	} else {
+		c.emit(code.OpUnpackArray, len(names))
+	}
+
+	for _, name := range names {
+		var symbol Symbol
+		if ls.IsConst() {
+			symbol = c.symbolTable.DefineConst(name.Value)
+		} else {
+			symbol = c.symbolTable.Define(name.Value)
+		}
+		c.storeSymbol(symbol)
+	}
+
+	return nil
+}
+
+// compileFunction compiles fl into a closure. If name is not nil, it is the
+// symbol fl is being bound to, which the body can use to refer to fl.
+func (c *Compiler) compileFunction(fl *ast.FunctionLiteral, name *Symbol) error {
+	c.enterScope()
+
+	if name != nil {
+		c.symbolTable.DefineFunctionName(name.Name, name.Const)
+	}
+	for _, p := range fl.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+
+	err := c.Compile(fl.Body)
+	if err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	instructions := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.loadSymbol(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(fl.Parameters),
+		Variadic:      fl.Variadic,
+	}
+
+	fnIndex := c.addConstant(compiledFn)
+	c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+	return nil
+}
+
+// resolve looks name up in the symbol table. A name that is not defined
+// there but is a builtin function is defined in the global table the
+// first time it is used, with its name as a constant for OpGetBuiltin:
+// the VM looks builtins up by name, the way the evaluator does, because
+// which builtins exist depends on what the host registered, and bytecode
+// may be run by another host than the one that compiled it.
+func (c *Compiler) resolve(name string) (Symbol, bool) {
+	if symbol, ok := c.symbolTable.Resolve(name); ok {
+		return symbol, true
+	}
+	if !evaluator.IsBuiltin(name) {
+		return Symbol{}, false
+	}
+
+	global := c.symbolTable
+	for global.Outer != nil {
+		global = global.Outer
+	}
+	index := c.addConstant(&object.String{Value: name})
+	return global.DefineBuiltin(index, name), true
+}
+
+func (c *Compiler) storeSymbol(s Symbol) {
+	if s.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, s.Index)
+	} else {
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	}
+}
@@ -0,0 +1,44 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/object"
+)
+
+// Disassemble lists the main program's instructions followed by those of
+// every compiled function in the constant pool, with constants and jump
+// targets annotated as in code.Instructions.Disassemble.
+func (b *Bytecode) Disassemble() string {
+	var out bytes.Buffer
+
+	out.WriteString("main:\n")
+	out.WriteString(b.Instructions.Disassemble(b.describeConstant))
+
+	for i, c := range b.Constants {
+		fn, ok := c.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&out, "\nconstant %d: fn (%d params, %d locals):\n",
+			i, fn.NumParameters, fn.NumLocals)
+		out.WriteString(fn.Instructions.Disassemble(b.describeConstant))
+	}
+
+	return out.String()
+}
+
+func (b *Bytecode) describeConstant(index int) string {
+	if index < 0 || index >= len(b.Constants) {
+		return fmt.Sprintf("<no constant %d>", index)
+	}
+
+	switch c := b.Constants[index].(type) {
+	case *object.String:
+		return fmt.Sprintf("%q", c.Value)
+	case *object.CompiledFunction:
+		return fmt.Sprintf("fn (constant %d)", index)
+	default:
+		return c.Inspect()
+	}
+}
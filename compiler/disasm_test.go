@@ -0,0 +1,34 @@
+package compiler
+
+import "testing"
+
+func TestBytecodeDisassemble(t *testing.T) {
+	input := `let f = fn(x) { if (x) { "yes" } else { 2 } }; f(true);`
+
+	expected := `main:
+  0000 OpClosure 2 0             ; fn (constant 2)
+  0004 OpSetGlobal 0
+  0007 OpGetGlobal 0
+  0010 OpTrue
+  0011 OpCall 1
+  0013 OpPop
+
+constant 2: fn (1 params, 1 locals):
+  0000 OpGetLocal 0
+  0002 OpJumpNotTruthy 11        ; -> 0011
+  0005 OpConstant 0              ; "yes"
+  0008 OpJump 14                 ; -> 0014
+> 0011 OpConstant 1              ; 2
+> 0014 OpReturnValue
+`
+
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	got := compiler.Bytecode().Disassemble()
+	if got != expected {
+		t.Errorf("bytecode wrongly disassembled.\nwant=%q\ngot=%q", expected, got)
+	}
+}
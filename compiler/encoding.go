@@ -0,0 +1,183 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"monkey/code"
+	"monkey/object"
+)
+
+// The encoding lives here rather than in package code because it needs
+// the object package, which itself depends on code.
+
+// EncodingVersion is the version of the bytecode file format written by
+// Encode. Decode rejects files of any other version.
+const EncodingVersion = 2
+
+// encodingMagic starts every bytecode file.
+var encodingMagic = []byte("\x00mkb")
+
+// Tags identifying the type of an encoded constant.
+const (
+	tagInteger byte = iota + 1
+	tagFloat
+	tagString
+	tagCompiledFunction
+)
+
+// Encode writes bytecode to w, so that it can be run later without
+// compiling the program again. The format is a magic number, a version,
+// the main instructions and the constants, all in big endian:
+//
+//	"\x00mkb" version:uint16
+//	len:uint32 instructions
+//	count:uint32 (tag:uint8 constant)...
+func Encode(w io.Writer, bytecode *Bytecode) error {
+	var buf bytes.Buffer
+
+	buf.Write(encodingMagic)
+	binary.Write(&buf, binary.BigEndian, uint16(EncodingVersion))
+	writeBytes(&buf, bytecode.Instructions)
+
+	binary.Write(&buf, binary.BigEndian, uint32(len(bytecode.Constants)))
+	for i, constant := range bytecode.Constants {
+		switch constant := constant.(type) {
+		case *object.Integer:
+			buf.WriteByte(tagInteger)
+			binary.Write(&buf, binary.BigEndian, constant.Value)
+		case *object.Float:
+			buf.WriteByte(tagFloat)
+			binary.Write(&buf, binary.BigEndian, math.Float64bits(constant.Value))
+		case *object.String:
+			buf.WriteByte(tagString)
+			writeBytes(&buf, []byte(constant.Value))
+		case *object.CompiledFunction:
+			buf.WriteByte(tagCompiledFunction)
+			binary.Write(&buf, binary.BigEndian, uint32(constant.NumLocals))
+			binary.Write(&buf, binary.BigEndian, uint32(constant.NumParameters))
+			if constant.Variadic {
+				buf.WriteByte(1)
+			} else {
+				buf.WriteByte(0)
+			}
+			writeBytes(&buf, constant.Instructions)
+		default:
+			return fmt.Errorf("cannot encode constant %d of type %s", i, constant.Type())
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeBytes(buf *bytes.Buffer, b []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(b)))
+	buf.Write(b)
+}
+
+// Decode reads bytecode written by Encode.
+func Decode(r io.Reader) (*Bytecode, error) {
+	d := &decoder{r: r}
+
+	magic := d.bytes(len(encodingMagic))
+	if d.err != nil || !bytes.Equal(magic, encodingMagic) {
+		return nil, errors.New("not a Monkey bytecode file")
+	}
+
+	if version := d.uint16(); d.err == nil && version != EncodingVersion {
+		return nil, fmt.Errorf("unsupported bytecode version %d, want %d",
+			version, EncodingVersion)
+	}
+
+	bytecode := &Bytecode{Instructions: code.Instructions(d.bytes(int(d.uint32())))}
+
+	count := d.uint32()
+	for i := uint32(0); i < count && d.err == nil; i++ {
+		var constant object.Object
+
+		switch tag := d.byte(); tag {
+		case tagInteger:
+			constant = object.NewInt(int64(d.uint64()))
+		case tagFloat:
+			constant = &object.Float{Value: math.Float64frombits(d.uint64())}
+		case tagString:
+			constant = &object.String{Value: string(d.bytes(int(d.uint32())))}
+		case tagCompiledFunction:
+			fn := &object.CompiledFunction{}
+			fn.NumLocals = int(d.uint32())
+			fn.NumParameters = int(d.uint32())
+			fn.Variadic = d.byte() == 1
+			fn.Instructions = code.Instructions(d.bytes(int(d.uint32())))
+			constant = fn
+		default:
+			if d.err == nil {
+				return nil, fmt.Errorf("unknown constant tag %d", tag)
+			}
+		}
+
+		bytecode.Constants = append(bytecode.Constants, constant)
+	}
+
+	if d.err != nil {
+		return nil, fmt.Errorf("reading bytecode: %w", d.err)
+	}
+	return bytecode, nil
+}
+
+// decoder reads big-endian values, remembering the first error so that
+// Decode only has to check once.
+type decoder struct {
+	r   io.Reader
+	err error
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+
+	// copying grows the buffer as data arrives, so a corrupt length
+	// can't make us allocate more than the input holds
+	var buf bytes.Buffer
+	_, d.err = io.CopyN(&buf, d.r, int64(n))
+	if d.err == io.EOF {
+		d.err = io.ErrUnexpectedEOF
+	}
+	return buf.Bytes()
+}
+
+func (d *decoder) byte() byte {
+	b := d.bytes(1)
+	if d.err != nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) uint16() uint16 {
+	b := d.bytes(2)
+	if d.err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+func (d *decoder) uint32() uint32 {
+	b := d.bytes(4)
+	if d.err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (d *decoder) uint64() uint64 {
+	b := d.bytes(8)
+	if d.err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
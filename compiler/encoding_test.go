@@ -0,0 +1,75 @@
+package compiler
+
+import (
+	"bytes"
+	"monkey/object"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	program := parse(`
+	let add = fn(a, b) { let c = a + b; c };
+	let all = fn(xs...) { xs };
+	add(1, 2.5);
+	"héllo";
+	`)
+
+	comp := New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, bytecode); err != nil {
+		t.Fatalf("Encode failed: %s", err)
+	}
+
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	if !bytes.Equal(decoded.Instructions, bytecode.Instructions) {
+		t.Errorf("wrong instructions.\nwant=%q\ngot=%q",
+			bytecode.Instructions, decoded.Instructions)
+	}
+
+	if !reflect.DeepEqual(decoded.Constants, bytecode.Constants) {
+		t.Errorf("wrong constants.\nwant=%#v\ngot=%#v", bytecode.Constants, decoded.Constants)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var valid bytes.Buffer
+	Encode(&valid, &Bytecode{
+		Instructions: []byte{1, 2, 3},
+		Constants:    []object.Object{&object.String{Value: "abc"}},
+	})
+	data := valid.Bytes()
+
+	tests := []struct {
+		input    []byte
+		expected string
+	}{
+		{[]byte("monkey"), "not a Monkey bytecode file"},
+		{[]byte("\x00mk"), "not a Monkey bytecode file"},
+		{[]byte("\x00mkb\x00\x09"), "unsupported bytecode version 9, want 2"},
+		{data[:len(data)-1], "reading bytecode: unexpected EOF"},
+		{append(append([]byte{}, data[:len(data)-8]...), 99), "unknown constant tag 99"},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode(bytes.NewReader(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	err := Encode(&bytes.Buffer{}, &Bytecode{Constants: []object.Object{object.TRUE}})
+	if err == nil || !strings.Contains(err.Error(), "BOOLEAN") {
+		t.Errorf("encoding a boolean constant should fail. got=%v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package compiler
+
+import "sort"
+
+type SymbolScope string
+
+const (
+	GlobalScope SymbolScope = "GLOBAL"
+	LocalScope  SymbolScope = "LOCAL"
+	FreeScope   SymbolScope = "FREE"
+
+	// FunctionScope is the scope of the name a function is bound to by a
+	// let statement, inside the function itself: it resolves to the
+	// closure being run, so that the function can call itself.
+	FunctionScope SymbolScope = "FUNCTION"
+
+	// BuiltinScope is the scope of the builtin functions. The index of a
+	// builtin symbol is that of the constant holding its name.
+	BuiltinScope SymbolScope = "BUILTIN"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	Const bool
+
+	// inBlock is set for globals defined in a block, which functions
+	// capture like locals, since each run of the block has its own
+	inBlock bool
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	// block is set for the table of a block, which has names of its own
+	// but takes their slots from the function, or the globals, it is part
+	// of
+	block bool
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := make(map[string]Symbol)
+	free := []Symbol{}
+	return &SymbolTable{store: s, FreeSymbols: free}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// NewBlockSymbolTable creates the table of a block within outer's scope,
+// like the body of a for loop. Names defined in it shadow outer's until
+// the block ends, but take the slots of the function, or the globals, the
+// block is part of, since blocks have no frames of their own.
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+	return s
+}
+
+func (s *SymbolTable) Define(name string) Symbol {
+	owner := s
+	for owner.block {
+		owner = owner.Outer
+	}
+
+	symbol := Symbol{Name: name, Index: owner.numDefinitions}
+	if owner.Outer == nil {
+		symbol.Scope = GlobalScope
+		symbol.inBlock = s.block
+	} else {
+		symbol.Scope = LocalScope
+	}
+
+	s.store[name] = symbol
+	owner.numDefinitions++
+	return symbol
+}
+
+// DefineConst defines name like Define, but marks it as a constant.
+func (s *SymbolTable) DefineConst(name string) Symbol {
+	symbol := s.Define(name)
+	symbol.Const = true
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineFunctionName defines name as referring to the function whose
+// scope this table is. It takes no local slot, and parameters and locals
+// of the same name shadow it.
+func (s *SymbolTable) DefineFunctionName(name string, isConst bool) Symbol {
+	symbol := Symbol{Name: name, Scope: FunctionScope, Index: 0, Const: isConst}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineBuiltin defines name as the builtin function whose name is the
+// constant at index. Like DefineFunctionName, it takes no slot, and
+// variables of the same name shadow it.
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Scope: BuiltinScope, Index: index}
+	s.store[name] = symbol
+	return symbol
+}
+
+// definedConst reports whether name was defined as a constant in this
+// table itself, not in an enclosing one.
+func (s *SymbolTable) definedConst(name string) bool {
+	symbol, ok := s.store[name]
+	return ok && symbol.Const &&
+		(symbol.Scope == GlobalScope || symbol.Scope == LocalScope)
+}
+
+// Symbols returns the symbols defined in this table itself, excluding
+// free symbols and the function name, ordered by index.
+func (s *SymbolTable) Symbols() []Symbol {
+	symbols := []Symbol{}
+	for _, symbol := range s.store {
+		if symbol.Scope == GlobalScope || symbol.Scope == LocalScope {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		return symbols[i].Index < symbols[j].Index
+	})
+	return symbols
+}
+
+// Resolve looks name up in this table and its enclosing tables. Locals of
+// an enclosing function, and globals of an enclosing block, are turned into
+// free symbols of this table.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	obj, ok := s.store[name]
+	if !ok && s.Outer != nil {
+		obj, ok = s.Outer.Resolve(name)
+		if !ok || s.block {
+			return obj, ok
+		}
+
+		if (obj.Scope == GlobalScope && !obj.inBlock) || obj.Scope == BuiltinScope {
+			return obj, ok
+		}
+
+		free := s.defineFree(obj)
+		return free, true
+	}
+
+	return obj, ok
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1}
+	symbol.Scope = FreeScope
+	symbol.Const = original.Const
+
+	s.store[original.Name] = symbol
+	return symbol
+}
@@ -0,0 +1,199 @@
+package compiler
+
+import "testing"
+
+func TestDefine(t *testing.T) {
+	expected := map[string]Symbol{
+		"a": {Name: "a", Scope: GlobalScope, Index: 0},
+		"b": {Name: "b", Scope: GlobalScope, Index: 1},
+		"c": {Name: "c", Scope: LocalScope, Index: 0},
+		"d": {Name: "d", Scope: LocalScope, Index: 1},
+	}
+
+	global := NewSymbolTable()
+	a := global.Define("a")
+	b := global.Define("b")
+
+	local := NewEnclosedSymbolTable(global)
+	c := local.Define("c")
+	d := local.Define("d")
+
+	for name, got := range map[string]Symbol{"a": a, "b": b, "c": c, "d": d} {
+		if got != expected[name] {
+			t.Errorf("expected %s=%+v, got=%+v", name, expected[name], got)
+		}
+	}
+}
+
+func TestDefineConst(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	b := global.DefineConst("b")
+
+	expected := Symbol{Name: "b", Scope: GlobalScope, Index: 1, Const: true}
+	if b != expected {
+		t.Errorf("expected b=%+v, got=%+v", expected, b)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	local.DefineConst("c")
+	inner := NewEnclosedSymbolTable(local)
+
+	for _, name := range []string{"b", "c"} {
+		sym, ok := inner.Resolve(name)
+		if !ok || !sym.Const {
+			t.Errorf("expected %s to resolve to a constant, got=%+v", name, sym)
+		}
+	}
+
+	if !global.definedConst("b") || global.definedConst("a") {
+		t.Errorf("definedConst wrong for global table")
+	}
+	if inner.definedConst("c") {
+		t.Errorf("free symbol c should not count as defined in inner table")
+	}
+}
+
+func TestDefineFunctionName(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	local := NewEnclosedSymbolTable(global)
+	local.DefineFunctionName("f", false)
+
+	nested := NewEnclosedSymbolTable(local)
+
+	expected := map[*SymbolTable]Symbol{
+		local:  {Name: "f", Scope: FunctionScope, Index: 0},
+		nested: {Name: "f", Scope: FreeScope, Index: 0},
+	}
+	for table, sym := range expected {
+		result, ok := table.Resolve("f")
+		if !ok {
+			t.Fatalf("function name %s not resolvable", sym.Name)
+		}
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+
+	if local.numDefinitions != 0 || len(local.Symbols()) != 0 {
+		t.Errorf("function name should not take a local slot")
+	}
+
+	local.Define("f")
+	if result, _ := local.Resolve("f"); result.Scope != LocalScope {
+		t.Errorf("local f should shadow the function name, got=%+v", result)
+	}
+}
+
+func TestDefineBuiltin(t *testing.T) {
+	global := NewSymbolTable()
+	firstLocal := NewEnclosedSymbolTable(global)
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+
+	expected := Symbol{Name: "len", Scope: BuiltinScope, Index: 3}
+	if result := global.DefineBuiltin(3, "len"); result != expected {
+		t.Errorf("expected len=%+v, got=%+v", expected, result)
+	}
+
+	for _, table := range []*SymbolTable{global, firstLocal, secondLocal} {
+		result, ok := table.Resolve("len")
+		if !ok {
+			t.Fatalf("name len not resolvable")
+		}
+		if result != expected {
+			t.Errorf("expected len to resolve to %+v, got=%+v", expected, result)
+		}
+	}
+	if len(secondLocal.FreeSymbols) != 0 {
+		t.Errorf("builtins should not become free symbols, got=%+v", secondLocal.FreeSymbols)
+	}
+	if len(global.Symbols()) != 0 {
+		t.Errorf("builtins should not be listed as symbols, got=%+v", global.Symbols())
+	}
+}
+
+func TestDefineBlock(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	block := NewBlockSymbolTable(global)
+	a := block.Define("a")
+	expected := Symbol{Name: "a", Scope: GlobalScope, Index: 1, inBlock: true}
+	if a != expected {
+		t.Errorf("expected a=%+v, got=%+v", expected, a)
+	}
+	if global.numDefinitions != 2 || block.numDefinitions != 0 {
+		t.Errorf("block should take slots of the globals. got global=%d, block=%d",
+			global.numDefinitions, block.numDefinitions)
+	}
+
+	// functions in the block capture its globals
+	local := NewEnclosedSymbolTable(block)
+	sym, ok := local.Resolve("a")
+	if !ok || sym != (Symbol{Name: "a", Scope: FreeScope, Index: 0}) {
+		t.Errorf("expected a to resolve to a free symbol, got=%+v", sym)
+	}
+
+	// blocks within functions take the function's slots
+	fn := NewEnclosedSymbolTable(global)
+	fn.Define("p")
+	inner := NewBlockSymbolTable(NewBlockSymbolTable(fn))
+	if b := inner.Define("b"); b != (Symbol{Name: "b", Scope: LocalScope, Index: 1}) {
+		t.Errorf("expected b to be the second local, got=%+v", b)
+	}
+	if sym, ok := inner.Resolve("p"); !ok || sym.Scope != LocalScope {
+		t.Errorf("expected p to resolve to a local, got=%+v", sym)
+	}
+
+	if sym, ok := global.Resolve("a"); !ok || sym.Index != 0 {
+		t.Errorf("block should not change global a, got=%+v", sym)
+	}
+}
+
+func TestResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("c")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("e")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "c", Scope: FreeScope, Index: 0},
+		{Name: "e", Scope: LocalScope, Index: 0},
+	}
+
+	for _, sym := range expected {
+		result, ok := secondLocal.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v",
+				sym.Name, sym, result)
+		}
+	}
+
+	expectedFree := []Symbol{{Name: "c", Scope: LocalScope, Index: 0}}
+	if len(secondLocal.FreeSymbols) != len(expectedFree) {
+		t.Fatalf("wrong number of free symbols. got=%d, want=%d",
+			len(secondLocal.FreeSymbols), len(expectedFree))
+	}
+
+	for i, sym := range expectedFree {
+		if secondLocal.FreeSymbols[i] != sym {
+			t.Errorf("wrong free symbol. got=%+v, want=%+v",
+				secondLocal.FreeSymbols[i], sym)
+		}
+	}
+
+	if _, ok := secondLocal.Resolve("unknown"); ok {
+		t.Errorf("name unknown resolved, but was expected not to")
+	}
+}
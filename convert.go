@@ -0,0 +1,173 @@
+package monkey
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"monkey/object"
+	"reflect"
+)
+
+// ToObject converts a Go value to a Monkey object. It accepts nil, bools,
+// integers, *big.Int, floats, strings, slices, arrays and maps of convertible
+// values, and objects, which are returned as they are. Map keys must
+// convert to integers, booleans or strings.
+func ToObject(value interface{}) (object.Object, error) {
+	switch value := value.(type) {
+	case nil:
+		return object.NULL, nil
+	case object.Object:
+		return value, nil
+	case bool:
+		if value {
+			return object.TRUE, nil
+		}
+		return object.FALSE, nil
+	case string:
+		return &object.String{Value: value}, nil
+	case *big.Int:
+		if value == nil {
+			return object.NULL, nil
+		}
+		return object.NewInteger(new(big.Int).Set(value)), nil
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return object.NewInt(v.Int()), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > 1<<63-1 {
+			return nil, fmt.Errorf("monkey: %d overflows INTEGER", v.Uint())
+		}
+		return object.NewInt(int64(v.Uint())), nil
+
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: v.Float()}, nil
+
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+
+	case reflect.Bool:
+		return ToObject(v.Bool())
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return object.NULL, nil
+		}
+
+		elements := make([]object.Object, v.Len())
+		for i := range elements {
+			elem, err := ToObject(v.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = elem
+		}
+		return &object.Array{Elements: elements}, nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return object.NULL, nil
+		}
+
+		pairs := make(map[object.HashKey]object.HashPair, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := ToObject(iter.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("monkey: unusable as hash key: %s", key.Type())
+			}
+
+			val, err := ToObject(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: val}
+		}
+		return &object.Hash{Pairs: pairs}, nil
+
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return object.NULL, nil
+		}
+		return ToObject(v.Elem().Interface())
+	}
+
+	return nil, fmt.Errorf("monkey: cannot convert %T to an object", value)
+}
+
+// ToGo converts a Monkey object to a Go value: integers to int64, big
+// integers to *big.Int, floats to float64, strings, booleans, null to nil, arrays to []interface{} and
+// hashes to map[interface{}]interface{}. Other objects, such as
+// functions, are returned as they are. Arrays and hashes that contain
+// themselves have no Go value and give an error.
+func ToGo(obj object.Object) (interface{}, error) {
+	return toGo(obj, map[object.Object]bool{})
+}
+
+// toGo converts obj, failing if it reaches one of the arrays and hashes
+// in visiting, which contain it.
+func toGo(obj object.Object, visiting map[object.Object]bool) (interface{}, error) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.BigInteger:
+		return new(big.Int).Set(obj.Value), nil
+	case *object.Float:
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Null:
+		return nil, nil
+
+	case *object.Array:
+		if visiting[obj] {
+			return nil, errCyclic
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		elements := make([]interface{}, len(obj.Elements))
+		for i, elem := range obj.Elements {
+			val, err := toGo(elem, visiting)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = val
+		}
+		return elements, nil
+
+	case *object.Hash:
+		if visiting[obj] {
+			return nil, errCyclic
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		m := make(map[interface{}]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			key, err := toGo(pair.Key, visiting)
+			if err != nil {
+				return nil, err
+			}
+			val, err := toGo(pair.Value, visiting)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = val
+		}
+		return m, nil
+	}
+
+	return obj, nil
+}
+
+var errCyclic = errors.New("monkey: cannot convert a value that contains itself")
@@ -0,0 +1,123 @@
+// Package coverage records which lines of a Monkey program run on the
+// evaluator, and writes the result as an annotated listing of the source
+// or in the LCOV format read by coverage tools.
+package coverage
+
+import (
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"sort"
+	"strings"
+)
+
+// Coverage is an evaluator.Hook that counts how often each statement of a
+// program runs. A line is covered when a statement on it ran.
+type Coverage struct {
+	counts map[ast.Statement]int
+}
+
+// New creates the coverage of program, which has not run yet. Only the
+// statements of program count, not those of modules it imports.
+func New(program *ast.Program) *Coverage {
+	c := &Coverage{counts: map[ast.Statement]int{}}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		if stmt, ok := node.(ast.Statement); ok {
+			// blocks only group the statements that count
+			if _, ok := stmt.(*ast.BlockStatement); !ok {
+				c.counts[stmt] = 0
+			}
+		}
+		return true
+	})
+
+	return c
+}
+
+func (c *Coverage) Before(node ast.Node, env *object.Environment, stack []evaluator.Frame) {
+	if stmt, ok := node.(ast.Statement); ok {
+		if _, ok := c.counts[stmt]; ok {
+			c.counts[stmt]++
+		}
+	}
+}
+
+// Lines returns how often each line with statements ran, as the count of
+// its most often run statement.
+func (c *Coverage) Lines() map[int]int {
+	lines := map[int]int{}
+	for stmt, count := range c.counts {
+		line := ast.Pos(stmt).Line
+		if count >= lines[line] {
+			lines[line] = count
+		}
+	}
+	return lines
+}
+
+// Covered returns how many of the lines with statements ran, out of all of
+// them.
+func (c *Coverage) Covered() (covered, total int) {
+	for _, count := range c.Lines() {
+		if count > 0 {
+			covered++
+		}
+		total++
+	}
+	return covered, total
+}
+
+// Percent returns the percentage of the lines with statements that ran,
+// which is 100 for a program without any.
+func (c *Coverage) Percent() float64 {
+	covered, total := c.Covered()
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(covered) / float64(total)
+}
+
+// WriteListing writes source to w with each line prefixed by how often it
+// ran, "#####" if it never did and "-" if it has no statements.
+func (c *Coverage) WriteListing(w io.Writer, source string) {
+	lines := c.Lines()
+
+	for i, text := range strings.Split(strings.TrimSuffix(source, "\n"), "\n") {
+		count, ok := lines[i+1]
+		prefix := fmt.Sprint(count)
+		switch {
+		case !ok:
+			prefix = "-"
+		case count == 0:
+			prefix = "#####"
+		}
+
+		if text == "" {
+			fmt.Fprintf(w, "%8s:\n", prefix)
+		} else {
+			fmt.Fprintf(w, "%8s: %s\n", prefix, text)
+		}
+	}
+}
+
+// WriteLCOV writes the coverage to w as an LCOV record for the source file
+// at path.
+func (c *Coverage) WriteLCOV(w io.Writer, path string) {
+	lines := c.Lines()
+
+	numbers := make([]int, 0, len(lines))
+	for line := range lines {
+		numbers = append(numbers, line)
+	}
+	sort.Ints(numbers)
+
+	fmt.Fprintf(w, "TN:\nSF:%s\n", path)
+	for _, line := range numbers {
+		fmt.Fprintf(w, "DA:%d,%d\n", line, lines[line])
+	}
+	covered, total := c.Covered()
+	fmt.Fprintf(w, "LF:%d\nLH:%d\nend_of_record\n", total, covered)
+}
@@ -0,0 +1,108 @@
+package coverage
+
+import (
+	"bytes"
+	"context"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+const source = `let abs = fn(n) {
+  if (n < 0) {
+    return -n;
+  }
+  n
+};
+
+abs(1); abs(2);
+`
+
+func TestCoverage(t *testing.T) {
+	c := run(t, source)
+
+	expected := map[int]int{1: 1, 2: 2, 3: 0, 5: 2, 8: 1}
+	lines := c.Lines()
+	if len(lines) != len(expected) {
+		t.Fatalf("wrong lines. want=%v, got=%v", expected, lines)
+	}
+	for line, count := range expected {
+		if lines[line] != count {
+			t.Errorf("wrong count for line %d. want=%d, got=%d", line, count, lines[line])
+		}
+	}
+
+	if covered, total := c.Covered(); covered != 4 || total != 5 {
+		t.Errorf("wrong coverage. want=4/5, got=%d/%d", covered, total)
+	}
+	if c.Percent() != 80 {
+		t.Errorf("wrong percentage. want=80, got=%v", c.Percent())
+	}
+}
+
+func TestWriteListing(t *testing.T) {
+	c := run(t, source)
+
+	var out bytes.Buffer
+	c.WriteListing(&out, source)
+
+	expected := `       1: let abs = fn(n) {
+       2:   if (n < 0) {
+   #####:     return -n;
+       -:   }
+       2:   n
+       -: };
+       -:
+       1: abs(1); abs(2);
+`
+	if out.String() != expected {
+		t.Errorf("wrong listing. want=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestWriteLCOV(t *testing.T) {
+	c := run(t, source)
+
+	var out bytes.Buffer
+	c.WriteLCOV(&out, "abs.monkey")
+
+	expected := `TN:
+SF:abs.monkey
+DA:1,1
+DA:2,2
+DA:3,0
+DA:5,2
+DA:8,1
+LF:5
+LH:4
+end_of_record
+`
+	if out.String() != expected {
+		t.Errorf("wrong LCOV. want=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestEmptyProgram(t *testing.T) {
+	c := run(t, "")
+	if c.Percent() != 100 {
+		t.Errorf("wrong percentage. want=100, got=%v", c.Percent())
+	}
+}
+
+func run(t *testing.T, input string) *Coverage {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+
+	c := New(program)
+	config := evaluator.Config{Hook: c}
+	result := evaluator.EvalWithConfig(context.Background(), program, object.NewEnvironment(), config)
+	if errObj, ok := result.(*object.Error); ok {
+		t.Fatalf("evaluation failed: %s", errObj.Message)
+	}
+	return c
+}
@@ -0,0 +1,287 @@
+// Package debugger runs Monkey programs on the evaluator under the control
+// of a user, who can stop them at breakpoints, step through them statement
+// by statement and look at their variables and calls in between.
+package debugger
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const PROMPT = "(debug) "
+
+const HELP = `Commands:
+  step, s            run to the next statement
+  next, n            run to the next statement, stepping over calls
+  finish, f          run until the current function returns
+  continue, c        run to the next breakpoint
+  break, b [line]    set a breakpoint at line, or list the breakpoints
+  delete, d <line>   remove the breakpoint at line
+  print, p <expr>    evaluate expr where the program stopped
+  locals             list the bindings of the current scope
+  list, l            show the source around the current line
+  backtrace, bt      show the calls in progress
+  quit, q            stop the program
+An empty line repeats the previous command.
+`
+
+// mode says where a running program stops next.
+type mode int
+
+const (
+	stepping   mode = iota // at the next statement
+	stepOver               // at the next statement no deeper than depth
+	stepOut                // at the next statement shallower than depth
+	continuing             // at the next breakpoint
+)
+
+// Debugger is an evaluator.Hook that stops the program before statements,
+// and reads commands from the user while it is stopped.
+type Debugger struct {
+	in     *bufio.Scanner
+	out    io.Writer
+	source []string
+
+	breakpoints map[int]bool
+	mode        mode
+	depth       int // the call depth step over and step out compare with
+	lastCommand string
+
+	// the position of the previous statement, so that a breakpoint stops
+	// once when its line is reached rather than at each statement on it
+	line      int
+	lineDepth int
+
+	cancel context.CancelFunc
+	quit   bool
+}
+
+// New creates a debugger for the program in source, which talks to the
+// user through in and out.
+func New(source string, in io.Reader, out io.Writer) *Debugger {
+	return &Debugger{
+		in:          bufio.NewScanner(in),
+		out:         out,
+		source:      strings.Split(source, "\n"),
+		breakpoints: map[int]bool{},
+	}
+}
+
+// SetBreakpoint makes the program stop before the statements on line.
+func (d *Debugger) SetBreakpoint(line int) {
+	d.breakpoints[line] = true
+}
+
+// Run evaluates program with config, stopping before its first statement.
+// It returns the program's result, or nil if the user quit.
+func (d *Debugger) Run(program *ast.Program, env *object.Environment, config evaluator.Config) object.Object {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.cancel = cancel
+	d.mode = stepping
+
+	config.Hook = d
+	result := evaluator.EvalWithConfig(ctx, program, env, config)
+	if d.quit {
+		return nil
+	}
+	return result
+}
+
+// Before stops the program before a statement when the current mode or a
+// breakpoint says so.
+func (d *Debugger) Before(node ast.Node, env *object.Environment, stack []evaluator.Frame) {
+	stmt, ok := node.(ast.Statement)
+	if !ok || d.quit {
+		return
+	}
+	if _, ok := stmt.(*ast.BlockStatement); ok {
+		return
+	}
+
+	line, depth := ast.Pos(stmt).Line, len(stack)
+	newLine := line != d.line || depth != d.lineDepth
+	d.line, d.lineDepth = line, depth
+
+	switch {
+	case d.mode == stepping:
+	case d.mode == stepOver && depth <= d.depth:
+	case d.mode == stepOut && depth < d.depth:
+	case d.breakpoints[line] && newLine:
+		fmt.Fprintf(d.out, "breakpoint at line %d\n", line)
+	default:
+		return
+	}
+
+	d.printLine(line)
+	d.prompt(env, stack)
+}
+
+// prompt reads commands until one of them resumes the program.
+func (d *Debugger) prompt(env *object.Environment, stack []evaluator.Frame) {
+	for {
+		fmt.Fprint(d.out, PROMPT)
+		if !d.in.Scan() {
+			d.stop()
+			return
+		}
+
+		line := strings.TrimSpace(d.in.Text())
+		if line == "" {
+			line = d.lastCommand
+		}
+		d.lastCommand = line
+
+		name, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+
+		switch name {
+		case "step", "s":
+			d.mode = stepping
+			return
+		case "next", "n":
+			d.mode, d.depth = stepOver, len(stack)
+			return
+		case "finish", "f":
+			d.mode, d.depth = stepOut, len(stack)
+			return
+		case "continue", "c":
+			d.mode = continuing
+			return
+		case "quit", "q":
+			d.stop()
+			return
+		case "break", "b":
+			d.breakCommand(arg)
+		case "delete", "d":
+			d.deleteCommand(arg)
+		case "print", "p":
+			d.print(arg, env)
+		case "locals":
+			d.printLocals(env)
+		case "list", "l":
+			d.list()
+		case "backtrace", "bt":
+			d.backtrace(stack)
+		case "help", "h", "":
+			io.WriteString(d.out, HELP)
+		default:
+			fmt.Fprintf(d.out, "unknown command %q, try help\n", name)
+		}
+	}
+}
+
+// stop ends the program, which the evaluator notices as soon as Before
+// returns.
+func (d *Debugger) stop() {
+	d.quit = true
+	d.cancel()
+}
+
+func (d *Debugger) breakCommand(arg string) {
+	if arg == "" {
+		lines := make([]int, 0, len(d.breakpoints))
+		for line := range d.breakpoints {
+			lines = append(lines, line)
+		}
+		sort.Ints(lines)
+		for _, line := range lines {
+			fmt.Fprintf(d.out, "breakpoint at line %d\n", line)
+		}
+		return
+	}
+
+	line, err := strconv.Atoi(arg)
+	if err != nil || line < 1 || line > len(d.source) {
+		fmt.Fprintf(d.out, "invalid line %q\n", arg)
+		return
+	}
+	d.SetBreakpoint(line)
+	fmt.Fprintf(d.out, "breakpoint set at line %d\n", line)
+}
+
+func (d *Debugger) deleteCommand(arg string) {
+	line, err := strconv.Atoi(arg)
+	if err != nil || !d.breakpoints[line] {
+		fmt.Fprintf(d.out, "no breakpoint at line %q\n", arg)
+		return
+	}
+	delete(d.breakpoints, line)
+}
+
+func (d *Debugger) print(src string, env *object.Environment) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, err := range p.Errors() {
+			fmt.Fprintln(d.out, err.Message)
+		}
+		return
+	}
+
+	if result := evaluator.Eval(program, env); result != nil {
+		fmt.Fprintln(d.out, result.Inspect())
+	}
+}
+
+func (d *Debugger) printLocals(env *object.Environment) {
+	bindings := env.Bindings()
+
+	names := make([]string, 0, len(bindings))
+	for name := range bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(d.out, "%s = %s\n", name, bindings[name].Inspect())
+	}
+}
+
+// list shows the lines around the current one, which is marked.
+func (d *Debugger) list() {
+	for n := d.line - 2; n <= d.line+2; n++ {
+		if n < 1 || n > len(d.source) {
+			continue
+		}
+		marker := "  "
+		if n == d.line {
+			marker = "=>"
+		}
+		fmt.Fprintf(d.out, "%s %4d  %s\n", marker, n, d.source[n-1])
+	}
+}
+
+// backtrace shows where each call in progress is, innermost first.
+func (d *Debugger) backtrace(stack []evaluator.Frame) {
+	line := d.line
+	for i := len(stack); i >= 0; i-- {
+		name := "main"
+		if i > 0 {
+			name = stack[i-1].Name
+		}
+		fmt.Fprintf(d.out, "#%d %s at line %d\n", len(stack)-i, name, line)
+
+		if i > 0 {
+			line = stack[i-1].Call.Line
+		}
+	}
+}
+
+func (d *Debugger) printLine(line int) {
+	text := ""
+	if line >= 1 && line <= len(d.source) {
+		text = strings.TrimSpace(d.source[line-1])
+	}
+	fmt.Fprintf(d.out, "line %d: %s\n", line, text)
+}
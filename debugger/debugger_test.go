@@ -0,0 +1,123 @@
+package debugger
+
+import (
+	"bytes"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+const program = `let add = fn(a, b) {
+  let sum = a + b;
+  sum
+};
+let x = add(1, 2);
+let y = add(x, 3);
+y`
+
+func TestDebugger(t *testing.T) {
+	tests := []struct {
+		commands    string
+		breakpoints []int
+		expected    []string
+	}{
+		{
+			"s\ns\ns\np a + b\nc\n",
+			nil,
+			[]string{
+				"line 1: let add = fn(a, b) {",
+				"line 5: let x = add(1, 2);",
+				"line 2: let sum = a + b;",
+				"(debug) 3\n",
+			},
+		},
+		{
+			"n\nn\nn\nn\n",
+			nil,
+			[]string{"line 1:", "line 5:", "line 6:", "line 7: y"},
+		},
+		{
+			"c\nbt\nlocals\nc\nc\n",
+			[]int{3},
+			[]string{
+				"breakpoint at line 3\nline 3: sum",
+				"#0 add at line 3\n#1 main at line 5\n",
+				"a = 1\nb = 2\nsum = 3\n",
+			},
+		},
+		{
+			"b 2\nc\nd 2\nf\nc\n",
+			nil,
+			[]string{
+				"breakpoint set at line 2",
+				"line 2: let sum = a + b;",
+				"line 6: let y = add(x, 3);",
+			},
+		},
+		{
+			"l\nfoo\nb 99\nq\n",
+			nil,
+			[]string{
+				"=>    1  let add = fn(a, b) {\n      2    let sum",
+				`unknown command "foo", try help`,
+				`invalid line "99"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		d := New(program, strings.NewReader(tt.commands), &out)
+		for _, line := range tt.breakpoints {
+			d.SetBreakpoint(line)
+		}
+
+		d.Run(parse(t, program), object.NewEnvironment(), evaluator.Config{})
+
+		for _, want := range tt.expected {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("output for %q does not contain %q. got=\n%s",
+					tt.commands, want, out.String())
+			}
+		}
+	}
+}
+
+func TestDebuggerResult(t *testing.T) {
+	tests := []struct {
+		commands string
+		expected string
+	}{
+		{"c\n", "6"},
+		{"s\nq\n", ""},
+		// the program stops when the commands run out
+		{"s\n", ""},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		d := New(program, strings.NewReader(tt.commands), &out)
+		result := d.Run(parse(t, program), object.NewEnvironment(), evaluator.Config{})
+
+		got := ""
+		if result != nil {
+			got = result.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.commands, tt.expected, got)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
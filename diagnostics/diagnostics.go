@@ -0,0 +1,163 @@
+// Package diagnostics renders errors in Monkey source the way compilers
+// like rustc do: the message, the file and position, the offending line of
+// source with its line number and a caret range under the part at fault,
+// followed by notes and a hint:
+//
+//	error: missing comma between elements
+//	 --> list.mk:2:13
+//	  |
+//	2 | let xs = [1 2];
+//	  |             ^
+//	  = hint: expected ',' or ']'
+//
+// It works for parse errors and runtime errors alike, since both carry the
+// line and column they happened at.
+package diagnostics
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/token"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Diagnostic is an error at a position in some source.
+type Diagnostic struct {
+	// Line and Column locate the error, counting from 1. They are zero
+	// when the position is unknown, and then no snippet is rendered.
+	Line   int
+	Column int
+
+	// Length is the number of characters the caret range covers. If it
+	// is zero, the range covers the token at the position.
+	Length int
+
+	Message string
+	Notes   []string // extra lines of context, like the calls in progress
+	Hint    string   // a suggestion for fixing the error, if any
+}
+
+// FromParseError returns the diagnostic for a syntax error. When several
+// tokens would have been accepted, its hint lists them.
+func FromParseError(err parser.ParseError) Diagnostic {
+	d := Diagnostic{Line: err.Line, Column: err.Column, Message: err.Message}
+	if len(err.Expected) > 1 {
+		d.Hint = "expected " + list(err.Expected)
+	}
+	return d
+}
+
+// FromError returns the diagnostic for a runtime error, with a note for
+// each call it happened in.
+func FromError(err *object.Error) Diagnostic {
+	d := Diagnostic{Line: err.Line, Column: err.Column, Message: err.Message}
+	d.Notes = err.StackLines()
+	return d
+}
+
+// Render formats d as it applies to source, which was read from the file
+// called filename.
+func Render(filename, source string, d Diagnostic) string {
+	var out bytes.Buffer
+
+	fmt.Fprintf(&out, "error: %s\n", d.Message)
+
+	lines := strings.Split(source, "\n")
+	if d.Line >= 1 && d.Line <= len(lines) {
+		line := strings.TrimRight(lines[d.Line-1], "\r")
+		number := strconv.Itoa(d.Line)
+		gutter := strings.Repeat(" ", len(number))
+
+		fmt.Fprintf(&out, "%s--> %s:%d:%d\n", gutter, filename, d.Line, d.Column)
+		fmt.Fprintf(&out, "%s |\n", gutter)
+		fmt.Fprintf(&out, "%s | %s\n", number, line)
+		fmt.Fprintf(&out, "%s | %s\n", gutter, caret(line, d.Column, length(source, d)))
+		for _, note := range d.Notes {
+			fmt.Fprintf(&out, "%s = note: %s\n", gutter, note)
+		}
+		if d.Hint != "" {
+			fmt.Fprintf(&out, "%s = hint: %s\n", gutter, d.Hint)
+		}
+		return out.String()
+	}
+
+	if d.Line != 0 {
+		fmt.Fprintf(&out, " --> %s:%d:%d\n", filename, d.Line, d.Column)
+	}
+	for _, note := range d.Notes {
+		fmt.Fprintf(&out, "  = note: %s\n", note)
+	}
+	if d.Hint != "" {
+		fmt.Fprintf(&out, "  = hint: %s\n", d.Hint)
+	}
+	return out.String()
+}
+
+// caret returns the line of carets covering length characters of line
+// from column on, indented to line up with them.
+func caret(line string, column, length int) string {
+	var out bytes.Buffer
+
+	runes := []rune(line)
+	for i := 0; i < column-1 && i < len(runes); i++ {
+		// keep tabs so the caret lines up with the source line
+		if runes[i] == '\t' {
+			out.WriteByte('\t')
+		} else {
+			out.WriteByte(' ')
+		}
+	}
+
+	// the range stops at the end of the line, but always has a caret
+	if rest := len(runes) - (column - 1); length > rest {
+		length = rest
+	}
+	if length < 1 {
+		length = 1
+	}
+	out.WriteString(strings.Repeat("^", length))
+
+	return out.String()
+}
+
+// length returns the length of the caret range of d: its own, or else
+// that of the token at its position in source.
+func length(source string, d Diagnostic) int {
+	if d.Length > 0 {
+		return d.Length
+	}
+
+	l := lexer.New(source)
+	for {
+		tok := l.NextToken()
+		if tok.Type == token.EOF || tok.Line > d.Line ||
+			tok.Line == d.Line && tok.Column > d.Column {
+			return 1
+		}
+		if tok.Line == d.Line && tok.Column == d.Column {
+			n := utf8.RuneCountInString(tok.Literal)
+			if tok.Type == token.STRING || tok.Type == token.TEMPLATE {
+				n += 2 // the quotes
+			}
+			return n
+		}
+	}
+}
+
+// list joins token types as "'a'", "'a' or 'b'" and "'a', 'b' or 'c'".
+func list(types []token.TokenType) string {
+	quoted := make([]string, len(types))
+	for i, t := range types {
+		quoted[i] = "'" + string(t) + "'"
+	}
+	last := len(quoted) - 1
+	if last == 0 {
+		return quoted[0]
+	}
+	return strings.Join(quoted[:last], ", ") + " or " + quoted[last]
+}
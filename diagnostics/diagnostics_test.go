@@ -0,0 +1,155 @@
+package diagnostics
+
+import (
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+func TestRenderParseError(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let a = 1;\nlet xs = [1 2];",
+			"error: missing comma between elements\n" +
+				" --> main.mk:2:13\n" +
+				"  |\n" +
+				"2 | let xs = [1 2];\n" +
+				"  |             ^\n" +
+				"  = hint: expected ',' or ']'\n",
+		},
+		{
+			"let x = (1 + 2;",
+			"error: expected next token to be ')', got ';' instead\n" +
+				" --> main.mk:1:15\n" +
+				"  |\n" +
+				"1 | let x = (1 + 2;\n" +
+				"  |               ^\n",
+		},
+		{
+			"\tlet = \"abc\";",
+			"error: expected next token to be 'IDENT', got '=' instead\n" +
+				" --> main.mk:1:6\n" +
+				"  |\n" +
+				"1 | \tlet = \"abc\";\n" +
+				"  | \t    ^\n",
+		},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("no parser errors for %q", tt.input)
+			continue
+		}
+
+		got := Render("main.mk", tt.input, FromParseError(p.Errors()[0]))
+		if got != tt.expected {
+			t.Errorf("wrong rendering for %q.\nwant=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let s = \"abc\";\nlet y = s + undefined;",
+			"error: identifier not found: undefined\n" +
+				" --> main.mk:2:13\n" +
+				"  |\n" +
+				"2 | let y = s + undefined;\n" +
+				"  |             ^^^^^^^^^\n",
+		},
+		{
+			`"abc" - 1`,
+			"error: type mismatch: STRING - INTEGER\n" +
+				" --> main.mk:1:7\n" +
+				"  |\n" +
+				"1 | \"abc\" - 1\n" +
+				"  |       ^\n",
+		},
+		{
+			"let f = fn() {\n  1 / 0\n};\nf();",
+			"error: division by zero\n" +
+				" --> main.mk:2:5\n" +
+				"  |\n" +
+				"2 |   1 / 0\n" +
+				"  |     ^\n" +
+				"  = note: in f, called at line 4, column 2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, p.Errors())
+		}
+
+		errObj, ok := evaluator.Eval(program, object.NewEnvironment()).(*object.Error)
+		if !ok {
+			t.Errorf("no error for %q", tt.input)
+			continue
+		}
+
+		got := Render("main.mk", tt.input, FromError(errObj))
+		if got != tt.expected {
+			t.Errorf("wrong rendering for %q.\nwant=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		diagnostic Diagnostic
+		source     string
+		expected   string
+	}{
+		{
+			Diagnostic{Line: 10, Column: 3, Length: 20, Message: "oops", Hint: "try harder"},
+			"\n\n\n\n\n\n\n\n\nabcdef",
+			"error: oops\n" +
+				"  --> f.mk:10:3\n" +
+				"   |\n" +
+				"10 | abcdef\n" +
+				"   |   ^^^^\n" +
+				"   = hint: try harder\n",
+		},
+		{
+			Diagnostic{Line: 1, Column: 3, Message: "in a string"},
+			`x("héllo")`,
+			"error: in a string\n" +
+				" --> f.mk:1:3\n" +
+				"  |\n" +
+				"1 | x(\"héllo\")\n" +
+				"  |   ^^^^^^^\n",
+		},
+		{
+			Diagnostic{Message: "nowhere", Notes: []string{"somewhere else"}},
+			"x",
+			"error: nowhere\n" +
+				"  = note: somewhere else\n",
+		},
+		{
+			Diagnostic{Line: 5, Column: 1, Message: "past the end"},
+			"x",
+			"error: past the end\n" +
+				" --> f.mk:5:1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		got := Render("f.mk", tt.source, tt.diagnostic)
+		if got != tt.expected {
+			t.Errorf("wrong rendering for %+v.\nwant=%q\ngot=%q", tt.diagnostic, tt.expected, got)
+		}
+	}
+}
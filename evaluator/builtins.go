@@ -0,0 +1,1175 @@
+package evaluator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"monkey/object"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var builtins = map[string]*object.Builtin{
+	"len": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.String:
+				return object.NewInt(int64(utf8.RuneCountInString(arg.Value)))
+			case *object.Array:
+				return object.NewInt(int64(len(arg.Elements)))
+			case *object.Range:
+				return object.NewInt(arg.Len())
+			default:
+				return newError("argument to `len` not supported, got %s",
+					args[0].Type())
+			}
+		},
+	},
+	"first": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			if args[0].Type() != object.ARRAY_OBJ {
+				return newError("argument to `first` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			arr := args[0].(*object.Array)
+			if len(arr.Elements) > 0 {
+				return arr.Elements[0]
+			}
+
+			return NULL
+		},
+	},
+	"last": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			if args[0].Type() != object.ARRAY_OBJ {
+				return newError("argument to `last` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			arr := args[0].(*object.Array)
+			length := len(arr.Elements)
+			if length > 0 {
+				return arr.Elements[length-1]
+			}
+
+			return NULL
+		},
+	},
+	"rest": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			if args[0].Type() != object.ARRAY_OBJ {
+				return newError("argument to `rest` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			arr := args[0].(*object.Array)
+			length := len(arr.Elements)
+			if length > 0 {
+				newElements := make([]object.Object, length-1)
+				copy(newElements, arr.Elements[1:length])
+				return &object.Array{Elements: newElements}
+			}
+
+			return NULL
+		},
+	},
+	"push": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+
+			if args[0].Type() != object.ARRAY_OBJ {
+				return newError("argument to `push` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			arr := args[0].(*object.Array)
+			length := len(arr.Elements)
+
+			newElements := make([]object.Object, length+1)
+			copy(newElements, arr.Elements)
+			newElements[length] = args[1]
+
+			return &object.Array{Elements: newElements}
+		},
+	},
+	"keys": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			hash, ok := args[0].(*object.Hash)
+			if !ok {
+				return newError("argument to `keys` must be HASH, got %s",
+					args[0].Type())
+			}
+
+			keys := make([]object.Object, 0, len(hash.Pairs))
+			for _, pair := range hash.Ordered() {
+				keys = append(keys, pair.Key)
+			}
+			return &object.Array{Elements: keys}
+		},
+	},
+	"values": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			hash, ok := args[0].(*object.Hash)
+			if !ok {
+				return newError("argument to `values` must be HASH, got %s",
+					args[0].Type())
+			}
+
+			values := make([]object.Object, 0, len(hash.Pairs))
+			for _, pair := range hash.Ordered() {
+				values = append(values, pair.Value)
+			}
+			return &object.Array{Elements: values}
+		},
+	},
+	"split": {
+		Fn: func(args ...object.Object) object.Object {
+			strs, err := stringArgs("split", 2, args)
+			if err != nil {
+				return err
+			}
+
+			parts := strings.Split(strs[0], strs[1])
+			elements := make([]object.Object, len(parts))
+			for i, part := range parts {
+				elements[i] = &object.String{Value: part}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"join": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument to `join` must be ARRAY, got %s",
+					args[0].Type())
+			}
+			sep, ok := args[1].(*object.String)
+			if !ok {
+				return newError("argument 2 to `join` must be STRING, got %s",
+					args[1].Type())
+			}
+
+			parts := make([]string, len(arr.Elements))
+			for i, elem := range arr.Elements {
+				str, ok := elem.(*object.String)
+				if !ok {
+					return newError("element %d of array given to `join` must be STRING, got %s",
+						i, elem.Type())
+				}
+				parts[i] = str.Value
+			}
+			return &object.String{Value: strings.Join(parts, sep.Value)}
+		},
+	},
+	"replace": {
+		Fn: func(args ...object.Object) object.Object {
+			strs, err := stringArgs("replace", 3, args)
+			if err != nil {
+				return err
+			}
+			return &object.String{Value: strings.ReplaceAll(strs[0], strs[1], strs[2])}
+		},
+	},
+	"trim": {
+		Fn: func(args ...object.Object) object.Object {
+			strs, err := stringArgs("trim", 1, args)
+			if err != nil {
+				return err
+			}
+			return &object.String{Value: strings.TrimSpace(strs[0])}
+		},
+	},
+	"upper": {
+		Fn: func(args ...object.Object) object.Object {
+			strs, err := stringArgs("upper", 1, args)
+			if err != nil {
+				return err
+			}
+			return &object.String{Value: strings.ToUpper(strs[0])}
+		},
+	},
+	"lower": {
+		Fn: func(args ...object.Object) object.Object {
+			strs, err := stringArgs("lower", 1, args)
+			if err != nil {
+				return err
+			}
+			return &object.String{Value: strings.ToLower(strs[0])}
+		},
+	},
+	"contains": {
+		Fn: func(args ...object.Object) object.Object {
+			strs, err := stringArgs("contains", 2, args)
+			if err != nil {
+				return err
+			}
+			return nativeBoolToBooleanObject(strings.Contains(strs[0], strs[1]))
+		},
+	},
+	"map": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			arr, fn, err := arrayAndFunction("map", args)
+			if err != nil {
+				return err
+			}
+
+			result := make([]object.Object, len(arr.Elements))
+			for i, elem := range arr.Elements {
+				mapped := rt.Call(fn, elem)
+				if isError(mapped) {
+					return mapped
+				}
+				result[i] = mapped
+			}
+			return &object.Array{Elements: result}
+		},
+	},
+	"filter": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			arr, fn, err := arrayAndFunction("filter", args)
+			if err != nil {
+				return err
+			}
+
+			result := []object.Object{}
+			for _, elem := range arr.Elements {
+				keep := rt.Call(fn, elem)
+				if isError(keep) {
+					return keep
+				}
+				if isTruthy(keep) {
+					result = append(result, elem)
+				}
+			}
+			return &object.Array{Elements: result}
+		},
+	},
+	"reduce": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			if len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=3",
+					len(args))
+			}
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument 1 to `reduce` must be ARRAY, got %s",
+					args[0].Type())
+			}
+			if !isCallable(args[2]) {
+				return newError("argument 3 to `reduce` must be FUNCTION, got %s",
+					args[2].Type())
+			}
+
+			acc := args[1]
+			for _, elem := range arr.Elements {
+				acc = rt.Call(args[2], acc, elem)
+				if isError(acc) {
+					return acc
+				}
+			}
+			return acc
+		},
+	},
+	"sort": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2",
+					len(args))
+			}
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument 1 to `sort` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			// without a comparator, elements are ordered by <
+			less := func(a, b object.Object) object.Object {
+				return evalInfixExpression("<", a, b, false)
+			}
+			if len(args) == 2 {
+				if !isCallable(args[1]) {
+					return newError("argument 2 to `sort` must be FUNCTION, got %s",
+						args[1].Type())
+				}
+				less = func(a, b object.Object) object.Object {
+					return rt.Call(args[1], a, b)
+				}
+			}
+
+			// the first error stops any further comparisons
+			var failed object.Object
+			sorted := make([]object.Object, len(arr.Elements))
+			copy(sorted, arr.Elements)
+			sort.SliceStable(sorted, func(i, j int) bool {
+				if failed != nil {
+					return false
+				}
+				result := less(sorted[i], sorted[j])
+				if isError(result) {
+					failed = result
+					return false
+				}
+				return isTruthy(result)
+			})
+
+			if failed != nil {
+				return failed
+			}
+			return &object.Array{Elements: sorted}
+		},
+	},
+	"error": {
+		Fn: func(args ...object.Object) object.Object {
+			strs, err := stringArgs("error", 1, args)
+			if err != nil {
+				return err
+			}
+			return newError("%s", strs[0])
+		},
+	},
+	"assert": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2",
+					len(args))
+			}
+			if isTruthy(args[0]) {
+				return NULL
+			}
+			if len(args) == 1 {
+				return newError("assertion failed")
+			}
+
+			msg, ok := args[1].(*object.String)
+			if !ok {
+				return newError("argument 2 to `assert` must be STRING, got %s",
+					args[1].Type())
+			}
+			return newError("assertion failed: %s", msg.Value)
+		},
+	},
+	// assertEq also fails for equal values of different types, telling 1
+	// from 1.0.
+	"assertEq": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			if args[0].Type() != args[1].Type() || !object.Equal(args[0], args[1]) {
+				return newError("assertion failed: %s != %s",
+					args[0].Inspect(), args[1].Inspect())
+			}
+			return NULL
+		},
+	},
+	// equals compares its arguments like ==, deeply for arrays, hashes
+	// and struct instances; see object.Equal.
+	"equals": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			return nativeBoolToBooleanObject(object.Equal(args[0], args[1]))
+		},
+	},
+	"puts": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			for _, arg := range args {
+				fmt.Fprintln(rt.Stdout(), arg.Inspect())
+			}
+
+			return NULL
+		},
+	},
+	"eputs": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			for _, arg := range args {
+				fmt.Fprintln(rt.Stderr(), arg.Inspect())
+			}
+
+			return NULL
+		},
+	},
+	"readLine": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0",
+					len(args))
+			}
+
+			line, err := readLine(rt.Stdin())
+			if err == io.EOF && line == "" {
+				return NULL
+			}
+			if err != nil && err != io.EOF {
+				return newError("reading standard input: %s", err)
+			}
+			return &object.String{Value: line}
+		},
+	},
+	"jsonEncode": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2",
+					len(args))
+			}
+			pretty := false
+			if len(args) == 2 {
+				b, ok := args[1].(*object.Boolean)
+				if !ok {
+					return newError("argument 2 to `jsonEncode` must be BOOLEAN, got %s",
+						args[1].Type())
+				}
+				pretty = b.Value
+			}
+
+			text, err := jsonEncode(args[0], pretty)
+			if err != nil {
+				return err
+			}
+			return &object.String{Value: text}
+		},
+	},
+	"jsonDecode": {
+		Fn: func(args ...object.Object) object.Object {
+			strs, err := stringArgs("jsonDecode", 1, args)
+			if err != nil {
+				return err
+			}
+
+			obj, err := jsonDecode(strs[0])
+			if err != nil {
+				return err
+			}
+			return obj
+		},
+	},
+	"readFile": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			strs, err := fileArgs(rt, "readFile", 1, args)
+			if err != nil {
+				return err
+			}
+
+			data, readErr := os.ReadFile(strs[0])
+			if readErr != nil {
+				return newError("%s", readErr)
+			}
+			return &object.String{Value: string(data)}
+		},
+	},
+	"readLines": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			strs, err := fileArgs(rt, "readLines", 1, args)
+			if err != nil {
+				return err
+			}
+
+			data, readErr := os.ReadFile(strs[0])
+			if readErr != nil {
+				return newError("%s", readErr)
+			}
+
+			lines := []object.Object{}
+			if len(data) > 0 {
+				for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+					lines = append(lines, &object.String{Value: strings.TrimSuffix(line, "\r")})
+				}
+			}
+			return &object.Array{Elements: lines}
+		},
+	},
+	"writeFile": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			strs, err := fileArgs(rt, "writeFile", 2, args)
+			if err != nil {
+				return err
+			}
+
+			if writeErr := os.WriteFile(strs[0], []byte(strs[1]), 0644); writeErr != nil {
+				return newError("%s", writeErr)
+			}
+			return NULL
+		},
+	},
+	"appendFile": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			strs, err := fileArgs(rt, "appendFile", 2, args)
+			if err != nil {
+				return err
+			}
+
+			f, openErr := os.OpenFile(strs[0], os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+			if openErr != nil {
+				return newError("%s", openErr)
+			}
+			_, writeErr := f.WriteString(strs[1])
+			if closeErr := f.Close(); writeErr == nil {
+				writeErr = closeErr
+			}
+			if writeErr != nil {
+				return newError("%s", writeErr)
+			}
+			return NULL
+		},
+	},
+	"fileExists": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			strs, err := fileArgs(rt, "fileExists", 1, args)
+			if err != nil {
+				return err
+			}
+
+			_, statErr := os.Stat(strs[0])
+			return nativeBoolToBooleanObject(statErr == nil)
+		},
+	},
+	"print": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			parts := make([]string, len(args))
+			for i, arg := range args {
+				parts[i] = arg.Inspect()
+			}
+			fmt.Fprint(rt.Stdout(), strings.Join(parts, " "))
+
+			return NULL
+		},
+	},
+	"printf": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			if len(args) == 0 {
+				return newError("wrong number of arguments. got=0, want=1 or more")
+			}
+			format, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument 1 to `printf` must be STRING, got %s",
+					args[0].Type())
+			}
+
+			out, err := formatString("printf", format.Value, args[1:])
+			if err != nil {
+				return err
+			}
+			fmt.Fprint(rt.Stdout(), out)
+
+			return NULL
+		},
+	},
+	"chan": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) > 1 {
+				return newError("wrong number of arguments. got=%d, want=0 or 1",
+					len(args))
+			}
+
+			size := int64(0)
+			if len(args) == 1 {
+				n, ok := args[0].(*object.Integer)
+				if !ok || n.Value < 0 {
+					return newError("argument to `chan` must be a non-negative INTEGER, got %s",
+						args[0].Inspect())
+				}
+				size = n.Value
+			}
+
+			return &object.Channel{Size: int(size)}
+		},
+	},
+	"send": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+			ch, ok := args[0].(*object.Channel)
+			if !ok {
+				return newError("argument 1 to `send` must be CHANNEL, got %s",
+					args[0].Type())
+			}
+
+			return send(rt, ch, args[1])
+		},
+	},
+	"recv": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+			ch, ok := args[0].(*object.Channel)
+			if !ok {
+				return newError("argument to `recv` must be CHANNEL, got %s",
+					args[0].Type())
+			}
+
+			// the error a spawned function failed with is raised here,
+			// in the task that waits for its result
+			return recv(rt, ch)
+		},
+	},
+	// type names the type of its argument: the name of a struct for its
+	// instances, and the type shown in error messages for anything else.
+	"type": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			if instance, ok := args[0].(*object.Instance); ok {
+				return &object.String{Value: instance.Struct.TypeName()}
+			}
+			return &object.String{Value: string(args[0].Type())}
+		},
+	},
+	// The conversion builtins give null for a value of the right type that
+	// cannot be converted, like int("abc"), so that input can be checked
+	// with ??, and an error for an argument of a type they do not convert.
+	"int": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer:
+				return arg
+			case *object.BigInteger:
+				if !arg.Value.IsInt64() {
+					return NULL
+				}
+				return object.NewInt(arg.Value.Int64())
+			case *object.Float:
+				// truncates toward zero, like Go
+				if math.IsNaN(arg.Value) || arg.Value < math.MinInt64 || arg.Value >= math.MaxInt64 {
+					return NULL
+				}
+				return object.NewInt(int64(arg.Value))
+			case *object.Boolean:
+				if arg.Value {
+					return object.NewInt(1)
+				}
+				return object.NewInt(0)
+			case *object.String:
+				n, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 10, 64)
+				if err != nil {
+					return NULL
+				}
+				return object.NewInt(n)
+			default:
+				return newError("argument to `int` not supported, got %s",
+					args[0].Type())
+			}
+		},
+	},
+	"float": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Float:
+				return arg
+			case *object.Integer:
+				return &object.Float{Value: float64(arg.Value)}
+			case *object.BigInteger:
+				f, _ := new(big.Float).SetInt(arg.Value).Float64()
+				return &object.Float{Value: f}
+			case *object.String:
+				f, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+				if err != nil {
+					return NULL
+				}
+				return &object.Float{Value: f}
+			default:
+				return newError("argument to `float` not supported, got %s",
+					args[0].Type())
+			}
+		},
+	},
+	"str": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			if str, ok := args[0].(*object.String); ok {
+				return str
+			}
+			return &object.String{Value: args[0].Inspect()}
+		},
+	},
+	"bool": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			return nativeBoolToBooleanObject(isTruthy(args[0]))
+		},
+	},
+	// The math builtins keep integers integers where they can: abs, min,
+	// max, floor, ceil and round give back an integer argument unchanged,
+	// and pow of two integers is the integer power, like **.
+	"abs": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer:
+				if arg.Value < 0 {
+					return object.NewInt(-arg.Value)
+				}
+				return arg
+			case *object.Float:
+				return &object.Float{Value: math.Abs(arg.Value)}
+			default:
+				return newError("argument to `abs` must be INTEGER or FLOAT, got %s",
+					args[0].Type())
+			}
+		},
+	},
+	"min": {
+		Fn: func(args ...object.Object) object.Object {
+			return extremum("min", args, func(a, b float64) bool { return a < b })
+		},
+	},
+	"max": {
+		Fn: func(args ...object.Object) object.Object {
+			return extremum("max", args, func(a, b float64) bool { return a > b })
+		},
+	},
+	"pow": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+
+			base, ok := args[0].(*object.Integer)
+			exp, ok2 := args[1].(*object.Integer)
+			if ok && ok2 {
+				result, err := object.IntegerArithmetic("**", base, exp, false)
+				if err != nil {
+					return newError("%s", err)
+				}
+				return result
+			}
+
+			nums, err := floatArgs("pow", args)
+			if err != nil {
+				return err
+			}
+			return &object.Float{Value: math.Pow(nums[0], nums[1])}
+		},
+	},
+	"sqrt": {
+		Fn: func(args ...object.Object) object.Object {
+			return floatFunction("sqrt", math.Sqrt, false, args)
+		},
+	},
+	"floor": {
+		Fn: func(args ...object.Object) object.Object {
+			return floatFunction("floor", math.Floor, true, args)
+		},
+	},
+	"ceil": {
+		Fn: func(args ...object.Object) object.Object {
+			return floatFunction("ceil", math.Ceil, true, args)
+		},
+	},
+	"round": {
+		Fn: func(args ...object.Object) object.Object {
+			// halves round away from zero
+			return floatFunction("round", math.Round, true, args)
+		},
+	},
+	// random() gives a float from 0 up to 1, and random(n) an integer from
+	// 0 up to n. Both use the generator of the engine running them, which
+	// randomSeed reseeds.
+	"random": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			switch len(args) {
+			case 0:
+				return &object.Float{Value: rt.Rand().Float64()}
+			case 1:
+				n, ok := args[0].(*object.Integer)
+				if !ok {
+					return newError("argument to `random` must be INTEGER, got %s",
+						args[0].Type())
+				}
+				if n.Value <= 0 {
+					return newError("argument to `random` must be positive, got %d",
+						n.Value)
+				}
+				return object.NewInt(rt.Rand().Int63n(n.Value))
+			default:
+				return newError("wrong number of arguments. got=%d, want=0 or 1",
+					len(args))
+			}
+		},
+	},
+	"randomSeed": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(args))
+			}
+
+			seed, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError("argument to `randomSeed` must be INTEGER, got %s",
+					args[0].Type())
+			}
+			rt.Rand().Seed(seed.Value)
+			return NULL
+		},
+	},
+	// env gives the value of an environment variable, or null if it is
+	// not set.
+	"env": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			if !rt.AllowEnv() {
+				return newError("`env` is not allowed: environment access is disabled")
+			}
+			strs, err := stringArgs("env", 1, args)
+			if err != nil {
+				return err
+			}
+
+			value, ok := os.LookupEnv(strs[0])
+			if !ok {
+				return NULL
+			}
+			return &object.String{Value: value}
+		},
+	},
+	// args gives the command-line arguments of the program, which the
+	// monkey command takes after a "--": monkey run script.monkey -- a b
+	"args": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0",
+					len(args))
+			}
+
+			elements := make([]object.Object, len(rt.Args()))
+			for i, arg := range rt.Args() {
+				elements[i] = &object.String{Value: arg}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	// exit stops the program with the given status, 0 by default. It
+	// cannot be caught by try.
+	"exit": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			if !rt.AllowExit() {
+				return newError("`exit` is not allowed: exiting is disabled")
+			}
+			if len(args) > 1 {
+				return newError("wrong number of arguments. got=%d, want=0 or 1",
+					len(args))
+			}
+
+			code := 0
+			if len(args) == 1 {
+				n, ok := args[0].(*object.Integer)
+				if !ok {
+					return newError("argument to `exit` must be INTEGER, got %s",
+						args[0].Type())
+				}
+				code = int(n.Value)
+			}
+
+			exit := &object.ExitError{Code: code}
+			return &object.Error{Message: exit.Error(), Exit: exit}
+		},
+	},
+	// exec runs a command with the given arguments and gives a hash of its
+	// exit code and output. A command that fails is not an error, one that
+	// cannot be started is.
+	"exec": {
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			if !rt.AllowExec() {
+				return newError("`exec` is not allowed: running commands is disabled")
+			}
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2",
+					len(args))
+			}
+
+			name, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument 1 to `exec` must be STRING, got %s",
+					args[0].Type())
+			}
+
+			cmdArgs := []string{}
+			if len(args) == 2 {
+				arr, ok := args[1].(*object.Array)
+				if !ok {
+					return newError("argument 2 to `exec` must be ARRAY, got %s",
+						args[1].Type())
+				}
+				for i, el := range arr.Elements {
+					str, ok := el.(*object.String)
+					if !ok {
+						return newError("element %d of array given to `exec` must be STRING, got %s",
+							i, el.Type())
+					}
+					cmdArgs = append(cmdArgs, str.Value)
+				}
+			}
+
+			var stdout, stderr bytes.Buffer
+			cmd := exec.CommandContext(rt.Context(), name.Value, cmdArgs...)
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+
+			code := 0
+			if err := cmd.Run(); err != nil {
+				exitErr, ok := err.(*exec.ExitError)
+				if !ok {
+					return newError("%s", err)
+				}
+				code = exitErr.ExitCode()
+			}
+
+			result := object.NewHash(3)
+			result.Set(&object.String{Value: "code"}, object.NewInt(int64(code)))
+			result.Set(&object.String{Value: "stdout"}, &object.String{Value: stdout.String()})
+			result.Set(&object.String{Value: "stderr"}, &object.String{Value: stderr.String()})
+			return result
+		},
+	},
+}
+
+// RegisterBuiltin makes fn callable from Monkey code under the given name.
+// Registering a name that already exists replaces the previous builtin.
+// Builtins are shared by every evaluation, so embedders should register
+// their functions before evaluating any programs.
+func RegisterBuiltin(name string, fn object.BuiltinFunction) {
+	builtins[name] = &object.Builtin{Fn: fn}
+}
+
+// RegisterRuntimeBuiltin is like RegisterBuiltin for functions that need
+// the engine running them, for example to check what the host allows
+// before reaching the network.
+func RegisterRuntimeBuiltin(name string, fn object.RuntimeFunction) {
+	builtins[name] = &object.Builtin{RuntimeFn: fn}
+}
+
+// IsBuiltin reports whether name is a builtin function, including those
+// registered by the host.
+func IsBuiltin(name string) bool {
+	_, ok := builtins[name]
+	return ok
+}
+
+// LookupBuiltin returns the builtin function called name, if there is one.
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
+
+// stringArgs checks that a builtin received want arguments, all strings,
+// and returns their values.
+func stringArgs(name string, want int, args []object.Object) ([]string, *object.Error) {
+	if len(args) != want {
+		return nil, newError("wrong number of arguments. got=%d, want=%d",
+			len(args), want)
+	}
+
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		str, ok := arg.(*object.String)
+		if !ok {
+			if want == 1 {
+				return nil, newError("argument to `%s` must be STRING, got %s",
+					name, arg.Type())
+			}
+			return nil, newError("argument %d to `%s` must be STRING, got %s",
+				i+1, name, arg.Type())
+		}
+		strs[i] = str.Value
+	}
+	return strs, nil
+}
+
+// floatArgs checks that the arguments of a builtin are all numbers and
+// returns them as floats.
+func floatArgs(name string, args []object.Object) ([]float64, *object.Error) {
+	nums := make([]float64, len(args))
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case *object.Integer:
+			nums[i] = float64(arg.Value)
+		case *object.Float:
+			nums[i] = arg.Value
+		default:
+			if len(args) == 1 {
+				return nil, newError("argument to `%s` must be INTEGER or FLOAT, got %s",
+					name, arg.Type())
+			}
+			return nil, newError("argument %d to `%s` must be INTEGER or FLOAT, got %s",
+				i+1, name, arg.Type())
+		}
+	}
+	return nums, nil
+}
+
+// floatFunction applies f to the single number in args. If keepIntegers
+// is set, an integer is returned unchanged instead, as rounding it would.
+func floatFunction(name string, f func(float64) float64, keepIntegers bool, args []object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	if _, ok := args[0].(*object.Integer); ok && keepIntegers {
+		return args[0]
+	}
+
+	nums, err := floatArgs(name, args)
+	if err != nil {
+		return err
+	}
+	return &object.Float{Value: f(nums[0])}
+}
+
+// extremum returns the argument that comes first when ordered by before,
+// keeping its type, for min and max.
+func extremum(name string, args []object.Object, before func(a, b float64) bool) object.Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments. got=0, want at least 1")
+	}
+
+	nums, err := floatArgs(name, args)
+	if err != nil {
+		return err
+	}
+
+	best := 0
+	for i := range nums {
+		if before(nums[i], nums[best]) {
+			best = i
+		}
+	}
+	return args[best]
+}
+
+// fileArgs checks that builtins may use the file system before checking
+// their arguments like stringArgs.
+func fileArgs(rt object.Runtime, name string, want int, args []object.Object) ([]string, *object.Error) {
+	if !rt.AllowFS() {
+		return nil, newError("`%s` is not allowed: file system access is disabled", name)
+	}
+	return stringArgs(name, want, args)
+}
+
+// arrayAndFunction checks that a builtin received an array and a function,
+// in that order.
+func arrayAndFunction(name string, args []object.Object) (*object.Array, object.Object, *object.Error) {
+	if len(args) != 2 {
+		return nil, nil, newError("wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, nil, newError("argument 1 to `%s` must be ARRAY, got %s",
+			name, args[0].Type())
+	}
+	if !isCallable(args[1]) {
+		return nil, nil, newError("argument 2 to `%s` must be FUNCTION, got %s",
+			name, args[1].Type())
+	}
+	return arr, args[1], nil
+}
+
+func isCallable(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Function, *object.Closure, *object.Builtin:
+		return true
+	default:
+		return false
+	}
+}
+
+// readLine reads up to the next line ending, which it drops. It reads a
+// byte at a time so that nothing after the line is consumed from r, which
+// may be shared with whoever else reads standard input.
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	buf := make([]byte, 1)
+
+	for {
+		n, err := r.Read(buf)
+		if n == 1 {
+			if buf[0] == '\n' {
+				return strings.TrimSuffix(string(line), "\r"), nil
+			}
+			line = append(line, buf[0])
+		}
+		if err != nil {
+			return string(line), err
+		}
+	}
+}
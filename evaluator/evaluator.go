@@ -0,0 +1,1495 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
+)
+
+// cancelCheckInterval is how many evaluation steps EvalContext takes
+// between checks of its context.
+const cancelCheckInterval = 1024
+
+// DefaultMaxCallDepth is how deeply function calls may nest unless a
+// Config says otherwise. It keeps deep recursion well clear of the limit
+// of the Go stack.
+const DefaultMaxCallDepth = 10000
+
+// Config adjusts how a program is evaluated. The zero value selects the
+// defaults.
+type Config struct {
+	// MaxCallDepth limits how deeply function calls may nest before
+	// evaluation fails with a stack overflow error. Zero means
+	// DefaultMaxCallDepth.
+	MaxCallDepth int
+
+	// BigIntegers makes integer arithmetic that overflows int64 produce
+	// big integers instead of wrapping around.
+	BigIntegers bool
+
+	// StrictBool makes the conditions of if and the operands of !, && and
+	// || fail with an error unless they are booleans, instead of counting
+	// every value but false and null as true.
+	StrictBool bool
+
+	// StrictIndexing makes out-of-bounds array indexing fail with an error
+	// instead of evaluating to null.
+	StrictIndexing bool
+
+	// Stdout, Stderr and Stdin are the streams of builtins like puts,
+	// eputs and readLine. Nil means os.Stdout, os.Stderr and os.Stdin.
+	Stdout io.Writer
+	Stderr io.Writer
+	Stdin  io.Reader
+
+	// AllowFS lets builtins like readFile and writeFile use the file
+	// system, which they refuse to by default.
+	AllowFS bool
+
+	// AllowNet lets builtins that hosts register use the network.
+	AllowNet bool
+
+	// AllowEnv lets env read environment variables, AllowExec lets exec
+	// run commands and AllowExit lets exit stop the program. Hosts that
+	// run untrusted programs leave them unset.
+	AllowEnv  bool
+	AllowExec bool
+	AllowExit bool
+
+	// Args are the command-line arguments returned by args.
+	Args []string
+
+	// MaxMemObjects limits the size of the arrays, hashes and strings an
+	// evaluation and the tasks it spawns create, as measured by
+	// object.Size, after which it fails with a "memory limit exceeded"
+	// error. Values are counted when they are created and never
+	// discounted, so the limit bounds what a program allocates over its
+	// run rather than what it holds at once. Zero means no limit.
+	MaxMemObjects int
+
+	// MaxSteps limits an evaluation, including the tasks it spawns, to
+	// evaluating that many nodes, after which it fails with an "execution
+	// budget exceeded" error. Unlike a context's deadline, the budget does
+	// not depend on how fast the machine is. Zero means no limit.
+	MaxSteps int
+
+	// Hook, if set, is called before every node is evaluated.
+	Hook Hook
+
+	// Rand is the random number generator of builtins like random. Nil
+	// means a generator seeded from the clock for each evaluation; the
+	// REPL keeps one across inputs so that randomSeed lasts.
+	Rand *rand.Rand
+}
+
+// A Hook follows an evaluation node by node, for tools like debuggers.
+// Before is called with the node about to be evaluated, the environment it
+// is evaluated in and the calls in progress, outermost first. The stack
+// must not be kept after Before returns. Evaluation stops with an error if
+// the context is done once Before returns.
+type Hook interface {
+	Before(node ast.Node, env *object.Environment, stack []Frame)
+}
+
+// An AfterHook is a Hook that is also called once each node it saw has been
+// evaluated, with the node and its result.
+type AfterHook interface {
+	Hook
+	After(node ast.Node, result object.Object)
+}
+
+// WithHook adapts f to a Hook, for hooks that need only the node about to
+// be evaluated and its environment:
+//
+//	config := Config{Hook: WithHook(func(node ast.Node, env *object.Environment) {
+//		steps++
+//	})}
+func WithHook(f func(node ast.Node, env *object.Environment)) Hook {
+	return hookFunc(f)
+}
+
+type hookFunc func(node ast.Node, env *object.Environment)
+
+func (f hookFunc) Before(node ast.Node, env *object.Environment, stack []Frame) {
+	f(node, env)
+}
+
+// A Frame is a call of a Monkey function in progress.
+type Frame struct {
+	Name string      // the called expression, like "fib" or "m.f"
+	Call token.Token // the call's position
+}
+
+// evaluation holds the state of a single call to Eval or EvalContext.
+type evaluation struct {
+	ctx    context.Context
+	config Config
+
+	steps int
+	depth int
+
+	// the nodes evaluated by this evaluation and the tasks it spawned, if
+	// MaxSteps is set; shared with those tasks
+	budget *atomic.Int64
+
+	// the size of the values created by this evaluation and the tasks it
+	// spawned, if MaxMemObjects is set; shared with those tasks
+	allocated *atomic.Int64
+
+	// the configured hook, if it is an AfterHook
+	after AfterHook
+
+	// the modules imported by this evaluation and the tasks it spawned;
+	// shared with those tasks
+	modules *moduleCache
+
+	// the tasks of this evaluation; shared with the tasks it spawned
+	sched *scheduler
+
+	// the calls in progress, outermost first
+	stack []Frame
+
+	// the call of the builtin running, after which Call names the
+	// functions the builtin calls
+	builtin Frame
+
+	// the calls in tail position of the function bodies applied so far
+	analyzed  map[*ast.BlockStatement]bool
+	tailCalls map[*ast.CallExpression]bool
+}
+
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	return EvalContext(context.Background(), node, env)
+}
+
+// EvalContext evaluates node like Eval, but gives up with an error once
+// ctx is done, so that runaway programs can be stopped.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	return EvalWithConfig(ctx, node, env, Config{})
+}
+
+// EvalWithConfig evaluates node like EvalContext, adjusted by config.
+func EvalWithConfig(
+	ctx context.Context,
+	node ast.Node,
+	env *object.Environment,
+	config Config,
+) object.Object {
+	if config.MaxCallDepth == 0 {
+		config.MaxCallDepth = DefaultMaxCallDepth
+	}
+	if config.Stdout == nil {
+		config.Stdout = os.Stdout
+	}
+	if config.Stderr == nil {
+		config.Stderr = os.Stderr
+	}
+	if config.Stdin == nil {
+		config.Stdin = os.Stdin
+	}
+	if config.Rand == nil {
+		config.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	// the tasks the evaluation spawns stop when it is done
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	e := &evaluation{
+		ctx:     ctx,
+		config:  config,
+		modules: newModuleCache(),
+		sched:   newScheduler(),
+	}
+	e.after, _ = config.Hook.(AfterHook)
+	if config.MaxSteps != 0 {
+		e.budget = new(atomic.Int64)
+	}
+	if config.MaxMemObjects != 0 {
+		e.allocated = new(atomic.Int64)
+	}
+	return e.sched.run(e, cancel, func() object.Object {
+		return e.eval(node, env)
+	})
+}
+
+func (e *evaluation) eval(node ast.Node, env *object.Environment) object.Object {
+	e.steps++
+	if e.steps%cancelCheckInterval == 0 {
+		e.sched.yield()
+		if err := e.ctx.Err(); err != nil {
+			return newError("%s", err)
+		}
+	}
+	if e.budget != nil && e.budget.Add(1) > int64(e.config.MaxSteps) {
+		return newError("execution budget exceeded")
+	}
+
+	if e.config.Hook != nil {
+		e.config.Hook.Before(node, env, e.stack)
+		if err := e.ctx.Err(); err != nil {
+			return newError("%s", err)
+		}
+		if e.after != nil {
+			result := e.evalNode(node, env)
+			e.after.After(node, result)
+			return result
+		}
+	}
+
+	return e.evalNode(node, env)
+}
+
+func (e *evaluation) evalNode(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+
+	// Statements
+	case *ast.Program:
+		return e.evalStatements(node.Statements, env)
+
+	case *ast.ExpressionStatement:
+		return e.eval(node.Expression, env)
+
+	case *ast.BlockStatement:
+		return e.evalBlockStatement(node, env)
+
+	case *ast.ReturnStatement:
+		if node.ReturnValue == nil {
+			return &object.ReturnValue{Value: NULL}
+		}
+		val := e.eval(node.ReturnValue, env)
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+
+	case *ast.ForInStatement:
+		return e.evalForInStatement(node, env)
+
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
+
+	case *ast.LetStatement:
+		return e.evalLetStatement(node, env)
+
+	// Expressions
+	case *ast.IntegerLiteral:
+		return object.NewInt(node.Value)
+
+	case *ast.Identifier:
+		return withPosition(evalIdentifier(node, env), node.Token)
+
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+
+	case *ast.TemplateLiteral:
+		return withPosition(e.allocate(e.evalTemplateLiteral(node, env)), node.Token)
+
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(node.Value)
+
+	case *ast.PrefixExpression:
+		right := e.eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		if node.Operator == "!" {
+			if _, err := e.condition(right); err != nil {
+				return withPosition(err, node.Token)
+			}
+		}
+		return withPosition(evalPrefixExpression(node.Operator, right, e.config.BigIntegers), node.Token)
+
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return withPosition(e.evalLogicalExpression(node, env), node.Token)
+		}
+
+		if node.Operator == "??" {
+			left := e.eval(node.Left, env)
+			if left != NULL {
+				return left
+			}
+			return e.eval(node.Right, env)
+		}
+
+		left := e.eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+
+		right := e.eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+
+		result := evalInfixExpression(node.Operator, left, right, e.config.BigIntegers)
+		if _, ok := result.(*object.String); ok {
+			result = e.allocate(result)
+		}
+		return withPosition(result, node.Token)
+
+	case *ast.IfExpression:
+		return e.evalIfExpression(node, env)
+
+	case *ast.TryExpression:
+		return e.evalTryExpression(node, env)
+
+	case *ast.MatchExpression:
+		return e.evalMatchExpression(node, env)
+
+	case *ast.AssignExpression:
+		val := e.eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+
+		if env.IsConst(node.Name.Value) {
+			err := newError("cannot assign to constant: %s", node.Name.Value)
+			return withPosition(err, node.Token)
+		}
+
+		if !env.Assign(node.Name.Value, val) {
+			err := newError("cannot assign to undeclared identifier: %s",
+				node.Name.Value)
+			return withPosition(err, node.Token)
+		}
+
+		return val
+
+	case *ast.IndexAssignExpression:
+		return withPosition(e.evalIndexAssignExpression(node, env), node.Token)
+
+	case *ast.ArrayLiteral:
+		elements := e.evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return withPosition(e.allocate(&object.Array{Elements: elements}), node.Token)
+
+	case *ast.IndexExpression:
+		left := e.eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+
+		index := e.eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+
+		return withPosition(evalIndexExpression(left, index, e.config.StrictIndexing), node.Token)
+
+	case *ast.SliceExpression:
+		return withPosition(e.allocate(e.evalSliceExpression(node, env)), node.Token)
+
+	case *ast.HashLiteral:
+		return withPosition(e.allocate(e.evalHashLiteral(node, env)), node.Token)
+
+	case *ast.SpawnExpression:
+		return withPosition(e.evalSpawnExpression(node, env), node.Token)
+
+	case *ast.StructLiteral:
+		fields := make([]string, len(node.Fields))
+		for i, f := range node.Fields {
+			fields[i] = f.Value
+		}
+		return &object.StructType{Fields: fields}
+
+	case *ast.FieldExpression:
+		return withPosition(e.evalFieldExpression(node, env), node.Token)
+
+	case *ast.ImportExpression:
+		return withPosition(e.evalImportExpression(node, env), node.Token)
+
+	case *ast.FunctionLiteral:
+		params := node.Parameters
+		body := node.Body
+		return &object.Function{Parameters: params, Env: env, Body: body, Variadic: node.Variadic}
+
+	case *ast.CallExpression:
+		function := e.eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+
+		args := e.evalArguments(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+
+		fn, ok := function.(*object.Function)
+		frame := Frame{Name: frameName(node.Function), Call: node.Token}
+		if !ok {
+			return withPosition(e.applyBuiltin(function, args, frame), node.Token)
+		}
+
+		if e.tailCalls[node] {
+			return &tailCall{fn: fn, args: args, frame: frame}
+		}
+
+		return withPosition(e.applyFrame(fn, args, frame), node.Token)
+
+	case *ast.MethodCallExpression:
+		return withPosition(e.evalMethodCallExpression(node, env), node.Token)
+
+	case *ast.SpreadExpression:
+		err := newError("'...' can only spread the last argument of a call")
+		return withPosition(err, node.Token)
+	}
+
+	return nil
+}
+
+func (e *evaluation) evalStatements(stmts []ast.Statement, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range stmts {
+		result = e.eval(statement, env)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		}
+	}
+
+	return result
+}
+
+func (e *evaluation) evalBlockStatement(
+	block *ast.BlockStatement,
+	env *object.Environment,
+) object.Object {
+	var result object.Object
+
+	for _, statement := range block.Statements {
+		result = e.eval(statement, env)
+
+		// stop without unwrapping, so the return value bubbles up to the
+		// enclosing function or program, and break or continue to the
+		// enclosing loop
+		if result != nil {
+			switch result.Type() {
+			case object.RETURN_VALUE_OBJ, object.ERROR_OBJ,
+				object.BREAK_OBJ, object.CONTINUE_OBJ:
+				return result
+			}
+		}
+	}
+
+	return result
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+func evalPrefixExpression(operator string, right object.Object, promote bool) object.Object {
+	switch operator {
+	case "!":
+		return evalBangOperatorExpression(right)
+	case "-":
+		return evalMinusPrefixOperatorExpression(right, promote)
+	default:
+		return newError("unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+func evalBangOperatorExpression(right object.Object) object.Object {
+	return nativeBoolToBooleanObject(!isTruthy(right))
+}
+
+func evalMinusPrefixOperatorExpression(right object.Object, promote bool) object.Object {
+	switch right := right.(type) {
+	case *object.Integer, *object.BigInteger:
+		return object.NegateInteger(right, promote)
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
+		return newError("unknown operator: -%s", right.Type())
+	}
+}
+
+func evalInfixExpression(
+	operator string,
+	left, right object.Object,
+	promote bool,
+) object.Object {
+	switch {
+	case operator == "..":
+		r, err := object.NewRange(left, right)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return r
+	case object.IsInteger(left) && object.IsInteger(right):
+		return evalIntegerInfixExpression(operator, left, right, promote)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
+	case operator == "==":
+		return nativeBoolToBooleanObject(object.Equal(left, right))
+	case operator == "!=":
+		return nativeBoolToBooleanObject(!object.Equal(left, right))
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s",
+			left.Type(), operator, right.Type())
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+// evalIntegerInfixExpression handles integers, which are big integers
+// when promote is set and a result outgrew int64.
+func evalIntegerInfixExpression(
+	operator string,
+	left, right object.Object,
+	promote bool,
+) object.Object {
+	switch operator {
+	case "+", "-", "*", "/", "%", "**":
+		result, err := object.IntegerArithmetic(operator, left, right, promote)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return result
+	}
+
+	cmp := object.CompareIntegers(left, right)
+
+	switch operator {
+	case "<":
+		return nativeBoolToBooleanObject(cmp < 0)
+	case ">":
+		return nativeBoolToBooleanObject(cmp > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(cmp <= 0)
+	case ">=":
+		return nativeBoolToBooleanObject(cmp >= 0)
+	case "==":
+		return nativeBoolToBooleanObject(cmp == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(cmp != 0)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+// evalFloatInfixExpression handles arithmetic and comparison where at
+// least one operand is a float. Integer operands are converted to floats,
+// so the result of arithmetic is always a float.
+func evalFloatInfixExpression(
+	operator string,
+	left, right object.Object,
+) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return object.IsInteger(obj) || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInteger:
+		return obj.Float64()
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
+
+func evalStringInfixExpression(
+	operator string,
+	left, right object.Object,
+) object.Object {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+// evalLogicalExpression evaluates `&&` and `||`. The right operand is only
+// evaluated when the left one does not already decide the result, and the
+// result is always a boolean.
+func (e *evaluation) evalLogicalExpression(
+	node *ast.InfixExpression,
+	env *object.Environment,
+) object.Object {
+	left := e.eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	holds, err := e.condition(left)
+	if err != nil {
+		return withPosition(err, ast.Pos(node.Left))
+	}
+
+	if node.Operator == "&&" && !holds {
+		return FALSE
+	}
+
+	if node.Operator == "||" && holds {
+		return TRUE
+	}
+
+	right := e.eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+
+	holds, err = e.condition(right)
+	if err != nil {
+		return withPosition(err, ast.Pos(node.Right))
+	}
+	return nativeBoolToBooleanObject(holds)
+}
+
+func (e *evaluation) evalTemplateLiteral(
+	tmpl *ast.TemplateLiteral,
+	env *object.Environment,
+) object.Object {
+	var out bytes.Buffer
+
+	for _, part := range tmpl.Parts {
+		val := e.eval(part, env)
+		if isError(val) {
+			return val
+		}
+
+		if str, ok := val.(*object.String); ok {
+			out.WriteString(str.Value)
+		} else {
+			out.WriteString(val.Inspect())
+		}
+	}
+
+	return &object.String{Value: out.String()}
+}
+
+// evalForInStatement runs the loop body once per element of an array,
+// integer of a range, character of a string or key of a hash. With two loop variables the
+// first one receives the index or key. Each iteration gets a scope of its
+// own, so loop variables don't leak out of the loop.
+func (e *evaluation) evalForInStatement(
+	fs *ast.ForInStatement,
+	env *object.Environment,
+) object.Object {
+	iterable := e.eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	// the keys are the indexes unless set, and the integers of a range
+	// are made as the loop reaches them
+	var keys, values []object.Object
+	var rng *object.Range
+
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		values = iterable.Elements
+
+	case *object.Range:
+		rng = iterable
+
+	case *object.String:
+		for _, r := range iterable.Value {
+			values = append(values, &object.String{Value: string(r)})
+		}
+
+	case *object.Hash:
+		for _, pair := range iterable.Ordered() {
+			keys = append(keys, pair.Key)
+			values = append(values, pair.Value)
+		}
+		if fs.Key == nil {
+			values = keys
+		}
+
+	default:
+		err := newError("cannot iterate over %s", iterable.Type())
+		return withPosition(err, fs.Token)
+	}
+
+	for i := int64(0); ; i++ {
+		var key, value object.Object = object.NewInt(i), nil
+		switch {
+		case rng != nil:
+			n, ok := rng.At(i)
+			if !ok {
+				return nil
+			}
+			value = object.NewInt(n)
+		case i >= int64(len(values)):
+			return nil
+		case keys != nil:
+			key, value = keys[i], values[i]
+		default:
+			value = values[i]
+		}
+
+		loopEnv := object.NewEnclosedEnvironment(env)
+		if fs.Key != nil {
+			loopEnv.Set(fs.Key.Value, key)
+		}
+		loopEnv.Set(fs.Value.Value, value)
+
+		result := e.eval(fs.Body, loopEnv)
+		if result != nil {
+			switch result.Type() {
+			case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+				return result
+			case object.BREAK_OBJ:
+				return nil
+			}
+		}
+	}
+}
+
+func (e *evaluation) evalIfExpression(
+	ie *ast.IfExpression,
+	env *object.Environment,
+) object.Object {
+	condition := e.eval(ie.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+
+	holds, err := e.condition(condition)
+	if err != nil {
+		return withPosition(err, ast.Pos(ie.Condition))
+	}
+
+	if holds {
+		return e.eval(ie.Consequence, env)
+	} else if ie.Alternative != nil {
+		return e.eval(ie.Alternative, env)
+	} else {
+		return NULL
+	}
+}
+
+func (e *evaluation) evalLetStatement(
+	ls *ast.LetStatement,
+	env *object.Environment,
+) object.Object {
+	names := []*ast.Identifier{ls.Name}
+	if ls.Pattern != nil {
+		names = ls.Pattern.Names
+	}
+
+	for _, name := range names {
+		if env.HasConst(name.Value) {
+			err := newError("cannot redeclare constant: %s", name.Value)
+			return withPosition(err, name.Token)
+		}
+	}
+
+	val := e.eval(ls.Value, env)
+	if isError(val) {
+		return val
+	}
+
+	// a struct type is named after the first name it is bound to
+	if st, ok := val.(*object.StructType); ok && st.Name == "" && ls.Pattern == nil {
+		st.Name = ls.Name.Value
+	}
+
+	values := []object.Object{val}
+	if ls.Pattern != nil {
+		var err *object.Error
+		values, err = destructure(ls.Pattern, val)
+		if err != nil {
+			return withPosition(err, ls.Pattern.Token)
+		}
+	}
+
+	for i, name := range names {
+		if ls.IsConst() {
+			env.SetConst(name.Value, values[i])
+		} else {
+			env.Set(name.Value, values[i])
+		}
+	}
+
+	return nil
+}
+
+// destructure returns the values that pattern binds from val, one for each
+// of its names, or an error if val does not have the pattern's shape.
+func destructure(pattern *ast.DestructurePattern, val object.Object) ([]object.Object, *object.Error) {
+	values := make([]object.Object, 0, len(pattern.Names))
+
+	if !pattern.IsHash() {
+		array, ok := val.(*object.Array)
+		if !ok {
+			return nil, newError("cannot destructure %s as an array", val.Type())
+		}
+		if len(array.Elements) != len(pattern.Names) {
+			return nil, newError("cannot destructure array of %d elements into %d names",
+				len(array.Elements), len(pattern.Names))
+		}
+		return append(values, array.Elements...), nil
+	}
+
+	hash, ok := val.(*object.Hash)
+	if !ok {
+		return nil, newError("cannot destructure %s as a hash", val.Type())
+	}
+	for _, name := range pattern.Names {
+		key := &object.String{Value: name.Value}
+		pair, ok := hash.Pairs[key.HashKey()]
+		if !ok {
+			return nil, newError("key not found in hash: %s", name.Value)
+		}
+		values = append(values, pair.Value)
+	}
+	return values, nil
+}
+
+// evalMatchExpression evaluates the body of the first arm whose pattern
+// equals the subject, as == has it, or gives null if none does.
+func (e *evaluation) evalMatchExpression(
+	me *ast.MatchExpression,
+	env *object.Environment,
+) object.Object {
+	subject := e.eval(me.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, arm := range me.Arms {
+		if arm.Pattern != nil {
+			pattern := e.eval(arm.Pattern, env)
+			if isError(pattern) {
+				return pattern
+			}
+			if evalInfixExpression("==", subject, pattern, false) != TRUE {
+				continue
+			}
+		}
+		return e.eval(arm.Body, env)
+	}
+
+	return NULL
+}
+
+// evalTryExpression runs the handler in place of a block that fails, with
+// the error's message bound to the handler's parameter. Running out of
+// time is not an error a program can recover from.
+func (e *evaluation) evalTryExpression(
+	te *ast.TryExpression,
+	env *object.Environment,
+) object.Object {
+	result := e.eval(te.Block, env)
+	if result == nil {
+		return NULL
+	}
+
+	errObj, ok := result.(*object.Error)
+	if !ok || errObj.Exit != nil || e.ctx.Err() != nil || e.overBudget() || e.overMemory() {
+		return result
+	}
+
+	env.Set(te.Param.Value, &object.String{Value: errObj.Message})
+	result = e.eval(te.Handler, env)
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+func evalIdentifier(
+	node *ast.Identifier,
+	env *object.Environment,
+) object.Object {
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+
+	if builtin, ok := builtins[node.Value]; ok {
+		return builtin
+	}
+
+	return newError("identifier not found: %s", node.Value)
+}
+
+// applyFrame applies fn in a frame of its own. An error fn fails with
+// gets the stack it happened in, unless a call inside fn gave it one.
+func (e *evaluation) applyFrame(fn object.Object, args []object.Object, frame Frame) object.Object {
+	e.stack = append(e.stack, frame)
+	result := e.applyFunction(fn, args)
+	if err, ok := result.(*object.Error); ok && err.Stack == nil && err.Exit == nil {
+		err.Stack = e.trace()
+	}
+	e.stack = e.stack[:len(e.stack)-1]
+	return result
+}
+
+// applyBuiltin applies fn, which is not a Monkey function, for the call
+// frame.
+func (e *evaluation) applyBuiltin(fn object.Object, args []object.Object, frame Frame) object.Object {
+	outer := e.builtin
+	e.builtin = frame
+	defer func() { e.builtin = outer }()
+	return e.applyFunction(fn, args)
+}
+
+// trace returns the calls in progress as the stack of an error, innermost
+// first.
+func (e *evaluation) trace() []object.StackFrame {
+	stack := make([]object.StackFrame, len(e.stack))
+	for i, frame := range e.stack {
+		stack[len(stack)-1-i] = object.StackFrame{
+			Function: frame.Name,
+			Line:     frame.Call.Line,
+			Column:   frame.Call.Column,
+		}
+	}
+	return stack
+}
+
+// frameName names the function a call calls after the expression calling
+// it, unless that is a function literal.
+func frameName(function ast.Expression) string {
+	if _, ok := function.(*ast.FunctionLiteral); ok {
+		return "anonymous function"
+	}
+	return function.String()
+}
+
+func (e *evaluation) applyFunction(fn object.Object, args []object.Object) object.Object {
+	switch fn := fn.(type) {
+	case *object.Function:
+		if err := checkArguments(fn, args); err != nil {
+			return err
+		}
+
+		if e.depth >= e.config.MaxCallDepth {
+			return newError("stack overflow")
+		}
+
+		e.depth++
+		defer func() { e.depth-- }()
+
+		// set once a tail call replaces fn, whose errors then belong to
+		// the tail call rather than to the original one
+		var tok *token.Token
+
+		for {
+			e.markTailCalls(fn.Body)
+
+			evaluated := e.eval(fn.Body, extendFunctionEnv(fn, args))
+			if evaluated == nil {
+				return NULL
+			}
+
+			result := unwrapReturnValue(evaluated)
+			tc, ok := result.(*tailCall)
+			if !ok {
+				if tok != nil {
+					return withPosition(result, *tok)
+				}
+				return result
+			}
+
+			if err := checkArguments(tc.fn, tc.args); err != nil {
+				return withPosition(err, tc.frame.Call)
+			}
+			fn, args, tok = tc.fn, tc.args, &tc.frame.Call
+
+			// the tail call takes over the frame of the call it replaces
+			if len(e.stack) > 0 {
+				e.stack[len(e.stack)-1] = tc.frame
+			}
+		}
+
+	case *object.Builtin:
+		var result object.Object
+		if fn.RuntimeFn != nil {
+			result = fn.RuntimeFn(e, args...)
+		} else {
+			result = fn.Fn(args...)
+		}
+		if e.allocated != nil && object.IsNew(result, args) {
+			return e.allocate(result)
+		}
+		return result
+	case *object.StructType:
+		if len(args) != len(fn.Fields) {
+			return newError("wrong number of arguments: want=%d, got=%d",
+				len(fn.Fields), len(args))
+		}
+		values := make([]object.Object, len(args))
+		copy(values, args)
+		return &object.Instance{Struct: fn, Values: values}
+	default:
+		return newError("not a function: %s", fn.Type())
+	}
+}
+
+func (e *evaluation) evalFieldExpression(
+	fe *ast.FieldExpression,
+	env *object.Environment,
+) object.Object {
+	receiver := e.eval(fe.Receiver, env)
+	if isError(receiver) {
+		return receiver
+	}
+
+	if fe.Optional && receiver == NULL {
+		return NULL
+	}
+
+	instance, ok := receiver.(*object.Instance)
+	if !ok {
+		return newError("cannot access field `%s` of %s", fe.Field.Value, receiver.Type())
+	}
+
+	val, ok := instance.Field(fe.Field.Value)
+	if !ok {
+		return newError("unknown field `%s` for %s",
+			fe.Field.Value, instance.Struct.TypeName())
+	}
+	return val
+}
+
+// evalSpawnExpression starts the function, which must take no arguments,
+// as a task of its own and returns a channel its result will be sent on.
+// If the function fails, the error is sent instead, and recv raises it in
+// whichever task receives it; if no task does, the evaluation fails with
+// it.
+//
+// The new task gets its own evaluation state and, like any call, its own
+// environment enclosing the function's. It takes turns with the other
+// tasks, as the scheduler arranges, so the values they share need no
+// locking.
+func (e *evaluation) evalSpawnExpression(
+	se *ast.SpawnExpression,
+	env *object.Environment,
+) object.Object {
+	fn := e.eval(se.Function, env)
+	if isError(fn) {
+		return fn
+	}
+
+	function, ok := fn.(*object.Function)
+	if !ok {
+		return newError("cannot spawn %s, want FUNCTION", fn.Type())
+	}
+	if err := checkArguments(function, nil); err != nil {
+		return err
+	}
+
+	// a generator must not be shared between goroutines, so the task
+	// gets its own, seeded from this one to stay reproducible
+	config := e.config
+	config.Rand = rand.New(rand.NewSource(e.config.Rand.Int63()))
+
+	child := &evaluation{
+		ctx:       e.ctx,
+		config:    config,
+		after:     e.after,
+		budget:    e.budget,
+		allocated: e.allocated,
+		modules:   e.modules,
+		sched:     e.sched,
+	}
+
+	return e.sched.spawn(child, func() object.Object {
+		return child.applyFunction(function, nil)
+	})
+}
+
+func (e *evaluation) overBudget() bool {
+	return e.budget != nil && e.budget.Load() > int64(e.config.MaxSteps)
+}
+
+// allocate counts obj, a value the program just created, against the
+// memory limit. It returns obj, or an error once the limit is exceeded.
+func (e *evaluation) allocate(obj object.Object) object.Object {
+	if e.allocated == nil || isError(obj) {
+		return obj
+	}
+	return e.charge(object.Size(obj), obj)
+}
+
+// charge counts size more against the memory limit, returning obj, or an
+// error once the limit is exceeded.
+func (e *evaluation) charge(size int, obj object.Object) object.Object {
+	if e.allocated != nil && e.allocated.Add(int64(size)) > int64(e.config.MaxMemObjects) {
+		return newError("memory limit exceeded")
+	}
+	return obj
+}
+
+func (e *evaluation) overMemory() bool {
+	return e.allocated != nil && e.allocated.Load() > int64(e.config.MaxMemObjects)
+}
+
+// Call lets builtins like map and sort call the functions they are given.
+func (e *evaluation) Call(fn object.Object, args ...object.Object) object.Object {
+	// fn gets a frame of its own, for tail calls in it to replace rather
+	// than the frame of the function calling the builtin
+	frame := Frame{Name: "function passed to " + e.builtin.Name, Call: e.builtin.Call}
+	return e.applyFrame(fn, args, frame)
+}
+
+func (e *evaluation) Stdout() io.Writer { return e.config.Stdout }
+func (e *evaluation) Stderr() io.Writer { return e.config.Stderr }
+func (e *evaluation) Stdin() io.Reader  { return e.config.Stdin }
+func (e *evaluation) AllowFS() bool     { return e.config.AllowFS }
+func (e *evaluation) AllowNet() bool    { return e.config.AllowNet }
+func (e *evaluation) AllowEnv() bool    { return e.config.AllowEnv }
+func (e *evaluation) AllowExec() bool   { return e.config.AllowExec }
+func (e *evaluation) AllowExit() bool   { return e.config.AllowExit }
+func (e *evaluation) Args() []string    { return e.config.Args }
+
+func (e *evaluation) Context() context.Context { return e.ctx }
+func (e *evaluation) Rand() *rand.Rand         { return e.config.Rand }
+
+// checkArguments returns an error if fn cannot be called with args. A
+// variadic function needs at least one argument for each parameter but the
+// last.
+func checkArguments(fn *object.Function, args []object.Object) *object.Error {
+	want := len(fn.Parameters)
+	switch {
+	case fn.Variadic && len(args) < want-1:
+		return newError("wrong number of arguments: want at least %d, got=%d",
+			want-1, len(args))
+	case !fn.Variadic && len(args) != want:
+		return newError("wrong number of arguments: want=%d, got=%d",
+			want, len(args))
+	}
+	return nil
+}
+
+func extendFunctionEnv(
+	fn *object.Function,
+	args []object.Object,
+) *object.Environment {
+	env := object.NewEnclosedEnvironment(fn.Env)
+
+	params := fn.Parameters
+	if fn.Variadic {
+		last := len(params) - 1
+		rest := make([]object.Object, len(args)-last)
+		copy(rest, args[last:])
+		env.Set(params[last].Value, &object.Array{Elements: rest})
+		params = params[:last]
+	}
+
+	for paramIdx, param := range params {
+		env.Set(param.Value, args[paramIdx])
+	}
+
+	return env
+}
+
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+
+	return obj
+}
+
+func (e *evaluation) evalExpressions(
+	exps []ast.Expression,
+	env *object.Environment,
+) []object.Object {
+	var result []object.Object
+
+	for _, exp := range exps {
+		evaluated := e.eval(exp, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+// evalArguments is evalExpressions for the arguments of a call, which
+// passes the elements of a spread array as separate arguments.
+func (e *evaluation) evalArguments(
+	exps []ast.Expression,
+	env *object.Environment,
+) []object.Object {
+	var result []object.Object
+
+	for _, exp := range exps {
+		spread, ok := exp.(*ast.SpreadExpression)
+		if !ok {
+			evaluated := e.eval(exp, env)
+			if isError(evaluated) {
+				return []object.Object{evaluated}
+			}
+			result = append(result, evaluated)
+			continue
+		}
+
+		evaluated := e.eval(spread.Value, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		array, ok := evaluated.(*object.Array)
+		if !ok {
+			err := newError("cannot spread %s, want ARRAY", evaluated.Type())
+			return []object.Object{withPosition(err, spread.Token)}
+		}
+		result = append(result, array.Elements...)
+	}
+
+	return result
+}
+
+func (e *evaluation) evalSliceExpression(
+	se *ast.SliceExpression,
+	env *object.Environment,
+) object.Object {
+	left := e.eval(se.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	bounds := []object.Object{NULL, NULL}
+	for i, exp := range []ast.Expression{se.Start, se.End} {
+		if exp == nil {
+			continue
+		}
+		bounds[i] = e.eval(exp, env)
+		if isError(bounds[i]) {
+			return bounds[i]
+		}
+	}
+
+	result, err := object.Slice(left, bounds[0], bounds[1])
+	if err != nil {
+		return newError("%s", err)
+	}
+	return result
+}
+
+// evalIndexAssignExpression stores a value in an array or hash. The
+// container is changed in place, so every binding that refers to it sees
+// the new value.
+func (e *evaluation) evalIndexAssignExpression(
+	ia *ast.IndexAssignExpression,
+	env *object.Environment,
+) object.Object {
+	left := e.eval(ia.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	index := e.eval(ia.Index, env)
+	if isError(index) {
+		return index
+	}
+
+	val := e.eval(ia.Value, env)
+	if isError(val) {
+		return val
+	}
+
+	// a new key grows a hash
+	size := object.Size(left)
+	if err := object.SetIndex(left, index, val); err != nil {
+		return newError("%s", err)
+	}
+	return e.charge(object.Size(left)-size, val)
+}
+
+func evalIndexExpression(left, index object.Object, strict bool) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalArrayIndexExpression(left, index, strict)
+	case left.Type() == object.HASH_OBJ:
+		return evalHashIndexExpression(left, index)
+	case left.Type() == object.MODULE_OBJ && index.Type() == object.STRING_OBJ:
+		return evalModuleIndexExpression(left, index)
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+func evalArrayIndexExpression(array, index object.Object, strict bool) object.Object {
+	arrayObject := array.(*object.Array)
+	idx := index.(*object.Integer).Value
+	max := int64(len(arrayObject.Elements) - 1)
+
+	if idx < 0 || idx > max {
+		if strict {
+			return newError("index out of range: %d (length %d)",
+				idx, len(arrayObject.Elements))
+		}
+		return NULL
+	}
+
+	return arrayObject.Elements[idx]
+}
+
+func (e *evaluation) evalHashLiteral(
+	node *ast.HashLiteral,
+	env *object.Environment,
+) object.Object {
+	hash := object.NewHash(len(node.Pairs))
+
+	for _, pair := range node.Pairs {
+		key := e.eval(pair.Key, env)
+		if isError(key) {
+			return key
+		}
+
+		if _, ok := key.(object.Hashable); !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+
+		value := e.eval(pair.Value, env)
+		if isError(value) {
+			return value
+		}
+
+		hash.Set(key, value)
+	}
+
+	return hash
+}
+
+func evalHashIndexExpression(hash, index object.Object) object.Object {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
+		return NULL
+	}
+
+	return pair.Value
+}
+
+func isTruthy(obj object.Object) bool {
+	return object.IsTruthy(obj)
+}
+
+// condition returns whether cond, the value of a condition, holds. Unless
+// StrictBool is set, any value can be a condition.
+func (e *evaluation) condition(cond object.Object) (bool, *object.Error) {
+	if e.config.StrictBool && cond.Type() != object.BOOLEAN_OBJ {
+		return false, newError("non-boolean condition: %s", cond.Type())
+	}
+	return isTruthy(cond), nil
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// withPosition stamps an error produced while evaluating the expression
+// starting at tok with that token's position. Errors that already carry a
+// position came from a more deeply nested expression and are left alone.
+func withPosition(obj object.Object, tok token.Token) object.Object {
+	if err, ok := obj.(*object.Error); ok && err.Line == 0 {
+		err.Line = tok.Line
+		err.Column = tok.Column
+	}
+	return obj
+}
+
+func isError(obj object.Object) bool {
+	if obj != nil {
+		return obj.Type() == object.ERROR_OBJ
+	}
+	return false
+}
@@ -0,0 +1,2655 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"monkey/ast"
+	"monkey/bench"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * (5 + 10)", 30},
+		{"3 * 3 * 3 + 10", 37},
+		{"3 * (3 * 3) + 10", 37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"10 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 + 10 % 4 * 3", 8},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"7 ** 0", 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"false != true", true},
+		{"(1 < 2) == true", true},
+		{"(1 < 2) == false", false},
+		{"(1 > 2) == true", false},
+		{"(1 > 2) == false", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"1.5 >= 1", true},
+		{"1 <= 0.5", false},
+		{`"a" < "b"`, true},
+		{`"b" <= "a"`, false},
+		{`"abc" >= "abc"`, true},
+		{`"b" > "abc"`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestDeepEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"[1, 2] == [1, 2]", true},
+		{"[1, 2] != [1, 2]", false},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, [2, 3]] == [1, [2, 3]]", true},
+		{"[1, 2] == [1, 2, 3]", false},
+		{"[1] == [1.0]", true},
+		{"[] == []", true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`{"a": 1} != {"a": 1, "b": 2}`, true},
+		{"1..3 == 1..3", true},
+		{"1..3 == 1..4", false},
+		{"let P = struct { x, y }; P(1, [2]) == P(1, [2])", true},
+		{"let P = struct { x }; let Q = struct { x }; P(1) == Q(1)", false},
+		{`[1] == "[1]"`, false},
+		{`first([]) == first([])`, true},
+		{`first([]) == false`, false},
+		{`first([]) == []`, false},
+		{"fn(x) { x } == fn(x) { x }", false},
+		{"let f = fn(x) { x }; f == f", true},
+		{"[len] == [len]", true},
+		{"let a = [1]; a[0] = a; let b = [1]; b[0] = b; a == b", true},
+		{"let a = [1, 2]; a[0] = a; let b = [1, 3]; b[0] = b; a == b", false},
+		{`match ([1, 2]) { [1, 2] => true, _ => false }`, true},
+		{"equals([1, {\"a\": 2}], [1, {\"a\": 2}])", true},
+		{"equals(1, 2)", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if !testBooleanObject(t, evaluated, tt.expected) {
+			t.Errorf("for %q", tt.input)
+		}
+	}
+}
+
+func TestBangOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!false", false},
+		{"!!5", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func testEval(input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	return Eval(program, env)
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{
+			"5 + true;",
+			"type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			"5 + true; 5;",
+			"type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			"-true",
+			"unknown operator: -BOOLEAN",
+		},
+		{
+			"true + false;",
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			"5; true + false; 5",
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			"-(true + false) * 5",
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			`
+if (10 > 1) {
+  if (10 > 1) {
+    return true + false;
+  }
+
+  return 1;
+}
+`,
+			"unknown operator: BOOLEAN + BOOLEAN",
+		},
+		{
+			"foobar",
+			"identifier not found: foobar",
+		},
+		{
+			"10 / 0",
+			"division by zero",
+		},
+		{
+			"let f = fn(x) { x % 0 }; f(10); 5",
+			"modulo by zero",
+		},
+		{
+			"foobar = 5",
+			"cannot assign to undeclared identifier: foobar",
+		},
+		{
+			`"Hello" - "World"`,
+			"unknown operator: STRING - STRING",
+		},
+		{
+			`{"name": "Monkey"}[[1, 2]];`,
+			"unusable as hash key: ARRAY",
+		},
+		{
+			`{[1]: 2}`,
+			"unusable as hash key: ARRAY",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLine    int
+		expectedColumn  int
+		expectedInspect string
+	}{
+		{"5 + true;", 1, 3, "ERROR: type mismatch: INTEGER + BOOLEAN at line 1, column 3"},
+		{"let x = 1;\n  -true", 2, 3, "ERROR: unknown operator: -BOOLEAN at line 2, column 3"},
+		{"1 + foobar", 1, 5, "ERROR: identifier not found: foobar at line 1, column 5"},
+		{"let f = fn() {\n  1 / 0\n};\nf();", 2, 5, "ERROR: division by zero at line 2, column 5"},
+		{`len(1, 2)`, 1, 4, "ERROR: wrong number of arguments. got=2, want=1 at line 1, column 4"},
+		{"[1][true]", 1, 4, "ERROR: index operator not supported: ARRAY at line 1, column 4"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Line != tt.expectedLine || errObj.Column != tt.expectedColumn {
+			t.Errorf("%q: wrong position. expected=%d:%d, got=%d:%d", tt.input,
+				tt.expectedLine, tt.expectedColumn, errObj.Line, errObj.Column)
+		}
+
+		if errObj.Inspect() != tt.expectedInspect {
+			t.Errorf("wrong Inspect. expected=%q, got=%q",
+				tt.expectedInspect, errObj.Inspect())
+		}
+	}
+}
+
+func TestErrorStack(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedTrace string
+	}{
+		{"1 + true", "ERROR: type mismatch: INTEGER + BOOLEAN at line 1, column 3"},
+		{
+			"let g = fn(x) {\n  x + true\n};\nlet f = fn(x) { let y = g(x); y };\nf(1);",
+			"ERROR: type mismatch: INTEGER + BOOLEAN at line 2, column 5\n" +
+				"\tin g, called at line 4, column 26\n" +
+				"\tin f, called at line 5, column 2",
+		},
+		{
+			// the tail call to g replaces the frame of f
+			"let g = fn() { 1 / 0 };\nlet f = fn() { g() };\nf();",
+			"ERROR: division by zero at line 1, column 18\n" +
+				"\tin g, called at line 2, column 17",
+		},
+		{
+			"let f = fn(x) { len(x) };\nlet h = fn(xs) { let r = map(xs, fn(x) { 1 + f(x) }); r };\nh([1]);",
+			"ERROR: argument to `len` not supported, got INTEGER at line 1, column 20\n" +
+				"\tin f, called at line 2, column 47\n" +
+				"\tin function passed to map, called at line 2, column 29\n" +
+				"\tin h, called at line 3, column 2",
+		},
+		{
+			"fn() { -true }();",
+			"ERROR: unknown operator: -BOOLEAN at line 1, column 8\n" +
+				"\tin anonymous function, called at line 1, column 15",
+		},
+		{
+			// the frames of a stack overflow are collapsed
+			"let f = fn(n) { 1 + f(n) };\nlet g = fn() { f(1) };\ng();",
+			"ERROR: stack overflow at line 1, column 22\n" +
+				"\tin f, called at line 1, column 22\n" +
+				"\t... previous frame repeated 9999 more times\n" +
+				"\tin f, called at line 2, column 17",
+		},
+		{
+			// caught errors leave no stack on the errors that follow
+			"let f = fn() { 1 / 0 };\nlet e = try { f() } catch (e) { e };\n-e",
+			"ERROR: unknown operator: -STRING at line 3, column 1",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Trace() != tt.expectedTrace {
+			t.Errorf("wrong Trace for %q.\nexpected=%q\ngot=%q",
+				tt.input, tt.expectedTrace, errObj.Trace())
+		}
+	}
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 < 2) { 10 } else { 20 } * 2", 20},
+		{"5 + if (1 > 2) { 10 } else { 20 }", 25},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"if (10 > 1) { return 10; }", 10},
+		{
+			`
+if (10 > 1) {
+  if (10 > 1) {
+    return 10;
+  }
+
+  return 1;
+}
+`,
+			10,
+		},
+		{
+			`
+let f = fn(x) {
+  return x;
+  x + 10;
+};
+f(10);`,
+			10,
+		},
+		{
+			`
+let f = fn(x) {
+   let result = x + 10;
+   return result;
+   return 10;
+};
+f(10);`,
+			20,
+		},
+		{
+			`
+let f = fn(x) {
+  if (x > 5) { return x; }
+  0
+};
+f(10) + f(1);`,
+			10,
+		},
+		{"let f = fn() { return; 10 }; f();", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj != NULL {
+		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		return false
+	}
+	return true
+}
+
+func TestStringLiteral(t *testing.T) {
+	input := `"Hello World!"`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringConcatenation(t *testing.T) {
+	input := `"Hello" + " " + "World!"`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringInterpolation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let name = "Monkey"; "Hello, ${name}!"`, "Hello, Monkey!"},
+		{`"${1 + 2} is three"`, "3 is three"},
+		{`"${true}, ${[1, 2]}, ${"nested ${1}"}"`, "true, [1, 2], nested 1"},
+		{`let h = {"a": 1}; "a=${h["a"]}"`, "a=1"},
+		{`"\${literal}"`, "${literal}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if str.Value != tt.expected {
+			t.Errorf("String has wrong value. want=%q, got=%q", tt.expected, str.Value)
+		}
+	}
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"a" + "b" == "ab"`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d",
+			len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][2]", 3},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"[[1, 2], [3, 4]][1][0]", 3},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestRangesAndSlices(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the result's Inspect, or the error message
+	}{
+		{"1..5", "1..5"},
+		{"let n = 3; 0..n * 2", "0..6"},
+		{"len(2..5); (5..2).len()", "0"},
+		{"let sum = 0; for (i in 1..5) { sum = sum + i }; sum", "10"},
+		{"let n = 0; for (i, x in 10..13) { n = n + i * x }; n", "35"},
+		{"let n = 0; for (x in 3..3) { n = n + 1 }; n", "0"},
+		{"[1, 2, 3, 4, 5][1:3]", "[2, 3]"},
+		{"[1, 2, 3, 4, 5][:2]", "[1, 2]"},
+		{"[1, 2, 3, 4, 5][3:]", "[4, 5]"},
+		{"[1, 2, 3, 4, 5][-2:]", "[4, 5]"},
+		{"[1, 2, 3, 4, 5][:-1]", "[1, 2, 3, 4]"},
+		{"[1, 2, 3][1:99]", "[2, 3]"},
+		{"[1, 2, 3][-99:1]", "[1]"},
+		{"[1, 2, 3][2:1]", "[]"},
+		{"let a = [1, 2]; let b = a[:]; push(b, 3); a", "[1, 2]"},
+		{`"héllo"[1:3]`, "él"},
+		{`"hello"[-3:]`, "llo"},
+		{`"abc"[5:]`, ""},
+		{"1..true", "range bounds must be INTEGER, got INTEGER..BOOLEAN"},
+		{"1.5..2", "range bounds must be INTEGER, got FLOAT..INTEGER"},
+		{`[1, 2]["a":]`, "slice index must be INTEGER, got STRING"},
+		{"5[1:2]", "slice operator not supported: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: want %q, got %v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestIndexAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the result's Inspect, or the error message
+	}{
+		{"let a = [1, 2, 3]; a[0] = 5; a", "[5, 2, 3]"},
+		{"let a = [1, 2, 3]; a[1] = 7", "7"},
+		{"let a = [1, 2]; let b = a; b[0] = 9; a", "[9, 2]"},
+		{"let a = [[1], [2]]; a[1][0] = 3; a", "[[1], [3]]"},
+		{"let a = [0, 0]; for (i in 0..2) { a[i] += i + 1 }; a", "[1, 2]"},
+		{`let h = {"a": 1}; h["a"] = 2; h["b"] = 3; h["a"] * 10 + h["b"]`, "23"},
+		{`let h = {}; let set = fn(k, v) { h[k] = v }; set(true, 1); h[true]`, "1"},
+		{"const a = [1]; a[0] = 2; a", "[2]"},
+		{"let a = [1]; a[1] = 2", "index out of range: 1 (length 1)"},
+		{"let a = [1]; a[-1] = 2", "index out of range: -1 (length 1)"},
+		{`let a = [1]; a["0"] = 2`, "array index must be INTEGER, got STRING"},
+		{"let h = {}; h[[1]] = 2", "unusable as hash key: ARRAY"},
+		{`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING"},
+		{"let a = [1]; a[0] = b", "identifier not found: b"},
+		{"let a = [0]; a[0] = a; a", "[[...]]"},
+		{`let h = {}; h["self"] = h; [h]`, "[{self: {...}}]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: want %q, got %v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestStrictArrayIndexing(t *testing.T) {
+	l := lexer.New("[1, 2, 3][3]")
+	program := parser.New(l).ParseProgram()
+	evaluated := EvalWithConfig(context.Background(), program, object.NewEnvironment(), Config{StrictIndexing: true})
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	expected := "index out of range: 3 (length 3)"
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+	}
+
+	if got := testEval("[1, 2, 3][3]"); got != NULL {
+		t.Errorf("expected null without StrictIndexing. got=%T(%+v)", got, got)
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `{
+		"one": 10 - 9,
+		"two": 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		TRUE.HashKey():                             5,
+		FALSE.HashKey():                            6,
+	}
+
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+		}
+
+		testIntegerObject(t, pair.Value, expectedValue)
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len("π≈3")`, 3},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, nil},
+		{`last(1)`, "argument to `last` must be ARRAY, got INTEGER"},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([])`, nil},
+		{`push([], 1)`, []int{1}},
+		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`len(keys({}))`, 0},
+		{`values({"a": 1})`, []int{1}},
+		{`keys([1])`, "argument to `keys` must be HASH, got ARRAY"},
+		{`values(1)`, "argument to `values` must be HASH, got INTEGER"},
+		{`puts()`, nil},
+		{`5()`, "not a function: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong num of elements. want=%d, got=%d",
+					len(expected), len(array.Elements))
+				continue
+			}
+
+			for i, expectedElem := range expected {
+				testIntegerObject(t, array.Elements[i], int64(expectedElem))
+			}
+		}
+	}
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	RegisterBuiltin("double", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	})
+	defer delete(builtins, "double")
+
+	testIntegerObject(t, testEval("double(21)"), 42)
+}
+
+func TestRegisterRuntimeBuiltin(t *testing.T) {
+	RegisterRuntimeBuiltin("fetch", func(rt object.Runtime, args ...object.Object) object.Object {
+		if !rt.AllowNet() {
+			return newError("`fetch` is not allowed: network access is disabled")
+		}
+		return &object.String{Value: "fetched"}
+	})
+	defer delete(builtins, "fetch")
+
+	program := parser.New(lexer.New("fetch()")).ParseProgram()
+
+	denied := EvalWithConfig(context.Background(), program, object.NewEnvironment(), Config{})
+	errObj, ok := denied.(*object.Error)
+	if !ok || errObj.Message != "`fetch` is not allowed: network access is disabled" {
+		t.Errorf("fetch should be denied. got=%v", denied)
+	}
+
+	allowed := EvalWithConfig(context.Background(), program, object.NewEnvironment(), Config{AllowNet: true})
+	if allowed.Inspect() != "fetched" {
+		t.Errorf("fetch should be allowed. got=%v", allowed)
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(input)
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v",
+			fn.Parameters)
+	}
+
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	}
+
+	expectedBody := "(x + 2)"
+
+	if fn.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+let newAdder = fn(x) {
+  fn(y) { x + y };
+};
+
+let addTwo = newAdder(2);
+addTwo(2);`
+
+	testIntegerObject(t, testEval(input), 4)
+}
+
+func TestHigherOrderFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{
+			`
+let add = fn(a, b) { a + b };
+let applyFunc = fn(a, b, func) { func(a, b) };
+applyFunc(2, 2, add);`,
+			4,
+		},
+		{
+			`
+let adder = fn(x) { fn(y) { x + y } };
+let addOne = adder(1);
+let addTen = adder(10);
+addOne(1) + addTen(1);`,
+			13,
+		},
+		{
+			`
+let compose = fn(f, g) { fn(x) { g(f(x)) } };
+let inc = fn(x) { x + 1 };
+let double = fn(x) { x * 2 };
+compose(inc, double)(5);`,
+			12,
+		},
+		{
+			// the body sees the environment the function was defined
+			// in, not the caller's
+			`
+let x = 1;
+let getX = fn() { x };
+let shadow = fn(x) { getX() };
+shadow(100);`,
+			1,
+		},
+		{
+			`
+let counter = fn() {
+  let count = 0;
+  fn() { count = count + 1 };
+};
+let next = counter();
+next(); next();
+next();`,
+			3,
+		},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFunctionArgumentCount(t *testing.T) {
+	evaluated := testEval("fn(a, b) { a + b; }(1);")
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	expected := "wrong number of arguments: want=2, got=1"
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+	}
+}
+
+func TestVariadicFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the result's Inspect, or the error message
+	}{
+		{"let f = fn(x, rest...) { [x, rest] }; f(1, 2, 3)", "[1, [2, 3]]"},
+		{"let f = fn(x, rest...) { [x, rest] }; f(1)", "[1, []]"},
+		{"let f = fn(args...) { len(args) }; f()", "0"},
+		{"let add = fn(a, b, c) { a + b + c }; add(1, [2, 3]...)", "6"},
+		{"let add = fn(a, b) { a + b }; let xs = [1, 2]; add(xs...)", "3"},
+		{"let f = fn(args...) { args }; f([1, 2]...)", "[1, 2]"},
+		{"let f = fn(xs...) { xs }; let g = fn(xs...) { f(0, xs...) }; g(1, 2)", "[0, 1, 2]"},
+		{"let f = fn(n, rest...) { if (n == 0) { rest } else { f(n - 1, rest...) } }; f(20000, 1, 2)", "[1, 2]"},
+		{"let f = fn(x, rest...) { x }; f()", "wrong number of arguments: want at least 1, got=0"},
+		{"let f = fn(a) { a }; f(1...)", "cannot spread INTEGER, want ARRAY"},
+		{"let f = fn(a) { a }; f([1, 2]...)", "wrong number of arguments: want=1, got=2"},
+		{"len([1, 2, 3]...)", "wrong number of arguments. got=3, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: want %q, got %v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the result's Inspect, or the error message
+	}{
+		{`"hello".upper()`, "HELLO"},
+		{`" a,b ".trim().split(",")`, "[a, b]"},
+		{`"héllo".len()`, "5"},
+		{"[1, 2, 3].len()", "3"},
+		{`[3, 1, 2].sort().map(fn(x) { "${x * 10}" }).join("-")`, "10-20-30"},
+		{"let xs = [1, 2]; xs.push(3).last()", "3"},
+		{`{"a": 1}.keys()`, "[a]"},
+		{`{"a": 1}.values()`, "[1]"},
+		{`let h = {"b": 1, "a": 2}; h.keys()`, "[b, a]"},
+		{`let h = {"b": 1, "a": 2}; h["c"] = 3; h["b"] = 4; h.values()`, "[4, 2, 3]"},
+		{`let len = fn(x) { 0 }; "abc".len()`, "3"},
+		{`let args = ["-"]; ["a", "b"].join(args...)`, "a-b"},
+		{"5.len()", "unknown method `len` for INTEGER"},
+		{`"a".keys()`, "unknown method `keys` for STRING"},
+		{`{}.len()`, "unknown method `len` for HASH"},
+		{`"a".split()`, "wrong number of arguments. got=1, want=2"},
+		{"missing.len()", "identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: want %q, got %v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.5", 3.5},
+		{"-2.5", -2.5},
+		{"1e3", 1000},
+		{"1.5 + 1.5", 3},
+		{"1 + 0.5", 1.5},
+		{"0.5 + 1", 1.5},
+		{"5 / 2.0", 2.5},
+		{"2 * 1.25", 2.5},
+		{"10 - 0.25", 9.75},
+		{"5.5 % 2", 1.5},
+		{"2 ** 0.5 ** 2", 1.189207115002721},
+		{"2 ** -1", 0.5},
+		{"4.0 ** 0.5", 2},
+	}
+
+	for _, tt := range tests {
+		testFloatObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFloatComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"2.0 == 2", true},
+		{"2 != 2.0", false},
+		{"0.1 + 0.2 == 0.3", false},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 5; x = x + 1; x;", 6},
+		{"let x = 5; x = 10;", 10},
+		{"let a = 1; let b = 2; a = b = 3; a + b;", 6},
+		{"let x = 1; let f = fn() { x = x + 1; }; f(); f(); x;", 3},
+		{"let x = 1; let f = fn(x) { x = 10; }; f(5); x;", 1},
+		{"let x = 5; x += 2; x", 7},
+		{"let x = 5; x -= 2 * 3; x", -1},
+		{"let x = 5; x *= 2 + 1; x", 15},
+		{"let x = 20; x /= 4; x", 5},
+		{"let a = 1; let b = 2; a += b += 3; a * 10 + b", 65},
+		{"let n = 0; for (i in 1..4) { n += i }; n", 6},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestConstBindings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"const a = 5; a;", 5},
+		{"const a = 5; let f = fn() { const a = 10; a }; f() + a;", 15},
+		{"const a = 5; let f = fn(a) { a = 1; a }; f(2);", 1},
+		{"let a = 1; const a = 2; a;", 2},
+		{"const a = 5; a = 10;", "cannot assign to constant: a"},
+		{"const a = 5; let f = fn() { a = 10 }; f();", "cannot assign to constant: a"},
+		{"const a = 5; let a = 10;", "cannot redeclare constant: a"},
+		{"const a = 5; const a = 10;", "cannot redeclare constant: a"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestForInStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let sum = 0; for (x in [1, 2, 3]) { sum = sum + x }; sum", 6},
+		{"let sum = 0; for (i, x in [10, 20]) { sum = sum + i * x }; sum", 20},
+		{`let s = ""; for (c in "héllo") { s = c + s }; s`, "olléh"},
+		{`let sum = 0; for (k in {1: 10, 2: 20}) { sum = sum + k }; sum`, 3},
+		{`let sum = 0; for (k, v in {1: 10, 2: 20}) { sum = sum + k * v }; sum`, 50},
+		{`let s = ""; for (k, v in {"b": 1, "a": 2, "c": 3}) { s = s + k + "${v}" }; s`, "b1a2c3"},
+		// ranges longer than the largest INTEGER
+		{"len(-9223372036854775808..9223372036854775807)", 9223372036854775807},
+		{"let n = 0; for (x in -9223372036854775808..9223372036854775807) { n = x; break }; n", -9223372036854775808},
+		{"let n = 0; for (i, x in -9223372036854775808..9223372036854775807) { if (i == 2) { n = x; break } }; n", -9223372036854775806},
+		{"let n = 0; for (x in 9223372036854775805..9223372036854775807) { n = n + 1 }; n", 2},
+		{"let n = 0; for (x in 9223372036854775807..-9223372036854775808) { n = n + 1 }; n", 0},
+		{
+			`
+let find = fn(arr, target) {
+  for (i, x in arr) {
+    if (x == target) { return i; }
+  }
+  -1
+};
+find([5, 6, 7], 7) * 10 + find([1], 9);`,
+			19,
+		},
+		{"for (x in [1]) { let y = x }; y", "identifier not found: y"},
+		{"for (x in [1]) { x }; x", "identifier not found: x"},
+		{"for (x in 5) { x }", "cannot iterate over INTEGER"},
+		{"for (x in [1, true]) { x + 1 }", "type mismatch: BOOLEAN + INTEGER"},
+		{"let sum = 0; for (x in [1, 2, 3, 4]) { if (x == 3) { break }; sum = sum + x }; sum", 3},
+		{"let sum = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue }; sum = sum + x }; sum", 8},
+		{
+			`
+let n = 0;
+for (row in [[1, 2], [3, 4]]) {
+  for (x in row) {
+    if (x % 2 == 0) { break }
+    n = n + x;
+  }
+  n = n * 10;
+}
+n`,
+			130,
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q",
+						expected, errObj.Message)
+				}
+				continue
+			}
+
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+			}
+		}
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && 2", true},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{"false && undefinedName", false},
+		{"true || undefinedName", true},
+		{"let x = 0; false && (x = 1); x == 0", true},
+		{"let x = 0; true || (x = 1); x == 0", true},
+		{"let x = 0; true && (x = 1); x == 1", true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestNullSafetyOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the result's Inspect, or the error message
+	}{
+		{`{"a": 1}["a"] ?? 2`, "1"},
+		{`{"a": 1}["b"] ?? 2`, "2"},
+		{"false ?? 1", "false"},
+		{"0 ?? 1", "0"},
+		{"first([]) ?? first([]) ?? 3", "3"},
+		{"1 ?? undefinedName", "1"},
+		{"let x = 0; 1 ?? (x = 1); x", "0"},
+		{"let x = first([]) ?? 5; x", "5"},
+		{"first([]) ?? 1 + 2", "3"},
+		{`let h = {"name": " ann "}; h["name"]?.trim()`, "ann"},
+		{`let h = {}; h["name"]?.trim()`, "null"},
+		{`let h = {}; h["name"]?.trim() ?? "anonymous"`, "anonymous"},
+		{"first([])?.len(undefinedName)", "null"},
+		{"[1, 2]?.len()", "2"},
+		{"first([]) ?? undefinedName", "identifier not found: undefinedName"},
+		{"first([]).len()", "unknown method `len` for NULL"},
+		{"first([])?.upper().len()", "unknown method `len` for NULL"},
+		{"5?.upper()", "unknown method `upper` for INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: want %q, got %v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestImportExpression(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"lib/math.monkey":    `let pi = 3; let sq = fn(x) { x * x }; let area = fn(r) { pi * sq(r) };`,
+		"lib/util.monkey":    `let math = import("math.monkey"); let cube = fn(x) { x * math["sq"](x) };`,
+		"lib/cycle.monkey":   `let again = import("cycle.monkey");`,
+		"lib/broken.monkey":  `let = 1;`,
+		"lib/failing.monkey": `let x = 1 + true;`,
+		"lib/hello.monkey":   `puts("loaded");`,
+	})
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let m = import("lib/math.monkey"); m["area"](2)`, 12},
+		{`import("lib/util.monkey")["cube"](3)`, 27},
+		{`import("lib/math.monkey") == import("lib/" + "math.monkey")`, true},
+		{`import("lib/util.monkey")["math"] == import("lib/math.monkey")`, true},
+		// tasks share the modules of the evaluation that spawned them
+		{`let load = fn() { import("lib/util.monkey") }; let a = spawn load; let b = spawn load; recv(a) == recv(b)`, true},
+		{`import("lib/math.monkey")["nope"]`, "module has no member: nope"},
+		{`import(1)`, "import path must be STRING, got INTEGER"},
+		{`import("lib/cycle.monkey")`, "import cycle: " + filepath.Join(dir, "lib/cycle.monkey")},
+		{`import("lib/failing.monkey")`, "type mismatch: INTEGER + BOOLEAN"},
+		{
+			`import("lib/broken.monkey")`,
+			`cannot import "lib/broken.monkey": ` + filepath.Join(dir, "lib/broken.monkey") +
+				":1:5: expected next token to be 'IDENT', got '=' instead",
+		},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.SetDir(dir)
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := EvalWithConfig(context.Background(), program, env, Config{AllowFS: true})
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T (%+v)",
+					tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+
+	// every evaluation evaluates the modules it imports with its own
+	// configuration, here its own stdout
+	for i := 0; i < 2; i++ {
+		var out bytes.Buffer
+		env := object.NewEnvironment()
+		env.SetDir(dir)
+		program := parser.New(lexer.New(`import("lib/hello.monkey"); import("lib/hello.monkey")`)).ParseProgram()
+		EvalWithConfig(context.Background(), program, env, Config{AllowFS: true, Stdout: &out})
+		if out.String() != "loaded\n" {
+			t.Errorf("evaluation %d: wrong output %q", i, out.String())
+		}
+	}
+}
+
+// writeModules writes the given files, keyed by relative path, to a
+// temporary directory and returns it.
+func writeModules(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestStandardLibrary(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import("std/array")["sort"]([5, 3, 9, 1, 3])`, "[1, 3, 3, 5, 9]"},
+		{`import("std/array")["map"]([1, 2, 3], fn(x) { x * x })`, "[1, 4, 9]"},
+		{`import("std/array")["filter"]([1, 2, 3, 4], fn(x) { x % 2 == 0 })`, "[2, 4]"},
+		{`import("std/array")["reduce"]([1, 2, 3], 10, fn(acc, x) { acc + x })`, "16"},
+		{`import("std/array")["sortWith"]([1, 3, 2], fn(a, b) { a > b })`, "[3, 2, 1]"},
+		{`import("std/string")["join"](["a", "b", "c"], ", ")`, "a, b, c"},
+		{`import("std/string")["repeat"]("ab", 3)`, "ababab"},
+		{`import("std/string")["endsWith"]("héllo", "llo")`, "true"},
+		{`import("std/math")["gcd"](12, -18)`, "6"},
+		{`import("std/math")["clamp"](15, 0, 10)`, "10"},
+		{`import("std/nope")`, `cannot import "std/nope": no standard library module "nope"`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		var got string
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		} else {
+			got = evaluated.Inspect()
+		}
+
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestEvalContextCancelled(t *testing.T) {
+	input := `
+let countdown = fn(n) { if (n == 0) { 0 } else { countdown(n - 1) } };
+countdown(500);
+`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	evaluated := EvalContext(context.Background(), program, object.NewEnvironment())
+	testIntegerObject(t, evaluated, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	evaluated = EvalContext(ctx, program, object.NewEnvironment())
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != context.Canceled.Error() {
+		t.Errorf("wrong error message. expected=%q, got=%q",
+			context.Canceled.Error(), errObj.Message)
+	}
+}
+
+func TestMaxSteps(t *testing.T) {
+	tests := []struct {
+		input    string
+		maxSteps int
+		expected string // the result's Inspect, or the error message
+	}{
+		{"let x = 1; x + 1", 0, "2"},
+		{"let x = 1; x + 1", 100, "2"},
+		{"let x = 1; x + 1", 3, "execution budget exceeded"},
+		{"let f = fn() { f() }; f()", 1000, "execution budget exceeded"},
+		{"let x = 0; for (i in 0..1000000) { x += 1 }", 5000, "execution budget exceeded"},
+		{`try { let f = fn() { f() }; f() } catch (e) { "caught" }`, 1000, "execution budget exceeded"},
+		{"let t = spawn fn() { let f = fn() { f() }; f() }; recv(t)", 1000, "execution budget exceeded"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		config := Config{MaxSteps: tt.maxSteps}
+		evaluated := EvalWithConfig(context.Background(), program, object.NewEnvironment(), config)
+
+		got := ""
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		} else if evaluated != nil {
+			got = evaluated.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("%s with %d steps: want %q, got %q", tt.input, tt.maxSteps, tt.expected, got)
+		}
+	}
+}
+
+func TestTruthiness(t *testing.T) {
+	// only false and null count as false, the same way everywhere
+	values := map[string]bool{
+		"false": false, "first([])": false,
+		"true": true, "0": true, "0.0": true, `""`: true, "[]": true, "{}": true, "len": true,
+	}
+
+	for value, truthy := range values {
+		inputs := map[string]bool{
+			"if (" + value + ") { true } else { false }": truthy,
+			"!" + value:         !truthy,
+			value + " && true":  truthy,
+			"true && " + value:  truthy,
+			value + " || false": truthy,
+			"false || " + value: truthy,
+		}
+		for input, expected := range inputs {
+			if !testBooleanObject(t, testEval(input), expected) {
+				t.Errorf("for %q", input)
+			}
+		}
+	}
+}
+
+func TestStrictBool(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (1 < 2) { 1 } else { 2 }", "1"},
+		{"!true || (false && true)", "false"},
+		{"if (0) { 1 }", "non-boolean condition: INTEGER at line 1, column 5"},
+		{"let xs = [];\nif (len(xs)) { 1 }", "non-boolean condition: INTEGER at line 2, column 8"},
+		{`!""`, "non-boolean condition: STRING at line 1, column 1"},
+		{"[] && true", "non-boolean condition: ARRAY at line 1, column 1"},
+		{"false || first([])", "non-boolean condition: NULL at line 1, column 15"},
+		{"first([]) ?? 1", "1"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		config := Config{StrictBool: true}
+		evaluated := EvalWithConfig(context.Background(), program, object.NewEnvironment(), config)
+
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = strings.TrimPrefix(errObj.Inspect(), "ERROR: ")
+		}
+		if got != tt.expected {
+			t.Errorf("%q: want %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestMaxMemObjects(t *testing.T) {
+	tests := []struct {
+		input         string
+		maxMemObjects int
+		expected      string // the result's Inspect, or the error message
+	}{
+		{"[1, 2, 3]", 0, "[1, 2, 3]"},
+		{"[1, 2, 3]", 4, "[1, 2, 3]"},
+		{"[1, 2, 3]", 3, "memory limit exceeded"},
+		{"let a = []; for (i in 0..1000) { a = push(a, i) }; len(a)", 1000, "memory limit exceeded"},
+		{`let s = ""; for (i in 0..1000) { s = s + "abcdefgh" }; len(s)`, 1000, "memory limit exceeded"},
+		{"let h = {}; for (i in 0..1000) { h[i] = i }; len(h)", 1000, "memory limit exceeded"},
+		{"let h = {}; for (i in 0..1000) { h[1] = i }; h[1]", 1000, "999"},
+		{"let a = [1]; for (i in 0..1000) { len(a) + first(a) }; len(a)", 10, "1"},
+		{"let a = [[1, 2, 3]]; for (i in 0..1000) { first(a) }; len(a)", 100, "1"},
+		{`try { let a = []; for (i in 0..1000) { a = push(a, i) } } catch (e) { "caught" }`, 1000,
+			"memory limit exceeded"},
+		{"let t = spawn fn() { let a = []; for (i in 0..1000) { a = push(a, i) } }; recv(t)", 1000,
+			"memory limit exceeded"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		config := Config{MaxMemObjects: tt.maxMemObjects}
+		evaluated := EvalWithConfig(context.Background(), program, object.NewEnvironment(), config)
+
+		got := ""
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		} else if evaluated != nil {
+			got = evaluated.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("%s with %d objects: want %q, got %q", tt.input, tt.maxMemObjects, tt.expected, got)
+		}
+	}
+}
+
+func TestSpawnAndChannels(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the result's Inspect, or the error message
+	}{
+		{"let t = spawn fn() { 1 + 2 }; recv(t)", "3"},
+		{"let ch = chan(); spawn fn() { send(ch, 42) }; recv(ch)", "42"},
+		{
+			`
+let ch = chan(3);
+let square = fn(n) { fn() { send(ch, n * n) } };
+for (i in 1..4) { spawn square(i) }
+recv(ch) + recv(ch) + recv(ch)`,
+			"14",
+		},
+		{
+			`
+let pings = chan();
+let pongs = chan();
+spawn fn() { send(pongs, recv(pings) + 1) };
+send(pings, 1);
+recv(pongs)`,
+			"2",
+		},
+		{"let x = 0; recv(spawn fn() { x = 5 }); x", "5"},
+		{"let t = spawn fn() { let y = 1; y }; recv(t); y", "identifier not found: y"},
+		{"let t = spawn fn() { 1 / 0 }; recv(t)", "division by zero"},
+		{"let t = spawn fn() { 1 / 0 }; try { recv(t) } catch (e) { e }", "division by zero"},
+		// tasks take turns changing and reading shared values
+		{
+			`
+let h = {};
+let a = [0];
+let fill = fn(k) { fn() { for (i in 0..500) { h[k * 1000 + i] = i; a[0] = i } } };
+let one = spawn fill(1);
+let two = spawn fill(2);
+for (i in 0..20) { for (k, v in h) { a[0] = v } }
+recv(one);
+recv(two);
+let n = 0;
+for (k, v in h) { n = n + 1 }
+n`,
+			"1000",
+		},
+		// waiting when no other task can go on
+		{"recv(chan())", "deadlock: all tasks are waiting"},
+		{"let c = chan(); send(c, 1)", "deadlock: all tasks are waiting"},
+		{"let c = chan(1); send(c, 1); send(c, 2)", "deadlock: all tasks are waiting"},
+		{"let c = chan(1); send(c, 1); recv(c)", "1"},
+		{"let a = chan(); let b = chan(); spawn fn() { recv(a) }; recv(b)", "deadlock: all tasks are waiting"},
+		{"let c = chan(); spawn fn() { 1 }; recv(c)", "deadlock: all tasks are waiting"},
+		{"let c = chan(); try { recv(c) } catch (e) { send(chan(1), 1) }", "null"},
+		// failures of tasks nobody waits for
+		{"spawn fn() { 1 / 0 }; 5", "division by zero"},
+		{"let t = spawn fn() { 1 / 0 }; try { recv(t) } catch (e) { 5 }", "5"},
+		{"let c = chan(); spawn fn() { recv(c) }; 5", "5"},
+		{"spawn 5", "cannot spawn INTEGER, want FUNCTION"},
+		{"spawn fn(x) { x }", "wrong number of arguments: want=1, got=0"},
+		{"chan(-1)", "argument to `chan` must be a non-negative INTEGER, got -1"},
+		{"chan(1, 2)", "wrong number of arguments. got=2, want=0 or 1"},
+		{"send(1, 2)", "argument 1 to `send` must be CHANNEL, got INTEGER"},
+		{"recv([])", "argument to `recv` must be CHANNEL, got ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: want %q, got %v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestSpawnStopsWithEvaluation(t *testing.T) {
+	program := parser.New(lexer.New(
+		"spawn fn() { for (i in 0..9223372036854775807) {} }; 1",
+	)).ParseProgram()
+
+	before := runtime.NumGoroutine()
+	evaluated := Eval(program, object.NewEnvironment())
+	testIntegerObject(t, evaluated, 1)
+
+	// the task's goroutine may take a moment to exit after it is done
+	for i := 0; runtime.NumGoroutine() > before; i++ {
+		if i == 100 {
+			t.Fatalf("task still running: %d goroutines, want %d", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRecvCancelled(t *testing.T) {
+	// a task that is still running keeps the wait from being a deadlock
+	input := "spawn fn() { for (i in 0..9223372036854775807) {} }; recv(chan())"
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	evaluated := EvalContext(ctx, program, object.NewEnvironment())
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != context.DeadlineExceeded.Error() {
+		t.Errorf("wrong error message. expected=%q, got=%q",
+			context.DeadlineExceeded.Error(), errObj.Message)
+	}
+}
+
+func TestHook(t *testing.T) {
+	input := `
+let double = fn(x) { x * 2 };
+double(1) + double(2);
+`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	calls := 0
+	var last *object.Environment
+	config := Config{Hook: WithHook(func(node ast.Node, env *object.Environment) {
+		if _, ok := node.(*ast.CallExpression); ok {
+			calls++
+		}
+		last = env
+	})}
+
+	evaluated := EvalWithConfig(context.Background(), program, object.NewEnvironment(), config)
+	testIntegerObject(t, evaluated, 6)
+
+	if calls != 2 {
+		t.Errorf("wrong number of calls seen. want=2, got=%d", calls)
+	}
+	if x, ok := last.Get("x"); !ok || x.Inspect() != "2" {
+		t.Errorf("last node not seen in the call's environment. got x=%v", x)
+	}
+}
+
+func TestHookStepLimit(t *testing.T) {
+	program := parser.New(lexer.New("let loop = fn() { loop() }; loop()")).ParseProgram()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	steps := 0
+	config := Config{Hook: WithHook(func(node ast.Node, env *object.Environment) {
+		if steps++; steps == 100 {
+			cancel()
+		}
+	})}
+
+	evaluated := EvalWithConfig(ctx, program, object.NewEnvironment(), config)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != context.Canceled.Error() {
+		t.Errorf("wrong error message. expected=%q, got=%q",
+			context.Canceled.Error(), errObj.Message)
+	}
+	if steps != 100 {
+		t.Errorf("evaluation went on after the hook cancelled it. steps=%d", steps)
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the result's Inspect
+	}{
+		{`split("a,b,c", ",")`, "[a, b, c]"},
+		{`split("abc", "")`, "[a, b, c]"},
+		{`split("", ",")`, "[]"},
+		{`len(split("a,,b", ","))`, "3"},
+		{`join(["a", "b", "c"], "-")`, "a-b-c"},
+		{`join([], "-")`, ""},
+		{`join(split("1 2 3", " "), "+")`, "1+2+3"},
+		{`replace("banana", "a", "o")`, "bonono"},
+		{`replace("banana", "x", "o")`, "banana"},
+		{`trim("  padded \t\n")`, "padded"},
+		{`upper("Hello, World")`, "HELLO, WORLD"},
+		{`lower("Hello, World")`, "hello, world"},
+		{`contains("monkey", "key")`, "true"},
+		{`contains("monkey", "donkey")`, "false"},
+		{`contains("monkey", "")`, "true"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if isError(evaluated) {
+			t.Errorf("%s: unexpected error %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: want %q, got %q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestTypeAndConversionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the result's Inspect, or the error message
+	}{
+		{"type(1)", "INTEGER"},
+		{"type(1.5)", "FLOAT"},
+		{`type("a")`, "STRING"},
+		{"type(true)", "BOOLEAN"},
+		{"type(first([]))", "NULL"},
+		{"type([1])", "ARRAY"},
+		{"type({})", "HASH"},
+		{"type(1..2)", "RANGE"},
+		{"type(fn() {})", "FUNCTION"},
+		{"type(len)", "BUILTIN"},
+		{"let P = struct { x }; type(P)", "STRUCT_TYPE"},
+		{"let P = struct { x }; type(P(1))", "P"},
+		{"type(struct { x }(1))", "struct"},
+		{`int("42")`, "42"},
+		{`int(" -7 ")`, "-7"},
+		{`int("4.2")`, "null"},
+		{`int("abc")`, "null"},
+		{`int("99999999999999999999")`, "null"},
+		{`int("abc") ?? 0`, "0"},
+		{"int(3.99)", "3"},
+		{"int(-3.99)", "-3"},
+		{"int(1e300)", "null"},
+		{"int(true) + int(false)", "1"},
+		{"int(5)", "5"},
+		{`float("3.1")`, "3.1"},
+		{`float("1e3")`, "1000.0"},
+		{`float("x")`, "null"},
+		{"float(2)", "2.0"},
+		{"str(42)", "42"},
+		{"str(1.5)", "1.5"},
+		{`str("a")`, "a"},
+		{"str([1, true])", "[1, true]"},
+		{`str(42) + "!"`, "42!"},
+		{"bool(0)", "true"},
+		{`bool("")`, "true"},
+		{"bool(first([]))", "false"},
+		{"bool(false)", "false"},
+		{"int([1])", "argument to `int` not supported, got ARRAY"},
+		{"int(first([]))", "argument to `int` not supported, got NULL"},
+		{"float(true)", "argument to `float` not supported, got BOOLEAN"},
+		{"type()", "wrong number of arguments. got=0, want=1"},
+		{"str(1, 2)", "wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: want %q, got %v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestMathBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the result's Inspect, or the error message
+	}{
+		{"abs(-5)", "5"},
+		{"abs(5)", "5"},
+		{"abs(-2.5)", "2.5"},
+		{"min(3, 1, 2)", "1"},
+		{"max(3, 1, 2)", "3"},
+		{"min(2, 1.5)", "1.5"},
+		{"max(2, 1.5)", "2"},
+		{"min(4)", "4"},
+		{"pow(2, 10)", "1024"},
+		{"pow(2, -1)", "0.5"},
+		{"pow(4, 0.5)", "2.0"},
+		{"sqrt(16)", "4.0"},
+		{"sqrt(2.25)", "1.5"},
+		{"floor(2.7)", "2.0"},
+		{"floor(-2.5)", "-3.0"},
+		{"floor(7)", "7"},
+		{"ceil(2.1)", "3.0"},
+		{"round(2.5)", "3.0"},
+		{"round(-2.5)", "-3.0"},
+		{"round(2.4)", "2.0"},
+		{"let r = random(10); r >= 0 && r < 10", "true"},
+		{"let r = random(); r >= 0 && r < 1", "true"},
+		{"randomSeed(7); let a = random(1000); randomSeed(7); a == random(1000)", "true"},
+		{`abs("a")`, "argument to `abs` must be INTEGER or FLOAT, got STRING"},
+		{"min()", "wrong number of arguments. got=0, want at least 1"},
+		{"max(1, true)", "argument 2 to `max` must be INTEGER or FLOAT, got BOOLEAN"},
+		{`sqrt("4")`, "argument to `sqrt` must be INTEGER or FLOAT, got STRING"},
+		{"pow(2)", "wrong number of arguments. got=1, want=2"},
+		{"random(0)", "argument to `random` must be positive, got 0"},
+		{"random(1.5)", "argument to `random` must be INTEGER, got FLOAT"},
+		{"random(1, 2)", "wrong number of arguments. got=2, want=0 or 1"},
+		{"randomSeed(1.5)", "argument to `randomSeed` must be INTEGER, got FLOAT"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: want %q, got %v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestStringBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`split("a")`, "wrong number of arguments. got=1, want=2"},
+		{`split(1, ",")`, "argument 1 to `split` must be STRING, got INTEGER"},
+		{`join("abc", "")`, "argument to `join` must be ARRAY, got STRING"},
+		{`join(["a"], 1)`, "argument 2 to `join` must be STRING, got INTEGER"},
+		{`join(["a", 1], "")`, "element 1 of array given to `join` must be STRING, got INTEGER"},
+		{`replace("a", "b")`, "wrong number of arguments. got=2, want=3"},
+		{`replace("a", "b", true)`, "argument 3 to `replace` must be STRING, got BOOLEAN"},
+		{`trim([])`, "argument to `trim` must be STRING, got ARRAY"},
+		{`upper()`, "wrong number of arguments. got=0, want=1"},
+		{`lower(1)`, "argument to `lower` must be STRING, got INTEGER"},
+		{`contains([1], 1)`, "argument 1 to `contains` must be STRING, got ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the result's Inspect
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`map([], fn(x) { x })`, "[]"},
+		{`map(["a", "b"], upper)`, "[A, B]"},
+		{`filter([1, 2, 3, 4], fn(x) { x % 2 == 0 })`, "[2, 4]"},
+		{`filter([1, 2], fn(x) { false })`, "[]"},
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, "10"},
+		{`reduce([], "empty", fn(acc, x) { acc + x })`, "empty"},
+		{`sort([3, 1, 2])`, "[1, 2, 3]"},
+		{`sort([2.5, 1, 0.5])`, "[0.5, 1, 2.5]"},
+		{`sort(["pear", "apple", "fig"])`, "[apple, fig, pear]"},
+		{`sort([3, 1, 2], fn(a, b) { a > b })`, "[3, 2, 1]"},
+		// equal elements keep their order
+		{`sort([[2, "a"], [1, "b"], [2, "c"], [1, "d"]], fn(a, b) { a[0] < b[0] })`,
+			"[[1, b], [1, d], [2, a], [2, c]]"},
+		{`let a = [2, 1]; sort(a); a`, "[2, 1]"},
+		{`let offset = 10; map([1, 2], fn(x) { x + offset })`, "[11, 12]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if isError(evaluated) {
+			t.Errorf("%s: unexpected error %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: want %q, got %q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestHigherOrderBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`map([1])`, "wrong number of arguments. got=1, want=2"},
+		{`map(1, fn(x) { x })`, "argument 1 to `map` must be ARRAY, got INTEGER"},
+		{`filter([1], 1)`, "argument 2 to `filter` must be FUNCTION, got INTEGER"},
+		{`reduce([1], fn(a, x) { a })`, "wrong number of arguments. got=2, want=3"},
+		{`reduce([1], 0, 0)`, "argument 3 to `reduce` must be FUNCTION, got INTEGER"},
+		{`sort()`, "wrong number of arguments. got=0, want=1 or 2"},
+		{`sort([1], "desc")`, "argument 2 to `sort` must be FUNCTION, got STRING"},
+		{`sort([1, "a"])`, "type mismatch: STRING < INTEGER"},
+		{`map([1, 0], fn(x) { 1 / x })`, "division by zero"},
+		{`map([1], fn(a, b) { a })`, "wrong number of arguments: want=2, got=1"},
+		{`sort([2, 1], fn(a, b) { missing })`, "identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q",
+				tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestAssertBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the error message, or "" if the assertion holds
+	}{
+		{`assert(true)`, ""},
+		{`assert(1 < 2, "ordered")`, ""},
+		{`assert(false)`, "assertion failed"},
+		{`assert(first([]), "not empty")`, "assertion failed: not empty"},
+		{`assert(false, 1)`, "argument 2 to `assert` must be STRING, got INTEGER"},
+		{`assert()`, "wrong number of arguments. got=0, want=1 or 2"},
+		{`assertEq(1 + 1, 2)`, ""},
+		{`assertEq([1, "a", [true]], [1, "a", [true]])`, ""},
+		{`assertEq({"a": [1], 2: "b"}, {2: "b", "a": [1]})`, ""},
+		{`let f = fn() { 1 }; assertEq(f, f)`, ""},
+		{`assertEq(first([]), first([]))`, ""},
+		{`assertEq(1, 2)`, "assertion failed: 1 != 2"},
+		{`assertEq(1, 1.0)`, "assertion failed: 1 != 1.0"},
+		{`assertEq([1, 2], [1])`, "assertion failed: [1, 2] != [1]"},
+		{`assertEq({"a": 1}, {"a": 2})`, "assertion failed: {a: 1} != {a: 2}"},
+		{`assertEq(fn() { 1 }, fn() { 1 })`, "assertion failed: fn() {\n1\n} != fn() {\n1\n}"},
+		{`assertEq(1)`, "wrong number of arguments. got=1, want=2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if tt.expected == "" {
+			if evaluated != NULL {
+				t.Errorf("%s: want null, got %s", tt.input, evaluated.Inspect())
+			}
+			continue
+		}
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q",
+				tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestOutputBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`puts("a", 1, [true])`, "a\n1\n[true]\n"},
+		{`puts()`, ""},
+		{`print("a", 1); print("b")`, "a 1b"},
+		{`printf("x = %d, s = %s\n", 42, "str")`, "x = 42, s = str\n"},
+		{`printf("%f %t %q", 1.5, false, "hi")`, `1.500000 false "hi"`},
+		{`printf("%v and %v", [1, "a"], fn(x) { x })`, "[1, a] and fn(x) {\nx\n}"},
+		{`printf("100%%")`, "100%"},
+		{`printf("%d", 9223372036854775807 * 2)`, "-2"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := EvalWithConfig(context.Background(), program,
+			object.NewEnvironment(), Config{Stdout: &out})
+		if isError(evaluated) {
+			t.Errorf("%s: unexpected error %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if evaluated != NULL {
+			t.Errorf("%s: want null, got %s", tt.input, evaluated.Inspect())
+		}
+		if out.String() != tt.expected {
+			t.Errorf("%s: wrong output. want=%q, got=%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestStreamBuiltins(t *testing.T) {
+	input := `
+	let first = readLine();
+	let second = readLine();
+	puts(first);
+	eputs(second, readLine(), readLine());
+	`
+
+	var stdout, stderr bytes.Buffer
+	program := parser.New(lexer.New(input)).ParseProgram()
+	evaluated := EvalWithConfig(context.Background(), program, object.NewEnvironment(),
+		Config{Stdout: &stdout, Stderr: &stderr, Stdin: strings.NewReader("one\r\ntwo\nthree")})
+	if isError(evaluated) {
+		t.Fatalf("unexpected error %s", evaluated.Inspect())
+	}
+
+	if stdout.String() != "one\n" {
+		t.Errorf("wrong stdout. want=%q, got=%q", "one\n", stdout.String())
+	}
+	// the last line needs no line ending, and input ends with null
+	if stderr.String() != "two\nthree\nnull\n" {
+		t.Errorf("wrong stderr. want=%q, got=%q", "two\nthree\nnull\n", stderr.String())
+	}
+}
+
+func TestFileBuiltins(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+
+	tests := []struct {
+		input    string
+		expected string // the result's Inspect
+	}{
+		{`fileExists(path)`, "false"},
+		{`writeFile(path, crlf)`, "null"},
+		{`fileExists(path)`, "true"},
+		{`appendFile(path, "three")`, "null"},
+		{`readFile(path)`, "one\r\ntwo\nthree"},
+		{`readLines(path)`, "[one, two, three]"},
+		{`writeFile(path, "")`, "null"},
+		{`readLines(path)`, "[]"},
+		{`appendFile(dir + "/new.txt", "x\n"); readLines(dir + "/new.txt")`, "[x]"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.Set("path", &object.String{Value: path})
+		env.Set("dir", &object.String{Value: dir})
+		env.Set("crlf", &object.String{Value: "one\r\ntwo\n"})
+
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := EvalWithConfig(context.Background(), program, env, Config{AllowFS: true})
+		if isError(evaluated) {
+			t.Fatalf("%s: unexpected error %s", tt.input, evaluated.Inspect())
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: want %q, got %q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestFileBuiltinErrors(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.txt")
+
+	tests := []struct {
+		input    string
+		allowFS  bool
+		expected string
+	}{
+		{`readFile("x")`, false, "`readFile` is not allowed: file system access is disabled"},
+		{`writeFile("x", "y")`, false, "`writeFile` is not allowed: file system access is disabled"},
+		{`fileExists("x")`, false, "`fileExists` is not allowed: file system access is disabled"},
+		{`readFile(1)`, true, "argument to `readFile` must be STRING, got INTEGER"},
+		{`writeFile("x")`, true, "wrong number of arguments. got=1, want=2"},
+		{`appendFile("x", [])`, true, "argument 2 to `appendFile` must be STRING, got ARRAY"},
+		{`readLines(missing)`, true, "open " + missing + ": no such file or directory"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.Set("missing", &object.String{Value: missing})
+
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := EvalWithConfig(context.Background(), program, env, Config{AllowFS: tt.allowFS})
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q",
+				tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestProcessBuiltins(t *testing.T) {
+	t.Setenv("MONKEY_TEST_VAR", "banana")
+
+	process := Config{AllowEnv: true, AllowExec: true, AllowExit: true, Args: []string{"a", "b"}}
+
+	tests := []struct {
+		input    string
+		config   Config
+		expected string // the result's Inspect, or the error message
+	}{
+		{`env("MONKEY_TEST_VAR")`, process, "banana"},
+		{`env("MONKEY_TEST_UNSET") ?? "none"`, process, "none"},
+		{`args()`, process, "[a, b]"},
+		{`args()`, Config{}, "[]"},
+		{`let r = exec("sh", ["-c", "echo out; echo err >&2; exit 3"]); [r["code"], r["stdout"], r["stderr"]]`,
+			process, "[3, out\n, err\n]"},
+		{`exec("true")["code"]`, process, "0"},
+		{`exit(3)`, process, "exit status 3"},
+		{`try { exit() } catch (e) { "caught" }`, process, "exit status 0"},
+		{`let f = fn() { exit(1); 2 }; f(); 3`, process, "exit status 1"},
+		{`env("HOME")`, Config{}, "`env` is not allowed: environment access is disabled"},
+		{`exec("true")`, Config{}, "`exec` is not allowed: running commands is disabled"},
+		{`exit(0)`, Config{}, "`exit` is not allowed: exiting is disabled"},
+		{`try { exit(0) } catch (e) { e }`, Config{}, "`exit` is not allowed: exiting is disabled"},
+		{`env(1)`, process, "argument to `env` must be STRING, got INTEGER"},
+		{`args(1)`, process, "wrong number of arguments. got=1, want=0"},
+		{`exit("1")`, process, "argument to `exit` must be INTEGER, got STRING"},
+		{`exec("true", [1])`, process, "element 0 of array given to `exec` must be STRING, got INTEGER"},
+		{`exec("true", "x")`, process, "argument 2 to `exec` must be ARRAY, got STRING"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := EvalWithConfig(context.Background(), program, object.NewEnvironment(), tt.config)
+
+		got := ""
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		} else if evaluated != nil {
+			got = evaluated.Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("%s: want %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestPrintfErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`printf()`, "wrong number of arguments. got=0, want=1 or more"},
+		{`printf(1)`, "argument 1 to `printf` must be STRING, got INTEGER"},
+		{`printf("%d", "a")`, "%d in format given to `printf` must be INTEGER, got STRING"},
+		{`printf("%s", 1)`, "%s in format given to `printf` must be STRING, got INTEGER"},
+		{`printf("%f", 1)`, "%f in format given to `printf` must be FLOAT, got INTEGER"},
+		{`printf("%d %d", 1)`, "missing argument for %d in format given to `printf`"},
+		{`printf("%d", 1, 2)`, "too many arguments for format given to `printf`. got=2, want=1"},
+		{`printf("%x", 1)`, "unknown verb %x in format given to `printf`"},
+		{`printf("50%")`, "format given to `printf` ends with %"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q",
+				tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestJSONBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the result's Inspect
+	}{
+		{`jsonEncode({"b": [1, 2.5, true, first([])], "a": "x<y"})`, `{"a":"x<y","b":[1,2.5,true,null]}`},
+		{`jsonEncode("say \"hi\"")`, `"say \"hi\""`},
+		{`jsonEncode([])`, "[]"},
+		{"let x = [1]; jsonEncode([x, x])", "[[1],[1]]"},
+		{`jsonEncode({"a": [1]}, true)`, "{\n  \"a\": [\n    1\n  ]\n}"},
+		{`jsonDecode("[1, -2.5, 1e3, true, null, \"s\"]")`, "[1, -2.5, 1000.0, true, null, s]"},
+		{`jsonDecode("{\"a\": {\"b\": [1]}}")["a"]["b"][0]`, "1"},
+		{`jsonDecode("99999999999999999999")`, "1e+20"},
+		{`let v = {"k": [1, "two", {"n": first([])}]}; jsonEncode(jsonDecode(jsonEncode(v))) == jsonEncode(v)`, "true"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if isError(evaluated) {
+			t.Errorf("%s: unexpected error %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: want %q, got %q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestJSONBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`jsonEncode(fn(x) { x })`, "cannot encode FUNCTION as JSON"},
+		{`jsonEncode([1, len])`, "cannot encode BUILTIN as JSON"},
+		{`jsonEncode({1: "a"})`, "cannot encode hash key 1 as JSON: keys must be STRING, got INTEGER"},
+		{"let a = [0]; a[0] = a; jsonEncode(a)", "cannot encode cyclic value as JSON"},
+		{`let h = {"a": [1]}; h["a"][0] = h; jsonEncode(h)`, "cannot encode cyclic value as JSON"},
+		{`jsonEncode(1, "yes")`, "argument 2 to `jsonEncode` must be BOOLEAN, got STRING"},
+		{`jsonDecode(1)`, "argument to `jsonDecode` must be STRING, got INTEGER"},
+		{`jsonDecode("")`, "invalid JSON: unexpected EOF"},
+		{`jsonDecode("[1,")`, "invalid JSON: unexpected EOF"},
+		{`jsonDecode("{a: 1}")`, "invalid JSON: invalid character 'a' looking for beginning of object key string"},
+		{`jsonDecode("1 2")`, "invalid JSON: unexpected data after top-level value"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q",
+				tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the result's Inspect, or the error message
+	}{
+		{"let [a, b] = [1, 2]; a * 10 + b", "12"},
+		{`let {name, age} = {"age": 3, "name": "ann"}; name + " is ${age}"`, "ann is 3"},
+		{"let f = fn(p) { let [x, y] = p; x - y }; f([5, 2])", "3"},
+		{"let a = 1; let b = 2; let [a, b] = [b, a]; [a, b]", "[2, 1]"},
+		{`let {x} = {"x": 1, "y": 2}; x`, "1"},
+		{"let [a, b] = [1, 2, 3];", "cannot destructure array of 3 elements into 2 names"},
+		{"let [a] = 5;", "cannot destructure INTEGER as an array"},
+		{`let {a} = [1];`, "cannot destructure ARRAY as a hash"},
+		{`let {name, age} = {"name": "ann"};`, "key not found in hash: age"},
+		{"const [a, b] = [1, 2]; a = 3;", "cannot assign to constant: a"},
+		{"const b = 1; let [a, b] = [1, 2];", "cannot redeclare constant: b"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: want %q, got %v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the result's Inspect, or the error message
+	}{
+		{"let Person = struct { name, age }; Person", "struct Person {name, age}"},
+		{`let Person = struct { name, age }; Person("ann", 3)`, "Person{name: ann, age: 3}"},
+		{`let Person = struct { name, age }; let p = Person("ann", 3); p.name`, "ann"},
+		{`let Person = struct { name, age }; Person("ann", 3).age + 1`, "4"},
+		{"let P = struct { x }; let Q = P; Q(1)", "P{x: 1}"},
+		{"struct { x, y }(1, 2)", "struct{x: 1, y: 2}"},
+		{"let Unit = struct {}; Unit()", "Unit{}"},
+		{
+			`
+let Point = struct { x, y };
+let Line = struct { from, to };
+let l = Line(Point(0, 0), Point(3, 4));
+l.to.x * l.to.y`,
+			"12",
+		},
+		{"let P = struct { x, y }; [[1, 2], [3, 4]].map(fn(xy) { P(xy...) })[1].y", "4"},
+		{"let P = struct { x }; let p = first([]); p?.x", "null"},
+		{"let P = struct { x }; P(1)?.x", "1"},
+		{"let P = struct { x, y }; P(1)", "wrong number of arguments: want=2, got=1"},
+		{"let P = struct { x }; P(1).y", "unknown field `y` for P"},
+		{`let h = {"x": 1}; h.x`, "cannot access field `x` of HASH"},
+		{"first([]).x", "cannot access field `x` of NULL"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			if errObj.Message != tt.expected {
+				t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, tt.expected, errObj.Message)
+			}
+			continue
+		}
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: want %q, got %v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the result's Inspect
+	}{
+		{`match (1) { 1 => "one", 2 => "two", _ => "other" }`, "one"},
+		{`match (2) { 1 => "one", 2 => "two", _ => "other" }`, "two"},
+		{`match (3) { 1 => "one", 2 => "two", _ => "other" }`, "other"},
+		{`match (3) { 1 => "one" }`, "null"},
+		{`match ("b") { "a" => 1, "b" => 2 }`, "2"},
+		{`match (1) { "1" => "string", 1.0 => "float" }`, "float"},
+		{`match (true) { 1 > 2 => "no", 1 < 2 => "yes" }`, "yes"},
+		{`let x = 5; match (x * 2) { x => "x", x + x => "twice x" }`, "twice x"},
+		// the first arm that matches wins, and later patterns are not
+		// evaluated
+		{`match (1) { 1 => "first", 1 => "second", 1 / 0 => "boom" }`, "first"},
+		{`let f = fn(n) { match (n % 2) { 0 => "even", _ => "odd" } }; [f(2), f(7)]`, "[even, odd]"},
+		{`let count = fn(n, acc) { match (n) { 0 => acc, _ => count(n - 1, acc + 1) } }; count(20000, 0)`, "20000"},
+		{`match (1) { 1 => match (2) { 2 => "inner" } }`, "inner"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if isError(evaluated) {
+			t.Errorf("%s: unexpected error %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: want %q, got %q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	evaluated := testEval(`match (1) { 2 => "two", 1 / 0 => "boom" }`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "division by zero" {
+		t.Errorf("expected an error from a pattern. got=%+v", evaluated)
+	}
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the result's Inspect
+	}{
+		{"try { 1 / 0 } catch (e) { e }", "division by zero"},
+		{"try { 5 } catch (e) { 0 }", "5"},
+		{"try {} catch (e) {}", "null"},
+		{"1 + try { 2 * [] } catch (e) { 10 }", "11"},
+		{`try { {"a": 1}["b"] + 1 } catch (e) { "missing" }`, "missing"},
+		{`try { jsonDecode("{") } catch (e) { e }`, "invalid JSON: unexpected EOF"},
+		{`try { error("boom") } catch (e) { "caught " + e }`, "caught boom"},
+		{`try { try { 1 / 0 } catch (e) { error("again: " + e) } } catch (e) { e }`, "again: division by zero"},
+		{"let f = fn() { try { return g() } catch (e) { 2 } }; let g = fn() { 1 / 0 }; f()", "2"},
+		{"let f = fn() { try { return 1 } catch (e) { 2 } }; f()", "1"},
+		{"let x = 0; for (i in [1, 0, 2]) { try { x = x + 10 / i } catch (e) { continue } }; x", "15"},
+		{"let x = 0; for (i in [1, 2, 3]) { try { if (i == 2) { break } x = x + i } catch (e) { x = 100 } }; x", "1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if isError(evaluated) {
+			t.Errorf("%s: unexpected error %s", tt.input, evaluated.Inspect())
+			continue
+		}
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: want %q, got %q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	evaluated := testEval("try { 1 / 0 } catch (e) { e + 1 }")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "type mismatch: STRING + INTEGER" {
+		t.Errorf("expected an error from the handler. got=%+v", evaluated)
+	}
+}
+
+func TestTryCannotCatchCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	program := parser.New(lexer.New(`
+	let loop = fn(n) { loop(n + 1) };
+	try { loop(0) } catch (e) { "caught" }
+	`)).ParseProgram()
+	evaluated := EvalContext(ctx, program, object.NewEnvironment())
+
+	if _, ok := evaluated.(*object.Error); !ok {
+		t.Fatalf("expected an error. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	tests := []struct {
+		input       string
+		wrapped     string
+		bigIntegers string
+	}{
+		{"9223372036854775807 + 1", "-9223372036854775808", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "9223372036854775807", "-9223372036854775809"},
+		{"let min = -9223372036854775807 - 1; -min", "-9223372036854775808", "9223372036854775808"},
+		{"-9223372036854775808 == -9223372036854775807 - 1", "true", "true"},
+		{"-9223372036854775808 - 1", "9223372036854775807", "-9223372036854775809"},
+		{"2 ** 64", "0", "18446744073709551616"},
+		{"2 ** 64 / 2 ** 60", "0", "16"},
+		{"1 / (2 ** 64)", "division by zero", "0"},
+		{"9223372036854775807 * 3 > 9223372036854775807", "false", "true"},
+		{"(9223372036854775807 + 1) - 1", "9223372036854775807", "9223372036854775807"},
+		{"(9223372036854775807 + 1) * 0.5", "-4.611686018427388e+18", "4.611686018427388e+18"},
+	}
+
+	for _, tt := range tests {
+		for _, bigIntegers := range []bool{false, true} {
+			expected := tt.wrapped
+			if bigIntegers {
+				expected = tt.bigIntegers
+			}
+
+			program := parser.New(lexer.New(tt.input)).ParseProgram()
+			config := Config{BigIntegers: bigIntegers}
+			evaluated := EvalWithConfig(context.Background(), program, object.NewEnvironment(), config)
+
+			got := evaluated.Inspect()
+			if errObj, ok := evaluated.(*object.Error); ok {
+				got = errObj.Message
+			}
+			if got != expected {
+				t.Errorf("%q (BigIntegers=%t): want %s, got %s",
+					tt.input, bigIntegers, expected, got)
+			}
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		depth    int
+		expected interface{}
+	}{
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(100000)", 0, 0},
+		{"let f = fn(n) { if (n == 0) { return 0; } return f(n - 1); }; f(100000)", 0, 0},
+		{"let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } }; sum(1000, 0)", 10, 500500},
+		{`let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+		  let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+		  even(50001)`, 0, false},
+		{"let f = fn(n) { for (x in [1, 2]) { return g(n + x); } }; let g = fn(n) { n * 10 }; f(1)", 0, 20},
+		{"let f = fn(n) { g(n, 1) }; let g = fn(x) { x }; f(1)", 0, "wrong number of arguments: want=1, got=2"},
+		{"let f = fn(n) { if (n == 0) { 1 / n } else { f(n - 1) } }; f(3)", 0, "division by zero"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+
+		config := Config{MaxCallDepth: tt.depth}
+		evaluated := EvalWithConfig(context.Background(), program, object.NewEnvironment(), config)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T (%+v)",
+					tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	tests := []struct {
+		input    string
+		depth    int
+		expected interface{}
+	}{
+		{"f(9)", 10, 9},
+		{"f(10)", 10, "stack overflow"},
+		{"f(5000)", 0, 5000},
+		{"f(20000)", 0, "stack overflow"},
+	}
+
+	for _, tt := range tests {
+		input := "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } };" + tt.input
+		program := parser.New(lexer.New(input)).ParseProgram()
+
+		config := Config{MaxCallDepth: tt.depth}
+		evaluated := EvalWithConfig(context.Background(), program, object.NewEnvironment(), config)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T (%+v)",
+					tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func BenchmarkEval(b *testing.B) {
+	for _, program := range bench.Programs() {
+		b.Run(program.Name, func(b *testing.B) {
+			parsed := parser.New(lexer.New(program.Source)).ParseProgram()
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				result := Eval(parsed, object.NewEnvironment())
+				if isError(result) {
+					b.Fatalf("evaluation failed: %s", result.Inspect())
+				}
+			}
+		})
+	}
+}
+
+func TestRandomSeedIsPerEvaluation(t *testing.T) {
+	l := lexer.New("[random(1000000), random(1000000), recv(spawn fn() { random(1000000) })]")
+	program := parser.New(l).ParseProgram()
+
+	run := func(seed int64) string {
+		config := Config{Rand: rand.New(rand.NewSource(seed))}
+		result := EvalWithConfig(context.Background(), program, object.NewEnvironment(), config)
+		arr, ok := result.(*object.Array)
+		if !ok {
+			t.Fatalf("result is not Array. got=%T (%+v)", result, result)
+		}
+		return arr.Inspect()
+	}
+
+	if a, b := run(1), run(1); a != b {
+		t.Errorf("same seed gave different numbers: %s and %s", a, b)
+	}
+	if a, b := run(1), run(2); a == b {
+		t.Errorf("different seeds gave the same numbers: %s", a)
+	}
+}
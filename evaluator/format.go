@@ -0,0 +1,82 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/object"
+	"strconv"
+	"strings"
+)
+
+// formatVerbs maps the verbs understood by formatString to the types of
+// the values they format. %v formats any value.
+var formatVerbs = map[byte][]object.ObjectType{
+	'd': {object.INTEGER_OBJ, object.BIG_INTEGER_OBJ},
+	'f': {object.FLOAT_OBJ},
+	's': {object.STRING_OBJ},
+	'q': {object.STRING_OBJ},
+	't': {object.BOOLEAN_OBJ},
+	'v': nil,
+}
+
+// formatString replaces the verbs in format, like %d and %s, with args in
+// order, as the builtin called name does. %% stands for a percent sign.
+func formatString(name, format string, args []object.Object) (string, *object.Error) {
+	var out strings.Builder
+	next := 0
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			out.WriteByte(format[i])
+			continue
+		}
+
+		i++
+		if i == len(format) {
+			return "", newError("format given to `%s` ends with %%", name)
+		}
+		verb := format[i]
+		if verb == '%' {
+			out.WriteByte('%')
+			continue
+		}
+
+		types, ok := formatVerbs[verb]
+		if !ok {
+			return "", newError("unknown verb %%%c in format given to `%s`", verb, name)
+		}
+		if next == len(args) {
+			return "", newError("missing argument for %%%c in format given to `%s`", verb, name)
+		}
+		arg := args[next]
+		next++
+
+		if types != nil && !hasType(arg, types) {
+			return "", newError("%%%c in format given to `%s` must be %s, got %s",
+				verb, name, types[0], arg.Type())
+		}
+
+		switch verb {
+		case 'f':
+			out.WriteString(fmt.Sprintf("%f", arg.(*object.Float).Value))
+		case 'q':
+			out.WriteString(strconv.Quote(arg.(*object.String).Value))
+		default:
+			out.WriteString(arg.Inspect())
+		}
+	}
+
+	if next < len(args) {
+		return "", newError("too many arguments for format given to `%s`. got=%d, want=%d",
+			name, len(args), next)
+	}
+	return out.String(), nil
+}
+
+func hasType(obj object.Object, types []object.ObjectType) bool {
+	for _, t := range types {
+		if obj.Type() == t {
+			return true
+		}
+	}
+	return false
+}
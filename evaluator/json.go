@@ -0,0 +1,151 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"monkey/object"
+	"strings"
+)
+
+// jsonEncode returns obj as JSON text, indented by two spaces per level
+// when pretty is set. Hash keys must be strings and come out sorted.
+func jsonEncode(obj object.Object, pretty bool) (string, *object.Error) {
+	value, err := toJSONValue(obj, map[object.Object]bool{})
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(value); err != nil {
+		return "", newError("cannot encode as JSON: %s", err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// toJSONValue converts obj to a value encoding/json can encode. visiting
+// holds the arrays and hashes being converted, which obj must not be.
+func toJSONValue(obj object.Object, visiting map[object.Object]bool) (interface{}, *object.Error) {
+	switch obj := obj.(type) {
+	case *object.Null:
+		return nil, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.BigInteger:
+		return json.Number(obj.Value.String()), nil
+	case *object.Float:
+		if math.IsInf(obj.Value, 0) || math.IsNaN(obj.Value) {
+			return nil, newError("cannot encode %s as JSON", obj.Inspect())
+		}
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+
+	case *object.Array:
+		if visiting[obj] {
+			return nil, newError("cannot encode cyclic value as JSON")
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		values := make([]interface{}, len(obj.Elements))
+		for i, elem := range obj.Elements {
+			value, err := toJSONValue(elem, visiting)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+
+	case *object.Hash:
+		if visiting[obj] {
+			return nil, newError("cannot encode cyclic value as JSON")
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		values := make(map[string]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			key, ok := pair.Key.(*object.String)
+			if !ok {
+				return nil, newError("cannot encode hash key %s as JSON: keys must be STRING, got %s",
+					pair.Key.Inspect(), pair.Key.Type())
+			}
+			value, err := toJSONValue(pair.Value, visiting)
+			if err != nil {
+				return nil, err
+			}
+			values[key.Value] = value
+		}
+		return values, nil
+
+	default:
+		return nil, newError("cannot encode %s as JSON", obj.Type())
+	}
+}
+
+// jsonDecode parses the JSON text src. Numbers without a fraction or
+// exponent that fit in an int64 become integers, other numbers floats.
+func jsonDecode(src string) (object.Object, *object.Error) {
+	dec := json.NewDecoder(strings.NewReader(src))
+	dec.UseNumber()
+
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, newError("invalid JSON: %s", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, newError("invalid JSON: unexpected data after top-level value")
+	}
+
+	return fromJSONValue(value), nil
+}
+
+func fromJSONValue(value interface{}) object.Object {
+	switch value := value.(type) {
+	case bool:
+		return nativeBoolToBooleanObject(value)
+	case string:
+		return &object.String{Value: value}
+
+	case json.Number:
+		if !strings.ContainsAny(value.String(), ".eE") {
+			if i, err := value.Int64(); err == nil {
+				return object.NewInt(i)
+			}
+		}
+		f, _ := value.Float64()
+		return &object.Float{Value: f}
+
+	case []interface{}:
+		elements := make([]object.Object, len(value))
+		for i, elem := range value {
+			elements[i] = fromJSONValue(elem)
+		}
+		return &object.Array{Elements: elements}
+
+	case map[string]interface{}:
+		// the pairs are not added with Set, so the hash orders them by key
+		pairs := make(map[object.HashKey]object.HashPair, len(value))
+		for k, v := range value {
+			key := &object.String{Value: k}
+			pairs[key.HashKey()] = object.HashPair{Key: key, Value: fromJSONValue(v)}
+		}
+		return &object.Hash{Pairs: pairs}
+
+	default:
+		return NULL
+	}
+}
@@ -0,0 +1,52 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// methods lists the builtins that values of each type can call as methods,
+// so that `xs.map(f)` is `map(xs, f)`.
+var methods = map[object.ObjectType]map[string]bool{
+	object.STRING_OBJ: set("len", "split", "replace", "trim", "upper", "lower", "contains"),
+	object.ARRAY_OBJ:  set("len", "first", "last", "rest", "push", "join", "map", "filter", "reduce", "sort"),
+	object.HASH_OBJ:   set("keys", "values"),
+	object.RANGE_OBJ:  set("len"),
+}
+
+func set(names ...string) map[string]bool {
+	s := make(map[string]bool, len(names))
+	for _, name := range names {
+		s[name] = true
+	}
+	return s
+}
+
+// evalMethodCallExpression calls the builtin named by the method with the
+// receiver as its first argument, if the receiver's type has that method.
+func (e *evaluation) evalMethodCallExpression(
+	mc *ast.MethodCallExpression,
+	env *object.Environment,
+) object.Object {
+	receiver := e.eval(mc.Receiver, env)
+	if isError(receiver) {
+		return receiver
+	}
+
+	if mc.Optional && receiver == NULL {
+		return NULL
+	}
+
+	args := e.evalArguments(mc.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	name := mc.Method.Value
+	if !methods[receiver.Type()][name] {
+		return newError("unknown method `%s` for %s", name, receiver.Type())
+	}
+
+	args = append([]object.Object{receiver}, args...)
+	return e.applyBuiltin(builtins[name], args, Frame{Name: name, Call: mc.Token})
+}
@@ -0,0 +1,128 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/module"
+	"monkey/object"
+	"path/filepath"
+)
+
+// moduleCache holds the modules imported by an evaluation and the tasks it
+// spawns, by resolved path, so that a module is evaluated only once however
+// often it is imported. Each evaluation has its own, since what a module
+// does depends on the configuration it is evaluated with. Its tasks take
+// turns using it.
+type moduleCache struct {
+	modules map[string]*moduleLoad
+
+	// the task each task is waiting for to finish evaluating a module
+	waiting map[*evaluation]*evaluation
+}
+
+// moduleLoad is a module being evaluated by a task, or evaluated already.
+type moduleLoad struct {
+	by     *evaluation
+	done   bool          // whether result is set
+	result object.Object // the *object.Module, or an error
+}
+
+func newModuleCache() *moduleCache {
+	return &moduleCache{
+		modules: map[string]*moduleLoad{},
+		waiting: map[*evaluation]*evaluation{},
+	}
+}
+
+// load returns the module at path, calling eval to evaluate it in task e
+// unless it is cached. If another task is evaluating the module, load
+// waits for it to finish. Waiting on a module that e is itself evaluating,
+// directly or through other tasks, is an import cycle. Modules that fail
+// to evaluate are not cached.
+func (c *moduleCache) load(e *evaluation, path string, eval func() object.Object) object.Object {
+	if l, ok := c.modules[path]; ok {
+		if l.done {
+			return l.result
+		}
+
+		for task := l.by; task != nil; task = c.waiting[task] {
+			if task == e {
+				return newError("import cycle: %s", path)
+			}
+		}
+		c.waiting[e] = l.by
+		defer delete(c.waiting, e)
+
+		for !l.done {
+			if err := e.wait(); err != nil {
+				return err
+			}
+		}
+		return l.result
+	}
+
+	l := &moduleLoad{by: e}
+	c.modules[path] = l
+
+	l.result = eval()
+	if isError(l.result) {
+		delete(c.modules, path)
+	}
+	l.done = true
+	e.sched.broadcast()
+
+	return l.result
+}
+
+// evalImportExpression evaluates the imported file in an environment of
+// its own and exposes its top-level bindings as the module's members.
+func (e *evaluation) evalImportExpression(
+	ie *ast.ImportExpression,
+	env *object.Environment,
+) object.Object {
+	pathObj := e.eval(ie.Path, env)
+	if isError(pathObj) {
+		return pathObj
+	}
+
+	str, ok := pathObj.(*object.String)
+	if !ok {
+		return newError("import path must be STRING, got %s", pathObj.Type())
+	}
+
+	path, err := module.Resolve(env.Dir(), str.Value)
+	if err != nil {
+		return newError("cannot import %q: %s", str.Value, err)
+	}
+	if !module.IsStd(path) && !e.config.AllowFS {
+		return newError("cannot import %q: file system access is disabled", str.Value)
+	}
+
+	return e.modules.load(e, path, func() object.Object {
+		program, err := module.Load(path)
+		if err != nil {
+			return newError("cannot import %q: %s", str.Value, err)
+		}
+
+		modEnv := object.NewEnvironment()
+		modEnv.SetDir(filepath.Dir(path))
+
+		result := e.eval(program, modEnv)
+		if isError(result) {
+			return result
+		}
+
+		return &object.Module{Path: path, Members: modEnv.Bindings()}
+	})
+}
+
+func evalModuleIndexExpression(mod, index object.Object) object.Object {
+	moduleObject := mod.(*object.Module)
+	name := index.(*object.String).Value
+
+	member, ok := moduleObject.Members[name]
+	if !ok {
+		return newError("module has no member: %s", name)
+	}
+
+	return member
+}
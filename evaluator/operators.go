@@ -0,0 +1,30 @@
+package evaluator
+
+import "monkey/object"
+
+// Infix applies a binary operator other than &&, || and ?? to left and
+// right the way the evaluator does, without big integers. It returns an
+// *object.Error when the operator does not apply to them.
+//
+// Infix, Prefix, Index and IsTruthy let code that runs Monkey programs
+// without the evaluator, like programs translated to Go, give them the
+// same meaning.
+func Infix(operator string, left, right object.Object) object.Object {
+	return evalInfixExpression(operator, left, right, false)
+}
+
+// Prefix applies the unary operator ! or - to right.
+func Prefix(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right, false)
+}
+
+// Index returns left[index] for an array, hash or module. Out-of-bounds
+// array indexes give null.
+func Index(left, index object.Object) object.Object {
+	return evalIndexExpression(left, index, false)
+}
+
+// IsTruthy reports whether obj counts as true in a condition.
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
@@ -0,0 +1,82 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// A call in tail position is the last thing its function does, so the
+// function's own environment is no longer needed once the call starts.
+// Instead of calling, eval returns a tailCall describing it, which
+// applyFunction runs in place of the returning function. Tail-recursive
+// functions thus run without growing the Go stack or the call depth.
+type tailCall struct {
+	fn    *object.Function
+	args  []object.Object
+	frame Frame // the call's name and position, for errors and hooks
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call" }
+
+// markTailCalls records the calls in tail position within the function
+// body: the value of a return statement and the value of the body's last
+// statement, including through the branches of if expressions. Each body
+// is only examined once.
+func (e *evaluation) markTailCalls(body *ast.BlockStatement) {
+	if e.analyzed[body] {
+		return
+	}
+	if e.analyzed == nil {
+		e.analyzed = map[*ast.BlockStatement]bool{}
+		e.tailCalls = map[*ast.CallExpression]bool{}
+	}
+	e.analyzed[body] = true
+
+	e.markTailBlock(body)
+
+	var markReturns func(node ast.Node) bool
+	markReturns = func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FunctionLiteral:
+			// a nested function's tail calls are its own
+			return false
+		case *ast.TryExpression:
+			// calls returned from a try block must still run inside it,
+			// so that their errors are caught
+			ast.Inspect(node.Handler, markReturns)
+			return false
+		case *ast.ReturnStatement:
+			if node.ReturnValue != nil {
+				e.markTailExpression(node.ReturnValue)
+			}
+		}
+		return true
+	}
+	ast.Inspect(body, markReturns)
+}
+
+func (e *evaluation) markTailBlock(block *ast.BlockStatement) {
+	if block == nil || len(block.Statements) == 0 {
+		return
+	}
+
+	last := block.Statements[len(block.Statements)-1]
+	if es, ok := last.(*ast.ExpressionStatement); ok {
+		e.markTailExpression(es.Expression)
+	}
+}
+
+func (e *evaluation) markTailExpression(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.CallExpression:
+		e.tailCalls[exp] = true
+	case *ast.IfExpression:
+		e.markTailBlock(exp.Consequence)
+		e.markTailBlock(exp.Alternative)
+	case *ast.MatchExpression:
+		for _, arm := range exp.Arms {
+			e.markTailExpression(arm.Body)
+		}
+	}
+}
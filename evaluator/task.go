@@ -0,0 +1,216 @@
+package evaluator
+
+import (
+	"context"
+	"monkey/object"
+	"runtime"
+	"sync"
+)
+
+// deadlockMessage is the error of a task waiting when every task is
+// waiting, so that none of them ever can go on.
+const deadlockMessage = "deadlock: all tasks are waiting"
+
+// scheduler runs the tasks of an evaluation: the evaluation itself and the
+// tasks started by spawn. Tasks take turns, running Monkey code only while
+// they hold mu, so that they can share arrays, hashes and environments. A
+// task gives up its turn while it waits on a channel or on a module
+// another task is importing, and every cancelCheckInterval steps so that
+// the others get to run.
+type scheduler struct {
+	mu   sync.Mutex
+	cond *sync.Cond // broadcast, with mu held, when waiting tasks may go on
+
+	live      int // the tasks that have not finished
+	waiting   int // the tasks waiting since the last broadcast
+	deadlocks int // how often all live tasks were waiting at once
+
+	// the spawned tasks that have not finished, for the evaluation to
+	// wait for once it is done
+	tasks sync.WaitGroup
+
+	// the tasks that failed while the evaluation ran, in order
+	failed []taskFailure
+}
+
+// taskFailure is a spawned task that failed with err, which it sent on
+// result.
+type taskFailure struct {
+	result *object.Channel
+	err    *object.Error
+}
+
+func newScheduler() *scheduler {
+	s := &scheduler{live: 1}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// run runs eval as the first task of evaluation e, then stops the tasks
+// it spawned, canceling their context with cancel, and waits for them to
+// finish. An error a task failed with that no task received becomes the
+// result, unless the evaluation failed itself.
+func (s *scheduler) run(e *evaluation, cancel context.CancelFunc, eval func() object.Object) object.Object {
+	// tasks waiting when the context is done must stop waiting
+	stop := context.AfterFunc(e.ctx, func() {
+		s.mu.Lock()
+		s.broadcast()
+		s.mu.Unlock()
+	})
+	defer stop()
+
+	s.mu.Lock()
+	result := eval()
+	cancel()
+	s.finish()
+	s.mu.Unlock()
+
+	s.tasks.Wait()
+
+	if isError(result) {
+		return result
+	}
+	for _, f := range s.failed {
+		if f.result.Received == 0 {
+			return f.err
+		}
+	}
+	return result
+}
+
+// spawn runs f as a new task on a goroutine of its own, sending its result
+// on the returned channel.
+func (s *scheduler) spawn(e *evaluation, f func() object.Object) *object.Channel {
+	result := &object.Channel{Size: 1}
+
+	s.live++
+	s.tasks.Add(1)
+	go func() {
+		defer s.tasks.Done()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		val := f()
+		// the error of stopping the task when the evaluation is done is
+		// not a failure of the task
+		if err, ok := val.(*object.Error); ok && !stopped(e, err) {
+			s.failed = append(s.failed, taskFailure{result: result, err: err})
+		}
+		result.Queue = append(result.Queue, val)
+		result.Sent++
+		s.finish()
+	}()
+
+	return result
+}
+
+// stopped reports whether err is the error of e's context being done.
+func stopped(e *evaluation, err *object.Error) bool {
+	return e.ctx.Err() != nil && err.Message == e.ctx.Err().Error()
+}
+
+// finish ends the running task, waking the waiting ones, which may have
+// waited for it.
+func (s *scheduler) finish() {
+	s.live--
+	s.broadcast()
+}
+
+// broadcast wakes the waiting tasks to check whether they can go on.
+func (s *scheduler) broadcast() {
+	s.waiting = 0
+	s.cond.Broadcast()
+}
+
+// yield lets the other tasks run, if there are any.
+func (s *scheduler) yield() {
+	if s.live > 1 {
+		s.mu.Unlock()
+		runtime.Gosched()
+		s.mu.Lock()
+	}
+}
+
+// wait gives up the turn of task e until another task changes something
+// it may be waiting for. It returns an error once every task is waiting,
+// or if e's context is done.
+func (e *evaluation) wait() *object.Error {
+	if err := e.ctx.Err(); err != nil {
+		return newError("%s", err)
+	}
+
+	s := e.sched
+	s.waiting++
+	if s.waiting == s.live {
+		// the waiting tasks fail along with e
+		s.deadlocks++
+		s.broadcast()
+		return newError(deadlockMessage)
+	}
+
+	deadlocks := s.deadlocks
+	s.cond.Wait()
+	if s.deadlocks != deadlocks {
+		return newError(deadlockMessage)
+	}
+	if err := e.ctx.Err(); err != nil {
+		return newError("%s", err)
+	}
+	return nil
+}
+
+// waiter returns how a builtin running on rt waits for other tasks. Only
+// the evaluator runs tasks; anywhere else, there is nobody to wait for.
+func waiter(rt object.Runtime) func() *object.Error {
+	if e, ok := rt.(*evaluation); ok {
+		return e.wait
+	}
+	return func() *object.Error { return newError(deadlockMessage) }
+}
+
+// signal tells the tasks waiting on rt, if any, that something changed.
+func signal(rt object.Runtime) {
+	if e, ok := rt.(*evaluation); ok {
+		e.sched.broadcast()
+	}
+}
+
+// send sends val on ch, waiting for room in it and, if ch has no room
+// at all, for a task to receive val.
+func send(rt object.Runtime, ch *object.Channel, val object.Object) object.Object {
+	wait := waiter(rt)
+
+	for len(ch.Queue) >= max(ch.Size, 1) {
+		if err := wait(); err != nil {
+			return err
+		}
+	}
+	ch.Queue = append(ch.Queue, val)
+	ch.Sent++
+	signal(rt)
+
+	if ch.Size == 0 {
+		for sent := ch.Sent; ch.Received < sent; {
+			if err := wait(); err != nil {
+				return err
+			}
+		}
+	}
+	return NULL
+}
+
+// recv receives a value from ch, waiting for one to be sent.
+func recv(rt object.Runtime, ch *object.Channel) object.Object {
+	wait := waiter(rt)
+
+	for len(ch.Queue) == 0 {
+		if err := wait(); err != nil {
+			return err
+		}
+	}
+	val := ch.Queue[0]
+	ch.Queue = ch.Queue[1:]
+	ch.Received++
+	signal(rt)
+	return val
+}
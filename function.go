@@ -0,0 +1,240 @@
+package monkey
+
+import (
+	"errors"
+	"fmt"
+	"monkey/object"
+	"reflect"
+)
+
+var (
+	objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// RegisterFunction makes fn callable from the script as a global function
+// called name. Returning an *object.Error from fn raises a runtime error.
+func (s *Script) RegisterFunction(name string, fn object.BuiltinFunction) error {
+	return s.SetGlobal(name, &object.Builtin{Fn: fn})
+}
+
+// RegisterGoFunction is like RegisterFunction, but accepts an ordinary Go
+// function, wrapped with WrapGoFunction.
+func (s *Script) RegisterGoFunction(name string, fn interface{}) error {
+	builtin, err := WrapGoFunction(name, fn)
+	if err != nil {
+		return err
+	}
+	return s.RegisterFunction(name, builtin)
+}
+
+// WrapGoFunction turns a Go function into a builtin. Arguments are
+// converted to the function's parameter types, which may be anything
+// ToGo produces, the corresponding sized types, slices and maps of those,
+// interface{} or object.Object. The function may return nothing, one
+// value, or a value and an error; a non-nil error raises a runtime error.
+// The name is only used in error messages.
+func WrapGoFunction(name string, fn interface{}) (object.BuiltinFunction, error) {
+	v := reflect.ValueOf(fn)
+	typ := v.Type()
+	if typ.Kind() != reflect.Func {
+		return nil, fmt.Errorf("monkey: %s is %T, not a function", name, fn)
+	}
+
+	numOut := typ.NumOut()
+	if numOut > 2 || (numOut == 2 && typ.Out(1) != errorType) {
+		return nil, fmt.Errorf("monkey: %s must return at most a value and an error", name)
+	}
+
+	return func(args ...object.Object) object.Object {
+		numIn := typ.NumIn()
+		if typ.IsVariadic() {
+			numIn--
+			if len(args) < numIn {
+				return newError("wrong number of arguments. got=%d, want at least %d",
+					len(args), numIn)
+			}
+		} else if len(args) != numIn {
+			return newError("wrong number of arguments. got=%d, want=%d",
+				len(args), numIn)
+		}
+
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			var paramType reflect.Type
+			if i >= numIn {
+				paramType = typ.In(numIn).Elem()
+			} else {
+				paramType = typ.In(i)
+			}
+
+			val, err := fromObject(arg, paramType)
+			if err != nil {
+				return newError("argument %d to `%s` %s", i+1, name, err)
+			}
+			in[i] = val
+		}
+
+		out := v.Call(in)
+
+		if numOut == 2 && !out[1].IsNil() {
+			return newError("%s", out[1].Interface().(error))
+		}
+		if numOut == 0 {
+			return object.NULL
+		}
+
+		if numOut == 1 && typ.Out(0) == errorType {
+			if !out[0].IsNil() {
+				return newError("%s", out[0].Interface().(error))
+			}
+			return object.NULL
+		}
+
+		result, err := ToObject(out[0].Interface())
+		if err != nil {
+			return newError("result of `%s`: %s", name, err)
+		}
+		return result
+	}, nil
+}
+
+// fromObject converts obj to a Go value of type typ. Its errors complete
+// a sentence starting with the argument being converted.
+func fromObject(obj object.Object, typ reflect.Type) (reflect.Value, error) {
+	if typ.Implements(objectType) {
+		if !reflect.TypeOf(obj).AssignableTo(typ) {
+			return reflect.Value{}, fmt.Errorf("must be %s, got %s", typ, obj.Type())
+		}
+		return reflect.ValueOf(obj), nil
+	}
+
+	mismatch := func() (reflect.Value, error) {
+		return reflect.Value{}, fmt.Errorf("must be %s, got %s", monkeyTypeName(typ), obj.Type())
+	}
+
+	switch typ.Kind() {
+	case reflect.Interface:
+		goValue, err := ToGo(obj)
+		if err != nil {
+			return reflect.Value{}, errors.New("contains itself")
+		}
+		if goValue == nil {
+			return reflect.Zero(typ), nil
+		}
+		if !reflect.TypeOf(goValue).AssignableTo(typ) {
+			return mismatch()
+		}
+		return reflect.ValueOf(goValue), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		integer, ok := obj.(*object.Integer)
+		if !ok {
+			return mismatch()
+		}
+		val := reflect.New(typ).Elem()
+		if val.OverflowInt(integer.Value) {
+			return reflect.Value{}, fmt.Errorf("overflows %s: %d", typ, integer.Value)
+		}
+		val.SetInt(integer.Value)
+		return val, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		integer, ok := obj.(*object.Integer)
+		if !ok {
+			return mismatch()
+		}
+		val := reflect.New(typ).Elem()
+		if integer.Value < 0 || val.OverflowUint(uint64(integer.Value)) {
+			return reflect.Value{}, fmt.Errorf("overflows %s: %d", typ, integer.Value)
+		}
+		val.SetUint(uint64(integer.Value))
+		return val, nil
+
+	case reflect.Float32, reflect.Float64:
+		val := reflect.New(typ).Elem()
+		switch obj := obj.(type) {
+		case *object.Float:
+			val.SetFloat(obj.Value)
+		case *object.Integer:
+			val.SetFloat(float64(obj.Value))
+		default:
+			return mismatch()
+		}
+		return val, nil
+
+	case reflect.String:
+		str, ok := obj.(*object.String)
+		if !ok {
+			return mismatch()
+		}
+		return reflect.ValueOf(str.Value).Convert(typ), nil
+
+	case reflect.Bool:
+		boolean, ok := obj.(*object.Boolean)
+		if !ok {
+			return mismatch()
+		}
+		return reflect.ValueOf(boolean.Value).Convert(typ), nil
+
+	case reflect.Slice:
+		array, ok := obj.(*object.Array)
+		if !ok {
+			return mismatch()
+		}
+		val := reflect.MakeSlice(typ, len(array.Elements), len(array.Elements))
+		for i, elem := range array.Elements {
+			e, err := fromObject(elem, typ.Elem())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("element %d %s", i, err)
+			}
+			val.Index(i).Set(e)
+		}
+		return val, nil
+
+	case reflect.Map:
+		hash, ok := obj.(*object.Hash)
+		if !ok {
+			return mismatch()
+		}
+		val := reflect.MakeMapWithSize(typ, len(hash.Pairs))
+		for _, pair := range hash.Pairs {
+			k, err := fromObject(pair.Key, typ.Key())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("key %s %s", pair.Key.Inspect(), err)
+			}
+			e, err := fromObject(pair.Value, typ.Elem())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("value of %s %s", pair.Key.Inspect(), err)
+			}
+			val.SetMapIndex(k, e)
+		}
+		return val, nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("has unsupported Go type %s", typ)
+}
+
+// monkeyTypeName names the Monkey type that converts to typ.
+func monkeyTypeName(typ reflect.Type) string {
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return object.INTEGER_OBJ
+	case reflect.Float32, reflect.Float64:
+		return object.FLOAT_OBJ
+	case reflect.String:
+		return object.STRING_OBJ
+	case reflect.Bool:
+		return object.BOOLEAN_OBJ
+	case reflect.Slice:
+		return object.ARRAY_OBJ
+	case reflect.Map:
+		return object.HASH_OBJ
+	}
+	return typ.String()
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
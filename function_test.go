@@ -0,0 +1,135 @@
+package monkey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"monkey/object"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRegisterFunction(t *testing.T) {
+	for _, engine := range engines {
+		script := NewWithEngine(engine)
+		script.RegisterFunction("count", func(args ...object.Object) object.Object {
+			return &object.Integer{Value: int64(len(args))}
+		})
+		script.RegisterFunction("fail", func(args ...object.Object) object.Object {
+			return &object.Error{Message: "failed on purpose"}
+		})
+
+		script.Compile("count(1, 2, 3)")
+		result, err := script.Run(context.Background())
+		if err != nil || result != int64(3) {
+			t.Errorf("[%s] wrong result. got=%v, err=%v", engine, result, err)
+		}
+
+		script.Compile("fail()")
+		_, err = script.Run(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "failed on purpose") {
+			t.Errorf("[%s] expected error from fail(). got=%v", engine, err)
+		}
+	}
+}
+
+func TestRegisterGoFunction(t *testing.T) {
+	funcs := map[string]interface{}{
+		"add":   func(a, b int) int { return a + b },
+		"half":  func(x float64) float64 { return x / 2 },
+		"upper": strings.ToUpper,
+		"sum": func(xs ...int8) int {
+			n := 0
+			for _, x := range xs {
+				n += int(x)
+			}
+			return n
+		},
+		"keys":  func(m map[string]bool) int { return len(m) },
+		"first": func(xs []string) string { return xs[0] },
+		"check": func(ok bool) error {
+			if !ok {
+				return errors.New("not ok")
+			}
+			return nil
+		},
+		"divide": func(a, b int) (int, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("divide by zero")
+			}
+			return a / b, nil
+		},
+		"kind": func(v interface{}) string { return fmt.Sprintf("%T", v) },
+		"raw":  func(obj object.Object) object.ObjectType { return obj.Type() },
+		"nop":  func() {},
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"add(2, 3)", int64(5)},
+		{"half(3)", 1.5},
+		{`upper("abc")`, "ABC"},
+		{"sum()", int64(0)},
+		{"sum(1, 2, 3)", int64(6)},
+		{`keys({"a": true, "b": false})`, int64(2)},
+		{`first(["x", "y"])`, "x"},
+		{"check(true)", nil},
+		{"divide(7, 2)", int64(3)},
+		{`kind([1])`, "[]interface {}"},
+		{"raw([1])", "ARRAY"},
+		{"nop()", nil},
+		{"add(1)", errors.New("wrong number of arguments. got=1, want=2")},
+		{`add(1, "2")`, errors.New("argument 2 to `add` must be INTEGER, got STRING")},
+		{"sum(1, 300)", errors.New("argument 2 to `sum` overflows int8: 300")},
+		{`first([1])`, errors.New("argument 1 to `first` element 0 must be STRING, got INTEGER")},
+		{"check(false)", errors.New("not ok")},
+		{"divide(1, 0)", errors.New("divide by zero")},
+	}
+
+	for _, engine := range engines {
+		script := NewWithEngine(engine)
+		for name, fn := range funcs {
+			if err := script.RegisterGoFunction(name, fn); err != nil {
+				t.Fatalf("RegisterGoFunction(%q) failed: %s", name, err)
+			}
+		}
+
+		for _, tt := range tests {
+			if err := script.Compile(tt.input); err != nil {
+				t.Fatalf("[%s] Compile(%q) failed: %s", engine, tt.input, err)
+			}
+			result, err := script.Run(context.Background())
+
+			if expected, ok := tt.expected.(error); ok {
+				if err == nil || !strings.HasPrefix(err.Error(), expected.Error()) {
+					t.Errorf("[%s] wrong error for %q. want=%q, got=%v", engine, tt.input, expected, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("[%s] Run(%q) failed: %s", engine, tt.input, err)
+				continue
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("[%s] wrong result for %q. want=%#v, got=%#v", engine, tt.input, tt.expected, result)
+			}
+		}
+	}
+}
+
+func TestWrapGoFunctionErrors(t *testing.T) {
+	tests := []interface{}{
+		5,
+		func() (int, int) { return 0, 0 },
+		func() (int, error, bool) { return 0, nil, false },
+	}
+
+	for _, fn := range tests {
+		if _, err := WrapGoFunction("f", fn); err == nil {
+			t.Errorf("WrapGoFunction(%T) should fail", fn)
+		}
+	}
+}
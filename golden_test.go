@@ -0,0 +1,92 @@
+package monkey
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of TestGolden")
+
+// TestGolden checks the programs in testdata/golden against the golden
+// files next to them: for each name.monkey, name.ast holds its syntax
+// tree as ast.Tree prints it, or its syntax errors, and name.out what it
+// prints when run on the evaluator, followed by the error it fails with,
+// if any. Programs that do not parse have no .out file.
+//
+// To cover more of the language, add a .monkey file and run
+//
+//	go test -run TestGolden -update
+//
+// to write its golden files, then check that they hold what they should.
+func TestGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "golden", "*.monkey"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no golden tests found")
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(input, ".monkey")
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			src, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p := parser.New(lexer.New(string(src)))
+			program := p.ParseProgram()
+			if len(p.Errors()) != 0 {
+				var out bytes.Buffer
+				for _, err := range p.Errors() {
+					out.WriteString(err.Error() + "\n")
+				}
+				checkGolden(t, name+".ast", out.Bytes())
+				return
+			}
+			checkGolden(t, name+".ast", []byte(ast.Tree(program)))
+
+			var out bytes.Buffer
+			env := object.NewEnvironment()
+			env.SetDir(filepath.Dir(input))
+			result := evaluator.EvalWithConfig(context.Background(), program, env,
+				evaluator.Config{Stdout: &out, Stderr: &out})
+			if errObj, ok := result.(*object.Error); ok {
+				out.WriteString(errObj.Trace() + "\n")
+			}
+			checkGolden(t, name+".out", out.Bytes())
+		})
+	}
+}
+
+// checkGolden compares got with the golden file path, or rewrites the file
+// with got when -update is set.
+func checkGolden(t *testing.T, path string, got []byte) {
+	t.Helper()
+
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s (run with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s does not match.\nwant:\n%s\ngot:\n%s", path, want, got)
+	}
+}
@@ -0,0 +1,98 @@
+package lexer
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"monkey/token"
+	"strings"
+)
+
+// Class is the kind of a token as far as syntax highlighting is concerned.
+type Class string
+
+const (
+	KEYWORD     Class = "keyword"
+	IDENT       Class = "ident"
+	NUMBER      Class = "number"
+	STRING      Class = "string"
+	OPERATOR    Class = "operator"
+	PUNCTUATION Class = "punctuation"
+	COMMENT     Class = "comment"
+	ILLEGAL     Class = "illegal"
+)
+
+// ClassifiedToken is a token with its class and the byte offsets of its
+// source, which span from Start up to but not including End.
+type ClassifiedToken struct {
+	token.Token
+	Class      Class
+	Start, End int
+}
+
+// TokenizeWithClasses splits src into tokens, comments included, and
+// classifies them. The source between two tokens is whitespace. The final
+// EOF token is left out.
+func TokenizeWithClasses(src string) []ClassifiedToken {
+	l := NewWithComments(src)
+
+	var tokens []ClassifiedToken
+	for {
+		tok := l.NextToken()
+		if tok.Type == token.EOF {
+			return tokens
+		}
+		tokens = append(tokens, ClassifiedToken{
+			Token: tok,
+			Class: Classify(tok.Type),
+			Start: l.start,
+			// an unterminated string leaves the lexer past the end
+			End: min(l.position, len(src)),
+		})
+	}
+}
+
+// Classify returns the class of tokens of type t.
+func Classify(t token.TokenType) Class {
+	switch t {
+	case token.IDENT:
+		return IDENT
+	case token.INT, token.FLOAT:
+		return NUMBER
+	case token.STRING, token.TEMPLATE:
+		return STRING
+	case token.COMMENT:
+		return COMMENT
+	case token.ILLEGAL, token.EOF:
+		return ILLEGAL
+	case token.COMMA, token.SEMICOLON, token.COLON, token.ARROW, token.DOT, token.ELLIPSIS,
+		token.LPAREN, token.RPAREN, token.LBRACE, token.RBRACE,
+		token.LBRACKET, token.RBRACKET:
+		return PUNCTUATION
+	}
+
+	if token.IsKeyword(t) {
+		return KEYWORD
+	}
+	return OPERATOR
+}
+
+// WriteHTML writes src to w as HTML, in a <pre class="monkey"> element
+// with each token but whitespace in a <span> whose class is the token's,
+// for style sheets to color.
+func WriteHTML(w io.Writer, src string) error {
+	var b strings.Builder
+	b.WriteString(`<pre class="monkey">`)
+
+	pos := 0
+	for _, tok := range TokenizeWithClasses(src) {
+		b.WriteString(html.EscapeString(src[pos:tok.Start]))
+		fmt.Fprintf(&b, `<span class="%s">%s</span>`, tok.Class, html.EscapeString(src[tok.Start:tok.End]))
+		pos = tok.End
+	}
+	b.WriteString(html.EscapeString(src[pos:]))
+
+	b.WriteString("</pre>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,80 @@
+package lexer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTokenizeWithClasses(t *testing.T) {
+	input := `let x = 1.5; // half
+if (x >= 1) { puts("big ${x}") } ~`
+
+	tests := []struct {
+		class Class
+		text  string
+	}{
+		{KEYWORD, "let"},
+		{IDENT, "x"},
+		{OPERATOR, "="},
+		{NUMBER, "1.5"},
+		{PUNCTUATION, ";"},
+		{COMMENT, "// half"},
+		{KEYWORD, "if"},
+		{PUNCTUATION, "("},
+		{IDENT, "x"},
+		{OPERATOR, ">="},
+		{NUMBER, "1"},
+		{PUNCTUATION, ")"},
+		{PUNCTUATION, "{"},
+		{IDENT, "puts"},
+		{PUNCTUATION, "("},
+		{STRING, `"big ${x}"`},
+		{PUNCTUATION, ")"},
+		{PUNCTUATION, "}"},
+		{ILLEGAL, "~"},
+	}
+
+	tokens := TokenizeWithClasses(input)
+	if len(tokens) != len(tests) {
+		t.Fatalf("wrong number of tokens. want=%d, got=%d", len(tests), len(tokens))
+	}
+
+	for i, tt := range tests {
+		tok := tokens[i]
+		if tok.Class != tt.class {
+			t.Errorf("tests[%d] - wrong class for %q. want=%s, got=%s",
+				i, tt.text, tt.class, tok.Class)
+		}
+		if text := input[tok.Start:tok.End]; text != tt.text {
+			t.Errorf("tests[%d] - wrong source. want=%q, got=%q", i, tt.text, text)
+		}
+	}
+}
+
+func TestTokenizeUnterminatedString(t *testing.T) {
+	input := `x + "open`
+
+	tokens := TokenizeWithClasses(input)
+	last := tokens[len(tokens)-1]
+	if last.Class != ILLEGAL || input[last.Start:last.End] != `"open` {
+		t.Errorf("wrong last token. got=%+v", last)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	input := "let s = \"<b>\";\n/* a & b */ s"
+
+	var out bytes.Buffer
+	if err := WriteHTML(&out, input); err != nil {
+		t.Fatalf("WriteHTML failed: %s", err)
+	}
+
+	expected := `<pre class="monkey"><span class="keyword">let</span> ` +
+		`<span class="ident">s</span> <span class="operator">=</span> ` +
+		`<span class="string">&#34;&lt;b&gt;&#34;</span><span class="punctuation">;</span>` + "\n" +
+		`<span class="comment">/* a &amp; b */</span> <span class="ident">s</span></pre>` + "\n"
+
+	if out.String() != expected {
+		t.Errorf("wrong HTML.\nwant=%s\ngot= %s", expected, out.String())
+	}
+}
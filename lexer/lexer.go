@@ -1,35 +1,105 @@
 package lexer
 
-import "monkey/token"
+import (
+	"monkey/token"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
 type Lexer struct {
 	input        string
 	position     int  // Curent position in the input (points to the current char)
 	readPosition int  // Current reading position in the input (after current char)
-	ch           byte // Current char under examination
+	ch           rune // Current char under examination
+	line         int  // Line of the current char
+	column       int  // Column of the current char
+
+	emitComments bool // Return comments as tokens instead of skipping them
+
+	start int // Position of the first char of the last token returned
+
+	names map[string]string // Interned identifier and keyword literals
 }
 
+// New creates a lexer for a whole source file. A first line starting with
+// "#!", like "#!/usr/bin/env monkey", is skipped so that scripts can be
+// run directly by the shell.
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
+	l.readChar()
+	if strings.HasPrefix(input, "#!") {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+	}
+	return l
+}
+
+// Input returns the source the lexer reads.
+func (l *Lexer) Input() string {
+	return l.input
+}
+
+// NewAt creates a lexer for input that starts at the given line and
+// column of some larger source, so that its tokens carry positions in
+// that source.
+func NewAt(input string, line, column int) *Lexer {
+	l := &Lexer{input: input, line: line, column: column - 1}
 	l.readChar()
 	return l
 }
 
+// NewWithComments creates a lexer that returns comments as COMMENT tokens
+// instead of skipping them, for tools that need to preserve them.
+func NewWithComments(input string) *Lexer {
+	l := New(input)
+	l.emitComments = true
+	return l
+}
+
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 0
+	}
+	l.column += 1
+
+	width := 1
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ch, width = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += width
 }
 
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 	l.skipWhitespace()
 
+	for l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*') {
+		l.start = l.position
+		line, column := l.line, l.column
+
+		literal, ok := l.readComment()
+		if !ok {
+			return token.Token{Type: token.ILLEGAL, Literal: literal, Line: line, Column: column}
+		}
+
+		if l.emitComments {
+			return token.Token{Type: token.COMMENT, Literal: literal, Line: line, Column: column}
+		}
+
+		l.skipWhitespace()
+	}
+
+	l.start = l.position
+	line, column := l.line, l.column
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -37,21 +107,53 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			literal := string(ch) + string(l.ch)
 			tok = token.Token{Type: token.EQ, Literal: literal}
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.ARROW, Literal: literal}
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
+	case ':':
+		tok = newToken(token.COLON, l.ch)
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
 		tok = newToken(token.RPAREN, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
+	case '.':
+		if l.peekChar() == '.' && l.peekCharAt(2) == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else if l.peekChar() == '.' {
+			l.readChar()
+			tok = token.Token{Type: token.DOTDOT, Literal: ".."}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.PLUS_ASSIGN, Literal: literal}
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.MINUS_ASSIGN, Literal: literal}
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -61,29 +163,114 @@ func (l *Lexer) NextToken() token.Token {
 		} else {
 			tok = newToken(token.BANG, l.ch)
 		}
+	case '?':
+		if l.peekChar() == '?' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.NULLISH, Literal: literal}
+		} else if l.peekChar() == '.' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.OPTIONAL_DOT, Literal: literal}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.AND, Literal: literal}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.OR, Literal: literal}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.SLASH_ASSIGN, Literal: literal}
+		} else {
+			tok = newToken(token.SLASH, l.ch)
+		}
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '*' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.POWER, Literal: literal}
+		} else if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.ASTERISK_ASSIGN, Literal: literal}
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.LT_EQ, Literal: literal}
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.GT_EQ, Literal: literal}
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
 	case '{':
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
 		tok = newToken(token.RBRACE, l.ch)
+	case '[':
+		tok = newToken(token.LBRACKET, l.ch)
+	case ']':
+		tok = newToken(token.RBRACKET, l.ch)
+	case '"':
+		raw, interpolated, ok := l.readString()
+		switch {
+		case !ok:
+			tok.Type = token.ILLEGAL
+			tok.Literal = raw
+		case interpolated:
+			tok.Type = token.TEMPLATE
+			tok.Literal = raw
+		default:
+			tok.Type = token.STRING
+			tok.Literal = Unescape(raw)
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
 	default:
 		if isLetter(l.ch) {
-			tok.Literal = l.readIdentifier()
+			tok.Literal = l.intern(l.readIdentifier())
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Line, tok.Column = line, column
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Type, tok.Literal = l.readNumber()
+			tok.Line, tok.Column = line, column
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -91,10 +278,23 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.readChar()
+	tok.Line, tok.Column = line, column
 	return tok
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+// asciiLiterals holds the literal of every single-byte token, so that
+// punctuation and operators don't allocate a string each.
+var asciiLiterals = func() (literals [utf8.RuneSelf]string) {
+	for ch := range literals {
+		literals[ch] = string(rune(ch))
+	}
+	return literals
+}()
+
+func newToken(tokenType token.TokenType, ch rune) token.Token {
+	if ch >= 0 && ch < utf8.RuneSelf {
+		return token.Token{Type: tokenType, Literal: asciiLiterals[ch]}
+	}
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
@@ -108,27 +308,298 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) peekChar() byte {
+// intern returns the lexer's copy of name, making one the first time the
+// name is seen. Every use of an identifier then shares a single string
+// that compares by pointer, and the tokens no longer keep the whole source
+// alive.
+func (l *Lexer) intern(name string) string {
+	if s, ok := l.names[name]; ok {
+		return s
+	}
+	if l.names == nil {
+		l.names = make(map[string]string)
+	}
+	s := strings.Clone(name)
+	l.names[s] = s
+	return s
+}
+
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	} else {
-		return l.input[l.readPosition]
+		ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+		return ch
 	}
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber reads an integer or a float literal. Floats have a fractional
+// part ("3.14"), an exponent ("1e9", "2.5E-3") or both. Integers may also
+// be written in hexadecimal ("0xFF"), octal ("0o755") or binary ("0b1010").
+func (l *Lexer) readNumber() (token.TokenType, string) {
 	position := l.position
+	tokenType := token.TokenType(token.INT)
+
+	if l.ch == '0' && isRadixPrefix(l.peekChar()) {
+		l.readChar()
+		l.readChar()
+		// read every alphanumeric char, so that the parser can point out
+		// malformed digits instead of splitting the literal in two
+		for isLetter(l.ch) || isDigit(l.ch) {
+			l.readChar()
+		}
+		return tokenType, l.input[position:l.position]
+	}
+
+	l.readDigits()
+
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+
+	if l.ch == 'e' || l.ch == 'E' {
+		next := l.peekChar()
+		if isDigit(next) || ((next == '+' || next == '-') && isDigit(l.peekCharAt(2))) {
+			tokenType = token.FLOAT
+			l.readChar()
+			if l.ch == '+' || l.ch == '-' {
+				l.readChar()
+			}
+			l.readDigits()
+		}
+	}
+
+	return tokenType, l.input[position:l.position]
+}
+
+func isRadixPrefix(ch rune) bool {
+	switch ch {
+	case 'x', 'X', 'o', 'O', 'b', 'B':
+		return true
+	}
+	return false
+}
+
+func (l *Lexer) readDigits() {
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// peekCharAt returns the char n positions after the current one.
+func (l *Lexer) peekCharAt(n int) rune {
+	pos := l.position
+	for ; n > 0 && pos < len(l.input); n-- {
+		_, width := utf8.DecodeRuneInString(l.input[pos:])
+		pos += width
+	}
+
+	if pos >= len(l.input) {
+		return 0
+	}
+	ch, _ := utf8.DecodeRuneInString(l.input[pos:])
+	return ch
+}
+
+// readString reads a double-quoted string literal and returns its raw
+// contents, escape sequences and all. It reports whether the string
+// contains `${...}` interpolations and returns false for ok if the input
+// ends before the closing quote.
+func (l *Lexer) readString() (raw string, interpolated bool, ok bool) {
+	position := l.position + 1
+
+	for {
+		l.readChar()
+
+		switch l.ch {
+		case '"':
+			return l.input[position:l.position], interpolated, true
+		case 0:
+			return l.input[position:l.position], interpolated, false
+		case '\\':
+			l.readChar()
+			if l.ch == 0 {
+				return l.input[position:l.position], interpolated, false
+			}
+		case '$':
+			if l.peekChar() == '{' {
+				interpolated = true
+				l.readChar()
+				if !l.skipInterpolation() {
+					return l.input[position:l.position], interpolated, false
+				}
+			}
+		}
+	}
+}
+
+// skipInterpolation advances from the '{' of a `${` to its matching '}',
+// stepping over nested braces and string literals.
+func (l *Lexer) skipInterpolation() bool {
+	depth := 1
+
+	for depth > 0 {
+		l.readChar()
+
+		switch l.ch {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '"':
+			if _, _, ok := l.readString(); !ok {
+				return false
+			}
+		case 0:
+			return false
+		}
+	}
+
+	return true
+}
+
+// Unescape decodes the escape sequences allowed in string literals:
+// \n, \t, \", \\, \$ and \u{XXXX} for any Unicode code point given in
+// hex. Any other backslash is kept as is.
+func Unescape(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	var out []byte
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			out = append(out, s[i])
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 'n':
+			out = append(out, '\n')
+		case 't':
+			out = append(out, '\t')
+		case '"', '\\', '$':
+			out = append(out, s[i])
+		case 'u':
+			if r, n, ok := decodeCodePoint(s[i+1:]); ok {
+				out = utf8.AppendRune(out, r)
+				i += n
+				break
+			}
+			out = append(out, '\\', s[i])
+		default:
+			out = append(out, '\\', s[i])
+		}
+	}
+
+	return string(out)
+}
+
+// decodeCodePoint decodes the `{XXXX}` part of a \u{XXXX} escape at the
+// start of s, returning the rune and the number of bytes it spans.
+func decodeCodePoint(s string) (rune, int, bool) {
+	end := strings.IndexByte(s, '}')
+	if len(s) < 3 || s[0] != '{' || end < 2 || end > 7 {
+		return 0, 0, false
+	}
+
+	n, err := strconv.ParseUint(s[1:end], 16, 32)
+	if err != nil || !utf8.ValidRune(rune(n)) {
+		return 0, 0, false
+	}
+
+	return rune(n), end + 1, true
+}
+
+// TemplatePart is a piece of an interpolated string literal: either
+// decoded literal text, or the source of an embedded `${...}` expression
+// along with the position where that source starts.
+type TemplatePart struct {
+	Text   string
+	IsExpr bool
+	Line   int
+	Column int
+}
+
+// SplitTemplate breaks the literal of a TEMPLATE token into its text and
+// expression parts. Positions of the parts are absolute, derived from the
+// position of tok.
+func SplitTemplate(tok token.Token) []TemplatePart {
+	l := NewAt(tok.Literal, tok.Line, tok.Column+1)
+
+	var parts []TemplatePart
+	text := l.position
+
+	for l.ch != 0 {
+		switch {
+		case l.ch == '\\':
+			l.readChar()
+
+		case l.ch == '$' && l.peekChar() == '{':
+			if text < l.position {
+				parts = append(parts, TemplatePart{Text: Unescape(l.input[text:l.position])})
+			}
+
+			l.readChar()
+			start, line, column := l.position+1, l.line, l.column+1
+			l.skipInterpolation()
+
+			parts = append(parts, TemplatePart{
+				Text:   l.input[start:l.position],
+				IsExpr: true,
+				Line:   line,
+				Column: column,
+			})
+			text = l.position + 1
+		}
+
+		l.readChar()
+	}
+
+	if text < len(l.input) {
+		parts = append(parts, TemplatePart{Text: Unescape(l.input[text:])})
+	}
+
+	return parts
+}
+
+// readComment reads a `// line` or `/* block */` comment, including its
+// delimiters. It returns false for a block comment that is never closed.
+func (l *Lexer) readComment() (string, bool) {
+	position := l.position
+
+	if l.peekChar() == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+		return l.input[position:l.position], true
+	}
+
+	l.readChar() // '/'
+	l.readChar() // '*'
+
+	for !(l.ch == '*' && l.peekChar() == '/') {
+		if l.ch == 0 {
+			return l.input[position:l.position], false
+		}
+		l.readChar()
+	}
+
+	l.readChar() // '*'
+	l.readChar() // '/'
+
+	return l.input[position:l.position], true
+}
+
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
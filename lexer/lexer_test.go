@@ -1,8 +1,10 @@
 package lexer
 
 import (
+	"monkey/bench"
 	"monkey/token"
 	"testing"
+	"unsafe"
 )
 
 func TestNextToken(t *testing.T) {
@@ -14,7 +16,7 @@ let add = fn(x, y) {
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -25,6 +27,8 @@ if (5 < 10) {
 
 10 == 10;
 10 != 9;
+[1, 2];
+1 <= 2 >= 1;
 `
 
 	tests := []struct {
@@ -104,6 +108,18 @@ if (5 < 10) {
 		{token.NOT_EQ, "!="},
 		{token.INT, "9"},
 		{token.SEMICOLON, ";"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.INT, "1"},
+		{token.LT_EQ, "<="},
+		{token.INT, "2"},
+		{token.GT_EQ, ">="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
 		{token.EOF, ""},
 	}
 
@@ -128,3 +144,604 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestStringLiterals(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{`"foobar"`, token.STRING, "foobar"},
+		{`"foo bar"`, token.STRING, "foo bar"},
+		{`""`, token.STRING, ""},
+		{`"line\nbreak"`, token.STRING, "line\nbreak"},
+		{`"tab\there"`, token.STRING, "tab\there"},
+		{`"say \"hi\""`, token.STRING, `say "hi"`},
+		{`"back\\slash"`, token.STRING, `back\slash`},
+		{`"unterminated`, token.ILLEGAL, "unterminated"},
+		{`"cost: \$5"`, token.STRING, "cost: $5"},
+		{`"\${x}"`, token.STRING, "${x}"},
+		{`"Hello, ${name}!"`, token.TEMPLATE, "Hello, ${name}!"},
+		{`"${ {"a": "}"}["a"] }"`, token.TEMPLATE, `${ {"a": "}"}["a"] }`},
+		{`"${x"`, token.ILLEGAL, `${x"`},
+		{`"héllo 🐍"`, token.STRING, "héllo 🐍"},
+		{`"\u{1F40D} \u{e9}"`, token.STRING, "🐍 é"},
+		{`"\u{110000} \u{} \u41"`, token.STRING, `\u{110000} \u{} \u41`},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - tokenliteral wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Fatalf("tests[%d] - expected EOF after string. got=%q", i, next.Type)
+		}
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := `let π = 3.14; let 名前 = "猿"; π_2 + 名前;`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "π", 5},
+		{token.ASSIGN, "=", 7},
+		{token.FLOAT, "3.14", 9},
+		{token.SEMICOLON, ";", 13},
+		{token.LET, "let", 15},
+		{token.IDENT, "名前", 19},
+		{token.ASSIGN, "=", 22},
+		{token.STRING, "猿", 24},
+		{token.SEMICOLON, ";", 27},
+		{token.IDENT, "π_", 29},
+		{token.INT, "2", 31},
+		{token.PLUS, "+", 33},
+		{token.IDENT, "名前", 35},
+		{token.SEMICOLON, ";", 37},
+		{token.EOF, "", 38},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+
+		if tok.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - column wrong. expected=%d, got=%d",
+				i, tt.expectedColumn, tok.Column)
+		}
+	}
+}
+
+func TestSplitTemplate(t *testing.T) {
+	l := New(`  "a\tb ${x + 1}${"${y}"}\${z}"`)
+	tok := l.NextToken()
+	if tok.Type != token.TEMPLATE {
+		t.Fatalf("expected TEMPLATE token. got=%q", tok.Type)
+	}
+
+	expected := []TemplatePart{
+		{Text: "a\tb "},
+		{Text: "x + 1", IsExpr: true, Line: 1, Column: 11},
+		{Text: `"${y}"`, IsExpr: true, Line: 1, Column: 19},
+		{Text: "${z}"},
+	}
+
+	parts := SplitTemplate(tok)
+	if len(parts) != len(expected) {
+		t.Fatalf("wrong number of parts. want=%d, got=%d (%+v)",
+			len(expected), len(parts), parts)
+	}
+
+	for i, part := range parts {
+		if part != expected[i] {
+			t.Errorf("parts[%d] wrong. want=%+v, got=%+v", i, expected[i], part)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  x + "a
+b";
+foo`
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.IDENT, 2, 3},
+		{token.PLUS, 2, 5},
+		{token.STRING, 2, 7},
+		{token.SEMICOLON, 3, 3},
+		{token.IDENT, 4, 1},
+		{token.EOF, 4, 4},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{"42", token.INT, "42"},
+		{"3.14", token.FLOAT, "3.14"},
+		{"1e9", token.FLOAT, "1e9"},
+		{"2.5E-3", token.FLOAT, "2.5E-3"},
+		{"6e+2", token.FLOAT, "6e+2"},
+		{"0.5", token.FLOAT, "0.5"},
+		{"0xFF", token.INT, "0xFF"},
+		{"0o755", token.INT, "0o755"},
+		{"0b1010", token.INT, "0b1010"},
+		{"0x", token.INT, "0x"},
+		{"0b102", token.INT, "0b102"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - tokenliteral wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Fatalf("tests[%d] - expected EOF after number. got=%q", i, next.Type)
+		}
+	}
+}
+
+func TestNumberFollowedByDot(t *testing.T) {
+	// A dot that is not followed by a digit does not belong to the number.
+	l := New("1e 5.x")
+
+	expected := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "1"},
+		{token.IDENT, "e"},
+		{token.INT, "5"},
+		{token.DOT, "."},
+		{token.IDENT, "x"},
+	}
+
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %q %q, got %q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading comment
+let x = 5; // trailing comment
+/* block
+   comment */ x / 2;
+/**/x`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %q %q, got %q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestEmitComments(t *testing.T) {
+	input := `// one
+x /* two */`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{token.COMMENT, "// one", 1, 1},
+		{token.IDENT, "x", 2, 1},
+		{token.COMMENT, "/* two */", 2, 3},
+		{token.EOF, "", 2, 12},
+	}
+
+	l := NewWithComments(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %q %q, got %q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestShebang(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"#!/usr/bin/env monkey\nputs(1)", token.IDENT, 2, 1},
+		{"#!/usr/bin/env monkey", token.EOF, 1, 22},
+		// only the first line may be a shebang
+		{"\n#!/usr/bin/env monkey", token.ILLEGAL, 2, 1},
+	}
+
+	for i, tt := range tests {
+		tok := New(tt.input).NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - wrong token type. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	l := New("1 /* never closed")
+
+	l.NextToken()
+	tok := l.NextToken()
+
+	if tok.Type != token.ILLEGAL {
+		t.Fatalf("expected ILLEGAL token. got=%q", tok.Type)
+	}
+
+	if tok.Literal != "/* never closed" {
+		t.Fatalf("wrong literal. got=%q", tok.Literal)
+	}
+
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Fatalf("expected EOF token. got=%q", tok.Type)
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	input := `a && b || !c & d | e`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.AND, "&&"},
+		{token.IDENT, "b"},
+		{token.OR, "||"},
+		{token.BANG, "!"},
+		{token.IDENT, "c"},
+		{token.ILLEGAL, "&"},
+		{token.IDENT, "d"},
+		{token.ILLEGAL, "|"},
+		{token.IDENT, "e"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %q %q, got %q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestModuloAndPower(t *testing.T) {
+	input := `10 % 3 ** 2 * 4`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "10"},
+		{token.PERCENT, "%"},
+		{token.INT, "3"},
+		{token.POWER, "**"},
+		{token.INT, "2"},
+		{token.ASTERISK, "*"},
+		{token.INT, "4"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %q %q, got %q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestCompoundAssignTokens(t *testing.T) {
+	input := `x += 1 -= 2 *= 3 /= 4 ** =`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "2"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "3"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "4"},
+		{token.POWER, "**"},
+		{token.ASSIGN, "="},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %q %q, got %q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestNullSafetyTokens(t *testing.T) {
+	input := `a ?? b?.c() ? d`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.NULLISH, "??"},
+		{token.IDENT, "b"},
+		{token.OPTIONAL_DOT, "?."},
+		{token.IDENT, "c"},
+		{token.LPAREN, "("},
+		{token.RPAREN, ")"},
+		{token.ILLEGAL, "?"},
+		{token.IDENT, "d"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %q %q, got %q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestDotTokens(t *testing.T) {
+	input := `fn(xs...) { f(1..., xs...) } 1.5.len() .. 0..10`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.IDENT, "xs"},
+		{token.ELLIPSIS, "..."},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.INT, "1"},
+		{token.ELLIPSIS, "..."},
+		{token.COMMA, ","},
+		{token.IDENT, "xs"},
+		{token.ELLIPSIS, "..."},
+		{token.RPAREN, ")"},
+		{token.RBRACE, "}"},
+		{token.FLOAT, "1.5"},
+		{token.DOT, "."},
+		{token.IDENT, "len"},
+		{token.LPAREN, "("},
+		{token.RPAREN, ")"},
+		{token.DOTDOT, ".."},
+		{token.INT, "0"},
+		{token.DOTDOT, ".."},
+		{token.INT, "10"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %q %q, got %q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestMatchTokens(t *testing.T) {
+	input := `match (x) { 1 => a, _ => b == c }`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.INT, "1"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.IDENT, "_"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "b"},
+		{token.EQ, "=="},
+		{token.IDENT, "c"},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %q %q, got %q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestIdentifiersAreInterned(t *testing.T) {
+	input := "let total = total + fn(total) { total };"
+	l := New(input)
+
+	var names []string
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Literal == "total" {
+			names = append(names, tok.Literal)
+		}
+	}
+
+	if len(names) != 4 {
+		t.Fatalf("wrong number of identifiers. got=%d", len(names))
+	}
+	for _, name := range names {
+		if unsafe.StringData(name) != unsafe.StringData(names[0]) {
+			t.Errorf("identifier %q was not interned", name)
+		}
+	}
+	if unsafe.StringData(names[0]) == unsafe.StringData(input[4:]) {
+		t.Errorf("identifier %q points into the source", names[0])
+	}
+}
+
+func BenchmarkLexer(b *testing.B) {
+	for _, program := range bench.Programs() {
+		b.Run(program.Name, func(b *testing.B) {
+			b.SetBytes(int64(len(program.Source)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				l := New(program.Source)
+				for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+				}
+			}
+		})
+	}
+}
+
+func FuzzLexer(f *testing.F) {
+	for _, program := range bench.Programs() {
+		f.Add(program.Source)
+	}
+	f.Add(`"unterminated ${x`)
+	f.Add("/* open")
+	f.Add("1.5e 0x 99999999999999999999")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		l := New(input)
+
+		// every token consumes input, so there can be no more tokens
+		// than bytes before EOF
+		for i := 0; i <= len(input); i++ {
+			if l.NextToken().Type == token.EOF {
+				return
+			}
+		}
+		t.Fatalf("no EOF after %d tokens for %q", len(input)+1, input)
+	})
+}
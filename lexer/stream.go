@@ -0,0 +1,62 @@
+package lexer
+
+import "monkey/token"
+
+// TokenStream reads the tokens of a Lexer with as much lookahead as a tool
+// needs, and can step back over the tokens it returned. Formatters,
+// highlighters and preprocessors can use it instead of keeping their own
+// buffer of tokens the way the parser does.
+//
+// Once the input runs out, the stream keeps returning the EOF token.
+type TokenStream struct {
+	l *Lexer
+
+	// the tokens read from l so far, up to the first EOF, and the number
+	// of calls to Next not undone by Backup
+	tokens []token.Token
+	pos    int
+}
+
+// NewTokenStream returns a stream of the tokens of l.
+func NewTokenStream(l *Lexer) *TokenStream {
+	return &TokenStream{l: l}
+}
+
+// Next returns the next token and moves past it.
+func (s *TokenStream) Next() token.Token {
+	tok := s.Peek(0)
+	s.pos++
+	return tok
+}
+
+// Peek returns the token n places after the next one without moving past
+// any: Peek(0) is the token Next returns, Peek(1) the one after it.
+func (s *TokenStream) Peek(n int) token.Token {
+	for len(s.tokens) <= s.pos+n {
+		if last := len(s.tokens) - 1; last >= 0 && s.tokens[last].Type == token.EOF {
+			return s.tokens[last]
+		}
+		s.tokens = append(s.tokens, s.l.NextToken())
+	}
+	return s.tokens[s.pos+n]
+}
+
+// Backup steps back over the last token Next returned, so that Next
+// returns it again. It can be called repeatedly to step back further, and
+// panics if the stream is at its start.
+func (s *TokenStream) Backup() {
+	if s.pos == 0 {
+		panic("lexer: Backup at the start of the token stream")
+	}
+	s.pos--
+}
+
+// All returns the remaining tokens, without the EOF token that ends them,
+// and moves past them.
+func (s *TokenStream) All() []token.Token {
+	var tokens []token.Token
+	for tok := s.Next(); tok.Type != token.EOF; tok = s.Next() {
+		tokens = append(tokens, tok)
+	}
+	return tokens
+}
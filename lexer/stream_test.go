@@ -0,0 +1,53 @@
+package lexer
+
+import (
+	"monkey/token"
+	"testing"
+)
+
+func TestTokenStream(t *testing.T) {
+	s := NewTokenStream(New("let x = 5;"))
+
+	expectType := func(tok token.Token, want token.TokenType) {
+		t.Helper()
+		if tok.Type != want {
+			t.Errorf("wrong token. want=%q, got=%q (%q)", want, tok.Type, tok.Literal)
+		}
+	}
+
+	expectType(s.Peek(0), token.LET)
+	expectType(s.Peek(3), token.INT)
+	expectType(s.Peek(10), token.EOF)
+
+	expectType(s.Next(), token.LET)
+	expectType(s.Next(), token.IDENT)
+	expectType(s.Peek(0), token.ASSIGN)
+
+	s.Backup()
+	s.Backup()
+	expectType(s.Next(), token.LET)
+
+	rest := s.All()
+	if len(rest) != 4 {
+		t.Fatalf("All returned %d tokens, want 4: %v", len(rest), rest)
+	}
+	expectType(rest[0], token.IDENT)
+	expectType(rest[3], token.SEMICOLON)
+
+	expectType(s.Next(), token.EOF)
+	expectType(s.Next(), token.EOF)
+	s.Backup()
+	expectType(s.Next(), token.EOF)
+	if s.All() != nil {
+		t.Errorf("All returned tokens at EOF")
+	}
+}
+
+func TestTokenStreamBackupAtStart(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Backup at the start did not panic")
+		}
+	}()
+	NewTokenStream(New("x")).Backup()
+}
@@ -0,0 +1,75 @@
+// Package module finds and parses the source files loaded by import
+// expressions. Evaluating them is left to the evaluator and the VM, which
+// each keep their own cache of loaded modules.
+package module
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/stdlib"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StdPrefix starts the paths of standard library modules, which are
+// bundled with the interpreter instead of being read from disk.
+const StdPrefix = "std/"
+
+// Resolve returns the absolute path of the module imported as path by
+// code in dir. Relative paths are resolved against dir, or against the
+// working directory if dir is empty. Standard library paths are kept as
+// they are. The result is suitable as a cache key.
+func Resolve(dir, path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("empty module path")
+	}
+
+	if IsStd(path) {
+		return path, nil
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	return filepath.Abs(path)
+}
+
+// IsStd reports whether the resolved path names a standard library
+// module. Only those can be imported without access to the file system.
+func IsStd(path string) bool {
+	return strings.HasPrefix(path, StdPrefix)
+}
+
+// Load reads and parses the module at the resolved path. Only the first
+// parse error is reported, prefixed with the file name and position.
+func Load(path string) (*ast.Program, error) {
+	src, err := readSource(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		return nil, fmt.Errorf("%s:%d:%d: %s",
+			path, errs[0].Line, errs[0].Column, errs[0].Message)
+	}
+
+	return program, nil
+}
+
+func readSource(path string) (string, error) {
+	if name, ok := strings.CutPrefix(path, StdPrefix); ok {
+		src, ok := stdlib.Source(name)
+		if !ok {
+			return "", fmt.Errorf("no standard library module %q", name)
+		}
+		return src, nil
+	}
+
+	data, err := os.ReadFile(path)
+	return string(data), err
+}
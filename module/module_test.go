@@ -0,0 +1,78 @@
+package module
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dir      string
+		path     string
+		expected string
+	}{
+		{"/src", "lib/math.monkey", "/src/lib/math.monkey"},
+		{"/src/app", "../lib/./math.monkey", "/src/lib/math.monkey"},
+		{"/src", "/other/math.monkey", "/other/math.monkey"},
+		{"", "math.monkey", filepath.Join(wd, "math.monkey")},
+		{"/src", "std/array", "std/array"},
+	}
+
+	for _, tt := range tests {
+		resolved, err := Resolve(tt.dir, tt.path)
+		if err != nil {
+			t.Fatalf("Resolve(%q, %q) failed: %s", tt.dir, tt.path, err)
+		}
+		if resolved != tt.expected {
+			t.Errorf("Resolve(%q, %q) wrong. want=%q, got=%q",
+				tt.dir, tt.path, tt.expected, resolved)
+		}
+	}
+
+	if _, err := Resolve("/src", ""); err == nil {
+		t.Errorf("expected error for empty path")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.monkey")
+	bad := filepath.Join(dir, "bad.monkey")
+	os.WriteFile(good, []byte("let x = 1;\nlet y = x;"), 0644)
+	os.WriteFile(bad, []byte("let x = 1;\nlet 5;"), 0644)
+
+	program, err := Load(good)
+	if err != nil {
+		t.Fatalf("Load failed: %s", err)
+	}
+	if len(program.Statements) != 2 {
+		t.Errorf("program has wrong number of statements. got=%d", len(program.Statements))
+	}
+
+	_, err = Load(bad)
+	expected := bad + ":2:5: expected next token to be 'IDENT', got 'INT' instead"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%v", expected, err)
+	}
+
+	if _, err := Load("std/array"); err != nil {
+		t.Errorf("Load(%q) failed: %s", "std/array", err)
+	}
+
+	_, err = Load("std/nope")
+	if err == nil || err.Error() != `no standard library module "nope"` {
+		t.Errorf("wrong error for missing std module. got=%v", err)
+	}
+
+	_, err = Load(filepath.Join(dir, "missing.monkey"))
+	if err == nil || !strings.Contains(err.Error(), "missing.monkey") {
+		t.Errorf("expected error for missing file. got=%v", err)
+	}
+}
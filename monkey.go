@@ -0,0 +1,378 @@
+// Package monkey embeds the Monkey interpreter in Go programs. A Script
+// compiles source code, receives values from the host with SetGlobal and
+// hands results back as plain Go values:
+//
+//	script := monkey.New()
+//	script.SetGlobal("x", 5)
+//	if err := script.Compile("x * 2"); err != nil {
+//		return err
+//	}
+//	result, err := script.Run(ctx) // int64(10)
+package monkey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+	"time"
+)
+
+// Engines a Script can run on.
+const (
+	EngineEval = "eval" // tree-walking evaluator
+	EngineVM   = "vm"   // bytecode compiler and virtual machine
+)
+
+// Script is a Monkey program together with its global variables. Globals
+// persist across calls to Compile and Run, so a script can be fed more
+// code after it has run.
+type Script struct {
+	engine string
+
+	maxCallDepth int
+	stackSize    int
+	bigIntegers  bool
+	strictBool   bool
+	strictIndex  bool
+
+	stdout io.Writer
+	stderr io.Writer
+	stdin  io.Reader
+
+	options Options
+	args    []string
+
+	// rng is the generator of builtins like random, kept across runs
+	rng *rand.Rand
+
+	program *ast.Program
+
+	// state of the evaluator
+	env *object.Environment
+
+	// state of the compiler and VM
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+	bytecode    *compiler.Bytecode
+}
+
+// New creates an empty script that runs on the evaluator.
+func New() *Script {
+	return NewWithEngine(EngineEval)
+}
+
+// NewWithEngine creates an empty script that runs on the given engine,
+// EngineEval or EngineVM. It panics on an unknown engine.
+func NewWithEngine(engine string) *Script {
+	if engine != EngineEval && engine != EngineVM {
+		panic(fmt.Sprintf("monkey: unknown engine %q", engine))
+	}
+
+	return &Script{
+		engine:      engine,
+		env:         object.NewEnvironment(),
+		symbolTable: compiler.NewSymbolTable(),
+		constants:   []object.Object{},
+		globals:     make([]object.Object, vm.GlobalsSize),
+		rng:         rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// SetDir sets the directory relative imports are resolved against. It
+// defaults to the working directory.
+func (s *Script) SetDir(dir string) {
+	s.env.SetDir(dir)
+}
+
+// Compile parses src and, for the VM, compiles it to bytecode, replacing
+// any previously compiled code. Parse errors are returned joined, each
+// one a parser.ParseError.
+func (s *Script) Compile(src string) error {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		errs := []error{}
+		for _, err := range p.Errors() {
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+	}
+
+	if s.engine == EngineVM {
+		comp := compiler.NewWithState(s.symbolTable, s.constants)
+		if err := comp.Compile(program); err != nil {
+			return err
+		}
+		s.bytecode = comp.Bytecode()
+		s.constants = s.bytecode.Constants
+	}
+
+	s.program = program
+	return nil
+}
+
+// Run executes the compiled code and returns the value of its last
+// statement converted with ToGo, or nil if the last statement is not an
+// expression. Failures at run time are reported as *RuntimeError, and
+// running stops with ctx's error once ctx is done.
+func (s *Script) Run(ctx context.Context) (interface{}, error) {
+	if s.program == nil {
+		return nil, errors.New("monkey: Run called before Compile")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var result object.Object
+
+	if s.engine == EngineVM {
+		opts := []vm.Option{}
+		if s.maxCallDepth != 0 {
+			// one more frame for the main program
+			opts = append(opts, vm.WithMaxFrames(s.maxCallDepth+1))
+		}
+		if s.stackSize != 0 {
+			opts = append(opts, vm.WithStackSize(s.stackSize))
+		}
+		machine := vm.NewWithGlobalsStore(s.bytecode, s.globals, opts...)
+		machine.SetDir(s.env.Dir())
+		machine.SetBigIntegers(s.bigIntegers)
+		machine.SetStrictBool(s.strictBool)
+		machine.SetStrictIndexing(s.strictIndex)
+		if s.stdout != nil {
+			machine.SetStdout(s.stdout)
+		}
+		if s.stderr != nil {
+			machine.SetStderr(s.stderr)
+		}
+		if s.stdin != nil {
+			machine.SetStdin(s.stdin)
+		}
+		machine.SetAllowFS(s.options.AllowFS)
+		machine.SetAllowNet(s.options.AllowNet)
+		machine.SetAllowEnv(s.options.AllowEnv)
+		machine.SetAllowExec(s.options.AllowExec)
+		machine.SetAllowExit(s.options.AllowExit)
+		machine.SetMaxSteps(s.options.MaxSteps)
+		machine.SetMaxMemObjects(s.options.MaxMemObjects)
+		machine.SetArgs(s.args)
+		machine.SetRand(s.rng)
+		err := machine.RunContext(ctx)
+		s.constants = machine.Constants()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if exit, ok := err.(*object.ExitError); ok {
+			return nil, &ExitError{Code: exit.Code}
+		}
+		if err != nil {
+			return nil, &RuntimeError{Message: err.Error(), err: err}
+		}
+		result = machine.LastPoppedStackElem()
+	} else {
+		config := evaluator.Config{
+			MaxCallDepth:   s.maxCallDepth,
+			BigIntegers:    s.bigIntegers,
+			StrictBool:     s.strictBool,
+			StrictIndexing: s.strictIndex,
+			Stdout:         s.stdout,
+			Stderr:         s.stderr,
+			Stdin:          s.stdin,
+			AllowFS:        s.options.AllowFS,
+			AllowNet:       s.options.AllowNet,
+			AllowEnv:       s.options.AllowEnv,
+			AllowExec:      s.options.AllowExec,
+			AllowExit:      s.options.AllowExit,
+			MaxSteps:       s.options.MaxSteps,
+			MaxMemObjects:  s.options.MaxMemObjects,
+			Args:           s.args,
+			Rand:           s.rng,
+		}
+		result = evaluator.EvalWithConfig(ctx, s.program, s.env, config)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if errObj, ok := result.(*object.Error); ok {
+			if errObj.Exit != nil {
+				return nil, &ExitError{Code: errObj.Exit.Code}
+			}
+			return nil, &RuntimeError{
+				Message: errObj.Message,
+				Line:    errObj.Line,
+				Column:  errObj.Column,
+			}
+		}
+	}
+
+	if !endsWithExpression(s.program) {
+		return nil, nil
+	}
+	return ToGo(result)
+}
+
+// SetMaxCallDepth limits how deeply function calls may nest before the
+// script fails with a "stack overflow" runtime error. It defaults to
+// evaluator.DefaultMaxCallDepth on the evaluator and vm.MaxFrames on the
+// VM.
+func (s *Script) SetMaxCallDepth(n int) {
+	s.maxCallDepth = n
+}
+
+// SetRandomSeed seeds the generator behind random, so that the script
+// draws the same numbers every time it runs from the same seed. Scripts
+// are seeded from the clock by default.
+func (s *Script) SetRandomSeed(seed int64) {
+	s.rng = rand.New(rand.NewSource(seed))
+}
+
+// SetStackSize sets the size of the VM's value stack, which bounds how
+// many arguments and locals all active calls can hold together. It
+// defaults to vm.StackSize and has no effect on the evaluator.
+func (s *Script) SetStackSize(n int) {
+	s.stackSize = n
+}
+
+// SetBigIntegers makes integer arithmetic that overflows int64 produce
+// big integers, which Run returns as *big.Int, instead of wrapping
+// around.
+func (s *Script) SetBigIntegers(enabled bool) {
+	s.bigIntegers = enabled
+}
+
+// SetStrictBool makes the conditions of if and the operands of !, && and
+// || fail with a runtime error unless they are booleans, instead of
+// counting every value but false and null as true. It catches conditions
+// like `if (len(xs))` that were meant to compare.
+func (s *Script) SetStrictBool(enabled bool) {
+	s.strictBool = enabled
+}
+
+// SetStrictIndexing makes out-of-bounds array indexing fail with a runtime
+// error instead of giving null.
+func (s *Script) SetStrictIndexing(enabled bool) {
+	s.strictIndex = enabled
+}
+
+// SetStdout, SetStderr and SetStdin set the streams of builtins like
+// puts, eputs and readLine, so that hosts can capture or provide them.
+// They default to os.Stdout, os.Stderr and os.Stdin.
+func (s *Script) SetStdout(w io.Writer) { s.stdout = w }
+func (s *Script) SetStderr(w io.Writer) { s.stderr = w }
+func (s *Script) SetStdin(r io.Reader)  { s.stdin = r }
+
+// SetAllowFS, SetAllowEnv, SetAllowExec and SetAllowExit change a single
+// capability of the script's Options. Scripts have none by default.
+func (s *Script) SetAllowFS(allowed bool)   { s.options.AllowFS = allowed }
+func (s *Script) SetAllowEnv(allowed bool)  { s.options.AllowEnv = allowed }
+func (s *Script) SetAllowExec(allowed bool) { s.options.AllowExec = allowed }
+func (s *Script) SetAllowExit(allowed bool) { s.options.AllowExit = allowed }
+
+// SetArgs sets the command-line arguments the script gets from args.
+func (s *Script) SetArgs(args []string) {
+	s.args = args
+}
+
+// SetGlobal binds name to value, converted with ToObject, in the
+// script's global scope. On the VM, globals that the compiled code does
+// not know about must be set before Compile.
+func (s *Script) SetGlobal(name string, value interface{}) error {
+	obj, err := ToObject(value)
+	if err != nil {
+		return err
+	}
+
+	if s.engine == EngineEval {
+		s.env.Set(name, obj)
+		return nil
+	}
+
+	symbol, ok := s.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		if s.bytecode != nil {
+			return fmt.Errorf("monkey: cannot add global %q after Compile", name)
+		}
+		symbol = s.symbolTable.Define(name)
+	}
+	s.globals[symbol.Index] = obj
+	return nil
+}
+
+// Global returns the value of a global variable converted with ToGo. It
+// reports false if the variable is not defined, or if its value cannot be
+// converted because it contains itself.
+func (s *Script) Global(name string) (interface{}, bool) {
+	if s.engine == EngineEval {
+		obj, ok := s.env.Get(name)
+		if !ok {
+			return nil, false
+		}
+		return global(obj)
+	}
+
+	symbol, ok := s.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope || s.globals[symbol.Index] == nil {
+		return nil, false
+	}
+	return global(s.globals[symbol.Index])
+}
+
+func global(obj object.Object) (interface{}, bool) {
+	val, err := ToGo(obj)
+	return val, err == nil
+}
+
+// RuntimeError is an error raised while running a script. Line and
+// Column are zero when the position is unknown, which is always the case
+// on the VM. Errors from the VM unwrap to the VM's own error values, so
+// errors.Is(err, vm.ErrStackOverflow) works on them.
+type RuntimeError struct {
+	Message string
+	Line    int
+	Column  int
+
+	// err is the error of the VM, if it failed with one of its own like
+	// vm.ErrStackOverflow
+	err error
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s at line %d, column %d", e.Message, e.Line, e.Column)
+}
+
+// Unwrap returns the error a script failed with on the VM, so that
+// errors.Is can tell failures like vm.ErrStackOverflow apart.
+func (e *RuntimeError) Unwrap() error {
+	return e.err
+}
+
+// ExitError is returned by Run when the script stops by calling exit.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func endsWithExpression(program *ast.Program) bool {
+	if len(program.Statements) == 0 {
+		return false
+	}
+
+	last := program.Statements[len(program.Statements)-1]
+	_, ok := last.(*ast.ExpressionStatement)
+	return ok
+}
@@ -0,0 +1,574 @@
+package monkey
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var engines = []string{EngineEval, EngineVM}
+
+func TestScriptRun(t *testing.T) {
+	tests := []struct {
+		input    string
+		globals  map[string]interface{}
+		expected interface{}
+	}{
+		{"1 + 2", nil, int64(3)},
+		{"x * 2", map[string]interface{}{"x": 5}, int64(10)},
+		{`name + "!"`, map[string]interface{}{"name": "hi"}, "hi!"},
+		{"if (flag) { 1.5 } else { 2 }", map[string]interface{}{"flag": true}, 1.5},
+		{"if (nothing) { 1 } else { 2 }", map[string]interface{}{"nothing": nil}, int64(2)},
+		{"[xs[1], xs[0]]", map[string]interface{}{"xs": []int{1, 2}}, []interface{}{int64(2), int64(1)}},
+		{`h["a"]`, map[string]interface{}{"h": map[string]int{"a": 7}}, int64(7)},
+		{`{"k": [true]}`, nil, map[interface{}]interface{}{"k": []interface{}{true}}},
+		{"let x = 1;", nil, nil},
+		{"len(s) + first(xs)", map[string]interface{}{"s": "ab", "xs": []int{5}}, int64(7)},
+		{"len + 1", map[string]interface{}{"len": 2}, int64(3)},
+	}
+
+	for _, engine := range engines {
+		for _, tt := range tests {
+			script := NewWithEngine(engine)
+			for name, value := range tt.globals {
+				if err := script.SetGlobal(name, value); err != nil {
+					t.Fatalf("[%s] SetGlobal(%q) failed: %s", engine, name, err)
+				}
+			}
+
+			if err := script.Compile(tt.input); err != nil {
+				t.Fatalf("[%s] Compile(%q) failed: %s", engine, tt.input, err)
+			}
+
+			result, err := script.Run(context.Background())
+			if err != nil {
+				t.Fatalf("[%s] Run(%q) failed: %s", engine, tt.input, err)
+			}
+
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("[%s] wrong result for %q. want=%#v, got=%#v",
+					engine, tt.input, tt.expected, result)
+			}
+		}
+	}
+}
+
+func TestScriptGlobalsPersist(t *testing.T) {
+	for _, engine := range engines {
+		script := NewWithEngine(engine)
+		script.SetGlobal("n", 1)
+
+		for _, src := range []string{"let total = n + 1;", "total = total * 10;"} {
+			if err := script.Compile(src); err != nil {
+				t.Fatalf("[%s] Compile(%q) failed: %s", engine, src, err)
+			}
+			if _, err := script.Run(context.Background()); err != nil {
+				t.Fatalf("[%s] Run(%q) failed: %s", engine, src, err)
+			}
+		}
+
+		total, ok := script.Global("total")
+		if !ok || total != int64(20) {
+			t.Errorf("[%s] wrong total. got=%v (%t)", engine, total, ok)
+		}
+
+		if _, ok := script.Global("missing"); ok {
+			t.Errorf("[%s] missing global should not be found", engine)
+		}
+	}
+}
+
+func TestScriptErrors(t *testing.T) {
+	for _, engine := range engines {
+		script := NewWithEngine(engine)
+
+		err := script.Compile("let = 1;")
+		var parseErr parser.ParseError
+		if !errors.As(err, &parseErr) {
+			t.Fatalf("[%s] expected a ParseError. got=%v", engine, err)
+		}
+
+		if _, err := script.Run(context.Background()); err == nil {
+			t.Errorf("[%s] Run before a successful Compile should fail", engine)
+		}
+
+		script.Compile("1 + true")
+		_, err = script.Run(context.Background())
+		var runtimeErr *RuntimeError
+		if !errors.As(err, &runtimeErr) {
+			t.Fatalf("[%s] expected a RuntimeError. got=%v", engine, err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := script.Run(ctx); err != context.Canceled {
+			t.Errorf("[%s] expected context.Canceled. got=%v", engine, err)
+		}
+	}
+
+	vmScript := NewWithEngine(EngineVM)
+	vmScript.Compile("1")
+	if err := vmScript.SetGlobal("late", 1); err == nil {
+		t.Errorf("adding a VM global after Compile should fail")
+	}
+}
+
+func TestScriptCyclicResult(t *testing.T) {
+	for _, engine := range engines {
+		for _, src := range []string{
+			"let a = [1]; a[0] = a; a",
+			`let h = {}; h["self"] = h; h`,
+			`let h = {}; let a = [h]; h["a"] = a; [a]`,
+		} {
+			script := NewWithEngine(engine)
+			if err := script.Compile(src); err != nil {
+				t.Fatalf("[%s] Compile(%q) failed: %s", engine, src, err)
+			}
+			result, err := script.Run(context.Background())
+			if err == nil || err.Error() != "monkey: cannot convert a value that contains itself" {
+				t.Errorf("[%s] %q: expected cyclic value error. got=%v, %v", engine, src, result, err)
+			}
+			if _, ok := script.Global("a"); ok && strings.HasPrefix(src, "let a") {
+				t.Errorf("[%s] %q: cyclic global should not convert", engine, src)
+			}
+		}
+
+		// a value may appear twice without containing itself
+		script := NewWithEngine(engine)
+		script.Compile("let a = [1]; [a, a]")
+		result, err := script.Run(context.Background())
+		want := []interface{}{[]interface{}{int64(1)}, []interface{}{int64(1)}}
+		if err != nil || !reflect.DeepEqual(result, want) {
+			t.Errorf("[%s] shared value: got %v, %v", engine, result, err)
+		}
+	}
+}
+
+func TestScriptDeadline(t *testing.T) {
+	xs := make([]int, 1000)
+
+	for _, engine := range engines {
+		script := NewWithEngine(engine)
+		script.SetGlobal("xs", xs)
+		script.Compile("let n = 0; for (a in xs) { for (b in xs) { n = n + 1 } }; n")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err := script.Run(ctx)
+		cancel()
+
+		if err != context.DeadlineExceeded {
+			t.Errorf("[%s] expected context.DeadlineExceeded. got=%v", engine, err)
+		}
+	}
+}
+
+func TestScriptMaxCallDepth(t *testing.T) {
+	for _, engine := range engines {
+		script := NewWithEngine(engine)
+		script.SetMaxCallDepth(20)
+		script.Compile("let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } };")
+		script.Run(context.Background())
+
+		script.Compile("f(19)")
+		if _, err := script.Run(context.Background()); err != nil {
+			t.Errorf("[%s] f(19) failed: %s", engine, err)
+		}
+
+		script.Compile("f(20)")
+		_, err := script.Run(context.Background())
+		if err == nil || !strings.HasPrefix(err.Error(), "stack overflow") {
+			t.Errorf("[%s] expected stack overflow. got=%v", engine, err)
+		}
+		if engine == EngineVM && !errors.Is(err, vm.ErrStackOverflow) {
+			t.Errorf("[%s] expected vm.ErrStackOverflow. got=%v", engine, err)
+		}
+	}
+}
+
+func TestScriptForInScope(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 100; for (x in [1, 2]) {}; x", int64(100)},
+		{"let y = 1; for (x in [1, 2]) { let y = 5 }; y", int64(1)},
+		{"let y = 1; for (x in [1, 2]) { y = x }; y", int64(2)},
+		{`let fs = []; for (x in [10, 20, 30]) { let y = x; fs = push(fs, fn() { y }) }; fs[0]()`, int64(10)},
+		{`let fs = []; for (i, x in [10, 20, 30]) { fs = push(fs, fn() { i }) }; fs[0]()`, int64(0)},
+		{`let fs = []; for (x in 1..4) { let f = fn(n) { if (n == 0) { x } else { f(n - 1) } }; fs = push(fs, f) }; fs[1](3)`, int64(2)},
+		{"let f = fn() { let s = 0; for (x in [1, 2]) { let s = 10 }; s }; f()", int64(0)},
+		{"let f = fn() { let fs = []; for (x in [1, 2]) { fs = push(fs, fn() { x }) }; fs[0]() }; f()", int64(1)},
+		{"for (a in [1]) { for (b in [2]) { let c = a + b } }; let c = 0; c", int64(0)},
+	}
+
+	for _, tt := range tests {
+		for _, engine := range engines {
+			script := NewWithEngine(engine)
+			if err := script.Compile(tt.input); err != nil {
+				t.Fatalf("[%s] Compile(%q) failed: %s", engine, tt.input, err)
+			}
+			result, err := script.Run(context.Background())
+			if err != nil || result != tt.expected {
+				t.Errorf("[%s] %q: want %v, got %v, %v", engine, tt.input, tt.expected, result, err)
+			}
+		}
+	}
+
+	// loop variables are gone once the loop is done
+	for _, engine := range engines {
+		script := NewWithEngine(engine)
+		script.Compile("for (x in [1]) {}; x")
+		if _, err := script.Run(context.Background()); err == nil {
+			t.Errorf("[%s] expected x to be undefined after the loop", engine)
+		}
+	}
+}
+
+func TestScriptFunctionType(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the result, or the start of the error message
+	}{
+		{"type(fn() {})", "FUNCTION"},
+		{"let f = fn(x) { fn() { x } }; type(f(1))", "FUNCTION"},
+		{"type(len)", "BUILTIN"},
+		{"jsonEncode([fn() {}])", "cannot encode FUNCTION as JSON"},
+	}
+
+	for _, tt := range tests {
+		for _, engine := range engines {
+			script := NewWithEngine(engine)
+			if err := script.Compile(tt.input); err != nil {
+				t.Fatalf("[%s] Compile(%q) failed: %s", engine, tt.input, err)
+			}
+			result, err := script.Run(context.Background())
+			got := fmt.Sprint(result)
+			if err != nil {
+				got = err.Error()
+			}
+			if !strings.HasPrefix(got, tt.expected) {
+				t.Errorf("[%s] %q: want %q, got %q", engine, tt.input, tt.expected, got)
+			}
+		}
+	}
+}
+
+func TestScriptStrictBool(t *testing.T) {
+	for _, engine := range engines {
+		script := NewWithEngine(engine)
+		script.SetStrictBool(true)
+
+		script.Compile("if (1 < 2) { 1 } else { 2 }")
+		if result, err := script.Run(context.Background()); err != nil || result != int64(1) {
+			t.Errorf("[%s] boolean condition: got %v, %v", engine, result, err)
+		}
+
+		script.Compile("if (1) { 1 }")
+		_, err := script.Run(context.Background())
+		if err == nil || !strings.HasPrefix(err.Error(), "non-boolean condition: INTEGER") {
+			t.Errorf("[%s] expected non-boolean condition error. got=%v", engine, err)
+		}
+	}
+}
+
+func TestScriptStrictIndexing(t *testing.T) {
+	for _, engine := range engines {
+		script := NewWithEngine(engine)
+		script.Compile("[1, 2, 3][3]")
+		if result, err := script.Run(context.Background()); err != nil || result != nil {
+			t.Errorf("[%s] lenient indexing: got %v, %v", engine, result, err)
+		}
+
+		script.SetStrictIndexing(true)
+		script.Compile("[1, 2, 3][2]")
+		if result, err := script.Run(context.Background()); err != nil || result != int64(3) {
+			t.Errorf("[%s] index in range: got %v, %v", engine, result, err)
+		}
+
+		script.Compile("[1, 2, 3][3]")
+		_, err := script.Run(context.Background())
+		if err == nil || !strings.HasPrefix(err.Error(), "index out of range: 3 (length 3)") {
+			t.Errorf("[%s] expected index out of range error. got=%v", engine, err)
+		}
+	}
+}
+
+func TestScriptStreams(t *testing.T) {
+	// echo copies a line of input to both output streams
+	echo := &object.Builtin{
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			line := make([]byte, 3)
+			n, _ := rt.Stdin().Read(line)
+			rt.Stdout().Write(line[:n])
+			rt.Stderr().Write(line[:n])
+			return object.NULL
+		},
+	}
+
+	for _, engine := range engines {
+		var stdout, stderr bytes.Buffer
+		script := NewWithEngine(engine)
+		script.SetStdout(&stdout)
+		script.SetStderr(&stderr)
+		script.SetStdin(strings.NewReader("abcdef"))
+		script.SetGlobal("echo", echo)
+
+		script.Compile("echo(); echo();")
+		if _, err := script.Run(context.Background()); err != nil {
+			t.Fatalf("[%s] Run failed: %s", engine, err)
+		}
+
+		if stdout.String() != "abcdef" || stderr.String() != "abcdef" {
+			t.Errorf("[%s] wrong output. stdout=%q, stderr=%q",
+				engine, stdout.String(), stderr.String())
+		}
+	}
+}
+
+func TestScriptRandomSeed(t *testing.T) {
+	// roll draws from the generator builtins like random use
+	roll := &object.Builtin{
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			return &object.Integer{Value: rt.Rand().Int63n(1000000)}
+		},
+	}
+
+	for _, engine := range engines {
+		draw := func() []interface{} {
+			script := NewWithEngine(engine)
+			script.SetRandomSeed(42)
+			script.SetGlobal("roll", roll)
+
+			// the sequence carries on from one run to the next
+			results := []interface{}{}
+			for i := 0; i < 2; i++ {
+				script.Compile("[roll(), roll()]")
+				result, err := script.Run(context.Background())
+				if err != nil {
+					t.Fatalf("[%s] Run failed: %s", engine, err)
+				}
+				results = append(results, result.([]interface{})...)
+			}
+			return results
+		}
+
+		first, second := draw(), draw()
+		if !reflect.DeepEqual(first, second) {
+			t.Errorf("[%s] same seed gave different numbers: %v and %v", engine, first, second)
+		}
+		if reflect.DeepEqual(first[:2], first[2:]) {
+			t.Errorf("[%s] second run repeated the first: %v", engine, first)
+		}
+	}
+}
+
+func TestScriptOptions(t *testing.T) {
+	// fetch stands in for a network builtin a host registers
+	fetch := &object.Builtin{
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			if !rt.AllowNet() {
+				return &object.Error{Message: "`fetch` is not allowed: network access is disabled"}
+			}
+			return &object.String{Value: "fetched"}
+		},
+	}
+
+	for _, engine := range engines {
+		script := NewWithOptions(engine, Options{})
+		script.SetGlobal("fetch", fetch)
+
+		script.Compile("fetch()")
+		_, err := script.Run(context.Background())
+		var runtimeErr *RuntimeError
+		if !errors.As(err, &runtimeErr) ||
+			runtimeErr.Message != "`fetch` is not allowed: network access is disabled" {
+			t.Errorf("[%s] fetch should be denied. got=%v", engine, err)
+		}
+
+		script.SetOptions(Options{AllowNet: true})
+		result, err := script.Run(context.Background())
+		if err != nil || result != "fetched" {
+			t.Errorf("[%s] fetch should be allowed. got=%v, %v", engine, result, err)
+		}
+	}
+
+	// the zero Options deny every capability of the builtins
+	denied := map[string]string{
+		`readFile("x")`: "`readFile` is not allowed: file system access is disabled",
+		`env("HOME")`:   "`env` is not allowed: environment access is disabled",
+		`exec("true")`:  "`exec` is not allowed: running commands is disabled",
+		`exit(0)`:       "`exit` is not allowed: exiting is disabled",
+	}
+	for input, expected := range denied {
+		script := NewWithOptions(EngineEval, Options{})
+		script.Compile(input)
+		_, err := script.Run(context.Background())
+
+		var runtimeErr *RuntimeError
+		if !errors.As(err, &runtimeErr) || runtimeErr.Message != expected {
+			t.Errorf("%s: want %q, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestScriptImportSandbox(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.monkey")
+	if err := os.WriteFile(lib, []byte("let answer = 42;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	imports := map[string]string{
+		`import("` + lib + `")["answer"]`: lib,
+		`import("lib.monkey")["answer"]`:  "lib.monkey",
+	}
+
+	for _, engine := range engines {
+		for input, path := range imports {
+			script := NewWithOptions(engine, Options{})
+			script.SetDir(dir)
+			script.Compile(input)
+			_, err := script.Run(context.Background())
+
+			expected := `cannot import "` + path + `": file system access is disabled`
+			var runtimeErr *RuntimeError
+			if !errors.As(err, &runtimeErr) || runtimeErr.Message != expected {
+				t.Errorf("[%s] %s: want %q, got %v", engine, input, expected, err)
+			}
+
+			script.SetOptions(Options{AllowFS: true})
+			result, err := script.Run(context.Background())
+			if err != nil || result != int64(42) {
+				t.Errorf("[%s] %s: import should be allowed. got=%v, %v", engine, input, result, err)
+			}
+		}
+
+		// the standard library is not read from disk
+		script := NewWithOptions(engine, Options{})
+		script.Compile(`import("std/math")["abs"](-3)`)
+		if result, err := script.Run(context.Background()); err != nil || result != int64(3) {
+			t.Errorf("[%s] std import should be allowed. got=%v, %v", engine, result, err)
+		}
+	}
+}
+
+func TestScriptMaxSteps(t *testing.T) {
+	for _, engine := range engines {
+		script := NewWithOptions(engine, Options{MaxSteps: 200})
+
+		// each run gets the whole budget
+		for i := 0; i < 3; i++ {
+			script.Compile("let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(10)")
+			if _, err := script.Run(context.Background()); err != nil {
+				t.Fatalf("[%s] run %d failed: %s", engine, i, err)
+			}
+		}
+
+		script.Compile("f(1000)")
+		_, err := script.Run(context.Background())
+		var runtimeErr *RuntimeError
+		if !errors.As(err, &runtimeErr) || runtimeErr.Message != "execution budget exceeded" {
+			t.Errorf("[%s] expected execution budget exceeded. got=%v", engine, err)
+		}
+	}
+}
+
+func TestScriptMaxMemObjects(t *testing.T) {
+	for _, engine := range engines {
+		script := NewWithOptions(engine, Options{MaxMemObjects: 1000})
+
+		script.Compile("let build = fn(a, n) { if (n == 0) { a } else { build(push(a, n), n - 1) } }; build([], 10)")
+		if _, err := script.Run(context.Background()); err != nil {
+			t.Fatalf("[%s] small build failed: %s", engine, err)
+		}
+
+		script.Compile("build([], 500)")
+		_, err := script.Run(context.Background())
+		var runtimeErr *RuntimeError
+		if !errors.As(err, &runtimeErr) || runtimeErr.Message != "memory limit exceeded" {
+			t.Errorf("[%s] expected memory limit exceeded. got=%v", engine, err)
+		}
+	}
+}
+
+func TestScriptExit(t *testing.T) {
+	// stop ends the script like exit(7) does
+	stop := &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			exit := &object.ExitError{Code: 7}
+			return &object.Error{Message: exit.Error(), Exit: exit}
+		},
+	}
+
+	for _, engine := range engines {
+		script := NewWithEngine(engine)
+		script.SetGlobal("stop", stop)
+
+		script.Compile(`try { stop() } catch (e) { "caught" }`)
+		_, err := script.Run(context.Background())
+
+		var exit *ExitError
+		if !errors.As(err, &exit) || exit.Code != 7 {
+			t.Errorf("[%s] expected exit status 7. got=%v", engine, err)
+		}
+	}
+
+	script := New()
+	script.Compile("exit(1)")
+	_, err := script.Run(context.Background())
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Errorf("exit should not be allowed by default. got=%v", err)
+	}
+
+	script.SetAllowExit(true)
+	script.SetArgs([]string{"x"})
+	script.Compile("exit(len(args()) + 1)")
+	_, err = script.Run(context.Background())
+	if err == nil || err.Error() != "exit status 2" {
+		t.Errorf("expected exit status 2. got=%v", err)
+	}
+}
+
+func TestToObject(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{true, "true"},
+		{int8(-3), "-3"},
+		{uint16(3), "3"},
+		{float32(0.5), "0.5"},
+		{"s", "s"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{map[int]bool{1: false}, "{1: false}"},
+		{&object.Integer{Value: 4}, "4"},
+	}
+
+	for _, tt := range tests {
+		obj, err := ToObject(tt.value)
+		if err != nil {
+			t.Fatalf("ToObject(%#v) failed: %s", tt.value, err)
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("ToObject(%#v) wrong. want=%q, got=%q", tt.value, tt.expected, obj.Inspect())
+		}
+	}
+
+	for _, value := range []interface{}{uint64(1 << 63), struct{}{}, []interface{}{make(chan int)}} {
+		if _, err := ToObject(value); err == nil {
+			t.Errorf("ToObject(%#v) should fail", value)
+		}
+	}
+}
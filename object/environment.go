@@ -0,0 +1,131 @@
+package object
+
+import "sync"
+
+// Environment holds the bindings of a scope. It is safe for concurrent
+// use, since tasks started by spawn share the scopes they close over.
+type Environment struct {
+	mu     sync.RWMutex
+	store  map[string]Object
+	consts map[string]bool
+	outer  *Environment
+
+	dir string
+}
+
+func NewEnvironment() *Environment {
+	s := make(map[string]Object)
+	c := make(map[string]bool)
+	return &Environment{store: s, consts: c}
+}
+
+// NewEnclosedEnvironment creates an environment whose lookups fall back
+// to outer for names that are not bound locally.
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+// Dir returns the directory relative imports are resolved against: the
+// directory of the file the environment belongs to, or of the nearest
+// enclosing one. It is empty for code that wasn't loaded from a file.
+func (e *Environment) Dir() string {
+	if e.dir == "" && e.outer != nil {
+		return e.outer.Dir()
+	}
+	return e.dir
+}
+
+func (e *Environment) SetDir(dir string) {
+	e.dir = dir
+}
+
+// Bindings returns the names bound in this scope itself, ignoring
+// enclosing scopes.
+func (e *Environment) Bindings() map[string]Object {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	bindings := make(map[string]Object, len(e.store))
+	for name, val := range e.store {
+		bindings[name] = val
+	}
+	return bindings
+}
+
+func (e *Environment) Get(name string) (Object, bool) {
+	e.mu.RLock()
+	obj, ok := e.store[name]
+	e.mu.RUnlock()
+
+	if !ok && e.outer != nil {
+		obj, ok = e.outer.Get(name)
+	}
+	return obj, ok
+}
+
+func (e *Environment) Set(name string, val Object) Object {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.store[name] = val
+	delete(e.consts, name)
+	return val
+}
+
+// SetConst binds name like Set, but marks the binding as constant.
+func (e *Environment) SetConst(name string, val Object) Object {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.store[name] = val
+	e.consts[name] = true
+	return val
+}
+
+// IsConst reports whether the nearest binding of name is a constant.
+func (e *Environment) IsConst(name string) bool {
+	e.mu.RLock()
+	_, ok := e.store[name]
+	isConst := e.consts[name]
+	e.mu.RUnlock()
+
+	if ok {
+		return isConst
+	}
+	if e.outer != nil {
+		return e.outer.IsConst(name)
+	}
+	return false
+}
+
+// HasConst reports whether name is bound as a constant in this scope
+// itself, ignoring enclosing scopes.
+func (e *Environment) HasConst(name string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.consts[name]
+}
+
+// Assign rebinds name in the nearest enclosing scope that defines it. It
+// reports false if name is not bound in any scope.
+func (e *Environment) Assign(name string, val Object) bool {
+	e.mu.Lock()
+	_, ok := e.store[name]
+	if ok {
+		e.store[name] = val
+	}
+	e.mu.Unlock()
+
+	if ok {
+		return true
+	}
+
+	if e.outer != nil {
+		return e.outer.Assign(name, val)
+	}
+
+	return false
+}
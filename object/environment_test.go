@@ -0,0 +1,94 @@
+package object
+
+import "testing"
+
+func TestEnclosedEnvironment(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("x", &Integer{Value: 1})
+	outer.Set("y", &Integer{Value: 2})
+
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("y", &Integer{Value: 20})
+
+	tests := []struct {
+		env      *Environment
+		name     string
+		expected int64
+	}{
+		{inner, "x", 1},
+		{inner, "y", 20},
+		{outer, "y", 2},
+	}
+
+	for _, tt := range tests {
+		obj, ok := tt.env.Get(tt.name)
+		if !ok {
+			t.Fatalf("%s not found", tt.name)
+		}
+		if obj.(*Integer).Value != tt.expected {
+			t.Errorf("%s has wrong value. want=%d, got=%d",
+				tt.name, tt.expected, obj.(*Integer).Value)
+		}
+	}
+
+	if _, ok := outer.Get("z"); ok {
+		t.Errorf("z should not be bound")
+	}
+}
+
+func TestEnvironmentAssign(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("x", &Integer{Value: 1})
+	inner := NewEnclosedEnvironment(outer)
+
+	if !inner.Assign("x", &Integer{Value: 5}) {
+		t.Fatalf("Assign did not find x")
+	}
+
+	obj, _ := outer.Get("x")
+	if obj.(*Integer).Value != 5 {
+		t.Errorf("outer x not updated. got=%d", obj.(*Integer).Value)
+	}
+
+	if inner.Assign("z", &Integer{Value: 1}) {
+		t.Errorf("Assign should fail for unbound names")
+	}
+}
+
+func TestEnvironmentConsts(t *testing.T) {
+	outer := NewEnvironment()
+	outer.SetConst("c", &Integer{Value: 1})
+	inner := NewEnclosedEnvironment(outer)
+
+	if !inner.IsConst("c") {
+		t.Errorf("c should be constant when seen from the inner scope")
+	}
+	if inner.HasConst("c") {
+		t.Errorf("c is not declared in the inner scope")
+	}
+
+	inner.Set("c", &Integer{Value: 2})
+	if inner.IsConst("c") {
+		t.Errorf("shadowing c with Set should make it mutable in the inner scope")
+	}
+
+	outer.Set("c", &Integer{Value: 3})
+	if outer.IsConst("c") {
+		t.Errorf("Set should clear the constant flag")
+	}
+}
+
+func TestEnvironmentDir(t *testing.T) {
+	outer := NewEnvironment()
+	outer.SetDir("lib")
+	inner := NewEnclosedEnvironment(outer)
+
+	if inner.Dir() != "lib" {
+		t.Errorf("inner.Dir() wrong. want=%q, got=%q", "lib", inner.Dir())
+	}
+
+	inner.SetDir("other")
+	if outer.Dir() != "lib" {
+		t.Errorf("outer.Dir() changed. got=%q", outer.Dir())
+	}
+}
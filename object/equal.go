@@ -0,0 +1,124 @@
+package object
+
+// Equal reports whether a and b are equal as `==` compares them:
+//
+//   - numbers are equal when their values are, whatever their types, so
+//     1 == 1.0
+//   - strings are equal when they hold the same characters
+//   - arrays are equal when they have the same length and equal elements
+//     in the same order, and hashes when they have the same keys with
+//     equal values, in any order
+//   - ranges are equal when they have the same bounds, and struct
+//     instances when they are of the same struct type and their fields
+//     are equal
+//   - booleans and null are only equal to themselves, so null == false is
+//     false
+//   - functions, builtins, modules and everything else are only equal to
+//     themselves: two functions with the same code are still different
+//
+// Values of different types are never equal, except for numbers. Arrays
+// and hashes that contain themselves compare without looping forever.
+func Equal(a, b Object) bool {
+	return equal(a, b, nil)
+}
+
+// pair is two composite values being compared, for equal to skip when it
+// meets them again inside themselves.
+type pair struct{ a, b Object }
+
+func equal(a, b Object, comparing map[pair]bool) bool {
+	if a == b {
+		return true
+	}
+
+	switch {
+	case IsInteger(a) && IsInteger(b):
+		return CompareIntegers(a, b) == 0
+	case isNumber(a) && isNumber(b):
+		return toFloat(a) == toFloat(b)
+	}
+
+	switch a := a.(type) {
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+
+	case *Range:
+		b, ok := b.(*Range)
+		return ok && a.Start == b.Start && a.End == b.End
+
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		if comparing, ok = enter(comparing, a, b); !ok {
+			return true
+		}
+		for i := range a.Elements {
+			if !equal(a.Elements[i], b.Elements[i], comparing) {
+				return false
+			}
+		}
+		return true
+
+	case *Hash:
+		b, ok := b.(*Hash)
+		if !ok || len(a.Pairs) != len(b.Pairs) {
+			return false
+		}
+		if comparing, ok = enter(comparing, a, b); !ok {
+			return true
+		}
+		for key, p := range a.Pairs {
+			other, ok := b.Pairs[key]
+			if !ok || !equal(p.Value, other.Value, comparing) {
+				return false
+			}
+		}
+		return true
+
+	case *Instance:
+		b, ok := b.(*Instance)
+		if !ok || a.Struct != b.Struct {
+			return false
+		}
+		if comparing, ok = enter(comparing, a, b); !ok {
+			return true
+		}
+		for i := range a.Values {
+			if !equal(a.Values[i], b.Values[i], comparing) {
+				return false
+			}
+		}
+		return true
+
+	default:
+		return false
+	}
+}
+
+// enter records that a and b are being compared, reporting false if they
+// already were: they then contain themselves, and are equal unless some
+// other part of them differs.
+func enter(comparing map[pair]bool, a, b Object) (map[pair]bool, bool) {
+	if comparing == nil {
+		comparing = map[pair]bool{}
+	}
+	if comparing[pair{a, b}] {
+		return comparing, false
+	}
+	comparing[pair{a, b}] = true
+	return comparing, true
+}
+
+func isNumber(obj Object) bool {
+	return IsInteger(obj) || obj.Type() == FLOAT_OBJ
+}
+
+func toFloat(obj Object) float64 {
+	if f, ok := obj.(*Float); ok {
+		return f.Value
+	}
+	return integerToFloat(obj)
+}
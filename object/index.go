@@ -0,0 +1,32 @@
+package object
+
+import "fmt"
+
+// SetIndex stores value at index in obj, changing obj in place. Arrays
+// only accept the indices of elements they already have; hashes add the
+// key if it is missing.
+func SetIndex(obj, index, value Object) error {
+	switch obj := obj.(type) {
+	case *Array:
+		i, ok := index.(*Integer)
+		if !ok {
+			return fmt.Errorf("array index must be INTEGER, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(obj.Elements)) {
+			return fmt.Errorf("index out of range: %d (length %d)",
+				i.Value, len(obj.Elements))
+		}
+		obj.Elements[i.Value] = value
+		return nil
+
+	case *Hash:
+		if _, ok := index.(Hashable); !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		obj.Set(index, value)
+		return nil
+
+	default:
+		return fmt.Errorf("index assignment not supported: %s", obj.Type())
+	}
+}
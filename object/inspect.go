@@ -0,0 +1,76 @@
+package object
+
+import "bytes"
+
+// inspect returns the Inspect text of an array, hash or struct instance.
+// Index assignment can make them contain themselves: a value met again
+// inside itself is written as [...], {...} or Name{...}.
+func inspect(obj Object) string {
+	var out bytes.Buffer
+	writeInspect(&out, obj, map[Object]bool{})
+	return out.String()
+}
+
+// writeInspect writes obj to out, writing the values in visiting, which
+// are being written already, as cycles.
+func writeInspect(out *bytes.Buffer, obj Object, visiting map[Object]bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		if visiting[obj] {
+			out.WriteString("[...]")
+			return
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		out.WriteString("[")
+		for i, e := range obj.Elements {
+			if i > 0 {
+				out.WriteString(", ")
+			}
+			writeInspect(out, e, visiting)
+		}
+		out.WriteString("]")
+
+	case *Hash:
+		if visiting[obj] {
+			out.WriteString("{...}")
+			return
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		out.WriteString("{")
+		for i, pair := range obj.Ordered() {
+			if i > 0 {
+				out.WriteString(", ")
+			}
+			writeInspect(out, pair.Key, visiting)
+			out.WriteString(": ")
+			writeInspect(out, pair.Value, visiting)
+		}
+		out.WriteString("}")
+
+	case *Instance:
+		out.WriteString(obj.Struct.TypeName())
+		if visiting[obj] {
+			out.WriteString("{...}")
+			return
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+
+		out.WriteString("{")
+		for i, name := range obj.Struct.Fields {
+			if i > 0 {
+				out.WriteString(", ")
+			}
+			out.WriteString(name + ": ")
+			writeInspect(out, obj.Values[i], visiting)
+		}
+		out.WriteString("}")
+
+	default:
+		out.WriteString(obj.Inspect())
+	}
+}
@@ -0,0 +1,231 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// MaxBigIntegerBits bounds the size of the big integers that `**` may
+// produce, so that a small expression cannot exhaust memory.
+const MaxBigIntegerBits = 1 << 20
+
+// The small integers that NewInt shares instead of allocating. Loop
+// counters, indexes and lengths nearly always fall in this range.
+const (
+	minCachedInteger = -128
+	maxCachedInteger = 255
+)
+
+var cachedIntegers = func() []*Integer {
+	cache := make([]*Integer, maxCachedInteger-minCachedInteger+1)
+	for i := range cache {
+		cache[i] = &Integer{Value: int64(i + minCachedInteger)}
+	}
+	return cache
+}()
+
+// NewInt returns an Integer holding value. Integers between -128 and
+// 255 are shared, so callers must never modify the result.
+func NewInt(value int64) *Integer {
+	if value >= minCachedInteger && value <= maxCachedInteger {
+		return cachedIntegers[value-minCachedInteger]
+	}
+	return &Integer{Value: value}
+}
+
+// IsInteger reports whether obj is an Integer or a BigInteger.
+func IsInteger(obj Object) bool {
+	switch obj.(type) {
+	case *Integer, *BigInteger:
+		return true
+	default:
+		return false
+	}
+}
+
+// IntegerArithmetic applies one of the operators +, -, *, /, % and ** to
+// two integers, each an *Integer or a *BigInteger. Results that overflow
+// an int64 wrap around like Go's int64 arithmetic, unless promote is set,
+// in which case they become a *BigInteger. Division truncates toward
+// zero, and a negative power gives a *Float.
+func IntegerArithmetic(operator string, left, right Object, promote bool) (Object, error) {
+	if (operator == "/" || operator == "%") && integerSign(right) == 0 {
+		if operator == "/" {
+			return nil, errors.New("division by zero")
+		}
+		return nil, errors.New("modulo by zero")
+	}
+
+	if operator == "**" && integerSign(right) < 0 {
+		return &Float{Value: math.Pow(integerToFloat(left), integerToFloat(right))}, nil
+	}
+
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	if lok && rok {
+		result, ok, err := int64Arithmetic(operator, l.Value, r.Value)
+		if err != nil {
+			return nil, err
+		}
+		if ok || !promote {
+			return NewInt(result), nil
+		}
+	}
+
+	a, b := toBigInt(left), toBigInt(right)
+	result := new(big.Int)
+
+	switch operator {
+	case "+":
+		result.Add(a, b)
+	case "-":
+		result.Sub(a, b)
+	case "*":
+		result.Mul(a, b)
+	case "/":
+		result.Quo(a, b)
+	case "%":
+		result.Rem(a, b)
+	case "**":
+		if !b.IsInt64() || int64(a.BitLen())*b.Int64() > MaxBigIntegerBits {
+			if a.CmpAbs(big.NewInt(1)) > 0 {
+				return nil, fmt.Errorf("integer too large: %s ** %s", a, b)
+			}
+			// 0, 1 and -1 stay small whatever the exponent, and only its
+			// parity matters
+			b = big.NewInt(2 + int64(b.Bit(0)))
+		}
+		result.Exp(a, b, nil)
+	default:
+		return nil, fmt.Errorf("unknown integer operator: %s", operator)
+	}
+
+	return NewInteger(result), nil
+}
+
+// NegateInteger returns -obj for an *Integer or a *BigInteger, promoting
+// the negation of the smallest int64 like IntegerArithmetic.
+func NegateInteger(obj Object, promote bool) Object {
+	if i, ok := obj.(*Integer); ok && (i.Value != math.MinInt64 || !promote) {
+		return NewInt(-i.Value)
+	}
+	return NewInteger(new(big.Int).Neg(toBigInt(obj)))
+}
+
+// CompareIntegers returns -1, 0 or +1 depending on whether left is less
+// than, equal to or greater than right, each an *Integer or a *BigInteger.
+func CompareIntegers(left, right Object) int {
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	if lok && rok {
+		switch {
+		case l.Value < r.Value:
+			return -1
+		case l.Value > r.Value:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return toBigInt(left).Cmp(toBigInt(right))
+}
+
+// NewInteger returns n as an *Integer if it fits in one and as a
+// *BigInteger otherwise.
+func NewInteger(n *big.Int) Object {
+	if n.IsInt64() {
+		return NewInt(n.Int64())
+	}
+	return &BigInteger{Value: n}
+}
+
+// int64Arithmetic applies operator to a and b. ok is false when the
+// result overflowed and wrapped around.
+func int64Arithmetic(operator string, a, b int64) (result int64, ok bool, err error) {
+	switch operator {
+	case "+":
+		result = a + b
+		return result, (b >= 0) == (result >= a), nil
+	case "-":
+		result = a - b
+		return result, (b >= 0) == (result <= a), nil
+	case "*":
+		result = a * b
+		if a == 0 || b == 0 {
+			return 0, true, nil
+		}
+		overflow := result/b != a ||
+			(a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64)
+		return result, !overflow, nil
+	case "/":
+		return a / b, !(a == math.MinInt64 && b == -1), nil
+	case "%":
+		return a % b, true, nil
+	case "**":
+		return int64Pow(a, b)
+	default:
+		return 0, false, fmt.Errorf("unknown integer operator: %s", operator)
+	}
+}
+
+// int64Pow raises base to the non-negative exp by repeated squaring.
+func int64Pow(base, exp int64) (result int64, ok bool, err error) {
+	result, ok = 1, true
+
+	for exp > 0 {
+		if exp&1 == 1 {
+			var mulOk bool
+			result, mulOk, _ = int64Arithmetic("*", result, base)
+			ok = ok && mulOk
+		}
+		exp >>= 1
+		if exp > 0 {
+			var mulOk bool
+			base, mulOk, _ = int64Arithmetic("*", base, base)
+			ok = ok && mulOk
+		}
+	}
+
+	return result, ok, nil
+}
+
+func toBigInt(obj Object) *big.Int {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value)
+	case *BigInteger:
+		return obj.Value
+	default:
+		return new(big.Int)
+	}
+}
+
+func integerSign(obj Object) int {
+	switch obj := obj.(type) {
+	case *Integer:
+		switch {
+		case obj.Value < 0:
+			return -1
+		case obj.Value > 0:
+			return 1
+		}
+		return 0
+	case *BigInteger:
+		return obj.Value.Sign()
+	default:
+		return 0
+	}
+}
+
+func integerToFloat(obj Object) float64 {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value)
+	case *BigInteger:
+		return obj.Float64()
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,508 @@
+package object
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/big"
+	"math/rand"
+	"monkey/ast"
+	"monkey/code"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type ObjectType string
+
+const (
+	INTEGER_OBJ     = "INTEGER"
+	BIG_INTEGER_OBJ = "BIG_INTEGER"
+	FLOAT_OBJ       = "FLOAT"
+	BOOLEAN_OBJ     = "BOOLEAN"
+	NULL_OBJ        = "NULL"
+	STRING_OBJ      = "STRING"
+	ARRAY_OBJ       = "ARRAY"
+	HASH_OBJ        = "HASH"
+	RANGE_OBJ       = "RANGE"
+	MODULE_OBJ      = "MODULE"
+	CHANNEL_OBJ     = "CHANNEL"
+	STRUCT_TYPE_OBJ = "STRUCT_TYPE"
+	STRUCT_OBJ      = "STRUCT"
+
+	FUNCTION_OBJ = "FUNCTION"
+	BUILTIN_OBJ  = "BUILTIN"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+
+	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	ERROR_OBJ        = "ERROR"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
+)
+
+// The null and boolean values are singletons that the evaluator and the
+// VM compare by identity, so that values can be passed between them.
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+// IsTruthy reports whether obj counts as true where a condition is
+// expected: by if, !, && and ||. Only false and null count as false, so
+// 0, "" and empty arrays and hashes count as true: a condition tests
+// whether there is a value rather than what it is.
+func IsTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	default:
+		return true
+	}
+}
+
+type Object interface {
+	Type() ObjectType
+	Inspect() string
+}
+
+// HashKey identifies an object used as a key in a Hash. Two objects with
+// the same type and value produce equal hash keys.
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// Hashable is implemented by objects that can be used as hash keys.
+type Hashable interface {
+	HashKey() HashKey
+}
+
+type Integer struct {
+	Value int64
+}
+
+func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
+func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+// BigInteger is an integer outside the range of Integer. Integer
+// arithmetic only produces one when it is asked to promote results that
+// overflow, see IntegerArithmetic; a BigInteger never holds a value that
+// fits in an Integer.
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (bi *BigInteger) Type() ObjectType { return BIG_INTEGER_OBJ }
+func (bi *BigInteger) Inspect() string  { return bi.Value.String() }
+func (bi *BigInteger) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(bi.Value.String()))
+
+	return HashKey{Type: bi.Type(), Value: h.Sum64()}
+}
+
+// Float64 returns the float nearest to the integer.
+func (bi *BigInteger) Float64() float64 {
+	f, _ := new(big.Float).SetInt(bi.Value).Float64()
+	return f
+}
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		// Keep whole floats recognizable as floats, e.g. "2.0" not "2".
+		s += ".0"
+	}
+	return s
+}
+func (f *Float) HashKey() HashKey {
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
+type Boolean struct {
+	Value bool
+}
+
+func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
+func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+
+	if b.Value {
+		value = 1
+	}
+
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string  { return inspect(a) }
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash maps keys to values. It remembers the order its keys were added
+// in, so that printing or iterating over a hash gives the same result on
+// every run.
+//
+// Pairs should only be added with Set. Pairs put into the map directly,
+// as when converting a Go map whose order is undefined, come after the
+// others, sorted by key.
+type Hash struct {
+	Pairs map[HashKey]HashPair
+
+	// keys lists the keys of Pairs in the order they were added
+	keys []HashKey
+}
+
+// NewHash returns an empty hash with room for size pairs.
+func NewHash(size int) *Hash {
+	return &Hash{
+		Pairs: make(map[HashKey]HashPair, size),
+		keys:  make([]HashKey, 0, size),
+	}
+}
+
+// Set binds key, which must be Hashable, to value. A new key is ordered
+// after the existing ones, while an existing key keeps its place.
+func (h *Hash) Set(key, value Object) {
+	if h.Pairs == nil {
+		h.Pairs = make(map[HashKey]HashPair)
+	}
+
+	hashKey := key.(Hashable).HashKey()
+	if _, ok := h.Pairs[hashKey]; !ok {
+		h.syncKeys()
+		h.keys = append(h.keys, hashKey)
+	}
+	h.Pairs[hashKey] = HashPair{Key: key, Value: value}
+}
+
+// Ordered returns the pairs of h in the order their keys were added.
+func (h *Hash) Ordered() []HashPair {
+	h.syncKeys()
+
+	pairs := make([]HashPair, len(h.keys))
+	for i, key := range h.keys {
+		pairs[i] = h.Pairs[key]
+	}
+	return pairs
+}
+
+// syncKeys orders the keys that were put into Pairs directly after the
+// ones added with Set.
+func (h *Hash) syncKeys() {
+	if len(h.keys) == len(h.Pairs) {
+		return
+	}
+
+	ordered := make(map[HashKey]bool, len(h.keys))
+	for _, key := range h.keys {
+		ordered[key] = true
+	}
+
+	var missing []HashPair
+	for key, pair := range h.Pairs {
+		if !ordered[key] {
+			missing = append(missing, pair)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		a, b := missing[i].Key, missing[j].Key
+		if a.Type() != b.Type() {
+			return a.Type() < b.Type()
+		}
+		return a.Inspect() < b.Inspect()
+	})
+
+	for _, pair := range missing {
+		h.keys = append(h.keys, pair.Key.(Hashable).HashKey())
+	}
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string  { return inspect(h) }
+
+// Module holds the top-level bindings of an imported file. Members are
+// read by indexing the module with their name, like a hash.
+type Module struct {
+	Path    string
+	Members map[string]Object
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return fmt.Sprintf("module(%q)", m.Path) }
+
+type Function struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+
+	// Variadic is set when the last parameter collects the remaining
+	// arguments into an array.
+	Variadic bool
+}
+
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+	if f.Variadic {
+		params[len(params)-1] += "..."
+	}
+
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(f.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+
+	// Variadic is set when the last parameter collects the remaining
+	// arguments into an array.
+	Variadic bool
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+
+	// Globals are the globals of the program or module the closure was
+	// created in, so that module functions keep using their own.
+	Globals []Object
+}
+
+// Type is that of the evaluator's functions, since closures are what
+// functions are in compiled code, and programs should not see a
+// difference.
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+type BuiltinFunction func(args ...Object) Object
+
+// A Runtime is the engine running a builtin, as the builtin sees it.
+type Runtime interface {
+	// Call applies fn, which may be any callable object, to args and
+	// returns its result or an *Error.
+	Call(fn Object, args ...Object) Object
+
+	// Stdout is where builtins like puts write their output, Stderr
+	// where eputs writes, and Stdin where readLine reads from.
+	Stdout() io.Writer
+	Stderr() io.Writer
+	Stdin() io.Reader
+
+	// AllowFS reports whether builtins may use the file system, AllowNet
+	// whether they may use the network, AllowEnv whether they may read
+	// environment variables, AllowExec whether they may run commands and
+	// AllowExit whether exit may stop the program. Builtins registered by
+	// hosts should check them too, and fail with an error like "`name` is
+	// not allowed: network access is disabled".
+	AllowFS() bool
+	AllowNet() bool
+	AllowEnv() bool
+	AllowExec() bool
+	AllowExit() bool
+
+	// Args are the command-line arguments the host passed to the program.
+	Args() []string
+
+	// Context is done once the program is stopped, so that builtins
+	// that block can give up.
+	Context() context.Context
+
+	// Rand is the random number generator of builtins like random, which
+	// randomSeed seeds to make a program's numbers reproducible.
+	Rand() *rand.Rand
+}
+
+// RuntimeFunction is a builtin that needs the engine running it, to call
+// back into Monkey code or to use its streams.
+type RuntimeFunction func(rt Runtime, args ...Object) Object
+
+type Builtin struct {
+	Fn BuiltinFunction
+
+	// RuntimeFn is called instead of Fn when set.
+	RuntimeFn RuntimeFunction
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin function" }
+
+// Channel carries values between the tasks started by spawn. Queue holds
+// the values sent and not received yet: up to Size of them, or the one
+// whose sender waits for a receiver if Size is zero. Tasks take turns, so
+// channels need no locking of their own.
+type Channel struct {
+	Size     int
+	Queue    []Object
+	Sent     int // how many values were sent
+	Received int // how many values were received
+}
+
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string  { return fmt.Sprintf("Channel[%p]", c) }
+
+type Null struct{}
+
+func (n *Null) Type() ObjectType { return NULL_OBJ }
+func (n *Null) Inspect() string  { return "null" }
+
+// Break and Continue signal a break or continue statement to the loop
+// being evaluated, the same way ReturnValue signals a return.
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
+type ReturnValue struct {
+	Value Object
+}
+
+func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
+
+type Error struct {
+	Message string
+
+	// Line and Column locate the expression that failed. They are zero
+	// when the position is unknown.
+	Line   int
+	Column int
+
+	// Exit is set on the error that exit stops a program with, which try
+	// does not catch.
+	Exit *ExitError
+
+	// Stack holds the function calls in progress when the error happened,
+	// innermost first. It is empty for errors outside any function.
+	Stack []StackFrame
+}
+
+// StackFrame is a call in progress when an error happened.
+type StackFrame struct {
+	Function string // the called expression, like "fib"
+	Line     int    // the position of the call
+	Column   int
+}
+
+// Trace returns Inspect followed by the lines of StackLines, one per line.
+func (e *Error) Trace() string {
+	var out bytes.Buffer
+	out.WriteString(e.Inspect())
+	for _, line := range e.StackLines() {
+		out.WriteString("\n\t" + line)
+	}
+	return out.String()
+}
+
+// maxStackLines is how many lines StackLines keeps from each end of a
+// long stack.
+const maxStackLines = 10
+
+// StackLines describes the calls the error happened in, innermost first,
+// like "in f, called at line 3, column 5". After a stack overflow the
+// stack holds thousands of calls, so runs of the same call are collapsed
+// into a line saying how often it repeats, and only the first and last
+// maxStackLines lines of what remains are kept.
+func (e *Error) StackLines() []string {
+	var lines []string
+	for i := 0; i < len(e.Stack); {
+		frame := e.Stack[i]
+		lines = append(lines, fmt.Sprintf("in %s, called at line %d, column %d",
+			frame.Function, frame.Line, frame.Column))
+
+		n := 1
+		for i+n < len(e.Stack) && e.Stack[i+n] == frame {
+			n++
+		}
+		if n > 1 {
+			lines = append(lines, fmt.Sprintf("... previous frame repeated %d more times", n-1))
+		}
+		i += n
+	}
+
+	if len(lines) > 2*maxStackLines {
+		omitted := len(lines) - 2*maxStackLines
+		kept := append([]string{}, lines[:maxStackLines]...)
+		kept = append(kept, fmt.Sprintf("... %d more lines", omitted))
+		lines = append(kept, lines[len(lines)-maxStackLines:]...)
+	}
+	return lines
+}
+
+// ExitError is how a program that called exit(code) ends, with the
+// status it asked for.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func (e *Error) Type() ObjectType { return ERROR_OBJ }
+func (e *Error) Inspect() string {
+	if e.Line == 0 {
+		return "ERROR: " + e.Message
+	}
+	return fmt.Sprintf("ERROR: %s at line %d, column %d", e.Message, e.Line, e.Column)
+}
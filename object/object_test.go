@@ -0,0 +1,493 @@
+package object
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		obj          Object
+		expectedType ObjectType
+		expected     string
+	}{
+		{&Integer{Value: 42}, INTEGER_OBJ, "42"},
+		{&Integer{Value: -7}, INTEGER_OBJ, "-7"},
+		{&Float{Value: 3.25}, FLOAT_OBJ, "3.25"},
+		{&Float{Value: 2}, FLOAT_OBJ, "2.0"},
+		{&Float{Value: 1e21}, FLOAT_OBJ, "1e+21"},
+		{&Boolean{Value: true}, BOOLEAN_OBJ, "true"},
+		{&String{Value: "monkey"}, STRING_OBJ, "monkey"},
+		{&Null{}, NULL_OBJ, "null"},
+		{&Range{Start: 1, End: 10}, RANGE_OBJ, "1..10"},
+		{&StructType{Name: "P", Fields: []string{"x", "y"}}, STRUCT_TYPE_OBJ, "struct P {x, y}"},
+		{&StructType{Fields: []string{"x"}}, STRUCT_TYPE_OBJ, "struct {x}"},
+		{
+			&Instance{Struct: &StructType{Name: "P", Fields: []string{"x", "y"}}, Values: []Object{&Integer{Value: 1}, NULL}},
+			STRUCT_OBJ,
+			"P{x: 1, y: null}",
+		},
+		{&ReturnValue{Value: &Integer{Value: 5}}, RETURN_VALUE_OBJ, "5"},
+		{&Error{Message: "type mismatch"}, ERROR_OBJ, "ERROR: type mismatch"},
+		{&Error{Message: "boom", Line: 2, Column: 5}, ERROR_OBJ, "ERROR: boom at line 2, column 5"},
+	}
+
+	for _, tt := range tests {
+		if tt.obj.Type() != tt.expectedType {
+			t.Errorf("wrong type. expected=%q, got=%q", tt.expectedType, tt.obj.Type())
+		}
+
+		if tt.obj.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect(). expected=%q, got=%q", tt.expected, tt.obj.Inspect())
+		}
+	}
+}
+
+func TestInspectCycles(t *testing.T) {
+	shared := &Array{Elements: []Object{&Integer{Value: 1}}}
+
+	array := &Array{Elements: []Object{&Integer{Value: 0}}}
+	array.Elements = append(array.Elements, array)
+
+	hash := NewHash(1)
+	hash.Set(&String{Value: "self"}, hash)
+
+	point := &StructType{Name: "P", Fields: []string{"xs"}}
+	xs := &Array{}
+	xs.Elements = []Object{&Instance{Struct: point, Values: []Object{xs}}}
+
+	tests := []struct {
+		obj      Object
+		expected string
+	}{
+		{&Array{Elements: []Object{shared, shared}}, "[[1], [1]]"},
+		{array, "[0, [...]]"},
+		{hash, "{self: {...}}"},
+		{&Array{Elements: []Object{hash}}, "[{self: {...}}]"},
+		{xs, "[P{xs: [...]}]"},
+		{xs.Elements[0], "P{xs: [P{...}]}"},
+	}
+
+	for _, tt := range tests {
+		if tt.obj.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect(). expected=%q, got=%q", tt.expected, tt.obj.Inspect())
+		}
+	}
+}
+
+func TestErrorStackLines(t *testing.T) {
+	f := StackFrame{Function: "f", Line: 1, Column: 2}
+	g := StackFrame{Function: "g", Line: 3, Column: 4}
+
+	repeated := &Error{Stack: []StackFrame{f, f, f, g, f}}
+	expected := []string{
+		"in f, called at line 1, column 2",
+		"... previous frame repeated 2 more times",
+		"in g, called at line 3, column 4",
+		"in f, called at line 1, column 2",
+	}
+	if got := repeated.StackLines(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong stack lines.\nwant=%q\ngot=%q", expected, got)
+	}
+
+	// mutual recursion repeats no single frame, but is cut short too
+	mutual := &Error{}
+	for i := 0; i < 5000; i++ {
+		mutual.Stack = append(mutual.Stack, f, g)
+	}
+	lines := mutual.StackLines()
+	if len(lines) != 2*maxStackLines+1 {
+		t.Fatalf("wrong number of stack lines. want=%d, got=%d", 2*maxStackLines+1, len(lines))
+	}
+	if lines[maxStackLines] != "... 9980 more lines" {
+		t.Errorf("wrong omission line: %q", lines[maxStackLines])
+	}
+	if lines[len(lines)-1] != "in g, called at line 3, column 4" {
+		t.Errorf("outermost call missing: %q", lines[len(lines)-1])
+	}
+}
+
+func TestStringHashKey(t *testing.T) {
+	hello1 := &String{Value: "Hello World"}
+	hello2 := &String{Value: "Hello World"}
+	diff1 := &String{Value: "My name is johnny"}
+	diff2 := &String{Value: "My name is johnny"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if diff1.HashKey() != diff2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if hello1.HashKey() == diff1.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+}
+
+func TestHashKeyTypesDiffer(t *testing.T) {
+	one := &Integer{Value: 1}
+	yes := &Boolean{Value: true}
+
+	if one.HashKey() == yes.HashKey() {
+		t.Errorf("integer 1 and true have same hash keys")
+	}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	max := &Integer{Value: math.MaxInt64}
+	min := &Integer{Value: math.MinInt64}
+	one := &Integer{Value: 1}
+	two := &Integer{Value: 2}
+	minusOne := &Integer{Value: -1}
+	huge := &BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 64)} // 2**64
+
+	tests := []struct {
+		operator     string
+		left, right  Object
+		promote      bool
+		expected     string
+		expectedType ObjectType
+	}{
+		{"+", max, minusOne, false, "9223372036854775806", INTEGER_OBJ},
+		{"+", max, one, false, "-9223372036854775808", INTEGER_OBJ},
+		{"+", max, one, true, "9223372036854775808", BIG_INTEGER_OBJ},
+		{"-", min, one, false, "9223372036854775807", INTEGER_OBJ},
+		{"-", min, one, true, "-9223372036854775809", BIG_INTEGER_OBJ},
+		{"*", max, two, false, "-2", INTEGER_OBJ},
+		{"*", max, two, true, "18446744073709551614", BIG_INTEGER_OBJ},
+		{"*", min, minusOne, true, "9223372036854775808", BIG_INTEGER_OBJ},
+		{"/", min, minusOne, false, "-9223372036854775808", INTEGER_OBJ},
+		{"/", min, minusOne, true, "9223372036854775808", BIG_INTEGER_OBJ},
+		{"%", min, minusOne, true, "0", INTEGER_OBJ},
+		{"**", two, &Integer{Value: 62}, true, "4611686018427387904", INTEGER_OBJ},
+		{"**", two, &Integer{Value: 64}, false, "0", INTEGER_OBJ},
+		{"**", two, &Integer{Value: 64}, true, "18446744073709551616", BIG_INTEGER_OBJ},
+		{"**", two, minusOne, true, "0.5", FLOAT_OBJ},
+		{"**", minusOne, huge, true, "1", INTEGER_OBJ},
+		// big results that fit again become integers
+		{"-", huge, huge, true, "0", INTEGER_OBJ},
+		{"/", huge, two, true, "9223372036854775808", BIG_INTEGER_OBJ},
+		{"/", huge, &Integer{Value: 4}, true, "4611686018427387904", INTEGER_OBJ},
+		{"+", huge, one, false, "18446744073709551617", BIG_INTEGER_OBJ},
+	}
+
+	for _, tt := range tests {
+		result, err := IntegerArithmetic(tt.operator, tt.left, tt.right, tt.promote)
+		if err != nil {
+			t.Errorf("%s %s %s: unexpected error %s",
+				tt.left.Inspect(), tt.operator, tt.right.Inspect(), err)
+			continue
+		}
+
+		if result.Inspect() != tt.expected || result.Type() != tt.expectedType {
+			t.Errorf("%s %s %s (promote=%t): want %s %s, got %s %s",
+				tt.left.Inspect(), tt.operator, tt.right.Inspect(), tt.promote,
+				tt.expectedType, tt.expected, result.Type(), result.Inspect())
+		}
+	}
+}
+
+func TestIntegerArithmeticErrors(t *testing.T) {
+	tests := []struct {
+		operator    string
+		left, right Object
+		expected    string
+	}{
+		{"/", &Integer{Value: 1}, &Integer{Value: 0}, "division by zero"},
+		{"%", &Integer{Value: 1}, &Integer{Value: 0}, "modulo by zero"},
+		{"**", &Integer{Value: 3}, &Integer{Value: 1 << 40}, "integer too large: 3 ** 1099511627776"},
+	}
+
+	for _, tt := range tests {
+		_, err := IntegerArithmetic(tt.operator, tt.left, tt.right, true)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+func TestNegateAndCompareIntegers(t *testing.T) {
+	min := &Integer{Value: math.MinInt64}
+
+	if got := NegateInteger(min, false); got.Inspect() != "-9223372036854775808" {
+		t.Errorf("wrapping negation wrong. got=%s", got.Inspect())
+	}
+
+	negated := NegateInteger(min, true)
+	if negated.Inspect() != "9223372036854775808" {
+		t.Fatalf("promoting negation wrong. got=%s", negated.Inspect())
+	}
+
+	if CompareIntegers(negated, &Integer{Value: math.MaxInt64}) != 1 {
+		t.Errorf("big integer should compare greater than MaxInt64")
+	}
+	if CompareIntegers(min, negated) != -1 {
+		t.Errorf("MinInt64 should compare less than its negation")
+	}
+	if NegateInteger(negated, true).Inspect() != min.Inspect() {
+		t.Errorf("negating twice should give MinInt64 back")
+	}
+}
+
+func TestNewInt(t *testing.T) {
+	for _, v := range []int64{-129, -128, 0, 1, 255, 256, math.MaxInt64} {
+		if got := NewInt(v); got.Value != v {
+			t.Errorf("NewInt(%d) has wrong value. got=%d", v, got.Value)
+		}
+	}
+
+	for _, v := range []int64{-128, 0, 255} {
+		if NewInt(v) != NewInt(v) {
+			t.Errorf("NewInt(%d) should be shared", v)
+		}
+	}
+	for _, v := range []int64{-129, 256} {
+		if NewInt(v) == NewInt(v) {
+			t.Errorf("NewInt(%d) should not be shared", v)
+		}
+	}
+}
+
+func TestRange(t *testing.T) {
+	r, err := NewRange(&Integer{Value: 2}, &Integer{Value: 5})
+	if err != nil || r.Start != 2 || r.End != 5 || r.Len() != 3 {
+		t.Errorf("wrong range. got=%+v, %v", r, err)
+	}
+	if (&Range{Start: 5, End: 2}).Len() != 0 {
+		t.Errorf("a backwards range is not empty")
+	}
+
+	full := &Range{Start: math.MinInt64, End: math.MaxInt64}
+	if full.Len() != math.MaxInt64 {
+		t.Errorf("wrong length of the full range. got=%d", full.Len())
+	}
+	for _, tt := range []struct {
+		i    int64
+		want int64
+		ok   bool
+	}{
+		{0, math.MinInt64, true},
+		{math.MaxInt64, -1, true},
+		{-1, 0, false},
+	} {
+		if n, ok := full.At(tt.i); n != tt.want || ok != tt.ok {
+			t.Errorf("At(%d) = %d, %t, want %d, %t", tt.i, n, ok, tt.want, tt.ok)
+		}
+	}
+	if n, ok := r.At(2); n != 4 || !ok {
+		t.Errorf("At(2) = %d, %t, want 4, true", n, ok)
+	}
+	if _, ok := r.At(3); ok {
+		t.Errorf("At(3) should be past the end of %s", r.Inspect())
+	}
+
+	_, err = NewRange(&Integer{Value: 1}, &String{Value: "a"})
+	if err == nil || err.Error() != "range bounds must be INTEGER, got INTEGER..STRING" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+func TestSlice(t *testing.T) {
+	array := &Array{Elements: []Object{&Integer{Value: 1}, &Integer{Value: 2}, &Integer{Value: 3}}}
+	str := &String{Value: "héllo"}
+	i := func(v int64) Object { return &Integer{Value: v} }
+
+	tests := []struct {
+		obj        Object
+		start, end Object
+		expected   string
+	}{
+		{array, i(1), NULL, "[2, 3]"},
+		{array, NULL, i(2), "[1, 2]"},
+		{array, NULL, NULL, "[1, 2, 3]"},
+		{array, i(-2), NULL, "[2, 3]"},
+		{array, i(0), i(-1), "[1, 2]"},
+		{array, i(-10), i(10), "[1, 2, 3]"},
+		{array, i(2), i(1), "[]"},
+		{array, i(5), i(7), "[]"},
+		{str, i(1), i(3), "él"},
+		{str, i(-3), NULL, "llo"},
+		{str, i(4), i(2), ""},
+	}
+
+	for _, tt := range tests {
+		result, err := Slice(tt.obj, tt.start, tt.end)
+		if err != nil {
+			t.Errorf("%s[%s:%s]: unexpected error %s", tt.obj.Inspect(), tt.start.Inspect(), tt.end.Inspect(), err)
+			continue
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s[%s:%s]: want=%q, got=%q", tt.obj.Inspect(), tt.start.Inspect(), tt.end.Inspect(), tt.expected, result.Inspect())
+		}
+	}
+
+	sliced, _ := Slice(array, NULL, NULL)
+	if sliced.(*Array) == array || &sliced.(*Array).Elements[0] == &array.Elements[0] {
+		t.Errorf("slice shares its elements with the array")
+	}
+
+	if _, err := Slice(array, &String{Value: "a"}, NULL); err == nil ||
+		err.Error() != "slice index must be INTEGER, got STRING" {
+		t.Errorf("wrong error for a string index. got=%v", err)
+	}
+	if _, err := Slice(i(1), NULL, NULL); err == nil ||
+		err.Error() != "slice operator not supported: INTEGER" {
+		t.Errorf("wrong error for an integer. got=%v", err)
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	hash := NewHash(0)
+	for _, key := range []string{"b", "a", "c"} {
+		hash.Set(&String{Value: key}, &Integer{Value: int64(len(hash.Pairs))})
+	}
+	hash.Set(&Integer{Value: 1}, TRUE)
+	hash.Set(&String{Value: "a"}, NULL)
+
+	expected := "{b: 0, a: null, c: 2, 1: true}"
+	for i := 0; i < 10; i++ {
+		if hash.Inspect() != expected {
+			t.Fatalf("wrong order. want=%q, got=%q", expected, hash.Inspect())
+		}
+	}
+
+	// pairs put into the map directly come last, sorted by key
+	direct := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, key := range []Object{&String{Value: "y"}, &Integer{Value: 2}, &String{Value: "x"}} {
+		direct.Pairs[key.(Hashable).HashKey()] = HashPair{Key: key, Value: key}
+	}
+	direct.Set(&String{Value: "z"}, NULL)
+
+	expected = "{2: 2, x: x, y: y, z: null}"
+	if direct.Inspect() != expected {
+		t.Errorf("wrong order. want=%q, got=%q", expected, direct.Inspect())
+	}
+}
+
+func TestSetIndex(t *testing.T) {
+	array := &Array{Elements: []Object{&Integer{Value: 1}, &Integer{Value: 2}}}
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+
+	if err := SetIndex(array, &Integer{Value: 1}, TRUE); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if array.Inspect() != "[1, true]" {
+		t.Errorf("wrong array. got=%s", array.Inspect())
+	}
+
+	key := &String{Value: "a"}
+	if err := SetIndex(hash, key, &Integer{Value: 1}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := SetIndex(hash, key, &Integer{Value: 2}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(hash.Pairs) != 1 || hash.Pairs[key.HashKey()].Value.Inspect() != "2" {
+		t.Errorf("wrong hash. got=%s", hash.Inspect())
+	}
+
+	tests := []struct {
+		obj      Object
+		index    Object
+		expected string
+	}{
+		{array, &Integer{Value: 2}, "index out of range: 2 (length 2)"},
+		{array, &Integer{Value: -1}, "index out of range: -1 (length 2)"},
+		{array, key, "array index must be INTEGER, got STRING"},
+		{hash, array, "unusable as hash key: ARRAY"},
+		{key, &Integer{Value: 0}, "index assignment not supported: STRING"},
+	}
+
+	for _, tt := range tests {
+		err := SetIndex(tt.obj, tt.index, NULL)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s[%s]: wrong error. want=%q, got=%v",
+				tt.obj.Inspect(), tt.index.Inspect(), tt.expected, err)
+		}
+	}
+}
+
+func TestSize(t *testing.T) {
+	hash := NewHash(2)
+	hash.Set(&String{Value: "a"}, &Integer{Value: 1})
+	hash.Set(&String{Value: "b"}, &Integer{Value: 2})
+
+	tests := []struct {
+		obj      Object
+		expected int
+	}{
+		{&Integer{Value: 1}, 0},
+		{&Array{}, 1},
+		{&Array{Elements: []Object{TRUE, FALSE, NULL}}, 4},
+		{hash, 3},
+		{&String{Value: "short"}, 1},
+		{&String{Value: strings.Repeat("x", 80)}, 11},
+	}
+
+	for _, tt := range tests {
+		if size := Size(tt.obj); size != tt.expected {
+			t.Errorf("Size(%s) wrong. want=%d, got=%d", tt.obj.Inspect(), tt.expected, size)
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	big1 := &BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 70)}
+	big2 := &BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 70)}
+
+	hash := func(pairs ...Object) *Hash {
+		h := NewHash(len(pairs) / 2)
+		for i := 0; i < len(pairs); i += 2 {
+			h.Set(pairs[i], pairs[i+1])
+		}
+		return h
+	}
+	str := func(s string) *String { return &String{Value: s} }
+
+	// hashes holding themselves under "self"
+	selfA := hash(str("n"), NewInt(1))
+	selfA.Set(str("self"), selfA)
+	selfB := hash(str("n"), NewInt(1))
+	selfB.Set(str("self"), selfB)
+	selfC := hash(str("n"), NewInt(2))
+	selfC.Set(str("self"), selfC)
+
+	fn := &Builtin{}
+
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{NewInt(1), NewInt(1), true},
+		{NewInt(1), &Float{Value: 1}, true},
+		{big1, big2, true},
+		{big1, NewInt(1), false},
+		{str("a"), str("a"), true},
+		{str("a"), str("b"), false},
+		{&Array{Elements: []Object{NewInt(1), str("x")}}, &Array{Elements: []Object{NewInt(1), str("x")}}, true},
+		{&Array{Elements: []Object{NewInt(1)}}, &Array{}, false},
+		{hash(str("a"), NewInt(1)), hash(str("a"), NewInt(1)), true},
+		{hash(str("a"), NewInt(1)), hash(str("a"), str("1")), false},
+		{selfA, selfB, true},
+		{selfA, selfC, false},
+		{NULL, NULL, true},
+		{NULL, FALSE, false},
+		{TRUE, NewInt(1), false},
+		{fn, fn, true},
+		{fn, &Builtin{}, false},
+	}
+
+	for i, tt := range tests {
+		if got := Equal(tt.a, tt.b); got != tt.expected {
+			t.Errorf("tests[%d]: Equal(%s, %s) = %t, want %t", i, tt.a.Type(), tt.b.Type(), got, tt.expected)
+		}
+		if got := Equal(tt.b, tt.a); got != tt.expected {
+			t.Errorf("tests[%d]: Equal is not symmetric", i)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package object
+
+import (
+	"fmt"
+	"math"
+)
+
+// Range is the integers from Start up to, but not including, End, made by
+// `start..end`. It is empty when End is not after Start.
+type Range struct {
+	Start int64
+	End   int64
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string  { return fmt.Sprintf("%d..%d", r.Start, r.End) }
+
+// Len returns the number of integers in the range, or math.MaxInt64 for
+// ranges of more, like math.MinInt64..math.MaxInt64.
+func (r *Range) Len() int64 {
+	size := r.size()
+	if size > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(size)
+}
+
+// At returns the i-th integer of the range, counting from zero, and
+// whether the range has one. It works for ranges of any length, so that
+// loops over them can go to their end.
+func (r *Range) At(i int64) (int64, bool) {
+	if i < 0 || uint64(i) >= r.size() {
+		return 0, false
+	}
+	return int64(uint64(r.Start) + uint64(i)), true
+}
+
+// size returns the number of integers in the range, which may not fit
+// in an int64.
+func (r *Range) size() uint64 {
+	if r.End <= r.Start {
+		return 0
+	}
+	return uint64(r.End) - uint64(r.Start)
+}
+
+// NewRange makes the range start..end of two integers.
+func NewRange(start, end Object) (*Range, error) {
+	s, ok := start.(*Integer)
+	e, ok2 := end.(*Integer)
+	if !ok || !ok2 {
+		return nil, fmt.Errorf("range bounds must be INTEGER, got %s..%s",
+			start.Type(), end.Type())
+	}
+	return &Range{Start: s.Value, End: e.Value}, nil
+}
+
+// Slice returns the elements of an array, or the characters of a string,
+// from start up to but not including end. Either bound may be NULL, which
+// stands for the start or end of obj. A negative bound counts back from
+// the end, so -1 is the last element, and bounds outside of obj are
+// clamped to it, so that slicing never fails on a valid bound:
+//
+//	[1, 2, 3][1:]   // [2, 3]
+//	[1, 2, 3][-2:]  // [2, 3]
+//	[1, 2, 3][:10]  // [1, 2, 3]
+//	[1, 2, 3][2:1]  // []
+func Slice(obj, start, end Object) (Object, error) {
+	switch obj := obj.(type) {
+	case *Array:
+		from, to, err := sliceBounds(len(obj.Elements), start, end)
+		if err != nil {
+			return nil, err
+		}
+		elements := make([]Object, to-from)
+		copy(elements, obj.Elements[from:to])
+		return &Array{Elements: elements}, nil
+
+	case *String:
+		runes := []rune(obj.Value)
+		from, to, err := sliceBounds(len(runes), start, end)
+		if err != nil {
+			return nil, err
+		}
+		return &String{Value: string(runes[from:to])}, nil
+
+	default:
+		return nil, fmt.Errorf("slice operator not supported: %s", obj.Type())
+	}
+}
+
+// sliceBounds resolves the bounds of a slice of something of length n to
+// indices with 0 <= from <= to <= n.
+func sliceBounds(n int, start, end Object) (from, to int, err error) {
+	from, err = sliceBound(n, start, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err = sliceBound(n, end, n)
+	if err != nil {
+		return 0, 0, err
+	}
+	if to < from {
+		to = from
+	}
+	return from, to, nil
+}
+
+func sliceBound(n int, bound Object, omitted int) (int, error) {
+	if bound == nil || bound == NULL {
+		return omitted, nil
+	}
+
+	i, ok := bound.(*Integer)
+	if !ok {
+		return 0, fmt.Errorf("slice index must be INTEGER, got %s", bound.Type())
+	}
+
+	idx := i.Value
+	if idx < 0 {
+		idx += int64(n)
+	}
+	switch {
+	case idx < 0:
+		return 0, nil
+	case idx > int64(n):
+		return n, nil
+	}
+	return int(idx), nil
+}
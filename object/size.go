@@ -0,0 +1,44 @@
+package object
+
+// Size approximates the memory obj takes up, roughly in machine words: one
+// for an array, hash or string, plus one for every element of the array,
+// pair of the hash or eight bytes of the string. The values an array or
+// hash holds are not included, as they have sizes of their own. Other
+// values have no size: they are small, and a program can only hold many
+// of them in arrays and hashes. The evaluator and the VM count the sizes
+// of the values a program creates against its memory limit.
+func Size(obj Object) int {
+	switch obj := obj.(type) {
+	case *Array:
+		return 1 + len(obj.Elements)
+	case *Hash:
+		return 1 + len(obj.Pairs)
+	case *String:
+		return 1 + len(obj.Value)/8
+	default:
+		return 0
+	}
+}
+
+// IsNew reports whether result, returned by a builtin called with args,
+// is a value the builtin created, like the array push returns, rather
+// than one of its arguments or an element of one, like first returns.
+func IsNew(result Object, args []Object) bool {
+	if Size(result) == 0 {
+		return false
+	}
+
+	for _, arg := range args {
+		if result == arg {
+			return false
+		}
+		if arr, ok := arg.(*Array); ok {
+			for _, el := range arr.Elements {
+				if result == el {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
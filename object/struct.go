@@ -0,0 +1,58 @@
+package object
+
+import (
+	"bytes"
+	"strings"
+)
+
+// StructType is made by a struct expression such as `struct { name, age }`.
+// Calling it with one argument per field builds an Instance. Name is the
+// name the type was first bound to, and tags its instances.
+type StructType struct {
+	Name   string
+	Fields []string
+}
+
+func (st *StructType) Type() ObjectType { return STRUCT_TYPE_OBJ }
+func (st *StructType) Inspect() string {
+	var out bytes.Buffer
+
+	out.WriteString("struct ")
+	if st.Name != "" {
+		out.WriteString(st.Name + " ")
+	}
+	out.WriteString("{")
+	out.WriteString(strings.Join(st.Fields, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// TypeName returns the name of the struct type, or "struct" for one that
+// was never bound to a name.
+func (st *StructType) TypeName() string {
+	if st.Name == "" {
+		return "struct"
+	}
+	return st.Name
+}
+
+// Instance is a value built by a StructType. Its fields cannot be
+// changed once it is built.
+type Instance struct {
+	Struct *StructType
+	Values []Object // in the order of Struct.Fields
+}
+
+func (in *Instance) Type() ObjectType { return STRUCT_OBJ }
+func (in *Instance) Inspect() string  { return inspect(in) }
+
+// Field returns the value of the named field.
+func (in *Instance) Field(name string) (Object, bool) {
+	for i, field := range in.Struct.Fields {
+		if field == name {
+			return in.Values[i], true
+		}
+	}
+	return nil, false
+}
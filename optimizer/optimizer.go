@@ -0,0 +1,263 @@
+// Package optimizer rewrites Monkey syntax trees into cheaper equivalents
+// before they are evaluated or compiled.
+//
+// Optimize folds operators applied to literals, like `2 * 3 + 4`, into a
+// single literal and drops the branch of an if expression that can never
+// run because its condition is a literal. Folding uses the evaluator
+// itself, so folded values are exactly what the program would compute at
+// run time; expressions that fail, like `1 / 0`, are left for run time to
+// report.
+package optimizer
+
+import (
+	"math"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/token"
+	"strconv"
+	"strings"
+)
+
+// Optimize rewrites program in place and returns it.
+func Optimize(program *ast.Program) *ast.Program {
+	program.Statements = optimizeStatements(program.Statements)
+	return program
+}
+
+func optimizeStatements(stmts []ast.Statement) []ast.Statement {
+	out := make([]ast.Statement, 0, len(stmts))
+
+	for i, stmt := range stmts {
+		stmt = optimizeStatement(stmt)
+		last := i == len(stmts)-1
+
+		// an if whose condition is a literal is replaced by the branch
+		// it takes. The last statement of a list is its value, so it is
+		// only replaced when the branch ends in an expression giving the
+		// same value.
+		if es, ok := stmt.(*ast.ExpressionStatement); ok {
+			if ie, ok := es.Expression.(*ast.IfExpression); ok {
+				if live, ok := liveBranch(ie); ok {
+					if live == nil && !last {
+						continue
+					}
+					if live != nil && (!last || endsInExpression(live)) {
+						out = append(out, live.Statements...)
+						continue
+					}
+				}
+			}
+		}
+
+		out = append(out, stmt)
+	}
+
+	return out
+}
+
+func optimizeStatement(stmt ast.Statement) ast.Statement {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		stmt.Value = optimizeExpression(stmt.Value)
+
+	case *ast.ReturnStatement:
+		stmt.ReturnValue = optimizeExpression(stmt.ReturnValue)
+
+	case *ast.ExpressionStatement:
+		stmt.Expression = optimizeExpression(stmt.Expression)
+
+	case *ast.ForInStatement:
+		stmt.Iterable = optimizeExpression(stmt.Iterable)
+		optimizeBlock(stmt.Body)
+
+	case *ast.BlockStatement:
+		optimizeBlock(stmt)
+	}
+
+	return stmt
+}
+
+func optimizeBlock(block *ast.BlockStatement) {
+	if block != nil {
+		block.Statements = optimizeStatements(block.Statements)
+	}
+}
+
+func optimizeExpression(exp ast.Expression) ast.Expression {
+	switch exp := exp.(type) {
+	case *ast.PrefixExpression:
+		exp.Right = optimizeExpression(exp.Right)
+		if isLiteral(exp.Right) {
+			return fold(exp, exp.Token)
+		}
+
+	case *ast.InfixExpression:
+		exp.Left = optimizeExpression(exp.Left)
+		exp.Right = optimizeExpression(exp.Right)
+		if isLiteral(exp.Left) && isLiteral(exp.Right) {
+			return fold(exp, exp.Token)
+		}
+
+	case *ast.IfExpression:
+		exp.Condition = optimizeExpression(exp.Condition)
+		optimizeBlock(exp.Consequence)
+		optimizeBlock(exp.Alternative)
+
+		// a branch of a single expression can stand in for the whole if
+		if live, ok := liveBranch(exp); ok && live != nil && len(live.Statements) == 1 {
+			if es, ok := live.Statements[0].(*ast.ExpressionStatement); ok {
+				return es.Expression
+			}
+		}
+
+	case *ast.TryExpression:
+		optimizeBlock(exp.Block)
+		optimizeBlock(exp.Handler)
+
+	case *ast.MatchExpression:
+		exp.Subject = optimizeExpression(exp.Subject)
+		for i := range exp.Arms {
+			if exp.Arms[i].Pattern != nil {
+				exp.Arms[i].Pattern = optimizeExpression(exp.Arms[i].Pattern)
+			}
+			exp.Arms[i].Body = optimizeExpression(exp.Arms[i].Body)
+		}
+
+	case *ast.TemplateLiteral:
+		optimizeExpressions(exp.Parts)
+
+	case *ast.AssignExpression:
+		exp.Value = optimizeExpression(exp.Value)
+
+	case *ast.FunctionLiteral:
+		optimizeBlock(exp.Body)
+
+	case *ast.CallExpression:
+		exp.Function = optimizeExpression(exp.Function)
+		optimizeExpressions(exp.Arguments)
+
+	case *ast.MethodCallExpression:
+		exp.Receiver = optimizeExpression(exp.Receiver)
+		optimizeExpressions(exp.Arguments)
+
+	case *ast.SpreadExpression:
+		exp.Value = optimizeExpression(exp.Value)
+
+	case *ast.FieldExpression:
+		exp.Receiver = optimizeExpression(exp.Receiver)
+
+	case *ast.SpawnExpression:
+		exp.Function = optimizeExpression(exp.Function)
+
+	case *ast.ImportExpression:
+		exp.Path = optimizeExpression(exp.Path)
+
+	case *ast.ArrayLiteral:
+		optimizeExpressions(exp.Elements)
+
+	case *ast.IndexExpression:
+		exp.Left = optimizeExpression(exp.Left)
+		exp.Index = optimizeExpression(exp.Index)
+
+	case *ast.IndexAssignExpression:
+		exp.Left = optimizeExpression(exp.Left)
+		exp.Index = optimizeExpression(exp.Index)
+		exp.Value = optimizeExpression(exp.Value)
+
+	case *ast.SliceExpression:
+		exp.Left = optimizeExpression(exp.Left)
+		if exp.Start != nil {
+			exp.Start = optimizeExpression(exp.Start)
+		}
+		if exp.End != nil {
+			exp.End = optimizeExpression(exp.End)
+		}
+
+	case *ast.HashLiteral:
+		for i := range exp.Pairs {
+			exp.Pairs[i].Key = optimizeExpression(exp.Pairs[i].Key)
+			exp.Pairs[i].Value = optimizeExpression(exp.Pairs[i].Value)
+		}
+	}
+
+	return exp
+}
+
+func optimizeExpressions(exps []ast.Expression) {
+	for i, exp := range exps {
+		exps[i] = optimizeExpression(exp)
+	}
+}
+
+// liveBranch returns the branch ie takes when its condition is a literal,
+// which is nil for a false condition without an else branch. ok is false
+// when the condition is not known before run time.
+func liveBranch(ie *ast.IfExpression) (live *ast.BlockStatement, ok bool) {
+	if !isLiteral(ie.Condition) {
+		return nil, false
+	}
+
+	if b, isBool := ie.Condition.(*ast.Boolean); isBool && !b.Value {
+		return ie.Alternative, true
+	}
+	return ie.Consequence, true
+}
+
+func endsInExpression(block *ast.BlockStatement) bool {
+	if len(block.Statements) == 0 {
+		return false
+	}
+	_, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement)
+	return ok
+}
+
+func isLiteral(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean:
+		return true
+	default:
+		return false
+	}
+}
+
+// fold evaluates exp, whose operands are all literals, and returns the
+// result as a literal positioned at tok. exp is returned unchanged when
+// evaluating it fails or gives a value no literal can hold.
+func fold(exp ast.Expression, tok token.Token) ast.Expression {
+	result := evaluator.Eval(exp, object.NewEnvironment())
+
+	switch result := result.(type) {
+	case *object.Integer:
+		tok.Type = token.INT
+		tok.Literal = strconv.FormatInt(result.Value, 10)
+		return &ast.IntegerLiteral{Token: tok, Value: result.Value}
+
+	case *object.Float:
+		if math.IsInf(result.Value, 0) || math.IsNaN(result.Value) {
+			return exp
+		}
+		tok.Type = token.FLOAT
+		tok.Literal = strconv.FormatFloat(result.Value, 'f', -1, 64)
+		if !strings.Contains(tok.Literal, ".") {
+			tok.Literal += ".0"
+		}
+		return &ast.FloatLiteral{Token: tok, Value: result.Value}
+
+	case *object.String:
+		tok.Type = token.STRING
+		tok.Literal = result.Value
+		return &ast.StringLiteral{Token: tok, Value: result.Value}
+
+	case *object.Boolean:
+		tok.Type = token.TRUE
+		tok.Literal = "true"
+		if !result.Value {
+			tok.Type = token.FALSE
+			tok.Literal = "false"
+		}
+		return &ast.Boolean{Token: tok, Value: result.Value}
+	}
+
+	return exp
+}
@@ -0,0 +1,109 @@
+package optimizer
+
+import (
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2 * 3 + 4", "10"},
+		{"let x = -(1 + 2) * 4;", "let x = -12;"},
+		{"10 / 4", "2"},
+		{"1.5 * 2", "3.0"},
+		{"2 ** -1", "0.5"},
+		{`"foo" + "bar"`, "foobar"},
+		{"1 < 2 == true", "true"},
+		{"!true || false", "false"},
+		{"x + 1 * 2", "(x + 2)"},
+		// failures are left for run time to report
+		{"1 / 0", "(1 / 0)"},
+		{`1 + "a"`, `(1 + a)`},
+		{"let x = if (1 > 2) { 10 } else { 20 };", "let x = 20;"},
+		{"let x = if (true) { let y = 1; y };", "let x = iftrue let y = 1;y;"},
+		{"if (false) { x }; y", "y"},
+		{"if (true) { x; y }; z", "xyz"},
+		{"if (false) { x } else { y; z }", "yz"},
+		// a final if without the branch it takes still gives null
+		{"if (false) { x }", "iffalse x"},
+		{"if (x) { 1 + 1 } else { 2 * 2 }", "ifx 2else 4"},
+		{"fn() { return 2 * 21; }", "fn() return 42;"},
+		{"[1 + 1, {2 - 1: 3 * 3}[4 / 4]]", "[2, ({1:9}[1])]"},
+		{"for (x in [1, 2]) { if (false) { continue } x }", "for (x in [1, 2]) x"},
+	}
+
+	for _, tt := range tests {
+		program := Optimize(parse(t, tt.input))
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q",
+				tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestOptimizePreservesResults(t *testing.T) {
+	tests := []string{
+		"2 * 3 + 4 - 10 / 3",
+		"let f = fn(n) { if (true) { n * (2 + 3) } else { 0 } }; f(2)",
+		"let x = 1; if (false) { x = 2 }; x",
+		"let s = 0; for (i in [1, 2, 3]) { if (1 > 2) { continue } s = s + i }; s",
+		`if ("a" < "b") { "yes" }`,
+		"if (false) { 1 }",
+	}
+
+	for _, input := range tests {
+		want := evaluator.Eval(parse(t, input), object.NewEnvironment())
+		got := evaluator.Eval(Optimize(parse(t, input)), object.NewEnvironment())
+
+		if got.Inspect() != want.Inspect() {
+			t.Errorf("optimizing %q changed its result. want=%s, got=%s",
+				input, want.Inspect(), got.Inspect())
+		}
+	}
+}
+
+func TestOptimizeShrinksBytecode(t *testing.T) {
+	tests := []string{
+		"2 * 3 + 4",
+		`let greeting = "hello" + ", " + "world";`,
+		"if (true) { 10 } else { 20 }; 3333;",
+		"let x = if (1 < 2) { 1 } else { 2 };",
+		"let a = 2; if (false) { a }; a * (60 * 60)",
+	}
+
+	for _, input := range tests {
+		before := compile(t, parse(t, input))
+		after := compile(t, Optimize(parse(t, input)))
+
+		if len(after.Instructions) >= len(before.Instructions) {
+			t.Errorf("instructions for %q did not shrink. before=\n%s\nafter=\n%s",
+				input, before.Disassemble(), after.Disassemble())
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func compile(t *testing.T, program *ast.Program) *compiler.Bytecode {
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return comp.Bytecode()
+}
@@ -0,0 +1,62 @@
+package monkey
+
+// Options is the policy a script runs under: what it may reach outside
+// of itself. The zero Options is a sandbox for untrusted scripts, which
+// can compute and use the streams set with SetStdout, SetStderr and
+// SetStdin, but not touch files, the network, the environment or other
+// processes; its resource ceilings are off, and hosts should set them
+// too. Builtins that need a denied capability fail with a runtime
+// error naming it, like "`readFile` is not allowed: file system access
+// is disabled".
+type Options struct {
+	// AllowFS lets builtins like readFile and writeFile use the file
+	// system, and import load modules from it. Without it, only the
+	// standard library modules under "std/" can be imported.
+	AllowFS bool
+
+	// AllowNet lets builtins use the network. None of the standard
+	// builtins do; hosts pass it on to the ones they register, which see
+	// it as object.Runtime's AllowNet.
+	AllowNet bool
+
+	// AllowEnv lets env read environment variables.
+	AllowEnv bool
+
+	// AllowExec lets exec run commands.
+	AllowExec bool
+
+	// AllowExit lets exit stop the script, which Run then reports as an
+	// *ExitError.
+	AllowExit bool
+
+	// MaxSteps limits each Run to evaluating that many syntax tree nodes
+	// on the evaluator, or executing that many instructions on the VM,
+	// after which it fails with an "execution budget exceeded" error. Zero
+	// means no limit.
+	MaxSteps int
+
+	// MaxMemObjects limits the size of the arrays, hashes and strings each
+	// Run creates, as measured by object.Size, after which it fails with a
+	// "memory limit exceeded" error. Values are counted when they are
+	// created, and never discounted when they are no longer used. Zero
+	// means no limit.
+	MaxMemObjects int
+}
+
+// NewWithOptions creates an empty script that runs on the given engine
+// under options. It panics on an unknown engine.
+func NewWithOptions(engine string, options Options) *Script {
+	s := NewWithEngine(engine)
+	s.options = options
+	return s
+}
+
+// SetOptions replaces the policy the script runs under from its next Run.
+func (s *Script) SetOptions(options Options) {
+	s.options = options
+}
+
+// Options returns the policy the script runs under.
+func (s *Script) Options() Options {
+	return s.options
+}
@@ -0,0 +1,54 @@
+package parser
+
+import "monkey/ast"
+
+// Option configures a Parser created by New.
+type Option func(*Parser)
+
+// WithArena makes the parser allocate its most common nodes in slabs of
+// slabSize nodes instead of one at a time. Large programs then cost the
+// garbage collector far fewer objects to track, at the price of keeping
+// a whole slab alive for as long as any node in it is reachable. It suits
+// tools that parse a program and keep its whole tree.
+func WithArena(slabSize int) Option {
+	return func(p *Parser) {
+		p.arena.slabSize = slabSize
+	}
+}
+
+// arena holds a partly used slab for each node type the parser allocates
+// in bulk. Its zero value allocates every node separately.
+type arena struct {
+	slabSize int
+
+	identifiers slab[ast.Identifier]
+	integers    slab[ast.IntegerLiteral]
+	floats      slab[ast.FloatLiteral]
+	strings     slab[ast.StringLiteral]
+	booleans    slab[ast.Boolean]
+	prefixes    slab[ast.PrefixExpression]
+	infixes     slab[ast.InfixExpression]
+	calls       slab[ast.CallExpression]
+	expressions slab[ast.ExpressionStatement]
+	lets        slab[ast.LetStatement]
+	blocks      slab[ast.BlockStatement]
+}
+
+// slab is the unused rest of a block of nodes.
+type slab[T any] []T
+
+// newNode returns a zeroed T taken from free, which is refilled with a
+// new slab when it runs out. Without an arena, when slabSize is zero, the
+// node is allocated on its own.
+func newNode[T any](slabSize int, free *slab[T]) *T {
+	if slabSize <= 0 {
+		return new(T)
+	}
+
+	if len(*free) == 0 {
+		*free = make([]T, slabSize)
+	}
+	node := &(*free)[0]
+	*free = (*free)[1:]
+	return node
+}
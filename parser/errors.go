@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/token"
+	"strings"
+)
+
+// ParseError describes a single syntax error found by the parser.
+type ParseError struct {
+	Line   int
+	Column int
+
+	// Token is the token the parser choked on.
+	Token token.Token
+	// Expected lists the token types that would have been accepted at
+	// this point, if the parser knows them.
+	Expected []token.TokenType
+
+	Message string
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("%s at line %d, column %d", e.Message, e.Line, e.Column)
+}
+
+// Render formats the error together with the offending line of source
+// and a caret pointing at the error's column:
+//
+//	2:15: expected next token to be ')', got ';' instead
+//	    let b = (1 + 2;
+//	                  ^
+func (e ParseError) Render(source string) string {
+	var out bytes.Buffer
+
+	fmt.Fprintf(&out, "%d:%d: %s\n", e.Line, e.Column, e.Message)
+
+	lines := strings.Split(source, "\n")
+	if e.Line < 1 || e.Line > len(lines) {
+		return out.String()
+	}
+
+	line := strings.TrimRight(lines[e.Line-1], "\r")
+	out.WriteString("    " + line + "\n")
+	out.WriteString("    ")
+	for i, ch := range []rune(line) {
+		if i >= e.Column-1 {
+			break
+		}
+		// keep tabs so the caret lines up with the source line
+		if ch == '\t' {
+			out.WriteByte('\t')
+		} else {
+			out.WriteByte(' ')
+		}
+	}
+	out.WriteString("^\n")
+
+	return out.String()
+}
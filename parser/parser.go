@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"math"
 	"monkey/ast"
 	"monkey/lexer"
 	"monkey/token"
@@ -9,69 +10,88 @@ import (
 )
 
 type (
-	prefixParseFn func() ast.Expression
-	infixParseFn  func(ast.Expression) ast.Expression
+	prefixParseFn func(*Parser) ast.Expression
+	infixParseFn  func(*Parser, ast.Expression) ast.Expression
 )
 
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // x = y
+	COALESCE    // x ?? y
+	LOGICAL_OR  // ||
+	LOGICAL_AND // &&
 	EQUALS      // ==
 	LESSGREATER // < >
+	RANGE       // a..b
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !x
+	POWER       // **
 	CALL        // function(x)
+	INDEX       // array[index]
 )
 
-var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
+// precedence returns the binding power of t as an infix operator, or
+// LOWEST for tokens that don't continue an expression.
+func precedence(t token.TokenType) int {
+	switch t {
+	case token.ASSIGN, token.PLUS_ASSIGN, token.MINUS_ASSIGN, token.ASTERISK_ASSIGN,
+		token.SLASH_ASSIGN:
+		return ASSIGN
+	case token.NULLISH:
+		return COALESCE
+	case token.OR:
+		return LOGICAL_OR
+	case token.AND:
+		return LOGICAL_AND
+	case token.EQ, token.NOT_EQ:
+		return EQUALS
+	case token.LT, token.GT, token.LT_EQ, token.GT_EQ:
+		return LESSGREATER
+	case token.DOTDOT:
+		return RANGE
+	case token.PLUS, token.MINUS:
+		return SUM
+	case token.SLASH, token.ASTERISK, token.PERCENT:
+		return PRODUCT
+	case token.POWER:
+		return POWER
+	case token.LPAREN:
+		return CALL
+	case token.LBRACKET, token.DOT, token.OPTIONAL_DOT:
+		return INDEX
+	}
+	return LOWEST
 }
 
 type Parser struct {
 	l      *lexer.Lexer
-	errors []string
-
-	currentToken token.Token
-	peekToken    token.Token
-
-	prefixParseFns map[token.TokenType]prefixParseFn
-	infixParseFns  map[token.TokenType]infixParseFn
-}
+	errors []ParseError
 
-func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	// synchronizing is set when an error was reported and the parser has
+	// not yet skipped to the next statement boundary.
+	synchronizing bool
 
-	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
+	// blockDepth counts the blocks enclosing the current statement, so
+	// that synchronize only stops at a '}' that can end one.
+	blockDepth int
 
-	p.registerPrefix(token.IDENT, p.parseIdentifier)
-	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	// loopDepth counts the loops enclosing the current statement within
+	// the current function, to reject break and continue outside of them.
+	loopDepth int
 
-	p.registerPrefix(token.BANG, p.parsePrefixExpression)
-	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
-
-	p.registerPrefix(token.TRUE, p.parseBoolean)
-	p.registerPrefix(token.FALSE, p.parseBoolean)
-
-	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
+	currentToken token.Token
+	peekToken    token.Token
 
-	p.infixParseFns = make(map[token.TokenType]infixParseFn)
+	arena arena
+}
 
-	p.registerInfix(token.PLUS, p.parseInfixExpression)
-	p.registerInfix(token.MINUS, p.parseInfixExpression)
-	p.registerInfix(token.SLASH, p.parseInfixExpression)
-	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
-	p.registerInfix(token.EQ, p.parseInfixExpression)
-	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
-	p.registerInfix(token.LT, p.parseInfixExpression)
-	p.registerInfix(token.GT, p.parseInfixExpression)
+func New(l *lexer.Lexer, opts ...Option) *Parser {
+	p := &Parser{l: l, errors: []ParseError{}}
+	for _, opt := range opts {
+		opt(p)
+	}
 
 	p.NextToken()
 	p.NextToken()
@@ -79,7 +99,7 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() []ParseError {
 	return p.errors
 }
 
@@ -89,7 +109,7 @@ func (p *Parser) NextToken() {
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
-	program := &ast.Program{}
+	program := &ast.Program{Source: p.l.Input()}
 	program.Statements = []ast.Statement{}
 
 	for p.currentToken.Type != token.EOF {
@@ -97,71 +117,182 @@ func (p *Parser) ParseProgram() *ast.Program {
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
+		p.synchronize()
 		p.NextToken()
 	}
 
 	return program
 }
 
-func (p *Parser) registerPrefix(
-	tokenType token.TokenType,
-	fn prefixParseFn,
-) {
-	p.prefixParseFns[tokenType] = fn
+// prefixParseFnFor returns the function that parses an expression
+// starting with a token of type t, or nil if no expression can start with
+// one. Dispatching with a switch instead of a map keeps the lookup cheap
+// and spares every parser from building its own table.
+func prefixParseFnFor(t token.TokenType) prefixParseFn {
+	switch t {
+	case token.IDENT:
+		return (*Parser).parseIdentifier
+	case token.INT:
+		return (*Parser).parseIntegerLiteral
+	case token.FLOAT:
+		return (*Parser).parseFloatLiteral
+	case token.STRING:
+		return (*Parser).parseStringLiteral
+	case token.TEMPLATE:
+		return (*Parser).parseTemplateLiteral
+	case token.BANG, token.MINUS:
+		return (*Parser).parsePrefixExpression
+	case token.TRUE, token.FALSE:
+		return (*Parser).parseBoolean
+	case token.LPAREN:
+		return (*Parser).parseGroupedExpression
+	case token.IF:
+		return (*Parser).parseIfExpression
+	case token.TRY:
+		return (*Parser).parseTryExpression
+	case token.MATCH:
+		return (*Parser).parseMatchExpression
+	case token.SPAWN:
+		return (*Parser).parseSpawnExpression
+	case token.STRUCT:
+		return (*Parser).parseStructLiteral
+	case token.FUNCTION:
+		return (*Parser).parseFunctionLiteral
+	case token.IMPORT:
+		return (*Parser).parseImportExpression
+	case token.LBRACKET:
+		return (*Parser).parseArrayLiteral
+	case token.LBRACE:
+		return (*Parser).parseHashLiteral
+	}
+	return nil
 }
 
-func (p *Parser) registerInfix(
-	tokenType token.TokenType,
-	fn infixParseFn,
-) {
-	p.infixParseFns[tokenType] = fn
+// infixParseFnFor returns the function that parses an operator of type t
+// and its right-hand side, or nil if t is not an infix operator.
+func infixParseFnFor(t token.TokenType) infixParseFn {
+	switch t {
+	case token.PLUS, token.MINUS, token.SLASH, token.ASTERISK, token.PERCENT, token.POWER,
+		token.EQ, token.NOT_EQ, token.LT, token.GT, token.LT_EQ, token.GT_EQ,
+		token.AND, token.OR, token.NULLISH, token.DOTDOT:
+		return (*Parser).parseInfixExpression
+	case token.ASSIGN, token.PLUS_ASSIGN, token.MINUS_ASSIGN, token.ASTERISK_ASSIGN,
+		token.SLASH_ASSIGN:
+		return (*Parser).parseAssignExpression
+	case token.LPAREN:
+		return (*Parser).parseCallExpression
+	case token.LBRACKET:
+		return (*Parser).parseIndexExpression
+	case token.DOT, token.OPTIONAL_DOT:
+		return (*Parser).parseDotExpression
+	}
+	return nil
 }
 
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.currentToken.Type {
-	case token.LET:
-		return p.parseLetStatement()
+	case token.LET, token.CONST:
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.FOR:
+		if stmt := p.parseForInStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case token.BREAK, token.CONTINUE:
+		return p.parseLoopControlStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
-	return &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	return p.newIdentifier()
+}
+
+// newIdentifier returns an identifier for the current token.
+func (p *Parser) newIdentifier() *ast.Identifier {
+	ident := newNode(p.arena.slabSize, &p.arena.identifiers)
+	*ident = ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	return ident
 }
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
-	stmt := &ast.LetStatement{Token: p.currentToken}
+	stmt := newNode(p.arena.slabSize, &p.arena.lets)
+	stmt.Token = p.currentToken
 
-	if !p.expectPeek(token.IDENT) {
-		return nil
-	}
+	if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+		p.NextToken()
+		stmt.Pattern = p.parseDestructurePattern()
+		if stmt.Pattern == nil {
+			return nil
+		}
+	} else {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
 
-	stmt.Name = &ast.Identifier{
-		Token: p.currentToken,
-		Value: p.currentToken.Literal}
+		stmt.Name = p.newIdentifier()
+	}
 
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
 
-	// TODO: Skipping expressions until semicolon
-	for !p.currTokenIs(token.SEMICOLON) {
+	p.NextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.NextToken()
 	}
 
 	return stmt
 }
 
+// parseDestructurePattern parses the names of `let [a, b]` or
+// `let {a, b}`, starting on the opening bracket.
+func (p *Parser) parseDestructurePattern() *ast.DestructurePattern {
+	pattern := &ast.DestructurePattern{Token: p.currentToken}
+
+	var end token.TokenType = token.RBRACKET
+	if pattern.IsHash() {
+		end = token.RBRACE
+	}
+
+	pattern.Names, _ = p.parseIdentifierList(end, "names", false)
+	if pattern.Names == nil {
+		return nil
+	}
+	if len(pattern.Names) == 0 {
+		p.addError(pattern.Token, "destructuring pattern binds no names")
+		return nil
+	}
+
+	return pattern
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.currentToken}
 
+	// a bare `return` leaves ReturnValue nil
+	switch p.peekToken.Type {
+	case token.SEMICOLON:
+		p.NextToken()
+		return stmt
+	case token.RBRACE, token.EOF:
+		return stmt
+	}
+
 	p.NextToken()
 
-	// TODO: Skipping expressions until semicolon
-	for !p.currTokenIs(token.SEMICOLON) {
+	stmt.ReturnValue = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.NextToken()
 	}
 
@@ -169,7 +300,8 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 }
 
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
-	stmt := &ast.ExpressionStatement{Token: p.currentToken}
+	stmt := newNode(p.arena.slabSize, &p.arena.expressions)
+	stmt.Token = p.currentToken
 
 	stmt.Expression = p.parseExpression(LOWEST)
 
@@ -181,45 +313,132 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
-	prefix := p.prefixParseFns[p.currentToken.Type]
+	prefix := prefixParseFnFor(p.currentToken.Type)
 	if prefix == nil {
 		p.noPrefixParseFnError(p.currentToken.Type)
 		return nil
 	}
-	leftExp := prefix()
+	leftExp := prefix(p)
 
-	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
-		infix := p.infixParseFns[p.peekToken.Type]
+	// after an error the operand may be incomplete, so it is not handed to
+	// an operator; synchronize skips the rest of the statement instead
+	for !p.synchronizing && !p.peekTokenIs(token.SEMICOLON) &&
+		precedence < p.peekPrecedence() {
+		infix := infixParseFnFor(p.peekToken.Type)
 		if infix == nil {
 			return leftExp
 		}
 		p.NextToken()
 
-		leftExp = infix(leftExp)
+		leftExp = infix(p, leftExp)
 	}
 	return leftExp
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
-	expression := &ast.PrefixExpression{
-		Token:    p.currentToken,
-		Operator: p.currentToken.Literal,
-	}
+	expression := newNode(p.arena.slabSize, &p.arena.prefixes)
+	expression.Token = p.currentToken
+	expression.Operator = p.currentToken.Literal
 
 	p.NextToken()
 
+	// 9223372036854775808 overflows int64 on its own, so the smallest
+	// integer can only be written as a literal if the minus is taken
+	// as part of it
+	if expression.Operator == "-" && p.currTokenIs(token.INT) &&
+		p.peekPrecedence() <= PREFIX && isMinInt64Magnitude(p.currentToken.Literal) {
+		lit := newNode(p.arena.slabSize, &p.arena.integers)
+		lit.Token = expression.Token
+		lit.Token.Type = token.INT
+		lit.Token.Literal = "-" + p.currentToken.Literal
+		lit.Value = math.MinInt64
+		return lit
+	}
+
 	expression.Right = p.parseExpression(PREFIX)
 	return expression
 }
 
+// splitIntegerLiteral returns the base of an integer literal, its digits
+// without the prefix naming the base and the name of the base.
+func splitIntegerLiteral(literal string) (base int, digits, name string) {
+	if len(literal) > 1 && literal[0] == '0' {
+		switch literal[1] {
+		case 'x', 'X':
+			return 16, literal[2:], "hexadecimal"
+		case 'o', 'O':
+			return 8, literal[2:], "octal"
+		case 'b', 'B':
+			return 2, literal[2:], "binary"
+		}
+	}
+	return 10, literal, "integer"
+}
+
+// isMinInt64Magnitude reports whether the integer literal is 2^63, the
+// magnitude of math.MinInt64.
+func isMinInt64Magnitude(literal string) bool {
+	base, digits, _ := splitIntegerLiteral(literal)
+	value, err := strconv.ParseUint(digits, base, 64)
+	return err == nil && value == 1<<63
+}
+
 func (p *Parser) parseIntegerLiteral() ast.Expression {
-	lit := &ast.IntegerLiteral{Token: p.currentToken}
+	lit := newNode(p.arena.slabSize, &p.arena.integers)
+	lit.Token = p.currentToken
+
+	literal := p.currentToken.Literal
+	base, digits, name := splitIntegerLiteral(literal)
+
+	if digits == "" {
+		msg := fmt.Sprintf("invalid %s literal %q: missing digits", name, literal)
+		p.addError(p.currentToken, msg)
+		return nil
+	}
+
+	for _, ch := range digits {
+		if !isDigitInBase(ch, base) {
+			msg := fmt.Sprintf("invalid %s literal %q: invalid digit %q", name, literal, ch)
+			p.addError(p.currentToken, msg)
+			return nil
+		}
+	}
+
+	value, err := strconv.ParseInt(digits, base, 64)
+
+	if err != nil {
+		// the digits are valid, so the value can only be out of range
+		msg := fmt.Sprintf("integer literal %q overflows int64", literal)
+		p.addError(p.currentToken, msg)
+		return nil
+	}
+
+	lit.Value = value
+
+	return lit
+}
+
+func isDigitInBase(ch rune, base int) bool {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return int(ch-'0') < base
+	case 'a' <= ch && ch <= 'f':
+		return base == 16
+	case 'A' <= ch && ch <= 'F':
+		return base == 16
+	}
+	return false
+}
 
-	value, err := strconv.ParseInt(p.currentToken.Literal, 0, 64)
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := newNode(p.arena.slabSize, &p.arena.floats)
+	lit.Token = p.currentToken
+
+	value, err := strconv.ParseFloat(p.currentToken.Literal, 64)
 
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as IntegerLiteral", p.currentToken.Literal)
-		p.errors = append(p.errors, msg)
+		msg := fmt.Sprintf("could not parse %q as FloatLiteral", p.currentToken.Literal)
+		p.addError(p.currentToken, msg)
 		return nil
 	}
 
@@ -228,25 +447,125 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+func (p *Parser) parseStringLiteral() ast.Expression {
+	lit := newNode(p.arena.slabSize, &p.arena.strings)
+	*lit = ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
+	return lit
+}
+
+// parseTemplateLiteral splits an interpolated string into its text parts
+// and parses each embedded expression with a parser of its own.
+func (p *Parser) parseTemplateLiteral() ast.Expression {
+	tmpl := &ast.TemplateLiteral{Token: p.currentToken}
+
+	for _, part := range lexer.SplitTemplate(p.currentToken) {
+		if !part.IsExpr {
+			tok := token.Token{
+				Type:    token.STRING,
+				Literal: part.Text,
+				Line:    p.currentToken.Line,
+				Column:  p.currentToken.Column,
+			}
+			tmpl.Parts = append(tmpl.Parts, &ast.StringLiteral{Token: tok, Value: part.Text})
+			continue
+		}
+
+		sub := New(lexer.NewAt(part.Text, part.Line, part.Column))
+		exp := sub.parseExpression(LOWEST)
+
+		if len(sub.errors) != 0 {
+			p.errors = append(p.errors, sub.errors...)
+			p.synchronizing = true
+			return nil
+		}
+		if !sub.peekTokenIs(token.EOF) {
+			msg := fmt.Sprintf("unexpected %s in string interpolation", sub.peekToken.Type)
+			p.addError(sub.peekToken, msg)
+			return nil
+		}
+
+		tmpl.Parts = append(tmpl.Parts, exp)
+	}
+
+	return tmpl
+}
+
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
-	expression := &ast.InfixExpression{
+	expression := newNode(p.arena.slabSize, &p.arena.infixes)
+	*expression = ast.InfixExpression{
 		Token:    p.currentToken,
 		Operator: p.currentToken.Literal,
 		Left:     left,
 	}
 
 	precedence := p.curPrecendence()
+	if p.currTokenIs(token.POWER) {
+		// ** is right associative: 2 ** 3 ** 2 is 2 ** (3 ** 2)
+		precedence--
+	}
 	p.NextToken()
 	expression.Right = p.parseExpression(precedence)
 
 	return expression
 }
 
+// compoundOperators maps each compound assignment token to the infix
+// operator it applies before assigning.
+var compoundOperators = map[token.TokenType]string{
+	token.PLUS_ASSIGN:     "+",
+	token.MINUS_ASSIGN:    "-",
+	token.ASTERISK_ASSIGN: "*",
+	token.SLASH_ASSIGN:    "/",
+}
+
+// parseAssignExpression parses `name = value` and `left[index] = value`.
+// Assignment is right associative, so `a = b = 1` assigns 1 to both a
+// and b. A compound assignment like `x += 1` is desugared to `x = x + 1`,
+// which evaluates the target twice.
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	switch left.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		msg := fmt.Sprintf("cannot assign to %s", left.String())
+		p.addError(p.currentToken, msg)
+		return nil
+	}
+
+	tok := p.currentToken
+	tok.Type, tok.Literal = token.ASSIGN, "="
+	operatorTok := p.currentToken
+
+	p.NextToken()
+	value := p.parseExpression(ASSIGN - 1)
+
+	if operator, ok := compoundOperators[operatorTok.Type]; ok {
+		operatorTok.Type, operatorTok.Literal = token.TokenType(operator), operator
+		value = &ast.InfixExpression{
+			Token:    operatorTok,
+			Left:     left,
+			Operator: operator,
+			Right:    value,
+		}
+	}
+
+	if target, ok := left.(*ast.IndexExpression); ok {
+		return &ast.IndexAssignExpression{
+			Token: tok,
+			Left:  target.Left,
+			Index: target.Index,
+			Value: value,
+		}
+	}
+	return &ast.AssignExpression{Token: tok, Name: left.(*ast.Identifier), Value: value}
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
-	return &ast.Boolean{
+	boolean := newNode(p.arena.slabSize, &p.arena.booleans)
+	*boolean = ast.Boolean{
 		Token: p.currentToken,
 		Value: p.currTokenIs(token.TRUE),
 	}
+	return boolean
 }
 
 func (p *Parser) parseGroupedExpression() ast.Expression {
@@ -260,9 +579,577 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 	return exp
 }
 
+func (p *Parser) parseStructLiteral() ast.Expression {
+	lit := &ast.StructLiteral{Token: p.currentToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	lit.Fields, _ = p.parseIdentifierList(token.RBRACE, "fields", false)
+	if lit.Fields == nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for _, field := range lit.Fields {
+		if seen[field.Value] {
+			p.addError(field.Token, "duplicate field name: "+field.Value)
+			return nil
+		}
+		seen[field.Value] = true
+	}
+
+	return lit
+}
+
+func (p *Parser) parseSpawnExpression() ast.Expression {
+	exp := &ast.SpawnExpression{Token: p.currentToken}
+
+	p.NextToken()
+	exp.Function = p.parseExpression(PREFIX)
+
+	return exp
+}
+
+func (p *Parser) parseImportExpression() ast.Expression {
+	expression := &ast.ImportExpression{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.NextToken()
+	expression.Path = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return expression
+}
+
+func (p *Parser) parseIfExpression() ast.Expression {
+	expression := &ast.IfExpression{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.NextToken()
+	expression.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Consequence = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.ELSE) {
+		p.NextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expression.Alternative = p.parseBlockStatement()
+	}
+
+	return expression
+}
+
+// WILDCARD is the pattern of the match arm that matches any value.
+const WILDCARD = "_"
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.NextToken()
+	expression.Subject = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	wildcard := false
+	for !p.peekTokenIs(token.RBRACE) {
+		p.NextToken()
+
+		if wildcard {
+			p.addError(p.currentToken, "unreachable match arm after "+WILDCARD)
+			return nil
+		}
+
+		arm := ast.MatchArm{}
+		if p.currTokenIs(token.IDENT) && p.currentToken.Literal == WILDCARD {
+			wildcard = true
+		} else {
+			arm.Pattern = p.parseExpression(LOWEST)
+		}
+
+		if !p.expectPeek(token.ARROW) {
+			return nil
+		}
+		p.NextToken()
+		arm.Body = p.parseExpression(LOWEST)
+
+		expression.Arms = append(expression.Arms, arm)
+
+		if p.peekTokenIs(token.RBRACE) {
+			break
+		}
+		if prefixParseFnFor(p.peekToken.Type) != nil {
+			p.addError(p.peekToken, "missing comma between arms", token.COMMA, token.RBRACE)
+			return nil
+		}
+		if !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return expression
+}
+
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.currentToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Block = p.parseBlockStatement()
+
+	if !p.expectPeek(token.CATCH) {
+		return nil
+	}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	expression.Param = p.newIdentifier()
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Handler = p.parseBlockStatement()
+
+	return expression
+}
+
+func (p *Parser) parseForInStatement() *ast.ForInStatement {
+	stmt := &ast.ForInStatement{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Value = p.newIdentifier()
+
+	if p.peekTokenIs(token.COMMA) {
+		p.NextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Key = stmt.Value
+		stmt.Value = p.newIdentifier()
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.NextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	p.loopDepth++
+	stmt.Body = p.parseBlockStatement()
+	p.loopDepth--
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.NextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	tok := p.currentToken
+
+	if p.loopDepth == 0 {
+		p.addError(tok, fmt.Sprintf("%s outside of loop", tok.Literal))
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.NextToken()
+	}
+
+	if tok.Type == token.BREAK {
+		return &ast.BreakStatement{Token: tok}
+	}
+	return &ast.ContinueStatement{Token: tok}
+}
+
+func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	block := newNode(p.arena.slabSize, &p.arena.blocks)
+	block.Token = p.currentToken
+	block.Statements = []ast.Statement{}
+
+	p.NextToken()
+
+	p.blockDepth++
+	for !p.currTokenIs(token.RBRACE) && !p.currTokenIs(token.EOF) {
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+		p.synchronize()
+		p.NextToken()
+	}
+	p.blockDepth--
+
+	return block
+}
+
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	lit.Parameters, lit.Variadic = p.parseFunctionParameters()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	// a function body starts outside of any loop, even if the function
+	// itself is defined inside one
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	lit.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
+
+	return lit
+}
+
+// parseFunctionParameters parses the parameters of a function literal and
+// reports whether the last one is variadic, as in `fn(x, rest...)`.
+func (p *Parser) parseFunctionParameters() ([]*ast.Identifier, bool) {
+	return p.parseIdentifierList(token.RPAREN, "parameters", true)
+}
+
+// parseIdentifierList is parseExpressionList for lists that may only hold
+// identifiers, such as parameters and destructuring patterns. With
+// allowRest, the last identifier may be followed by '...', which the
+// second result reports.
+func (p *Parser) parseIdentifierList(
+	end token.TokenType,
+	elements string,
+	allowRest bool,
+) ([]*ast.Identifier, bool) {
+	identifiers := []*ast.Identifier{}
+	rest := false
+
+	if p.peekTokenIs(end) {
+		p.NextToken()
+		return identifiers, false
+	}
+
+	for {
+		if rest {
+			p.addError(p.peekToken, "only the last of the "+elements+" can be followed by '...'", end)
+			return nil, false
+		}
+
+		if !p.expectPeek(token.IDENT) {
+			return nil, false
+		}
+
+		ident := p.newIdentifier()
+		identifiers = append(identifiers, ident)
+
+		if allowRest && p.peekTokenIs(token.ELLIPSIS) {
+			p.NextToken()
+			rest = true
+		}
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.NextToken()
+
+		// allow a trailing comma
+		if p.peekTokenIs(end) {
+			break
+		}
+	}
+
+	if !p.expectListEnd(end, elements) {
+		return nil, false
+	}
+
+	return identifiers, rest
+}
+
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	exp := newNode(p.arena.slabSize, &p.arena.calls)
+	*exp = ast.CallExpression{Token: p.currentToken, Function: function}
+	exp.Arguments = p.parseExpressionList(token.RPAREN, "arguments", true)
+	return exp
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.currentToken}
+
+	array.Elements = p.parseExpressionList(token.RBRACKET, "elements", false)
+
+	return array
+}
+
+// parseExpressionList parses a comma separated list of expressions up to
+// and including the end token, which may follow a trailing comma. The
+// expressions are called elements in errors. With allowSpread, the last
+// expression may be followed by '...' to spread it.
+func (p *Parser) parseExpressionList(
+	end token.TokenType,
+	elements string,
+	allowSpread bool,
+) []ast.Expression {
+	list := []ast.Expression{}
+
+	if p.peekTokenIs(end) {
+		p.NextToken()
+		return list
+	}
+
+	for {
+		if len(list) > 0 {
+			if _, ok := list[len(list)-1].(*ast.SpreadExpression); ok {
+				p.addError(p.peekToken, "only the last of the "+elements+" can be followed by '...'", end)
+				return nil
+			}
+		}
+
+		p.NextToken()
+		exp := p.parseExpression(LOWEST)
+		if allowSpread && p.peekTokenIs(token.ELLIPSIS) {
+			p.NextToken()
+			exp = &ast.SpreadExpression{Token: p.currentToken, Value: exp}
+		}
+		list = append(list, exp)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.NextToken()
+
+		// allow a trailing comma
+		if p.peekTokenIs(end) {
+			break
+		}
+	}
+
+	if !p.expectListEnd(end, elements) {
+		return nil
+	}
+
+	return list
+}
+
+// expectListEnd is expectPeek for the end of a list of elements, which
+// points out a missing comma when the next token starts another element.
+func (p *Parser) expectListEnd(end token.TokenType, elements string) bool {
+	if p.peekTokenIs(end) {
+		p.NextToken()
+		return true
+	}
+
+	if prefixParseFnFor(p.peekToken.Type) != nil {
+		p.addError(p.peekToken, "missing comma between "+elements, token.COMMA, end)
+		return false
+	}
+
+	p.peekError(end)
+	return false
+}
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.currentToken}
+	hash.Pairs = []ast.HashPair{}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.NextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.NextToken()
+		value := p.parseExpression(LOWEST)
+
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+
+		if p.peekTokenIs(token.RBRACE) {
+			break
+		}
+		if prefixParseFnFor(p.peekToken.Type) != nil {
+			p.addError(p.peekToken, "missing comma between pairs", token.COMMA, token.RBRACE)
+			return nil
+		}
+		if !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return hash
+}
+
+// parseDotExpression parses `.method(args)` or `.field` after a receiver.
+func (p *Parser) parseDotExpression(receiver ast.Expression) ast.Expression {
+	tok := p.currentToken
+	optional := p.currTokenIs(token.OPTIONAL_DOT)
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	name := p.newIdentifier()
+
+	if !p.peekTokenIs(token.LPAREN) {
+		return &ast.FieldExpression{
+			Token:    tok,
+			Receiver: receiver,
+			Field:    name,
+			Optional: optional,
+		}
+	}
+	p.NextToken()
+
+	return &ast.MethodCallExpression{
+		Token:     tok,
+		Receiver:  receiver,
+		Method:    name,
+		Arguments: p.parseExpressionList(token.RPAREN, "arguments", true),
+		Optional:  optional,
+	}
+}
+
+// parseIndexExpression parses `left[index]`, or a slice such as
+// `left[start:end]` where either bound may be left out.
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	tok := p.currentToken
+
+	var index ast.Expression
+	if !p.peekTokenIs(token.COLON) {
+		p.NextToken()
+		index = p.parseExpression(LOWEST)
+	}
+
+	if !p.peekTokenIs(token.COLON) {
+		if !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+		return &ast.IndexExpression{Token: tok, Left: left, Index: index}
+	}
+	p.NextToken()
+
+	exp := &ast.SliceExpression{Token: tok, Left: left, Start: index}
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.NextToken()
+		exp.End = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return exp
+}
+
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(p.currentToken, msg)
+}
+
+// addError records a syntax error at tok. expected lists the token types
+// that would have been valid instead, if known.
+func (p *Parser) addError(tok token.Token, msg string, expected ...token.TokenType) {
+	// an error while synchronizing is most likely caused by the one
+	// being recovered from, like the outer list of a nested call failing
+	// because the inner one did
+	if p.synchronizing {
+		return
+	}
+
+	p.errors = append(p.errors, ParseError{
+		Line:     tok.Line,
+		Column:   tok.Column,
+		Token:    tok,
+		Expected: expected,
+		Message:  msg,
+	})
+	p.synchronizing = true
+}
+
+// synchronize recovers from a syntax error by skipping tokens up to the
+// next statement boundary, so that a single mistake is reported once
+// instead of cascading into errors for every token that follows it. It
+// stops on a ';', or before a keyword that starts a statement or, inside
+// a block, a '}', so that the enclosing statement loop can carry on from
+// there.
+func (p *Parser) synchronize() {
+	if !p.synchronizing {
+		return
+	}
+	p.synchronizing = false
+
+	for !p.currTokenIs(token.SEMICOLON) && !p.currTokenIs(token.EOF) {
+		switch p.peekToken.Type {
+		case token.RBRACE:
+			if p.blockDepth > 0 {
+				return
+			}
+		case token.LET, token.CONST, token.RETURN, token.FOR,
+			token.BREAK, token.CONTINUE, token.EOF:
+			return
+		}
+		p.NextToken()
+	}
 }
 
 func (p *Parser) currTokenIs(t token.TokenType) bool {
@@ -284,19 +1171,14 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 }
 
 func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
-		return p
-	}
-	return LOWEST
+	return precedence(p.peekToken.Type)
 }
 
 func (p *Parser) curPrecendence() int {
-	if p, ok := precedences[p.currentToken.Type]; ok {
-		return p
-	}
-	return LOWEST
+	return precedence(p.currentToken.Type)
 }
+
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be '%s', got '%s' instea", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	msg := fmt.Sprintf("expected next token to be '%s', got '%s' instead", t, p.peekToken.Type)
+	p.addError(p.peekToken, msg, t)
 }
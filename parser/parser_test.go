@@ -3,50 +3,84 @@ package parser
 import (
 	"fmt"
 	"monkey/ast"
+	"monkey/bench"
 	"monkey/lexer"
+	"monkey/token"
+	"runtime"
+	"strings"
 	"testing"
 )
 
 func TestLetStatements(t *testing.T) {
-	input := `
-let x = 5;
-let y = 10;
-let foobar = 83838;
-`
-
-	program := NewProgram(t, input, 3)
-
 	tests := []struct {
+		input              string
 		expectedIdentifier string
+		expectedValue      interface{}
 	}{
-		{"x"},
-		{"y"},
-		{"foobar"},
+		{"let x = 5;", "x", 5},
+		{"let y = true;", "y", true},
+		{"let foobar = y;", "foobar", "y"},
+		{"let z = 1 + 2", "z", nil},
 	}
 
-	for i, tt := range tests {
-		stmt := program.Statements[i]
+	for _, tt := range tests {
+		program := NewProgram(t, tt.input, 1)
+
+		stmt := program.Statements[0]
 		if !testLetStatement(t, stmt, tt.expectedIdentifier) {
 			return
 		}
+
+		if tt.expectedValue == nil {
+			continue
+		}
+
+		val := stmt.(*ast.LetStatement).Value
+		if !testLiteralExpression(t, val, tt.expectedValue) {
+			return
+		}
 	}
 }
 
-func TestReturnStatement(t *testing.T) {
-	input := `
-return 5;
-return 10;
-return 999325;
-`
+func TestConstStatements(t *testing.T) {
+	program := NewProgram(t, "const answer = 42;", 1)
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.LetStatement. got=%T", program.Statements[0])
+	}
+
+	if !stmt.IsConst() {
+		t.Errorf("stmt.IsConst() is false for a const statement")
+	}
+	if stmt.String() != "const answer = 42;" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+	testLiteralExpression(t, stmt.Value, 42)
 
-	program := NewProgram(t, input, 3)
+	program = NewProgram(t, "let answer = 42;", 1)
+	if program.Statements[0].(*ast.LetStatement).IsConst() {
+		t.Errorf("stmt.IsConst() is true for a let statement")
+	}
+}
 
-	for _, stmt := range program.Statements {
-		returnStmt, ok := stmt.(*ast.ReturnStatement)
+func TestReturnStatement(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedValue interface{}
+	}{
+		{"return 5;", 5},
+		{"return true;", true},
+		{"return foobar;", "foobar"},
+		{"return x + 1", nil},
+	}
 
+	for _, tt := range tests {
+		program := NewProgram(t, tt.input, 1)
+
+		returnStmt, ok := program.Statements[0].(*ast.ReturnStatement)
 		if !ok {
-			t.Errorf("stmt not *ast.ReturnStatement. got %T", stmt)
-			continue
+			t.Fatalf("stmt not *ast.ReturnStatement. got %T", program.Statements[0])
 		}
 
 		if returnStmt.TokenLiteral() != "return" {
@@ -55,8 +89,119 @@ return 999325;
 				returnStmt.TokenLiteral(),
 			)
 		}
+
+		if tt.expectedValue == nil {
+			testInfixExpression(t, returnStmt.ReturnValue, "x", "+", 1)
+			continue
+		}
+
+		if !testLiteralExpression(t, returnStmt.ReturnValue, tt.expectedValue) {
+			return
+		}
+	}
+}
+
+func TestForInStatement(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedKey   string
+		expectedValue string
+	}{
+		{"for (x in items) { x }", "", "x"},
+		{"for (k, v in items) { v }", "k", "v"},
+		{"for (x in items) { x };", "", "x"},
+	}
+
+	for _, tt := range tests {
+		program := NewProgram(t, tt.input, 1)
+
+		stmt, ok := program.Statements[0].(*ast.ForInStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ForInStatement. got=%T", program.Statements[0])
+		}
+
+		if tt.expectedKey == "" {
+			if stmt.Key != nil {
+				t.Errorf("stmt.Key should be nil. got=%s", stmt.Key)
+			}
+		} else {
+			testIdentifier(t, stmt.Key, tt.expectedKey)
+		}
+
+		testIdentifier(t, stmt.Value, tt.expectedValue)
+		testIdentifier(t, stmt.Iterable, "items")
+
+		if len(stmt.Body.Statements) != 1 {
+			t.Fatalf("body is not 1 statement. got=%d", len(stmt.Body.Statements))
+		}
+		body := stmt.Body.Statements[0].(*ast.ExpressionStatement)
+		testIdentifier(t, body.Expression, tt.expectedValue)
+	}
+}
+
+func TestLoopControlStatements(t *testing.T) {
+	program := NewProgram(t, "for (x in items) { break; continue }", 1)
+
+	stmt := program.Statements[0].(*ast.ForInStatement)
+	if len(stmt.Body.Statements) != 2 {
+		t.Fatalf("body is not 2 statements. got=%d", len(stmt.Body.Statements))
+	}
+
+	if _, ok := stmt.Body.Statements[0].(*ast.BreakStatement); !ok {
+		t.Errorf("stmt not *ast.BreakStatement. got=%T", stmt.Body.Statements[0])
+	}
+	if _, ok := stmt.Body.Statements[1].(*ast.ContinueStatement); !ok {
+		t.Errorf("stmt not *ast.ContinueStatement. got=%T", stmt.Body.Statements[1])
+	}
+}
+
+func TestForInStatementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for x in y { x }", "expected next token to be '(', got 'IDENT' instead at line 1, column 5"},
+		{"for (x y) { x }", "expected next token to be 'IN', got 'IDENT' instead at line 1, column 8"},
+		{"for (1 in y) { x }", "expected next token to be 'IDENT', got 'INT' instead at line 1, column 6"},
+		{"break;", "break outside of loop at line 1, column 1"},
+		{"if (x) { continue }", "continue outside of loop at line 1, column 10"},
+		{"for (x in y) { fn() { break } }", "break outside of loop at line 1, column 23"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+
+		if errors[0].Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0].Error())
+		}
 	}
+}
+
+func TestBareReturnStatement(t *testing.T) {
+	for _, input := range []string{"return;", "return", "fn() { return }"} {
+		program := NewProgram(t, input, 1)
 
+		stmt := program.Statements[0]
+		if fn, ok := stmt.(*ast.ExpressionStatement); ok {
+			stmt = fn.Expression.(*ast.FunctionLiteral).Body.Statements[0]
+		}
+
+		returnStmt, ok := stmt.(*ast.ReturnStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ReturnStatement. got %T", stmt)
+		}
+
+		if returnStmt.ReturnValue != nil {
+			t.Errorf("%q: expected no return value, got %s", input, returnStmt.ReturnValue)
+		}
+	}
 }
 
 func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
@@ -111,6 +256,70 @@ func TestIdentifierExpression(t *testing.T) {
 	}
 }
 
+func TestRadixIntegerLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xFF", 255},
+		{"0Xff", 255},
+		{"0o755", 493},
+		{"0b1010", 10},
+		{"010", 10},
+		{"9223372036854775807", 9223372036854775807},
+		{"0x7FFFFFFFFFFFFFFF", 9223372036854775807},
+		// the minus is part of the smallest integer
+		{"-9223372036854775808", -9223372036854775808},
+		{"-0x8000000000000000", -9223372036854775808},
+	}
+
+	for _, tt := range tests {
+		program := NewProgram(t, tt.input, 1)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+
+		if literal.Value != tt.expected {
+			t.Errorf("%q: literal.Value not %d. got=%d", tt.input, tt.expected, literal.Value)
+		}
+	}
+}
+
+func TestMalformedIntegerLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"0x", `invalid hexadecimal literal "0x": missing digits at line 1, column 1`},
+		{"1 + 0b102", `invalid binary literal "0b102": invalid digit '2' at line 1, column 5`},
+		{"0o78", `invalid octal literal "0o78": invalid digit '8' at line 1, column 1`},
+		{"0xFG", `invalid hexadecimal literal "0xFG": invalid digit 'G' at line 1, column 1`},
+		{"0x8000000000000000", `integer literal "0x8000000000000000" overflows int64 at line 1, column 1`},
+		{"9223372036854775808", `integer literal "9223372036854775808" overflows int64 at line 1, column 1`},
+		{"let x = 99999999999999999999;", `integer literal "99999999999999999999" overflows int64 at line 1, column 9`},
+		{"-9223372036854775809", `integer literal "9223372036854775809" overflows int64 at line 1, column 2`},
+		{"-9223372036854775808 ** 2", `integer literal "9223372036854775808" overflows int64 at line 1, column 2`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("%q: expected 1 error, got %d: %q", tt.input, len(errors), errors)
+			continue
+		}
+
+		if errors[0].Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0].Error())
+		}
+	}
+}
+
 func TestIntegerLiteralExpression(t *testing.T) {
 	input := "5;"
 
@@ -257,11 +466,15 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 / 5;", 5, "/", 5},
 		{"5 > 5;", 5, ">", 5},
 		{"5 < 5;", 5, "<", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 <= 5;", 5, "<=", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
 		{"true == true;", true, "==", true},
 		{"false == false;", false, "==", false},
 		{"true != false;", true, "!=", false},
+		{"true && false;", true, "&&", false},
+		{"a || b;", "a", "||", "b"},
 	}
 
 	for _, tt := range infixTests {
@@ -293,6 +506,10 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"!-a",
 			"(!(-a))",
 		},
+		{
+			"-9223372036854775808 * -9223372036854775807",
+			"(-9223372036854775808 * (-9223372036854775807))",
+		},
 		{
 			"a + b + c",
 			"((a + b) + c)",
@@ -349,6 +566,74 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"3 < 5 == true",
 			"((3 < 5) == true)",
 		},
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
+		},
+		{
+			"-a[0]",
+			"(-(a[0]))",
+		},
+		{
+			"a + add(b * c) + d",
+			"((a + add((b * c))) + d)",
+		},
+		{
+			"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))",
+			"add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))",
+		},
+		{
+			"add(a + b + c * d / f + g)",
+			"add((((a + b) + ((c * d) / f)) + g))",
+		},
+		{
+			"a = b = 1 + 2",
+			"(a = (b = (1 + 2)))",
+		},
+		{
+			"x = x == y",
+			"(x = (x == y))",
+		},
+		{
+			"a + 1 <= b == c >= d * 2",
+			"(((a + 1) <= b) == (c >= (d * 2)))",
+		},
+		{
+			"a * b % c",
+			"((a * b) % c)",
+		},
+		{
+			"a + b % c",
+			"(a + (b % c))",
+		},
+		{
+			"2 ** 3 ** 2",
+			"(2 ** (3 ** 2))",
+		},
+		{
+			"-2 ** 2",
+			"(-(2 ** 2))",
+		},
+		{
+			"a * b ** c",
+			"(a * (b ** c))",
+		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a == b && c < d || !e",
+			"(((a == b) && (c < d)) || (!e))",
+		},
+		{
+			"x = a && b",
+			"(x = (a && b))",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -496,9 +781,1283 @@ func checkParserErrors(t *testing.T, p *Parser) {
 
 	t.Errorf("parser has %d errors.", len(errors))
 
-	for _, msg := range errors {
-		t.Errorf("parser error: %q", msg)
+	for _, err := range errors {
+		t.Errorf("parser error: %q", err.Error())
 	}
 
 	t.FailNow()
 }
+
+func TestIfExpression(t *testing.T) {
+	input := `if (x < y) { x }`
+
+	program := NewProgram(t, input, 1)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(exp.Consequence.Statements) != 1 {
+		t.Errorf("consequence is not 1 statements. got=%d\n",
+			len(exp.Consequence.Statements))
+	}
+
+	consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Consequence.Statements[0])
+	}
+
+	if !testIdentifier(t, consequence.Expression, "x") {
+		return
+	}
+
+	if exp.Alternative != nil {
+		t.Errorf("exp.Alternative was not nil. got=%+v", exp.Alternative)
+	}
+}
+
+func TestIfElseExpression(t *testing.T) {
+	input := `if (x < y) { x } else { y }`
+
+	program := NewProgram(t, input, 1)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+
+	consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Consequence.Statements[0])
+	}
+
+	if !testIdentifier(t, consequence.Expression, "x") {
+		return
+	}
+
+	if exp.Alternative == nil {
+		t.Fatalf("exp.Alternative was nil")
+	}
+
+	if len(exp.Alternative.Statements) != 1 {
+		t.Errorf("alternative is not 1 statements. got=%d\n",
+			len(exp.Alternative.Statements))
+	}
+
+	alternative, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Alternative.Statements[0])
+	}
+
+	if !testIdentifier(t, alternative.Expression, "y") {
+		return
+	}
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello world";`
+
+	program := NewProgram(t, input, 1)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+
+	if literal.Value != "hello world" {
+		t.Errorf("literal.Value not %q. got=%q", "hello world", literal.Value)
+	}
+}
+
+func TestTemplateLiteralParsing(t *testing.T) {
+	input := `"Hello, ${first + last}!"`
+
+	program := NewProgram(t, input, 1)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	tmpl, ok := stmt.Expression.(*ast.TemplateLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.TemplateLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(tmpl.Parts) != 3 {
+		t.Fatalf("wrong number of parts. want=3, got=%d", len(tmpl.Parts))
+	}
+
+	for i, expected := range map[int]string{0: "Hello, ", 2: "!"} {
+		text, ok := tmpl.Parts[i].(*ast.StringLiteral)
+		if !ok {
+			t.Fatalf("part %d not *ast.StringLiteral. got=%T", i, tmpl.Parts[i])
+		}
+		if text.Value != expected {
+			t.Errorf("part %d wrong. want=%q, got=%q", i, expected, text.Value)
+		}
+	}
+
+	testInfixExpression(t, tmpl.Parts[1], "first", "+", "last")
+
+	ident := tmpl.Parts[1].(*ast.InfixExpression).Right.(*ast.Identifier)
+	if ident.Token.Line != 1 || ident.Token.Column != 19 {
+		t.Errorf("wrong position for embedded identifier. want=1:19, got=%d:%d",
+			ident.Token.Line, ident.Token.Column)
+	}
+}
+
+func TestTemplateLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a ${}"`, "no prefix parse function for EOF found at line 1, column 6"},
+		{`"a ${1 2}"`, "unexpected INT in string interpolation at line 1, column 8"},
+		{"\n \"${1 + }\"", "no prefix parse function for EOF found at line 2, column 9"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+
+		if errors[0].Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0].Error())
+		}
+	}
+}
+
+func TestParsingArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	program := NewProgram(t, input, 1)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+}
+
+func TestParsingEmptyArrayLiterals(t *testing.T) {
+	program := NewProgram(t, "[]", 1)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 0 {
+		t.Errorf("len(array.Elements) not 0. got=%d", len(array.Elements))
+	}
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	input := "myArray[1 + 1]"
+
+	program := NewProgram(t, input, 1)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, indexExp.Left, "myArray") {
+		return
+	}
+
+	if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
+		return
+	}
+}
+
+func TestRangeAndSliceParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"0..10", "(0 .. 10)"},
+		{"0..n - 1", "(0 .. (n - 1))"},
+		{"a < 1..2", "(a < (1 .. 2))"},
+		{"xs[1:2]", "(xs[1:2])"},
+		{"xs[:n + 1]", "(xs[:(n + 1)])"},
+		{"xs[-2:]", "(xs[(-2):])"},
+		{"xs[:]", "(xs[:])"},
+		{"f()[1:][0]", "((f()[1:])[0])"},
+	}
+
+	for _, tt := range tests {
+		program := NewProgram(t, tt.input, 1)
+		if program.String() != tt.expected {
+			t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	program := NewProgram(t, "s[i:j]", 1)
+	slice, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.SliceExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.SliceExpression. got=%T", program.Statements[0])
+	}
+	testIdentifier(t, slice.Left, "s")
+	testIdentifier(t, slice.Start, "i")
+	testIdentifier(t, slice.End, "j")
+}
+
+func TestImportExpressionParsing(t *testing.T) {
+	program := NewProgram(t, `import(dir + name)`, 1)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	imp, ok := stmt.Expression.(*ast.ImportExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.ImportExpression. got=%T", stmt.Expression)
+	}
+
+	testInfixExpression(t, imp.Path, "dir", "+", "name")
+}
+
+func TestTryExpressionParsing(t *testing.T) {
+	program := NewProgram(t, `try { risky(x) } catch (err) { err }`, 1)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	te, ok := stmt.Expression.(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.TryExpression. got=%T", stmt.Expression)
+	}
+
+	if len(te.Block.Statements) != 1 {
+		t.Fatalf("block does not contain 1 statement. got=%d", len(te.Block.Statements))
+	}
+	if !testIdentifier(t, te.Param, "err") {
+		return
+	}
+	handler := te.Handler.Statements[0].(*ast.ExpressionStatement)
+	testIdentifier(t, handler.Expression, "err")
+}
+
+func TestTryExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { 1 }", "expected next token to be 'CATCH', got 'EOF' instead"},
+		{"try { 1 } catch { 2 }", "expected next token to be '(', got '{' instead"},
+		{"try { 1 } catch (1) { 2 }", "expected next token to be 'IDENT', got 'INT' instead"},
+		{"try 1", "expected next token to be '{', got 'INT' instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("%q: expected parser errors", tt.input)
+			continue
+		}
+		if errors[0].Message != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, errors[0].Message)
+		}
+	}
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedHash  bool
+		expectedNames []string
+		expectedValue string
+	}{
+		{"let [a, b] = pair;", false, []string{"a", "b"}, "pair"},
+		{"let [first,] = xs", false, []string{"first"}, "xs"},
+		{"let {name, age} = person;", true, []string{"name", "age"}, "person"},
+		{"const {x} = point;", true, []string{"x"}, "point"},
+	}
+
+	for _, tt := range tests {
+		program := NewProgram(t, tt.input, 1)
+
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.LetStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Name != nil || stmt.Pattern == nil {
+			t.Fatalf("%q: not a destructuring let. name=%v, pattern=%v", tt.input, stmt.Name, stmt.Pattern)
+		}
+		if stmt.Pattern.IsHash() != tt.expectedHash {
+			t.Errorf("%q: wrong pattern kind. want hash=%t", tt.input, tt.expectedHash)
+		}
+		if len(stmt.Pattern.Names) != len(tt.expectedNames) {
+			t.Fatalf("%q: wrong number of names. want=%d, got=%d",
+				tt.input, len(tt.expectedNames), len(stmt.Pattern.Names))
+		}
+		for i, name := range tt.expectedNames {
+			testIdentifier(t, stmt.Pattern.Names[i], name)
+		}
+		testIdentifier(t, stmt.Value, tt.expectedValue)
+	}
+}
+
+func TestDestructuringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [] = xs;", "destructuring pattern binds no names"},
+		{"let [a, 1] = xs;", "expected next token to be 'IDENT', got 'INT' instead"},
+		{"let [a b] = xs;", "missing comma between names"},
+		{"let {a, b = h;", "expected next token to be '}', got '=' instead"},
+		{"let [a, b];", "expected next token to be '=', got ';' instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("%q: expected parser errors", tt.input)
+			continue
+		}
+		if errors[0].Message != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, errors[0].Message)
+		}
+	}
+}
+
+func TestMatchExpressionParsing(t *testing.T) {
+	program := NewProgram(t, `match (x + 1) { 1 => "one", y => y * 2, _ => 0, }`, 1)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	me, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.MatchExpression. got=%T", stmt.Expression)
+	}
+
+	if !testInfixExpression(t, me.Subject, "x", "+", 1) {
+		return
+	}
+	if len(me.Arms) != 3 {
+		t.Fatalf("match does not have 3 arms. got=%d", len(me.Arms))
+	}
+
+	testLiteralExpression(t, me.Arms[0].Pattern, 1)
+	if str, ok := me.Arms[0].Body.(*ast.StringLiteral); !ok || str.Value != "one" {
+		t.Errorf("wrong body of arm 0. got=%s", me.Arms[0].Body)
+	}
+	testIdentifier(t, me.Arms[1].Pattern, "y")
+	testInfixExpression(t, me.Arms[1].Body, "y", "*", 2)
+	if me.Arms[2].Pattern != nil {
+		t.Errorf("wildcard arm has a pattern. got=%s", me.Arms[2].Pattern)
+	}
+	testLiteralExpression(t, me.Arms[2].Body, 0)
+}
+
+func TestMatchExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"match x { 1 => 2 }", "expected next token to be '(', got 'IDENT' instead"},
+		{"match (x) { 1 => 2 ", "expected next token to be ',', got 'EOF' instead"},
+		{"match (x) { 1: 2 }", "expected next token to be '=>', got ':' instead"},
+		{"match (x) { 1 => 2 3 => 4 }", "missing comma between arms"},
+		{"match (x) { _ => 1, 2 => 3 }", "unreachable match arm after _"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("%q: expected parser errors", tt.input)
+			continue
+		}
+		if errors[0].Message != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, errors[0].Message)
+		}
+	}
+}
+
+func TestTrailingCommas(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2,]", "[1, 2]"},
+		{"[\n  1,\n  2,\n]", "[1, 2]"},
+		{"add(1, 2,)", "add(1, 2)"},
+		{`{"a": 1, "b": 2,}`, "{a:1, b:2}"},
+		{"fn(a, b,) { a }", "fn(a, b) a"},
+		{"fn(a,) { a }", "fn(a) a"},
+	}
+
+	for _, tt := range tests {
+		program := NewProgram(t, tt.input, 1)
+		if program.String() != tt.expected {
+			t.Errorf("%q: want %q, got %q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestListErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		column   int
+	}{
+		{"[1 2]", "missing comma between elements", 4},
+		{`add(1 "b")`, "missing comma between arguments", 7},
+		{"fn(a b) { a }", "missing comma between parameters", 6},
+		{`{"a": 1 "b": 2}`, "missing comma between pairs", 9},
+		{"[1, 2;", "expected next token to be ']', got ';' instead", 6},
+		{"[,]", "no prefix parse function for , found", 2},
+		{"fn(,) { 1 }", "expected next token to be 'IDENT', got ',' instead", 4},
+		// the enclosing lists do not report the error again
+		{"puts(f(a 2));", "missing comma between arguments", 10},
+		{"[[1 2], 3]", "missing comma between elements", 5},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("%q: expected 1 parser error, got %q", tt.input, errors)
+			continue
+		}
+		if errors[0].Message != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, errors[0].Message)
+		}
+		if errors[0].Column != tt.column {
+			t.Errorf("%q: wrong column. want=%d, got=%d", tt.input, tt.column, errors[0].Column)
+		}
+	}
+}
+
+func TestParsingHashLiteralsStringKeys(t *testing.T) {
+	input := `{"one": 1, "two": 2, "three": 3}`
+
+	program := NewProgram(t, input, 1)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	expected := []struct {
+		key   string
+		value int64
+	}{
+		{"one", 1},
+		{"two", 2},
+		{"three", 3},
+	}
+
+	if len(hash.Pairs) != len(expected) {
+		t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	for i, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
+			continue
+		}
+
+		if literal.Value != expected[i].key {
+			t.Errorf("key is not %q. got=%q", expected[i].key, literal.Value)
+		}
+
+		testIntegerLiteral(t, pair.Value, expected[i].value)
+	}
+}
+
+func TestParsingEmptyHashLiteral(t *testing.T) {
+	program := NewProgram(t, "{}", 1)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 0 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+}
+
+func TestParsingHashLiteralsWithExpressions(t *testing.T) {
+	input := `{"one": 0 + 1, "two": 10 - 8, "three": 15 / 5}`
+
+	program := NewProgram(t, input, 1)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 3 {
+		t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	tests := []func(ast.Expression){
+		func(e ast.Expression) { testInfixExpression(t, e, 0, "+", 1) },
+		func(e ast.Expression) { testInfixExpression(t, e, 10, "-", 8) },
+		func(e ast.Expression) { testInfixExpression(t, e, 15, "/", 5) },
+	}
+
+	for i, pair := range hash.Pairs {
+		tests[i](pair.Value)
+	}
+}
+
+func TestParserErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let x 5;",
+			"expected next token to be '=', got 'INT' instead at line 1, column 7",
+		},
+		{
+			"let a = 1;\nlet b = (1 + 2;",
+			"expected next token to be ')', got ';' instead at line 2, column 15",
+		},
+		{
+			"\n  * 2",
+			"no prefix parse function for * found at line 2, column 3",
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+
+		if errors[0].Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0].Error())
+		}
+	}
+}
+
+func TestParseErrorDetails(t *testing.T) {
+	p := New(lexer.New("let a = 1;\nlet b = (1 + 2;"))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 error, got %d: %q", len(errors), errors)
+	}
+
+	err := errors[0]
+	if err.Line != 2 || err.Column != 15 {
+		t.Errorf("wrong position. want=2:15, got=%d:%d", err.Line, err.Column)
+	}
+	if err.Token.Type != token.SEMICOLON {
+		t.Errorf("wrong offending token. want=%q, got=%q", token.SEMICOLON, err.Token.Type)
+	}
+	if len(err.Expected) != 1 || err.Expected[0] != token.RPAREN {
+		t.Errorf("wrong expected tokens. want=[%q], got=%q", token.RPAREN, err.Expected)
+	}
+}
+
+func TestParseErrorRender(t *testing.T) {
+	input := "let a = 1;\n\tlet b = (1 + 2;"
+	p := New(lexer.New(input))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 error, got %d: %q", len(errors), errors)
+	}
+
+	expected := "2:16: expected next token to be ')', got ';' instead\n" +
+		"    \tlet b = (1 + 2;\n" +
+		"    \t              ^\n"
+
+	if rendered := errors[0].Render(input); rendered != expected {
+		t.Errorf("wrong rendering.\nwant=%q\ngot=%q", expected, rendered)
+	}
+}
+
+func TestParserErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedErrors int
+		expectedStmts  int
+	}{
+		{"let = 5; let y = 10;", 1, 1},
+		{"let x 5; let y = 10; y;", 1, 2},
+		{"let x = 1 + * 2 3 4; let y = 10;", 1, 2},
+		{"let x = (1 + 2; let y = 10;", 1, 2},
+		{"let x = 5 let = 6; let z = 7", 1, 2},
+		{"if (x) { let = 1; x } let y = 2;", 1, 2},
+		{"let a = ; let b = ; let c = 3;", 2, 3},
+		// a '}' only ends a statement inside a block
+		{"let y = {1: 2 3: 4}; let z = 1;", 1, 2},
+		{"fn() { let x = 1 +; x }; let z = 1;", 1, 2},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+
+		if len(p.Errors()) != tt.expectedErrors {
+			t.Errorf("%q: expected %d errors, got %d: %q",
+				tt.input, tt.expectedErrors, len(p.Errors()), p.Errors())
+		}
+
+		if len(program.Statements) != tt.expectedStmts {
+			t.Errorf("%q: expected %d statements, got %d",
+				tt.input, tt.expectedStmts, len(program.Statements))
+		}
+	}
+}
+
+func TestCallExpressionParsing(t *testing.T) {
+	input := "add(1, 2 * 3, 4 + 5);"
+
+	program := NewProgram(t, input, 1)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T",
+			stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Function, "add") {
+		return
+	}
+
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+
+	testLiteralExpression(t, exp.Arguments[0], 1)
+	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
+	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
+}
+
+func TestFunctionLiteralParsing(t *testing.T) {
+	input := `fn(x, y) { x + y; }`
+
+	program := NewProgram(t, input, 1)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(function.Parameters) != 2 {
+		t.Fatalf("function literal parameters wrong. want 2, got=%d\n",
+			len(function.Parameters))
+	}
+
+	testLiteralExpression(t, function.Parameters[0], "x")
+	testLiteralExpression(t, function.Parameters[1], "y")
+
+	if len(function.Body.Statements) != 1 {
+		t.Fatalf("function.Body.Statements has not 1 statements. got=%d\n",
+			len(function.Body.Statements))
+	}
+
+	bodyStmt, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("function body stmt is not ast.ExpressionStatement. got=%T",
+			function.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestFunctionParameterParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{input: "fn() {};", expectedParams: []string{}},
+		{input: "fn(x) {};", expectedParams: []string{"x"}},
+		{input: "fn(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
+	}
+
+	for _, tt := range tests {
+		program := NewProgram(t, tt.input, 1)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Errorf("length parameters wrong. want %d, got=%d\n",
+				len(tt.expectedParams), len(function.Parameters))
+		}
+
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+	}
+}
+
+func TestVariadicsAndSpread(t *testing.T) {
+	program := NewProgram(t, "fn(x, rest...) { f(x, rest...) }", 1)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	function := stmt.Expression.(*ast.FunctionLiteral)
+	if !function.Variadic || len(function.Parameters) != 2 {
+		t.Fatalf("wrong parameters. variadic=%t, got=%v", function.Variadic, function.Parameters)
+	}
+	testIdentifier(t, function.Parameters[1], "rest")
+
+	call := function.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	spread, ok := call.Arguments[1].(*ast.SpreadExpression)
+	if !ok {
+		t.Fatalf("last argument not *ast.SpreadExpression. got=%T", call.Arguments[1])
+	}
+	testIdentifier(t, spread.Value, "rest")
+	if program.String() != "fn(x, rest...) f(x, rest...)" {
+		t.Errorf("wrong String. got=%q", program.String())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a..., b) {}", "only the last of the parameters can be followed by '...'"},
+		{"f(a..., b)", "only the last of the arguments can be followed by '...'"},
+		{"[a...]", "expected next token to be ']', got '...' instead"},
+		{"let [a...] = b;", "expected next token to be ']', got '...' instead"},
+		{"a...", "no prefix parse function for ... found"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("%q: expected parser errors", tt.input)
+			continue
+		}
+		if errors[0].Message != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, errors[0].Message)
+		}
+	}
+}
+
+func TestMethodCallParsing(t *testing.T) {
+	program := NewProgram(t, `xs.join(", ", ys...)`, 1)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	mc, ok := stmt.Expression.(*ast.MethodCallExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.MethodCallExpression. got=%T", stmt.Expression)
+	}
+	testIdentifier(t, mc.Receiver, "xs")
+	testIdentifier(t, mc.Method, "join")
+	if len(mc.Arguments) != 2 {
+		t.Fatalf("wrong number of arguments. want=2, got=%d", len(mc.Arguments))
+	}
+	if str, ok := mc.Arguments[0].(*ast.StringLiteral); !ok || str.Value != ", " {
+		t.Errorf("wrong first argument. got=%s", mc.Arguments[0])
+	}
+	if _, ok := mc.Arguments[1].(*ast.SpreadExpression); !ok {
+		t.Errorf("last argument not *ast.SpreadExpression. got=%T", mc.Arguments[1])
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a".upper().len()`, "a.upper().len()"},
+		{"-x.len() * 2", "((-x.len()) * 2)"},
+		{"a[0].first()", "(a[0]).first()"},
+		{"f(x).rest()[0]", "(f(x).rest()[0])"},
+		{"1.5.len()", "1.5.len()"},
+	}
+
+	for _, tt := range tests {
+		program := NewProgram(t, tt.input, 1)
+		if program.String() != tt.expected {
+			t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	for input, expected := range map[string]string{
+		"x.1()": "expected next token to be 'IDENT', got 'INT' instead",
+		"x.":    "expected next token to be 'IDENT', got 'EOF' instead",
+	} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0].Message != expected {
+			t.Errorf("%q: wrong errors. want=%q, got=%v", input, expected, p.Errors())
+		}
+	}
+}
+
+func TestNullSafetyParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a ?? b", "(a ?? b)"},
+		{"a ?? b ?? c", "((a ?? b) ?? c)"},
+		{"a || b ?? c && d", "((a || b) ?? (c && d))"},
+		{"x = a ?? b", "(x = (a ?? b))"},
+		{"a?.len()", "a?.len()"},
+		{"h[k]?.trim().upper()", "(h[k])?.trim().upper()"},
+		{"a?.len() ?? 0", "(a?.len() ?? 0)"},
+	}
+
+	for _, tt := range tests {
+		program := NewProgram(t, tt.input, 1)
+		if program.String() != tt.expected {
+			t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	program := NewProgram(t, "a?.b(c)", 1)
+	mc := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.MethodCallExpression)
+	if !mc.Optional {
+		t.Errorf("method call is not optional")
+	}
+}
+
+func TestSpawnExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input      string
+		statements int
+		expected   string
+	}{
+		{"spawn fn() { x }", 1, "spawn fn() x"},
+		{"spawn worker(1)", 1, "spawn worker(1)"},
+		{"let t = spawn f; recv(t)", 2, "let t = spawn f;recv(t)"},
+	}
+
+	for _, tt := range tests {
+		program := NewProgram(t, tt.input, tt.statements)
+		if program.String() != tt.expected {
+			t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestStructParsing(t *testing.T) {
+	program := NewProgram(t, "struct { name, age, }", 1)
+	lit, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.StructLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StructLiteral. got=%T", program.Statements[0])
+	}
+	if len(lit.Fields) != 2 {
+		t.Fatalf("wrong number of fields. want=2, got=%d", len(lit.Fields))
+	}
+	testIdentifier(t, lit.Fields[0], "name")
+	testIdentifier(t, lit.Fields[1], "age")
+
+	program = NewProgram(t, "p?.name", 1)
+	field, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FieldExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.FieldExpression. got=%T", program.Statements[0])
+	}
+	testIdentifier(t, field.Receiver, "p")
+	testIdentifier(t, field.Field, "name")
+	if !field.Optional {
+		t.Errorf("field access is not optional")
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct {}", "struct {}"},
+		{"p.name", "p.name"},
+		{"p.address.city.upper()", "p.address.city.upper()"},
+		{"-p.age + 1", "((-p.age) + 1)"},
+		{"ps[0].name", "(ps[0]).name"},
+		{"f().name", "f().name"},
+	}
+
+	for _, tt := range tests {
+		program := NewProgram(t, tt.input, 1)
+		if program.String() != tt.expected {
+			t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	for input, expected := range map[string]string{
+		"struct { a, b, a }": "duplicate field name: a",
+		"struct { 1 }":       "expected next token to be 'IDENT', got 'INT' instead",
+		"struct name":        "expected next token to be '{', got 'IDENT' instead",
+		"p.name = 1":         "cannot assign to p.name",
+	} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0].Message != expected {
+			t.Errorf("%q: wrong errors. want=%q, got=%v", input, expected, p.Errors())
+		}
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	program := NewProgram(t, "3.14;", 1)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+	}
+
+	if literal.Value != 3.14 {
+		t.Errorf("literal.Value not %f. got=%f", 3.14, literal.Value)
+	}
+
+	if literal.TokenLiteral() != "3.14" {
+		t.Errorf("literal.TokenLiteral not %s. got=%s", "3.14", literal.TokenLiteral())
+	}
+}
+
+func TestAssignExpression(t *testing.T) {
+	program := NewProgram(t, "x = y + 1;", 1)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.AssignExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.AssignExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Name, "x") {
+		return
+	}
+
+	testInfixExpression(t, exp.Value, "y", "+", 1)
+}
+
+func TestIndexAssignExpression(t *testing.T) {
+	program := NewProgram(t, `h["k"][0] = x + 1`, 1)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.IndexAssignExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexAssignExpression. got=%T", stmt.Expression)
+	}
+	if exp.Left.String() != `(h[k])` {
+		t.Errorf("wrong left. got=%s", exp.Left)
+	}
+	testIntegerLiteral(t, exp.Index, 0)
+	testInfixExpression(t, exp.Value, "x", "+", 1)
+
+	for input, expected := range map[string]string{
+		"a[0] = b[1] = 2": "(a[0] = (b[1] = 2))",
+		"a[i][j] = 0":     "((a[i])[j] = 0)",
+	} {
+		program := NewProgram(t, input, 1)
+		if program.String() != expected {
+			t.Errorf("%q: want=%q, got=%q", input, expected, program.String())
+		}
+	}
+}
+
+func TestCompoundAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x += 1", "(x = (x + 1))"},
+		{"x -= y * 2", "(x = (x - (y * 2)))"},
+		{"x *= 2 ** 3", "(x = (x * (2 ** 3)))"},
+		{"x /= 2 + 1", "(x = (x / (2 + 1)))"},
+		{"a += b -= 1", "(a = (a + (b = (b - 1))))"},
+		{"xs[i] -= 1", "(xs[i] = ((xs[i]) - 1))"},
+	}
+
+	for _, tt := range tests {
+		program := NewProgram(t, tt.input, 1)
+		if program.String() != tt.expected {
+			t.Errorf("%q: want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("f() += 1"))
+	p.ParseProgram()
+	expected := "cannot assign to f() at line 1, column 5"
+	if len(p.Errors()) != 1 || p.Errors()[0].Error() != expected {
+		t.Errorf("wrong errors. want=%q, got=%v", expected, p.Errors())
+	}
+}
+
+func TestInvalidAssignmentTarget(t *testing.T) {
+	p := New(lexer.New("a + b = 5;"))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 error, got %d: %q", len(errors), errors)
+	}
+
+	expected := "cannot assign to (a + b) at line 1, column 7"
+	if errors[0].Error() != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, errors[0].Error())
+	}
+}
+
+func BenchmarkParseProgram(b *testing.B) {
+	for _, program := range bench.Programs() {
+		b.Run(program.Name, func(b *testing.B) {
+			b.SetBytes(int64(len(program.Source)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				p := New(lexer.New(program.Source))
+				p.ParseProgram()
+				if len(p.Errors()) != 0 {
+					b.Fatalf("parser errors: %v", p.Errors())
+				}
+			}
+		})
+	}
+}
+
+func TestArena(t *testing.T) {
+	inputs := []string{
+		`let x = -1.5 * f(a, "b", true) + [1, 2][0]; if (x) { x } else { !x }`,
+		`let s = "a${b}c"; for (k, v in {1: 2}) { s += k; }`,
+	}
+	for _, program := range bench.Programs() {
+		inputs = append(inputs, program.Source)
+	}
+
+	for _, input := range inputs {
+		want := New(lexer.New(input)).ParseProgram().String()
+
+		// a tiny slab makes the arena refill it many times
+		p := New(lexer.New(input), WithArena(3))
+		got := p.ParseProgram().String()
+		checkParserErrors(t, p)
+
+		if got != want {
+			t.Errorf("arena changed the tree.\nwant=%q\ngot=%q", want, got)
+		}
+	}
+}
+
+func TestReparse(t *testing.T) {
+	source := `let a = 1;
+let add = fn(x, y) {
+	x + y
+};
+// total
+let total = add(a, 2);
+"héllo ${total}";
+`
+
+	tests := []struct {
+		edit     Range
+		newText  string
+		expected string
+	}{
+		// change a literal in the first statement
+		{Range{Position{1, 9}, Position{1, 10}}, "100", strings.Replace(source, "= 1;", "= 100;", 1)},
+		// add lines inside the function
+		{Range{Position{3, 2}, Position{3, 2}}, "let z = 0;\n\t", strings.Replace(source, "\tx + y", "\tlet z = 0;\n\tx + y", 1)},
+		// insert a statement between two others
+		{Range{Position{5, 1}, Position{5, 1}}, "let b = 2;\n", strings.Replace(source, "// total", "let b = 2;\n// total", 1)},
+		// join two lines, moving the later statements up and right
+		{Range{Position{1, 11}, Position{2, 1}}, " ", strings.Replace(source, "1;\nlet add", "1; let add", 1)},
+		// edit after a non-ASCII character
+		{Range{Position{7, 8}, Position{7, 16}}, "${a}", strings.Replace(source, "${total}", "${a}", 1)},
+		// remove a semicolon, so the next statement continues the expression
+		{Range{Position{1, 10}, Position{1, 11}}, "\n(2)", strings.Replace(source, "1;", "1\n(2)", 1)},
+		// leave a block open, so that it takes in the rest of the text
+		{Range{Position{4, 1}, Position{4, 2}}, "", strings.Replace(source, "\n};", "\n;", 1)},
+		// append at the end
+		{Range{Position{8, 1}, Position{8, 1}}, "total * 2", source + "total * 2"},
+		// replace everything
+		{Range{Position{1, 1}, Position{8, 1}}, "1 + 1", "1 + 1"},
+	}
+
+	for i, tt := range tests {
+		old := New(lexer.New(source)).ParseProgram()
+		program, errors := Reparse(old, tt.edit, tt.newText)
+		if len(errors) != 0 {
+			t.Fatalf("tests[%d] - parser errors: %v", i, errors)
+		}
+		if program.Source != tt.expected {
+			t.Fatalf("tests[%d] - wrong source.\nwant=%q\ngot=%q", i, tt.expected, program.Source)
+		}
+
+		want, _ := ast.ToJSON(New(lexer.New(tt.expected)).ParseProgram())
+		got, _ := ast.ToJSON(program)
+		if string(got) != string(want) {
+			t.Errorf("tests[%d] - wrong program.\nwant=%s\ngot=%s", i, want, got)
+		}
+	}
+}
+
+func TestReparseReusesStatements(t *testing.T) {
+	old := New(lexer.New("let a = 1;\nlet b = 2;\nlet c = 3;")).ParseProgram()
+	first, third := old.Statements[0], old.Statements[2]
+
+	program, _ := Reparse(old, Range{Position{2, 9}, Position{2, 10}}, "20")
+
+	if program.String() != "let a = 1;let b = 20;let c = 3;" {
+		t.Fatalf("wrong program. got=%q", program.String())
+	}
+	if program.Statements[0] != first || program.Statements[2] != third {
+		t.Errorf("unchanged statements were not reused")
+	}
+}
+
+func TestReparseErrors(t *testing.T) {
+	old := New(lexer.New("let a = 1;\nlet b = 2;\nlet c = 3;")).ParseProgram()
+
+	program, errors := Reparse(old, Range{Position{2, 9}, Position{2, 10}}, "(")
+	if len(errors) == 0 {
+		t.Fatalf("expected errors, got program %q", program.String())
+	}
+
+	p := New(lexer.New("let a = 1;\nlet b = (;\nlet c = 3;"))
+	p.ParseProgram()
+	if fmt.Sprint(errors) != fmt.Sprint(p.Errors()) {
+		t.Errorf("errors are not those of a full parse.\nwant=%v\ngot=%v", p.Errors(), errors)
+	}
+}
+
+// largeProgram is the whole corpus repeated many times, so that the cost
+// of parsing dominates that of setting up the parser.
+func largeProgram() string {
+	var source strings.Builder
+	for i := 0; i < 50; i++ {
+		for _, program := range bench.Programs() {
+			source.WriteString(program.Source)
+			source.WriteString("\n")
+		}
+	}
+	return source.String()
+}
+
+// BenchmarkParseLargeProgram compares parsing a large program with and
+// without an arena. Besides the throughput it reports live-B, the heap
+// the finished tree keeps alive.
+func BenchmarkParseLargeProgram(b *testing.B) {
+	input := largeProgram()
+
+	modes := []struct {
+		name string
+		opts []Option
+	}{
+		{"heap", nil},
+		{"arena", []Option{WithArena(256)}},
+	}
+
+	for _, mode := range modes {
+		b.Run(mode.name, func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			b.ReportAllocs()
+
+			var program *ast.Program
+			for i := 0; i < b.N; i++ {
+				p := New(lexer.New(input), mode.opts...)
+				program = p.ParseProgram()
+				if len(p.Errors()) != 0 {
+					b.Fatalf("parser errors: %v", p.Errors())
+				}
+			}
+
+			b.StopTimer()
+			program = nil
+			before := liveHeap()
+			program = New(lexer.New(input), mode.opts...).ParseProgram()
+			b.ReportMetric(float64(liveHeap()-before), "live-B")
+			runtime.KeepAlive(program)
+		})
+	}
+}
+
+func liveHeap() uint64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+func FuzzParseProgram(f *testing.F) {
+	for _, program := range bench.Programs() {
+		f.Add(program.Source)
+	}
+	f.Add("let x = 99999999999999999999;")
+	f.Add("fn(a, b")
+	f.Add("if (x) { let")
+	f.Add("{1: [2, `${3")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+	})
+}
@@ -0,0 +1,171 @@
+package parser
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/token"
+	"strings"
+	"unicode/utf8"
+)
+
+// Position is a place in a source text, with the same 1-based line and
+// column, counted in characters, as the tokens.
+type Position struct {
+	Line   int
+	Column int
+}
+
+// Range is the part of a source text from Start up to, but not including,
+// End.
+type Range struct {
+	Start Position
+	End   Position
+}
+
+// Reparse returns the program for old's source with the text in edit
+// replaced by newText. Only the top-level statements the edit touches are
+// lexed and parsed again; the others are reused, and those after the edit
+// are moved to their new positions in place, so old must not be used
+// afterwards.
+//
+// old must come from ParseProgram, or an earlier Reparse, without errors,
+// since the statements dropped by a failed parse cannot be reused. When
+// the edited statements don't parse on their own, the whole text is
+// parsed again instead and the errors are those of the whole program.
+func Reparse(old *ast.Program, edit Range, newText string) (*ast.Program, []ParseError) {
+	src := old.Source
+	lines := lineOffsets(src)
+	start := offsetOf(src, lines, edit.Start)
+	end := offsetOf(src, lines, edit.End)
+	if end < start {
+		end = start
+	}
+	text := src[:start] + newText + src[end:]
+	delta := len(newText) - (end - start)
+
+	stmts := old.Statements
+	offsets := make([]int, len(stmts))
+	for i, stmt := range stmts {
+		offsets[i] = offsetOf(src, lines, position(stmt))
+	}
+
+	// the statements from first up to last are parsed again: those that
+	// start before the edit up to the one containing it, and those that
+	// start inside it
+	first := 0
+	for first+1 < len(stmts) && offsets[first+1] < start {
+		first++
+	}
+	last := first
+	for last < len(stmts) && offsets[last] <= end {
+		last++
+	}
+
+	// a statement that starts with something like a '(' or a '-' may
+	// continue the expression before it
+	for first > 0 && continuesExpression(stmts[first]) {
+		first--
+	}
+	for last < len(stmts) && continuesExpression(stmts[last]) {
+		last++
+	}
+
+	regionStart, regionEnd := 0, len(text)
+	line, column := 1, 1
+	if first > 0 {
+		regionStart = offsets[first]
+		pos := position(stmts[first])
+		line, column = pos.Line, pos.Column
+	}
+	if last < len(stmts) {
+		regionEnd = offsets[last] + delta
+	}
+
+	p := New(lexer.NewAt(text[regionStart:regionEnd], line, column))
+	region := p.ParseProgram()
+	if len(p.Errors()) != 0 || !balanced(text[regionStart:regionEnd]) {
+		p = New(lexer.New(text))
+		return p.ParseProgram(), p.Errors()
+	}
+
+	program := &ast.Program{Source: text}
+	program.Statements = make([]ast.Statement, 0, first+len(region.Statements)+len(stmts)-last)
+	program.Statements = append(program.Statements, stmts[:first]...)
+	program.Statements = append(program.Statements, region.Statements...)
+
+	newEnd := endOf(edit.Start, newText)
+	for _, stmt := range stmts[last:] {
+		ast.Shift(stmt, edit.End.Line, newEnd.Line-edit.End.Line, newEnd.Column-edit.End.Column)
+		program.Statements = append(program.Statements, stmt)
+	}
+
+	return program, p.Errors()
+}
+
+// position returns where stmt starts. The token of every top-level
+// statement is its first one.
+func position(stmt ast.Statement) Position {
+	tok := ast.Pos(stmt)
+	return Position{Line: tok.Line, Column: tok.Column}
+}
+
+func continuesExpression(stmt ast.Statement) bool {
+	return infixParseFnFor(ast.Pos(stmt).Type) != nil
+}
+
+// balanced reports whether every bracket in src is closed within it. The
+// parser accepts a block left open at the end of its input, which in the
+// whole text would go on past the statements parsed again.
+func balanced(src string) bool {
+	depth := 0
+	l := lexer.New(src)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			depth--
+		}
+	}
+	return depth == 0
+}
+
+// lineOffsets returns the offset in src of the start of each line.
+func lineOffsets(src string) []int {
+	lines := []int{0}
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
+
+// offsetOf converts pos to an offset in src, clamping positions beyond
+// the end of a line or of src.
+func offsetOf(src string, lines []int, pos Position) int {
+	if pos.Line < 1 {
+		return 0
+	}
+	if pos.Line > len(lines) {
+		return len(src)
+	}
+
+	offset := lines[pos.Line-1]
+	for column := 1; column < pos.Column && offset < len(src) && src[offset] != '\n'; column++ {
+		_, width := utf8.DecodeRuneInString(src[offset:])
+		offset += width
+	}
+	return offset
+}
+
+// endOf returns the position just after text when it is inserted at
+// start.
+func endOf(start Position, text string) Position {
+	newlines := strings.Count(text, "\n")
+	if newlines == 0 {
+		return Position{Line: start.Line, Column: start.Column + utf8.RuneCountInString(text)}
+	}
+	lastLine := text[strings.LastIndexByte(text, '\n')+1:]
+	return Position{Line: start.Line + newlines, Column: 1 + utf8.RuneCountInString(lastLine)}
+}
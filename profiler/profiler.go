@@ -0,0 +1,249 @@
+// Package profiler measures where Monkey programs run on the evaluator
+// spend their time: in which functions, on which lines, and what values
+// they create along the way.
+package profiler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// MAIN is the name the top level of a program is profiled under.
+const MAIN = "main"
+
+// MAX_LINES is how many of the hottest lines Report lists.
+const MAX_LINES = 20
+
+// Function is the profile of the calls of one function, by the expression
+// that names it in calls, like "fib" or "m.f".
+type Function struct {
+	Name  string
+	Calls int
+
+	Self  time.Duration // spent in the function's own code
+	Total time.Duration // spent in it and the functions it called
+}
+
+// Line is the profile of the code on one line of the program.
+type Line struct {
+	Line int
+	Hits int // the nodes evaluated on the line
+	Self time.Duration
+}
+
+// Profiler is an evaluator.AfterHook that charges the time between two
+// nodes to the function and line of the first, and counts the values that
+// expressions create.
+type Profiler struct {
+	functions map[string]*Function
+	lines     map[int]*Line
+	objects   map[object.ObjectType]int
+
+	// where the time since last is being spent: the functions being
+	// called, innermost last, and the line
+	last  time.Time
+	names []string
+	line  int
+
+	// the value counted last, which calls and blocks pass on unchanged
+	lastObject object.Object
+}
+
+func New() *Profiler {
+	return &Profiler{
+		functions: map[string]*Function{},
+		lines:     map[int]*Line{},
+		objects:   map[object.ObjectType]int{},
+		names:     []string{MAIN},
+	}
+}
+
+// Run evaluates program with config, profiling it with p.
+func (p *Profiler) Run(program *ast.Program, env *object.Environment, config evaluator.Config) object.Object {
+	config.Hook = p
+	p.last = time.Now()
+	result := evaluator.EvalWithConfig(context.Background(), program, env, config)
+	p.tick()
+	return result
+}
+
+func (p *Profiler) Before(node ast.Node, env *object.Environment, stack []evaluator.Frame) {
+	p.tick()
+
+	p.names = p.names[:1]
+	for _, frame := range stack {
+		p.names = append(p.names, frame.Name)
+	}
+
+	if _, ok := node.(*ast.Program); ok {
+		return
+	}
+	p.line = ast.Pos(node).Line
+	p.lineProfile(p.line).Hits++
+
+	if call, ok := node.(*ast.CallExpression); ok {
+		p.function(call.Function.String()).Calls++
+	}
+}
+
+func (p *Profiler) After(node ast.Node, result object.Object) {
+	p.tick()
+
+	// statements pass on the values of their expressions, and names
+	// values that already exist
+	switch node.(type) {
+	case ast.Statement, *ast.Program, *ast.Identifier:
+		return
+	}
+	if result == nil || result == p.lastObject {
+		return
+	}
+
+	switch result.Type() {
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+		return
+	}
+	// true, false and null are never created
+	if result == object.TRUE || result == object.FALSE || result == object.NULL {
+		return
+	}
+
+	p.objects[result.Type()]++
+	p.lastObject = result
+}
+
+// tick charges the time since the last tick to where it was spent.
+func (p *Profiler) tick() {
+	now := time.Now()
+	elapsed := now.Sub(p.last)
+	p.last = now
+
+	p.function(p.names[len(p.names)-1]).Self += elapsed
+	p.lineProfile(p.line).Self += elapsed
+
+	// a recursive function is only charged once
+	for i, name := range p.names {
+		if !contains(p.names[:i], name) {
+			p.function(name).Total += elapsed
+		}
+	}
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Profiler) function(name string) *Function {
+	f, ok := p.functions[name]
+	if !ok {
+		f = &Function{Name: name}
+		p.functions[name] = f
+	}
+	return f
+}
+
+func (p *Profiler) lineProfile(line int) *Line {
+	l, ok := p.lines[line]
+	if !ok {
+		l = &Line{Line: line}
+		p.lines[line] = l
+	}
+	return l
+}
+
+// Functions returns the profiles of the functions called, and of MAIN,
+// the most time consuming first.
+func (p *Profiler) Functions() []*Function {
+	functions := make([]*Function, 0, len(p.functions))
+	for _, f := range p.functions {
+		functions = append(functions, f)
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		if functions[i].Total != functions[j].Total {
+			return functions[i].Total > functions[j].Total
+		}
+		return functions[i].Name < functions[j].Name
+	})
+	return functions
+}
+
+// Lines returns the profiles of the lines run, the most time consuming
+// first.
+func (p *Profiler) Lines() []*Line {
+	lines := make([]*Line, 0, len(p.lines))
+	for _, l := range p.lines {
+		if l.Line > 0 {
+			lines = append(lines, l)
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].Self != lines[j].Self {
+			return lines[i].Self > lines[j].Self
+		}
+		return lines[i].Line < lines[j].Line
+	})
+	return lines
+}
+
+// Objects returns how many values of each type expressions created. Values
+// that expressions only pass on, like those of names and calls, count
+// once.
+func (p *Profiler) Objects() map[object.ObjectType]int {
+	return p.objects
+}
+
+// Report writes the profile to w as tables of the functions, the hottest
+// lines and the values created.
+func (p *Profiler) Report(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "function\tcalls\tself\ttotal")
+	for _, f := range p.Functions() {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", f.Name, f.Calls, round(f.Self), round(f.Total))
+	}
+
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "line\thits\tself")
+	lines := p.Lines()
+	if len(lines) > MAX_LINES {
+		lines = lines[:MAX_LINES]
+	}
+	for _, l := range lines {
+		fmt.Fprintf(tw, "%d\t%d\t%s\n", l.Line, l.Hits, round(l.Self))
+	}
+
+	types := make([]object.ObjectType, 0, len(p.objects))
+	for t := range p.objects {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if p.objects[types[i]] != p.objects[types[j]] {
+			return p.objects[types[i]] > p.objects[types[j]]
+		}
+		return types[i] < types[j]
+	})
+
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "type\tcreated")
+	for _, t := range types {
+		fmt.Fprintf(tw, "%s\t%d\n", t, p.objects[t])
+	}
+
+	tw.Flush()
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,84 @@
+package profiler
+
+import (
+	"bytes"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+const program = `let fib = fn(n) {
+  if (n < 2) { return n; }
+  fib(n - 1) + fib(n - 2)
+};
+let words = ["a", "b"];
+fib(5)`
+
+func TestProfiler(t *testing.T) {
+	p := New()
+	result := p.Run(parse(t, program), object.NewEnvironment(), evaluator.Config{})
+	if result.Inspect() != "5" {
+		t.Fatalf("wrong result. want=5, got=%s", result.Inspect())
+	}
+
+	calls := map[string]int{}
+	for _, f := range p.Functions() {
+		calls[f.Name] = f.Calls
+		if f.Self > f.Total {
+			t.Errorf("%s has more self time than total time. self=%s, total=%s",
+				f.Name, f.Self, f.Total)
+		}
+	}
+	if calls["fib"] != 15 || calls[MAIN] != 0 {
+		t.Errorf("wrong calls. got=%v", calls)
+	}
+	if p.Functions()[0].Name != MAIN {
+		t.Errorf("main is not the most time consuming. got=%s", p.Functions()[0].Name)
+	}
+
+	hits := map[int]int{}
+	for _, l := range p.Lines() {
+		hits[l.Line] = l.Hits
+	}
+	// the let statement, the function literal and its body once per call
+	if hits[1] != 17 {
+		t.Errorf("wrong hits for line 1. want=17, got=%d", hits[1])
+	}
+	// each call of fib runs the if expression, its block and condition
+	if hits[2] < 15*3 {
+		t.Errorf("too few hits for line 2. got=%d", hits[2])
+	}
+
+	objects := p.Objects()
+	if objects[object.ARRAY_OBJ] != 1 || objects[object.STRING_OBJ] != 2 ||
+		objects[object.FUNCTION_OBJ] != 1 {
+		t.Errorf("wrong objects created. got=%v", objects)
+	}
+}
+
+func TestReport(t *testing.T) {
+	p := New()
+	p.Run(parse(t, program), object.NewEnvironment(), evaluator.Config{})
+
+	var out bytes.Buffer
+	p.Report(&out)
+
+	for _, want := range []string{"function  calls", "fib       15", "line  hits", "type      created", "ARRAY     1"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report does not contain %q. got=\n%s", want, out.String())
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
@@ -0,0 +1,133 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"os"
+	"sort"
+	"strings"
+)
+
+const HELP = `Commands:
+  :help           show this help
+  :quit, :q       leave the REPL
+  :env            list the current bindings
+  :ast <input>    print the syntax tree of input
+  :tree [input]   print the syntax tree of input, or of the last input,
+                  as an indented tree of nodes
+  :tokens <input> print the tokens of input
+  :load <file>    run a file in this session
+  :reset          forget all bindings
+`
+
+// command runs a meta-command line such as ":env" and reports whether the
+// REPL should quit.
+func (s *session) command(line string) (quit bool) {
+	name, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case ":quit", ":q":
+		return true
+	case ":help":
+		io.WriteString(s.out, HELP)
+	case ":env":
+		s.printBindings()
+	case ":ast":
+		s.printAST(arg)
+	case ":tree":
+		s.printTree(arg)
+	case ":tokens":
+		s.printTokens(arg)
+	case ":load":
+		s.load(arg)
+	case ":reset":
+		s.reset()
+	default:
+		fmt.Fprintf(s.out, "unknown command %s, try :help\n", name)
+	}
+
+	return false
+}
+
+func (s *session) printBindings() {
+	bindings := map[string]string{}
+
+	if s.engine == ENGINE_VM {
+		for _, sym := range s.symbolTable.Symbols() {
+			if value := s.globals[sym.Index]; value != nil {
+				bindings[sym.Name] = value.Inspect()
+			}
+		}
+	} else {
+		for name, value := range s.env.Bindings() {
+			bindings[name] = value.Inspect()
+		}
+	}
+
+	names := make([]string, 0, len(bindings))
+	for name := range bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(s.out, "%s = %s\n", name, bindings[name])
+	}
+}
+
+func (s *session) printAST(src string) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, src, p.Errors())
+		return
+	}
+
+	for _, stmt := range program.Statements {
+		fmt.Fprintln(s.out, stmt.String())
+	}
+}
+
+func (s *session) printTree(src string) {
+	if src == "" {
+		src = s.last
+	}
+	if src == "" {
+		io.WriteString(s.out, "usage: :tree [input]\n")
+		return
+	}
+
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, src, p.Errors())
+		return
+	}
+
+	io.WriteString(s.out, ast.Tree(program))
+}
+
+func (s *session) printTokens(src string) {
+	for _, tok := range lexer.NewTokenStream(lexer.New(src)).All() {
+		fmt.Fprintf(s.out, "%d:%d\t%s\t%q\n", tok.Line, tok.Column, tok.Type, tok.Literal)
+	}
+}
+
+func (s *session) load(name string) {
+	if name == "" {
+		io.WriteString(s.out, "usage: :load <file>\n")
+		return
+	}
+
+	src, err := os.ReadFile(name)
+	if err != nil {
+		fmt.Fprintf(s.out, "Woops! %s\n", err)
+		return
+	}
+
+	s.run(string(src))
+}
@@ -0,0 +1,298 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// HISTORY_FILE is where the line editor keeps the lines typed into it,
+// relative to the user's home directory.
+const HISTORY_FILE = ".monkey_history"
+
+// MAX_HISTORY is how many lines of history the line editor remembers.
+const MAX_HISTORY = 1000
+
+// lineReader reads the lines typed into the REPL.
+type lineReader interface {
+	// ReadLine shows prompt and returns the next line without its line
+	// ending, or io.EOF once the input ends.
+	ReadLine(prompt string) (string, error)
+}
+
+// newLineReader returns a line editor when in and out are a terminal and
+// reads plain lines otherwise.
+func newLineReader(in io.Reader, out io.Writer) lineReader {
+	inFile, inOk := in.(*os.File)
+	outFile, outOk := out.(*os.File)
+	if inOk && outOk && isTerminal(inFile.Fd()) && isTerminal(outFile.Fd()) {
+		e := &editor{fd: inFile.Fd(), in: bufio.NewReader(in), out: out}
+		if home, err := os.UserHomeDir(); err == nil {
+			e.historyFile = filepath.Join(home, HISTORY_FILE)
+			e.loadHistory()
+		}
+		return e
+	}
+
+	return &scannerReader{scanner: bufio.NewScanner(in), out: out}
+}
+
+type scannerReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *scannerReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+// editor reads lines from a terminal in raw mode, with readline-style
+// editing keys and a history browsed with the arrow keys:
+//
+//	Left, Right, Ctrl-B, Ctrl-F  move the cursor
+//	Home, End, Ctrl-A, Ctrl-E    move to the start or end of the line
+//	Up, Down, Ctrl-P, Ctrl-N     step through the history
+//	Backspace, Delete            delete around the cursor
+//	Ctrl-K, Ctrl-U               delete to the end or start of the line
+//	Ctrl-C                       discard the line
+//	Ctrl-D                       end input on an empty line
+type editor struct {
+	fd  uintptr
+	in  *bufio.Reader
+	out io.Writer
+
+	history     []string
+	historyFile string // where new lines are appended, if not empty
+}
+
+// lineState is the line being edited.
+type lineState struct {
+	prompt string
+	buf    []rune
+	pos    int // cursor position in buf
+
+	histIdx int    // the history entry shown, len(history) for none
+	saved   string // the new line, kept while browsing the history
+}
+
+func (e *editor) ReadLine(prompt string) (string, error) {
+	restore, err := makeRaw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	return e.readLine(prompt)
+}
+
+// readLine reads a line with the terminal already in raw mode, handling
+// the editing keys as they come in.
+func (e *editor) readLine(prompt string) (string, error) {
+	s := &lineState{prompt: prompt, histIdx: len(e.history)}
+	e.refresh(s)
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			io.WriteString(e.out, "\n")
+			line := string(s.buf)
+			e.addHistory(line)
+			return line, nil
+		case 1: // Ctrl-A
+			s.pos = 0
+		case 2: // Ctrl-B
+			s.moveBy(-1)
+		case 3: // Ctrl-C
+			io.WriteString(e.out, "^C\n")
+			s.buf, s.pos = nil, 0
+		case 4: // Ctrl-D
+			if len(s.buf) == 0 {
+				io.WriteString(e.out, "\n")
+				return "", io.EOF
+			}
+			s.deleteAt(s.pos)
+		case 5: // Ctrl-E
+			s.pos = len(s.buf)
+		case 6: // Ctrl-F
+			s.moveBy(1)
+		case 8, 127: // Backspace
+			if s.pos > 0 {
+				s.pos--
+				s.deleteAt(s.pos)
+			}
+		case 11: // Ctrl-K
+			s.buf = s.buf[:s.pos]
+		case 14: // Ctrl-N
+			e.historyNext(s)
+		case 16: // Ctrl-P
+			e.historyPrev(s)
+		case 21: // Ctrl-U
+			s.buf = s.buf[s.pos:]
+			s.pos = 0
+		case 27: // Escape starts the sequence sent by special keys
+			e.escape(s)
+		default:
+			if unicode.IsPrint(r) {
+				s.insert(r)
+			}
+		}
+
+		e.refresh(s)
+	}
+}
+
+// escape handles the rest of an escape sequence like "\x1b[A" for Up.
+func (e *editor) escape(s *lineState) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return
+	}
+
+	// sequences like "\x1b[3~" carry a number before their final key
+	var num strings.Builder
+	for {
+		r, _, err = e.in.ReadRune()
+		if err != nil {
+			return
+		}
+		if r < '0' || r > '9' {
+			break
+		}
+		num.WriteRune(r)
+	}
+
+	switch {
+	case r == 'A':
+		e.historyPrev(s)
+	case r == 'B':
+		e.historyNext(s)
+	case r == 'C':
+		s.moveBy(1)
+	case r == 'D':
+		s.moveBy(-1)
+	case r == 'H', r == '~' && (num.String() == "1" || num.String() == "7"):
+		s.pos = 0
+	case r == 'F', r == '~' && (num.String() == "4" || num.String() == "8"):
+		s.pos = len(s.buf)
+	case r == '~' && num.String() == "3":
+		s.deleteAt(s.pos)
+	}
+}
+
+// refresh redraws the line and puts the cursor back in place.
+func (e *editor) refresh(s *lineState) {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", s.prompt, string(s.buf))
+	if back := len(s.buf) - s.pos; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
+
+func (e *editor) historyPrev(s *lineState) {
+	if s.histIdx == 0 {
+		return
+	}
+	if s.histIdx == len(e.history) {
+		s.saved = string(s.buf)
+	}
+	s.histIdx--
+	s.set(e.history[s.histIdx])
+}
+
+func (e *editor) historyNext(s *lineState) {
+	if s.histIdx == len(e.history) {
+		return
+	}
+	s.histIdx++
+	if s.histIdx == len(e.history) {
+		s.set(s.saved)
+	} else {
+		s.set(e.history[s.histIdx])
+	}
+}
+
+// addHistory remembers line unless it is blank or repeats the previous
+// line, and appends it to the history file.
+func (e *editor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" ||
+		(len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+
+	e.history = append(e.history, line)
+	if len(e.history) > MAX_HISTORY {
+		e.history = e.history[len(e.history)-MAX_HISTORY:]
+	}
+
+	if e.historyFile == "" {
+		return
+	}
+	f, err := os.OpenFile(e.historyFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+// loadHistory reads the last lines of the history file, which is not an
+// error if missing.
+func (e *editor) loadHistory() {
+	data, err := os.ReadFile(e.historyFile)
+	if err != nil {
+		return
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > MAX_HISTORY {
+		lines = lines[len(lines)-MAX_HISTORY:]
+	}
+	for _, line := range lines {
+		if line != "" {
+			e.history = append(e.history, line)
+		}
+	}
+}
+
+func (s *lineState) set(line string) {
+	s.buf = []rune(line)
+	s.pos = len(s.buf)
+}
+
+func (s *lineState) insert(r rune) {
+	s.buf = append(s.buf, 0)
+	copy(s.buf[s.pos+1:], s.buf[s.pos:])
+	s.buf[s.pos] = r
+	s.pos++
+}
+
+func (s *lineState) deleteAt(i int) {
+	if i < len(s.buf) {
+		s.buf = append(s.buf[:i], s.buf[i+1:]...)
+	}
+}
+
+func (s *lineState) moveBy(n int) {
+	s.pos += n
+	if s.pos < 0 {
+		s.pos = 0
+	}
+	if s.pos > len(s.buf) {
+		s.pos = len(s.buf)
+	}
+}
@@ -0,0 +1,156 @@
+package repl
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testEditor returns an editor reading the keys in input, with history.
+func testEditor(input string, history ...string) (*editor, *strings.Builder) {
+	out := &strings.Builder{}
+	e := &editor{in: bufio.NewReader(strings.NewReader(input)), out: out, history: history}
+	return e, out
+}
+
+func TestEditorKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		history  []string
+		expected string
+	}{
+		{"plain", "let x = 1;\r", nil, "let x = 1;"},
+		{"newline", "1 + 2\n", nil, "1 + 2"},
+		{"unicode", "\"héllo\"\r", nil, "\"héllo\""},
+		{"control characters", "a\x07b\x00\r", nil, "ab"},
+		{"backspace", "abc\x7f\x7fd\r", nil, "ad"},
+		{"ctrl-h", "abc\x08\r", nil, "ab"},
+		{"backspace at start", "\x7fa\r", nil, "a"},
+		{"left and insert", "ac\x1b[Db\r", nil, "abc"},
+		{"right", "ac\x1b[D\x1b[Cb\r", nil, "acb"},
+		{"ctrl-b and ctrl-f", "ac\x02\x02\x06b\r", nil, "abc"},
+		{"left past start", "b\x1b[D\x1b[Da\r", nil, "ab"},
+		{"right past end", "a\x1b[Cb\r", nil, "ab"},
+		{"ctrl-a and ctrl-e", "bc\x01a\x05d\r", nil, "abcd"},
+		{"home and end", "bc\x1b[Ha\x1b[Fd\r", nil, "abcd"},
+		{"home and end, tilde", "bc\x1b[1~a\x1b[4~d\r", nil, "abcd"},
+		{"home and end, O", "bc\x1bOHa\x1bOFd\r", nil, "abcd"},
+		{"delete", "abc\x01\x1b[3~\r", nil, "bc"},
+		{"delete at end", "abc\x1b[3~\r", nil, "abc"},
+		{"ctrl-d deletes", "abc\x01\x04\r", nil, "bc"},
+		{"ctrl-k", "abcd\x1b[D\x1b[D\x0b\r", nil, "ab"},
+		{"ctrl-u", "abcd\x1b[D\x1b[D\x15\r", nil, "cd"},
+		{"ctrl-c discards", "abc\x03d\r", nil, "d"},
+		{"unknown escape", "a\x1b[Zb\x1bxc\r", nil, "abc"},
+		{"up", "\x1b[A\r", []string{"one", "two"}, "two"},
+		{"up twice", "\x1b[A\x1b[A\r", []string{"one", "two"}, "one"},
+		{"up past oldest", "\x1b[A\x1b[A\x1b[A\r", []string{"one", "two"}, "one"},
+		{"up and edit", "\x1b[A!\r", []string{"one"}, "one!"},
+		{"up and down", "new\x1b[A\x1b[A\x1b[B\r", []string{"one", "two"}, "two"},
+		{"down to new line", "new\x1b[A\x1b[B\r", []string{"one"}, "new"},
+		{"down without history", "new\x1b[B\r", []string{"one"}, "new"},
+		{"ctrl-p and ctrl-n", "\x10\x10\x0e\r", []string{"one", "two"}, "two"},
+	}
+
+	for _, tt := range tests {
+		e, _ := testEditor(tt.input, tt.history...)
+		line, err := e.readLine(">> ")
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if line != tt.expected {
+			t.Errorf("%s: wrong line. want=%q, got=%q", tt.name, tt.expected, line)
+		}
+	}
+}
+
+func TestEditorEOF(t *testing.T) {
+	// Ctrl-D on an empty line ends the input
+	e, out := testEditor("\x04")
+	if _, err := e.readLine(">> "); err != io.EOF {
+		t.Errorf("ctrl-d: wrong error. want=%v, got=%v", io.EOF, err)
+	}
+	if !strings.HasSuffix(out.String(), "\n") {
+		t.Errorf("ctrl-d: line not ended, got=%q", out.String())
+	}
+
+	// so does the end of the keys, even in the middle of a line
+	e, _ = testEditor("abc")
+	if _, err := e.readLine(">> "); err != io.EOF {
+		t.Errorf("end of input: wrong error. want=%v, got=%v", io.EOF, err)
+	}
+}
+
+func TestEditorRefresh(t *testing.T) {
+	e, out := testEditor("ab\x1b[D\r")
+	if _, err := e.readLine(">> "); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "\r>> \x1b[K" +
+		"\r>> a\x1b[K" +
+		"\r>> ab\x1b[K" +
+		"\r>> ab\x1b[K\x1b[1D" +
+		"\n"
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestEditorHistory(t *testing.T) {
+	e, _ := testEditor("one\r\r  \rone\rtwo\r\x1b[A\x1b[A\r")
+	e.historyFile = filepath.Join(t.TempDir(), HISTORY_FILE)
+
+	for i := 0; i < 6; i++ {
+		if _, err := e.readLine(">> "); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// blank lines and repeats are not remembered; recalled lines are
+	expected := []string{"one", "two", "one"}
+	if strings.Join(e.history, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong history. want=%q, got=%q", expected, e.history)
+	}
+
+	data, err := os.ReadFile(e.historyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "one\ntwo\none\n" {
+		t.Errorf("wrong history file, got=%q", data)
+	}
+
+	loaded := &editor{historyFile: e.historyFile}
+	loaded.loadHistory()
+	if strings.Join(loaded.history, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong loaded history. want=%q, got=%q", expected, loaded.history)
+	}
+}
+
+func TestEditorHistoryLimit(t *testing.T) {
+	var input strings.Builder
+	for i := 0; i < MAX_HISTORY+5; i++ {
+		input.WriteString(strconv.Itoa(i) + "\r")
+	}
+	e, _ := testEditor(input.String())
+
+	for i := 0; i < MAX_HISTORY+5; i++ {
+		if _, err := e.readLine(">> "); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(e.history) != MAX_HISTORY {
+		t.Fatalf("wrong history length. want=%d, got=%d", MAX_HISTORY, len(e.history))
+	}
+	if e.history[0] != "5" {
+		t.Errorf("oldest lines not dropped, first=%q", e.history[0])
+	}
+}
@@ -1,34 +1,275 @@
 package repl
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"math/rand"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/diagnostics"
+	"monkey/evaluator"
 	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
 	"monkey/token"
+	"monkey/vm"
+	"strings"
+	"time"
 )
 
 const PROMPT = ">> "
 
-func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+// CONTINUATION_PROMPT asks for more lines of an unfinished input.
+const CONTINUATION_PROMPT = ".. "
+
+// INPUT_NAME stands for the file name of inputs in error messages.
+const INPUT_NAME = "<repl>"
+
+// Execution engines selectable with Start.
+const (
+	ENGINE_EVAL = "eval"
+	ENGINE_VM   = "vm"
+)
+
+const MONKEY_FACE = `            __,__
+   .--.  .-"     "-.  .--.
+  / .. \/  .-. .-.  \/ .. \
+ | |  '|  /   Y   \  |'  | |
+ | \   \  \ 0 | 0 /  /   / |
+  \ '- ,\.-"""""""-./, -' /
+   ''-' /_   ^ ^   _\ '-''
+       |  \._   _./  |
+       \   \ '~' /   /
+        '._ '-=-' _.'
+           '-----'
+`
+
+// Config selects the engine a REPL runs on and the streams it uses.
+type Config struct {
+	// Engine is ENGINE_EVAL or ENGINE_VM. Only the evaluator reports
+	// where errors happened and the calls they happened in.
+	Engine string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	// Stderr is where programs write with eputs. Nil means Stdout.
+	Stderr io.Writer
+
+	// AllowFS lets programs use the file system with builtins like
+	// readFile.
+	AllowFS bool
+}
+
+// Start runs a REPL reading from in and writing to out.
+func Start(in io.Reader, out io.Writer, engine string) {
+	Run(Config{Engine: engine, Stdin: in, Stdout: out})
+}
+
+// Run runs a REPL configured by config until its input ends.
+func Run(config Config) {
+	if config.Stderr == nil {
+		config.Stderr = config.Stdout
+	}
+
+	lines := newLineReader(config.Stdin, config.Stdout)
+	s := newSession(config)
+
+	var pending []string
 
 	for {
-		fmt.Fprintf(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		prompt := PROMPT
+		if len(pending) != 0 {
+			prompt = CONTINUATION_PROMPT
+		}
+		text, err := lines.ReadLine(prompt)
+		if err != nil {
+			return
+		}
+
+		if len(pending) == 0 && strings.HasPrefix(text, ":") {
+			if quit := s.command(text); quit {
+				return
+			}
+			continue
+		}
+
+		// keep reading while brackets, strings or comments are open. An
+		// empty line gives up and reports what is wrong with the input.
+		pending = append(pending, text)
+		line := strings.Join(pending, "\n")
+		if text != "" && incomplete(line) {
+			continue
+		}
+		pending = nil
+
+		s.run(line)
+	}
+}
+
+// session is the state kept between the inputs of a REPL: the bindings
+// of the evaluator, or the symbols, constants and globals of the VM.
+type session struct {
+	out    io.Writer
+	stderr io.Writer
+	in     io.Reader
+	engine string
+
+	allowFS bool
+
+	// rng is kept across inputs so that randomSeed lasts
+	rng *rand.Rand
+
+	env *object.Environment
+
+	// last is the last input run, for :tree
+	last string
+
+	constants   []object.Object
+	globals     []object.Object
+	symbolTable *compiler.SymbolTable
+}
+
+func newSession(config Config) *session {
+	s := &session{
+		out:    config.Stdout,
+		stderr: config.Stderr,
+		in:     config.Stdin,
+		engine: config.Engine,
+
+		allowFS: config.AllowFS,
+
+		rng: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	s.reset()
+	return s
+}
+
+// reset forgets everything defined so far.
+func (s *session) reset() {
+	s.env = object.NewEnvironment()
+	s.constants = []object.Object{}
+	s.globals = make([]object.Object, vm.GlobalsSize)
+	s.symbolTable = compiler.NewSymbolTable()
+}
+
+// run executes src and prints its value.
+func (s *session) run(src string) {
+	out := s.out
+	s.last = src
+
+	l := lexer.New(src)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(out, src, p.Errors())
+		return
+	}
+
+	if s.engine == ENGINE_VM {
+		comp := compiler.NewWithState(s.symbolTable, s.constants)
+		err := comp.Compile(program)
+		if err != nil {
+			fmt.Fprintf(out, "Woops! Compilation failed:\n %s\n", err)
 			return
 		}
 
-		line := scanner.Text()
-		if line == ":q" {
+		machine := vm.NewWithGlobalsStore(comp.Bytecode(), s.globals)
+		machine.SetStdout(out)
+		machine.SetStderr(s.stderr)
+		machine.SetStdin(s.in)
+		machine.SetAllowFS(s.allowFS)
+		machine.SetRand(s.rng)
+		err = machine.Run()
+
+		// imported modules add their own constants to the pool
+		s.constants = machine.Constants()
+		if err != nil {
+			fmt.Fprintf(out, "Woops! Executing bytecode failed:\n %s\n", err)
 			return
 		}
 
-		l := lexer.New(line)
+		if endsWithExpression(program) {
+			lastPopped := machine.LastPoppedStackElem()
+			io.WriteString(out, lastPopped.Inspect())
+			io.WriteString(out, "\n")
+		}
+		return
+	}
+
+	config := evaluator.Config{
+		Stdout:  out,
+		Stderr:  s.stderr,
+		Stdin:   s.in,
+		AllowFS: s.allowFS,
+		Rand:    s.rng,
+	}
+	evaluated := evaluator.EvalWithConfig(context.Background(), program, s.env, config)
+	if errObj, ok := evaluated.(*object.Error); ok {
+		printError(out, src, errObj)
+	} else if evaluated != nil {
+		io.WriteString(out, evaluated.Inspect())
+		io.WriteString(out, "\n")
+	}
+}
+
+// incomplete reports whether src ends inside an unclosed bracket, string
+// or block comment, so that more lines are needed to complete it.
+func incomplete(src string) bool {
+	l := lexer.New(src)
+	depth := 0
+
+	for {
+		tok := l.NextToken()
 
-		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-			fmt.Fprintf(out, "%+v\n", tok)
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+		case token.ILLEGAL:
+			// unterminated strings and comments run to the end of src
+			if l.NextToken().Type == token.EOF &&
+				(strings.HasPrefix(tok.Literal, "/*") || strings.HasSuffix(src, `"`+tok.Literal)) {
+				return true
+			}
+		case token.EOF:
+			return depth > 0
 		}
 	}
 }
+
+// endsWithExpression reports whether the program leaves a value behind,
+// which is only the case when its last statement is an expression.
+func endsWithExpression(program *ast.Program) bool {
+	if len(program.Statements) == 0 {
+		return false
+	}
+
+	last := program.Statements[len(program.Statements)-1]
+	_, ok := last.(*ast.ExpressionStatement)
+	return ok
+}
+
+func printParserErrors(out io.Writer, source string, errors []parser.ParseError) {
+	io.WriteString(out, MONKEY_FACE)
+	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
+	io.WriteString(out, " parser errors:\n")
+
+	for _, err := range errors {
+		io.WriteString(out, diagnostics.Render(INPUT_NAME, source, diagnostics.FromParseError(err)))
+	}
+}
+
+// printError prints a runtime error of the input source. Errors in
+// functions may have happened in earlier inputs, whose lines are gone, so
+// only those outside any function get a snippet of source.
+func printError(out io.Writer, source string, err *object.Error) {
+	if len(err.Stack) != 0 {
+		io.WriteString(out, err.Trace())
+		io.WriteString(out, "\n")
+		return
+	}
+	io.WriteString(out, diagnostics.Render(INPUT_NAME, source, diagnostics.FromError(err)))
+}
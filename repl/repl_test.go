@@ -0,0 +1,117 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"", false},
+		{"let x = 1;", false},
+		{"let x = 1", false},
+		{"let f = fn(x) {", true},
+		{"let f = fn(x) {\n  x * 2\n", true},
+		{"let f = fn(x) {\n  x * 2\n};", false},
+		{"if (x) { if (y) { 1 }", true},
+		{"[1, 2,", true},
+		{"{1: 2,", true},
+		{"puts(1", true},
+		{"puts(1))", false},
+		{"1 }", false},
+		{`"abc`, true},
+		{"let s = \"a\" + \"b", true},
+		{`"abc"`, false},
+		{`"{"`, false},
+		{`"(" + "["`, false},
+		{"/* a comment", true},
+		{"/* a comment\n{", true},
+		{"/* done */ 1", false},
+		{"// {", false},
+		{"1 // (", false},
+	}
+
+	for _, tt := range tests {
+		if got := incomplete(tt.input); got != tt.expected {
+			t.Errorf("incomplete(%q) = %t, want %t", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.monkey")
+	if err := os.WriteFile(lib, []byte("let xs = [1, 2];\nlet y = len(xs) * 21;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		lines    []string // run in order; only the output of the last is checked
+		expected string
+		quit     bool
+	}{
+		{[]string{":help"}, HELP, false},
+		{[]string{":quit"}, "", true},
+		{[]string{":q"}, "", true},
+		{[]string{":nope"}, "unknown command :nope, try :help\n", false},
+		{[]string{":env"}, "", false},
+		{[]string{"let b = [1, 2];", "let a = 1;", ":env"}, "a = 1\nb = [1, 2]\n", false},
+		{[]string{"let a = 1;", ":reset", ":env"}, "", false},
+		{[]string{":ast 1 + 2 * 3"}, "(1 + (2 * 3))\n", false},
+		{[]string{":tokens let x"}, "1:1\tLET\t\"let\"\n1:5\tIDENT\t\"x\"\n", false},
+		{[]string{":tree"}, "usage: :tree [input]\n", false},
+		{[]string{":tree -1"}, "Program\n" +
+			"  Statements[0]: ExpressionStatement \"-\" 1:1\n" +
+			"    Expression: PrefixExpression \"-\" 1:1\n" +
+			"      Right: IntegerLiteral \"1\" 1:2\n", false},
+		{[]string{"1 + 2", ":tree"}, "Program\n" +
+			"  Statements[0]: ExpressionStatement \"1\" 1:1\n" +
+			"    Expression: InfixExpression \"+\" 1:3\n" +
+			"      Left: IntegerLiteral \"1\" 1:1\n" +
+			"      Right: IntegerLiteral \"2\" 1:5\n", false},
+		{[]string{":load"}, "usage: :load <file>\n", false},
+		{[]string{":load " + filepath.Join(dir, "missing.monkey")},
+			"Woops! open " + filepath.Join(dir, "missing.monkey") + ": no such file or directory\n", false},
+		{[]string{":load " + lib, ":env"}, "xs = [1, 2]\ny = 42\n", false},
+		{[]string{":load " + lib, "y * 2"}, "84\n", false},
+	}
+
+	for _, engine := range []string{ENGINE_EVAL, ENGINE_VM} {
+		for _, tt := range tests {
+			var out bytes.Buffer
+			s := newSession(Config{Engine: engine, Stdin: strings.NewReader(""), Stdout: &out, Stderr: &out})
+
+			var quit bool
+			for _, line := range tt.lines {
+				out.Reset()
+				if strings.HasPrefix(line, ":") {
+					quit = s.command(line)
+				} else {
+					s.run(line)
+				}
+			}
+
+			if out.String() != tt.expected {
+				t.Errorf("[%s] %q: wrong output. want=%q, got=%q", engine, tt.lines, tt.expected, out.String())
+			}
+			if quit != tt.quit {
+				t.Errorf("[%s] %q: wrong quit. want=%t, got=%t", engine, tt.lines, tt.quit, quit)
+			}
+		}
+	}
+}
+
+func TestRunQuits(t *testing.T) {
+	var out bytes.Buffer
+	Run(Config{Engine: ENGINE_EVAL, Stdin: strings.NewReader("1\n:quit\n2\n"), Stdout: &out})
+
+	if out.String() != ">> 1\n>> " {
+		t.Errorf("wrong output. want=%q, got=%q", ">> 1\n>> ", out.String())
+	}
+}
@@ -0,0 +1,147 @@
+//go:build linux
+
+package repl
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// openPTY opens a pseudo-terminal, returning both of its ends.
+func openPTY(t *testing.T) (master, slave *os.File) {
+	t.Helper()
+
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminals: %s", err)
+	}
+	t.Cleanup(func() { master.Close() })
+
+	var unlock int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(),
+		syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+		t.Skipf("cannot unlock pseudo-terminal: %s", errno)
+	}
+	var n uint32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(),
+		syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); errno != 0 {
+		t.Skipf("cannot name pseudo-terminal: %s", errno)
+	}
+
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("cannot open pseudo-terminal: %s", err)
+	}
+	t.Cleanup(func() { slave.Close() })
+	return master, slave
+}
+
+func TestIsTerminal(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if isTerminal(f.Fd()) {
+		t.Errorf("a file is not a terminal")
+	}
+
+	_, slave := openPTY(t)
+	if !isTerminal(slave.Fd()) {
+		t.Errorf("a pseudo-terminal is a terminal")
+	}
+}
+
+func TestMakeRaw(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := makeRaw(f.Fd()); err == nil {
+		t.Errorf("a file cannot be made raw")
+	}
+
+	_, slave := openPTY(t)
+	old, err := getTermios(slave.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restore, err := makeRaw(slave.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := getTermios(slave.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw.Lflag&(syscall.ECHO|syscall.ICANON|syscall.ISIG) != 0 {
+		t.Errorf("still echoing or reading whole lines, lflag=%#x", raw.Lflag)
+	}
+	if raw.Iflag&syscall.ICRNL != 0 {
+		t.Errorf("still translating carriage returns, iflag=%#x", raw.Iflag)
+	}
+	if raw.Oflag != old.Oflag {
+		t.Errorf("output processing changed. want=%#x, got=%#x", old.Oflag, raw.Oflag)
+	}
+
+	restore()
+	restored, err := getTermios(slave.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Lflag != old.Lflag || restored.Iflag != old.Iflag {
+		t.Errorf("mode not restored. want=%#x/%#x, got=%#x/%#x",
+			old.Lflag, old.Iflag, restored.Lflag, restored.Iflag)
+	}
+}
+
+func TestEditorOnTerminal(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	master, slave := openPTY(t)
+
+	lines := newLineReader(slave, slave)
+	if _, ok := lines.(*editor); !ok {
+		t.Fatalf("no line editor on a terminal, got=%T", lines)
+	}
+
+	type result struct {
+		line string
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		line, err := lines.ReadLine(">> ")
+		done <- result{line, err}
+	}()
+
+	// the prompt shows once the terminal is raw
+	var shown []byte
+	buf := make([]byte, 64)
+	for !bytes.Contains(shown, []byte(">> ")) {
+		n, err := master.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shown = append(shown, buf[:n]...)
+	}
+
+	// keys typed into the terminal reach the editor one at a time, with
+	// Ctrl-C discarding the line rather than interrupting the process
+	if _, err := master.Write([]byte("abc\x03xy\x7fz\r")); err != nil {
+		t.Fatal(err)
+	}
+
+	r := <-done
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if r.line != "xz" {
+		t.Errorf("wrong line. want=%q, got=%q", "xz", r.line)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package repl
+
+import "errors"
+
+func isTerminal(fd uintptr) bool { return false }
+
+func makeRaw(fd uintptr) (restore func(), err error) {
+	return nil, errors.New("line editing is not supported on this platform")
+}
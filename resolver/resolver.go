@@ -0,0 +1,341 @@
+// Package resolver works out what each name in a Monkey program refers
+// to. It builds the tree of scopes a program creates when it runs and
+// links every identifier to the declaration it reads or assigns: a let
+// binding, a parameter, a loop variable, a catch parameter or a builtin.
+// Names declared nowhere are unresolved.
+//
+// Scopes follow the evaluator: a program, each function body and each
+// loop body has its own, while the blocks of if, try and match share the
+// scope around them. A function body may use names declared after the
+// function, as long as it runs after they are, so function bodies are
+// resolved when the scope around them ends.
+package resolver
+
+import (
+	"monkey/ast"
+	"monkey/evaluator"
+)
+
+// Kind tells how a name was declared.
+type Kind int
+
+const (
+	Unresolved Kind = iota
+	Let
+	Parameter
+	LoopVariable
+	CatchParameter
+	Builtin
+)
+
+var kindNames = [...]string{
+	Unresolved:     "unresolved",
+	Let:            "let",
+	Parameter:      "parameter",
+	LoopVariable:   "loop variable",
+	CatchParameter: "catch parameter",
+	Builtin:        "builtin",
+}
+
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// Declaration is one declaration of a name.
+type Declaration struct {
+	Name  string
+	Kind  Kind
+	Ident *ast.Identifier // where the name is declared, nil for builtins and unresolved names
+	Scope *Scope          // nil for builtins and unresolved names
+
+	// Shadows is the declaration of the same name in an enclosing scope
+	// that this one hides, if any.
+	Shadows *Declaration
+
+	Uses    []*ast.Identifier // the identifiers that read the name
+	Assigns []*ast.Identifier // the targets of assignments to the name
+}
+
+// Scope is a program, a function body or a loop body and the names
+// declared directly in it.
+type Scope struct {
+	// Node is the *ast.Program, *ast.FunctionLiteral or
+	// *ast.ForInStatement that creates the scope.
+	Node  ast.Node
+	Outer *Scope
+	Inner []*Scope
+
+	// Declarations lists the names declared in the scope in order. A name
+	// declared twice appears twice.
+	Declarations []*Declaration
+
+	names map[string]*Declaration
+}
+
+// Lookup returns the latest declaration of name in s or the scopes
+// around it, or nil if there is none.
+func (s *Scope) Lookup(name string) *Declaration {
+	for ; s != nil; s = s.Outer {
+		if decl, ok := s.names[name]; ok {
+			return decl
+		}
+	}
+	return nil
+}
+
+// Info is the result of resolving a program.
+type Info struct {
+	Global *Scope
+
+	// Scopes maps the nodes that create a scope to that scope.
+	Scopes map[ast.Node]*Scope
+
+	// Declarations maps the identifiers that declare a name to their
+	// declaration.
+	Declarations map[*ast.Identifier]*Declaration
+
+	// Refs maps every other identifier standing for a variable, read or
+	// assigned, to the declaration it refers to.
+	Refs map[*ast.Identifier]*Declaration
+
+	// the declarations shared by all uses of a builtin or of an
+	// unresolved name
+	builtins   map[string]*Declaration
+	unresolved map[string]*Declaration
+}
+
+// Resolve builds the scopes of program and resolves its identifiers.
+func Resolve(program *ast.Program) *Info {
+	r := &resolver{pending: map[*Scope][]*ast.FunctionLiteral{}, info: &Info{
+		Scopes:       map[ast.Node]*Scope{},
+		Declarations: map[*ast.Identifier]*Declaration{},
+		Refs:         map[*ast.Identifier]*Declaration{},
+		builtins:     map[string]*Declaration{},
+		unresolved:   map[string]*Declaration{},
+	}}
+
+	global := r.openScope(program, nil)
+	r.info.Global = global
+	r.statements(program.Statements, global)
+	r.closeScope(global)
+
+	return r.info
+}
+
+type resolver struct {
+	info *Info
+
+	// pending holds, for each open scope, the function literals found in
+	// it and not resolved yet.
+	pending map[*Scope][]*ast.FunctionLiteral
+}
+
+func (r *resolver) openScope(node ast.Node, outer *Scope) *Scope {
+	s := &Scope{Node: node, Outer: outer, names: map[string]*Declaration{}}
+	if outer != nil {
+		outer.Inner = append(outer.Inner, s)
+	}
+	r.info.Scopes[node] = s
+	return s
+}
+
+func (r *resolver) closeScope(s *Scope) {
+	for len(r.pending[s]) > 0 {
+		fn := r.pending[s][0]
+		r.pending[s] = r.pending[s][1:]
+
+		body := r.openScope(fn, s)
+		for _, param := range fn.Parameters {
+			r.declare(body, param, Parameter)
+		}
+		r.block(fn.Body, body)
+		r.closeScope(body)
+	}
+	delete(r.pending, s)
+}
+
+func (r *resolver) declare(s *Scope, ident *ast.Identifier, kind Kind) {
+	decl := &Declaration{Name: ident.Value, Kind: kind, Ident: ident, Scope: s}
+	if s.Outer != nil {
+		decl.Shadows = r.lookup(s.Outer, ident.Value)
+	} else if evaluator.IsBuiltin(ident.Value) {
+		decl.Shadows = r.builtin(ident.Value)
+	}
+
+	s.names[ident.Value] = decl
+	s.Declarations = append(s.Declarations, decl)
+	r.info.Declarations[ident] = decl
+}
+
+// lookup is like s.Lookup, but falls back to the builtins.
+func (r *resolver) lookup(s *Scope, name string) *Declaration {
+	if decl := s.Lookup(name); decl != nil {
+		return decl
+	}
+	if evaluator.IsBuiltin(name) {
+		return r.builtin(name)
+	}
+	return nil
+}
+
+func (r *resolver) builtin(name string) *Declaration {
+	decl, ok := r.info.builtins[name]
+	if !ok {
+		decl = &Declaration{Name: name, Kind: Builtin}
+		r.info.builtins[name] = decl
+	}
+	return decl
+}
+
+func (r *resolver) refer(s *Scope, ident *ast.Identifier, assign bool) {
+	decl := r.lookup(s, ident.Value)
+	if decl == nil {
+		decl = r.info.unresolved[ident.Value]
+		if decl == nil {
+			decl = &Declaration{Name: ident.Value, Kind: Unresolved}
+			r.info.unresolved[ident.Value] = decl
+		}
+	}
+
+	if assign {
+		decl.Assigns = append(decl.Assigns, ident)
+	} else {
+		decl.Uses = append(decl.Uses, ident)
+	}
+	r.info.Refs[ident] = decl
+}
+
+func (r *resolver) statements(stmts []ast.Statement, s *Scope) {
+	for _, stmt := range stmts {
+		r.statement(stmt, s)
+	}
+}
+
+func (r *resolver) statement(stmt ast.Statement, s *Scope) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		r.expression(stmt.Value, s)
+		if stmt.Pattern != nil {
+			for _, name := range stmt.Pattern.Names {
+				r.declare(s, name, Let)
+			}
+		} else {
+			r.declare(s, stmt.Name, Let)
+		}
+
+	case *ast.ReturnStatement:
+		r.expression(stmt.ReturnValue, s)
+
+	case *ast.ExpressionStatement:
+		r.expression(stmt.Expression, s)
+
+	case *ast.ForInStatement:
+		r.expression(stmt.Iterable, s)
+		loop := r.openScope(stmt, s)
+		if stmt.Key != nil {
+			r.declare(loop, stmt.Key, LoopVariable)
+		}
+		r.declare(loop, stmt.Value, LoopVariable)
+		r.block(stmt.Body, loop)
+		r.closeScope(loop)
+
+	case *ast.BlockStatement:
+		r.block(stmt, s)
+	}
+}
+
+func (r *resolver) block(block *ast.BlockStatement, s *Scope) {
+	if block != nil {
+		r.statements(block.Statements, s)
+	}
+}
+
+func (r *resolver) expression(exp ast.Expression, s *Scope) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		r.refer(s, exp, false)
+
+	case *ast.PrefixExpression:
+		r.expression(exp.Right, s)
+
+	case *ast.InfixExpression:
+		r.expression(exp.Left, s)
+		r.expression(exp.Right, s)
+
+	case *ast.AssignExpression:
+		r.expression(exp.Value, s)
+		r.refer(s, exp.Name, true)
+
+	case *ast.IndexAssignExpression:
+		r.expression(exp.Left, s)
+		r.expression(exp.Index, s)
+		r.expression(exp.Value, s)
+
+	case *ast.IfExpression:
+		r.expression(exp.Condition, s)
+		r.block(exp.Consequence, s)
+		r.block(exp.Alternative, s)
+
+	case *ast.TryExpression:
+		r.block(exp.Block, s)
+		r.declare(s, exp.Param, CatchParameter)
+		r.block(exp.Handler, s)
+
+	case *ast.MatchExpression:
+		r.expression(exp.Subject, s)
+		for _, arm := range exp.Arms {
+			r.expression(arm.Pattern, s)
+			r.expression(arm.Body, s)
+		}
+
+	case *ast.FunctionLiteral:
+		r.pending[s] = append(r.pending[s], exp)
+
+	case *ast.CallExpression:
+		r.expression(exp.Function, s)
+		r.expressions(exp.Arguments, s)
+
+	case *ast.MethodCallExpression:
+		r.expression(exp.Receiver, s)
+		r.expressions(exp.Arguments, s)
+
+	case *ast.FieldExpression:
+		r.expression(exp.Receiver, s)
+
+	case *ast.SpreadExpression:
+		r.expression(exp.Value, s)
+
+	case *ast.SpawnExpression:
+		r.expression(exp.Function, s)
+
+	case *ast.ImportExpression:
+		r.expression(exp.Path, s)
+
+	case *ast.TemplateLiteral:
+		r.expressions(exp.Parts, s)
+
+	case *ast.ArrayLiteral:
+		r.expressions(exp.Elements, s)
+
+	case *ast.IndexExpression:
+		r.expression(exp.Left, s)
+		r.expression(exp.Index, s)
+
+	case *ast.SliceExpression:
+		r.expression(exp.Left, s)
+		r.expression(exp.Start, s)
+		r.expression(exp.End, s)
+
+	case *ast.HashLiteral:
+		for _, pair := range exp.Pairs {
+			r.expression(pair.Key, s)
+			r.expression(pair.Value, s)
+		}
+	}
+}
+
+func (r *resolver) expressions(exps []ast.Expression, s *Scope) {
+	for _, exp := range exps {
+		r.expression(exp, s)
+	}
+}
@@ -0,0 +1,112 @@
+package resolver
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string // each reference as "line:column name -> kind line:column"
+	}{
+		{"let x = 1; x", []string{"1:12 x -> let 1:5"}},
+		{"y", []string{"1:1 y -> unresolved"}},
+		{"len([])", []string{"1:1 len -> builtin"}},
+		{"let len = 1; len", []string{"1:14 len -> let 1:5"}},
+		{"fn(a) { a }", []string{"1:9 a -> parameter 1:4"}},
+		{"for (k, v in []) { k + v }", []string{"1:20 k -> loop variable 1:6", "1:24 v -> loop variable 1:9"}},
+		{"try { 1 } catch (e) { e }", []string{"1:23 e -> catch parameter 1:18"}},
+		{"let [a, b] = [1, 2]; b", []string{"1:22 b -> let 1:9"}},
+		{"let x = 1; x = 2", []string{"1:12 x -> let 1:5"}},
+		// the value of a let is resolved before its name is declared
+		{"let x = 1; let x = x", []string{"1:20 x -> let 1:5"}},
+		// a function sees the names declared after it
+		{"let f = fn() { g }; let g = 1;", []string{"1:16 g -> let 1:25"}},
+		// blocks of if share the scope around them
+		{"if (true) { let x = 1; } x", []string{"1:26 x -> let 1:17"}},
+		// but loop bodies don't
+		{"for (i in []) { let x = 1; } x", []string{"1:30 x -> unresolved"}},
+	}
+
+	for _, tt := range tests {
+		info := Resolve(parse(t, tt.input))
+
+		var got []string
+		ast.Inspect(info.Global.Node, func(node ast.Node) bool {
+			ident, ok := node.(*ast.Identifier)
+			if !ok {
+				return true
+			}
+			decl, ok := info.Refs[ident]
+			if !ok {
+				return true
+			}
+			ref := fmt.Sprintf("%d:%d %s -> %s", ident.Token.Line, ident.Token.Column, ident.Value, decl.Kind)
+			if decl.Ident != nil {
+				ref += fmt.Sprintf(" %d:%d", decl.Ident.Token.Line, decl.Ident.Token.Column)
+			}
+			got = append(got, ref)
+			return true
+		})
+
+		if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+			t.Errorf("wrong references for %q.\nwant=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestScopes(t *testing.T) {
+	program := parse(t, `
+let x = 1;
+let f = fn(x, y) {
+	for (i in [x]) { let x = i; }
+	x = 2;
+	len(y)
+};
+`)
+	info := Resolve(program)
+
+	global := info.Global
+	if global.Node != program || len(global.Declarations) != 2 || len(global.Inner) != 1 {
+		t.Fatalf("wrong global scope: %+v", global)
+	}
+
+	fn := global.Inner[0]
+	if _, ok := fn.Node.(*ast.FunctionLiteral); !ok || info.Scopes[fn.Node] != fn {
+		t.Fatalf("wrong function scope node: %T", fn.Node)
+	}
+	params := fn.Declarations
+	if len(params) != 2 || params[0].Kind != Parameter || params[0].Shadows != global.Lookup("x") {
+		t.Errorf("parameter x should shadow the global x")
+	}
+	if len(params[0].Uses) != 1 || len(params[0].Assigns) != 1 {
+		t.Errorf("wrong uses of parameter x: %d reads, %d assignments",
+			len(params[0].Uses), len(params[0].Assigns))
+	}
+
+	loop := fn.Inner[0]
+	inner := loop.Lookup("x")
+	if inner.Scope != loop || inner.Shadows != params[0] || info.Declarations[inner.Ident] != inner {
+		t.Errorf("wrong declaration of x in the loop: %+v", inner)
+	}
+
+	if builtin := loop.Lookup("len"); builtin != nil {
+		t.Errorf("Lookup should not find builtins, got %+v", builtin)
+	}
+	if len(global.Lookup("x").Uses) != 0 {
+		t.Errorf("the global x is never read")
+	}
+}
@@ -0,0 +1,29 @@
+// Package stdlib bundles the standard library: modules written in Monkey
+// that programs load with import("std/<name>"), e.g. import("std/array").
+package stdlib
+
+import "embed"
+
+//go:embed *.monkey
+var files embed.FS
+
+// Source returns the source of the standard library module called name,
+// without the "std/" prefix. It reports false if there is no such module.
+func Source(name string) (string, bool) {
+	data, err := files.ReadFile(name + ".monkey")
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// Names returns the names of all standard library modules.
+func Names() []string {
+	entries, _ := files.ReadDir(".")
+
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name()[:len(e.Name())-len(".monkey")])
+	}
+	return names
+}
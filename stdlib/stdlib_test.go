@@ -0,0 +1,33 @@
+package stdlib
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func TestModulesParse(t *testing.T) {
+	names := Names()
+	if len(names) == 0 {
+		t.Fatalf("no standard library modules found")
+	}
+
+	for _, name := range names {
+		src, ok := Source(name)
+		if !ok {
+			t.Fatalf("Source(%q) not found", name)
+		}
+
+		p := parser.New(lexer.New(src))
+		p.ParseProgram()
+		for _, err := range p.Errors() {
+			t.Errorf("std/%s: %s", name, err.Error())
+		}
+	}
+}
+
+func TestSourceMissing(t *testing.T) {
+	if _, ok := Source("nope"); ok {
+		t.Errorf("Source(%q) should not be found", "nope")
+	}
+}
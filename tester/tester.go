@@ -0,0 +1,153 @@
+// Package tester finds and runs the tests written in Monkey. Tests live in
+// files ending in _test.monkey, as functions without parameters whose names
+// start with "test", and fail by returning an error, usually one made by
+// the assert and assertEq builtins:
+//
+//	let testAdd = fn() {
+//		assertEq(1 + 2, 3);
+//	};
+package tester
+
+import (
+	"context"
+	"io/fs"
+	"monkey/ast"
+	"monkey/diagnostics"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SUFFIX ends the names of test files.
+const SUFFIX = "_test.monkey"
+
+// PREFIX starts the names of test functions.
+const PREFIX = "test"
+
+// Find returns the test files under path, in lexical order, or path itself
+// if it is a file.
+func Find(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(name, SUFFIX) {
+			files = append(files, name)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// File is a parsed test file.
+type File struct {
+	Path    string
+	Source  string
+	Program *ast.Program
+
+	// Tests are the names of the test functions, in the order they are
+	// defined.
+	Tests []string
+}
+
+// Load reads and parses the test file at path.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	src := string(data)
+
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		var msgs []string
+		for _, err := range p.Errors() {
+			msgs = append(msgs, diagnostics.Render(path, src, diagnostics.FromParseError(err)))
+		}
+		return nil, &LoadError{Path: path, Message: "parser errors:\n" + strings.Join(msgs, "")}
+	}
+
+	f := &File{Path: path, Source: src, Program: program}
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || let.Name == nil || !strings.HasPrefix(let.Name.Value, PREFIX) {
+			continue
+		}
+		if fn, ok := let.Value.(*ast.FunctionLiteral); ok && len(fn.Parameters) == 0 {
+			f.Tests = append(f.Tests, let.Name.Value)
+		}
+	}
+	return f, nil
+}
+
+// LoadError is a test file that could not be parsed or run.
+type LoadError struct {
+	Path    string
+	Message string
+}
+
+func (e *LoadError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// Result is the outcome of one test.
+type Result struct {
+	File    string
+	Name    string
+	Err     *object.Error // nil if the test passed
+	Elapsed time.Duration
+}
+
+func (r Result) Passed() bool {
+	return r.Err == nil
+}
+
+// Run runs the program of f and then each of its tests with config, in
+// the order they are defined.
+func (f *File) Run(config evaluator.Config) ([]Result, error) {
+	env := object.NewEnvironment()
+	env.SetDir(filepath.Dir(f.Path))
+
+	result := evaluator.EvalWithConfig(context.Background(), f.Program, env, config)
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, &LoadError{Path: f.Path, Message: errObj.Message}
+	}
+
+	results := make([]Result, 0, len(f.Tests))
+	for _, name := range f.Tests {
+		call := &ast.CallExpression{
+			Token: token.Token{Type: token.LPAREN, Literal: "("},
+			Function: &ast.Identifier{
+				Token: token.Token{Type: token.IDENT, Literal: name},
+				Value: name,
+			},
+		}
+
+		start := time.Now()
+		result := evaluator.EvalWithConfig(context.Background(), call, env, config)
+		r := Result{File: f.Path, Name: name, Elapsed: time.Since(start)}
+		if errObj, ok := result.(*object.Error); ok {
+			r.Err = errObj
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
@@ -0,0 +1,126 @@
+package tester
+
+import (
+	"bytes"
+	"monkey/evaluator"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b_test.monkey", "a_test.monkey", "main.monkey", "sub/c_test.monkey"} {
+		writeFile(t, filepath.Join(dir, name), "")
+	}
+
+	files, err := Find(dir)
+	if err != nil {
+		t.Fatalf("Find failed: %s", err)
+	}
+	expected := []string{
+		filepath.Join(dir, "a_test.monkey"),
+		filepath.Join(dir, "b_test.monkey"),
+		filepath.Join(dir, "sub/c_test.monkey"),
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("wrong files. want=%v, got=%v", expected, files)
+	}
+
+	// a file is found whatever its name
+	files, err = Find(filepath.Join(dir, "main.monkey"))
+	if err != nil || len(files) != 1 {
+		t.Errorf("file not found by its own name. got=%v, %v", files, err)
+	}
+
+	if _, err := Find(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("no error for a missing path")
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "lib.monkey"), `let double = fn(x) { x * 2 };`)
+	path := filepath.Join(dir, "math_test.monkey")
+	writeFile(t, path, `
+let lib = import("lib.monkey");
+let helper = fn() { 1 };
+let testDouble = fn() { assertEq(lib["double"](2), 4) };
+let testFails = fn() { assertEq(lib["double"](2), 5) };
+let testWithArgs = fn(x) { x };
+let testPrints = fn() { puts("hello"); };
+let testAssert = fn() {
+  assert(true, "fine");
+  assert(helper() == 2, "helper returns 2");
+  puts("not reached");
+};
+`)
+
+	f, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %s", err)
+	}
+	expected := []string{"testDouble", "testFails", "testPrints", "testAssert"}
+	if !reflect.DeepEqual(f.Tests, expected) {
+		t.Fatalf("wrong tests. want=%v, got=%v", expected, f.Tests)
+	}
+
+	var out bytes.Buffer
+	results, err := f.Run(evaluator.Config{Stdout: &out, AllowFS: true})
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+
+	failures := map[string]string{}
+	for _, r := range results {
+		if r.File != path {
+			t.Errorf("wrong file for %s: %s", r.Name, r.File)
+		}
+		if !r.Passed() {
+			failures[r.Name] = r.Err.Message
+		}
+	}
+	expectedFailures := map[string]string{
+		"testFails":  "assertion failed: 4 != 5",
+		"testAssert": "assertion failed: helper returns 2",
+	}
+	if len(results) != 4 || !reflect.DeepEqual(failures, expectedFailures) {
+		t.Errorf("wrong failures. want=%v, got=%v", expectedFailures, failures)
+	}
+	if out.String() != "hello\n" {
+		t.Errorf("wrong output. want=%q, got=%q", "hello\n", out.String())
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	broken := filepath.Join(dir, "broken_test.monkey")
+	writeFile(t, broken, "let = 1;")
+	if _, err := Load(broken); err == nil {
+		t.Errorf("no error for a file that does not parse")
+	}
+
+	failing := filepath.Join(dir, "failing_test.monkey")
+	writeFile(t, failing, "let testA = fn() { 1 }; missing;")
+	f, err := Load(failing)
+	if err != nil {
+		t.Fatalf("Load failed: %s", err)
+	}
+	_, err = f.Run(evaluator.Config{})
+	expected := failing + ": identifier not found: missing"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%v", expected, err)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
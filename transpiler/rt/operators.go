@@ -0,0 +1,112 @@
+package rt
+
+import (
+	"monkey/evaluator"
+	"monkey/object"
+)
+
+// Infix applies a binary operator other than &&, || and ??, which the
+// generated code evaluates itself. Add, Sub, Mul and the comparisons are
+// Infix for their operator with a fast path for integers.
+func Infix(line, column int, operator string, left, right object.Object) object.Object {
+	return check(evaluator.Infix(operator, left, right), line, column)
+}
+
+// Prefix applies the unary operator - or !.
+func Prefix(line, column int, operator string, right object.Object) object.Object {
+	return check(evaluator.Prefix(operator, right), line, column)
+}
+
+// Not returns !right.
+func Not(right object.Object) object.Object {
+	return Bool(!Truthy(right))
+}
+
+// Matches reports whether a match arm's pattern equals its subject.
+func Matches(subject, pattern object.Object) bool {
+	return evaluator.Infix("==", subject, pattern) == object.TRUE
+}
+
+func integers(left, right object.Object) (l, r int64, ok bool) {
+	li, ok := left.(*object.Integer)
+	if !ok {
+		return 0, 0, false
+	}
+	ri, ok := right.(*object.Integer)
+	if !ok {
+		return 0, 0, false
+	}
+	return li.Value, ri.Value, true
+}
+
+func Add(line, column int, left, right object.Object) object.Object {
+	if l, r, ok := integers(left, right); ok {
+		return object.NewInt(l + r)
+	}
+	return Infix(line, column, "+", left, right)
+}
+
+func Sub(line, column int, left, right object.Object) object.Object {
+	if l, r, ok := integers(left, right); ok {
+		return object.NewInt(l - r)
+	}
+	return Infix(line, column, "-", left, right)
+}
+
+func Mul(line, column int, left, right object.Object) object.Object {
+	if l, r, ok := integers(left, right); ok {
+		return object.NewInt(l * r)
+	}
+	return Infix(line, column, "*", left, right)
+}
+
+func Less(line, column int, left, right object.Object) object.Object {
+	if l, r, ok := integers(left, right); ok {
+		return Bool(l < r)
+	}
+	return Infix(line, column, "<", left, right)
+}
+
+func Greater(line, column int, left, right object.Object) object.Object {
+	if l, r, ok := integers(left, right); ok {
+		return Bool(l > r)
+	}
+	return Infix(line, column, ">", left, right)
+}
+
+func LessEqual(line, column int, left, right object.Object) object.Object {
+	if l, r, ok := integers(left, right); ok {
+		return Bool(l <= r)
+	}
+	return Infix(line, column, "<=", left, right)
+}
+
+func GreaterEqual(line, column int, left, right object.Object) object.Object {
+	if l, r, ok := integers(left, right); ok {
+		return Bool(l >= r)
+	}
+	return Infix(line, column, ">=", left, right)
+}
+
+func Equal(line, column int, left, right object.Object) object.Object {
+	if l, r, ok := integers(left, right); ok {
+		return Bool(l == r)
+	}
+	return Infix(line, column, "==", left, right)
+}
+
+func NotEqual(line, column int, left, right object.Object) object.Object {
+	if l, r, ok := integers(left, right); ok {
+		return Bool(l != r)
+	}
+	return Infix(line, column, "!=", left, right)
+}
+
+// Coalesce returns left unless it is null, and right() otherwise, for
+// left ?? right.
+func Coalesce(left object.Object, right func() object.Object) object.Object {
+	if left != object.NULL {
+		return left
+	}
+	return right()
+}
@@ -0,0 +1,377 @@
+// Package rt is the runtime of the Monkey programs that package
+// transpiler translates to Go. The generated code keeps every value as an
+// object.Object and calls rt for whatever it does with them, so programs
+// behave as they do on the evaluator, whose operators and builtins rt
+// shares.
+//
+// Operations that fail panic with an *object.Error carrying the position
+// they are given, which Try recovers from and Main reports.
+package rt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"monkey/evaluator"
+	"monkey/object"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Main runs program, the body of a translated program, and reports the
+// error it fails with, if any, before exiting with status 1. A program
+// stopped by exit exits with the status it asked for.
+func Main(program func()) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		err, ok := r.(*object.Error)
+		if !ok {
+			panic(r)
+		}
+		if err.Exit != nil {
+			os.Exit(err.Exit.Code)
+		}
+		fmt.Fprintf(os.Stderr, "%s: %s\n", filepath.Base(os.Args[0]), err.Inspect())
+		os.Exit(1)
+	}()
+	program()
+}
+
+// runtime is the object.Runtime the builtins of a translated program run
+// with. Like the run command, it lets programs use the file system and
+// the process they run in.
+type runtime struct {
+	rand  *rand.Rand
+	depth int
+}
+
+var state = &runtime{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// Call lets builtins like map and sort call the functions they are given.
+// It returns the error a function fails with instead of panicking, as the
+// builtins expect.
+func (r *runtime) Call(fn object.Object, args ...object.Object) (result object.Object) {
+	defer func() {
+		if p := recover(); p != nil {
+			err, ok := p.(*object.Error)
+			if !ok {
+				panic(p)
+			}
+			result = err
+		}
+	}()
+	return call(fn, args)
+}
+
+func (r *runtime) Stdout() io.Writer { return os.Stdout }
+func (r *runtime) Stderr() io.Writer { return os.Stderr }
+func (r *runtime) Stdin() io.Reader  { return os.Stdin }
+func (r *runtime) AllowFS() bool     { return true }
+func (r *runtime) AllowNet() bool    { return false }
+func (r *runtime) AllowEnv() bool    { return true }
+func (r *runtime) AllowExec() bool   { return true }
+func (r *runtime) AllowExit() bool   { return true }
+func (r *runtime) Args() []string    { return os.Args[1:] }
+
+func (r *runtime) Context() context.Context { return context.Background() }
+func (r *runtime) Rand() *rand.Rand         { return r.rand }
+
+// Builtin returns the builtin function called name.
+func Builtin(name string) object.Object {
+	builtin, ok := evaluator.LookupBuiltin(name)
+	if !ok {
+		panic("rt: unknown builtin " + name)
+	}
+	return builtin
+}
+
+// Func returns a Monkey function taking params parameters, the last of
+// which collects the remaining arguments into an array if variadic is
+// set. body receives exactly one argument per parameter.
+//
+// Functions are builtins to the rest of the program, so that builtins
+// like map accept them.
+func Func(params int, variadic bool, body func(args []object.Object) object.Object) object.Object {
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		switch {
+		case variadic && len(args) < params-1:
+			return newError("wrong number of arguments: want at least %d, got=%d",
+				params-1, len(args))
+		case !variadic && len(args) != params:
+			return newError("wrong number of arguments: want=%d, got=%d",
+				params, len(args))
+		}
+
+		if state.depth >= evaluator.DefaultMaxCallDepth {
+			return newError("stack overflow")
+		}
+		state.depth++
+		defer func() { state.depth-- }()
+
+		if variadic {
+			last := params - 1
+			rest := make([]object.Object, len(args)-last)
+			copy(rest, args[last:])
+			args = append(args[:last:last], &object.Array{Elements: rest})
+		}
+		return body(args)
+	}}
+}
+
+// Call calls fn with args.
+func Call(line, column int, fn object.Object, args ...object.Object) object.Object {
+	return check(call(fn, args), line, column)
+}
+
+func call(fn object.Object, args []object.Object) object.Object {
+	builtin, ok := fn.(*object.Builtin)
+	if !ok {
+		return newError("not a function: %s", fn.Type())
+	}
+	if builtin.RuntimeFn != nil {
+		return builtin.RuntimeFn(state, args...)
+	}
+	return builtin.Fn(args...)
+}
+
+// Args joins the groups of arguments of a call that spreads arrays.
+func Args(groups ...[]object.Object) []object.Object {
+	var args []object.Object
+	for _, group := range groups {
+		args = append(args, group...)
+	}
+	return args
+}
+
+// Spread returns the elements of the array that `value...` passes as
+// separate arguments.
+func Spread(line, column int, value object.Object) []object.Object {
+	array, ok := value.(*object.Array)
+	if !ok {
+		fail(line, column, "cannot spread %s, want ARRAY", value.Type())
+	}
+	return array.Elements
+}
+
+// Try returns the result of body or, if body fails, that of handler with
+// the error's message. Errors from exit are not caught.
+func Try(body func() object.Object, handler func(message object.Object) object.Object) (result object.Object) {
+	defer func() {
+		p := recover()
+		if p == nil {
+			return
+		}
+		err, ok := p.(*object.Error)
+		if !ok || err.Exit != nil {
+			panic(p)
+		}
+		result = handler(&object.String{Value: err.Message})
+	}()
+	return body()
+}
+
+// Load returns the value of the variable called name, which is nil until
+// the variable is first set.
+func Load(line, column int, value object.Object, name string) object.Object {
+	if value == nil {
+		fail(line, column, "identifier not found: %s", name)
+	}
+	return value
+}
+
+// Store sets *variable to value and returns value.
+func Store(variable *object.Object, value object.Object) object.Object {
+	*variable = value
+	return value
+}
+
+// Fail fails with message once operands, whose values are not needed,
+// have been evaluated.
+func Fail(line, column int, message string, operands ...object.Object) object.Object {
+	panic(&object.Error{Message: message, Line: line, Column: column})
+}
+
+// Truthy reports whether value counts as true in a condition.
+func Truthy(value object.Object) bool {
+	return evaluator.IsTruthy(value)
+}
+
+// Bool returns the Monkey boolean for b.
+func Bool(b bool) object.Object {
+	if b {
+		return object.TRUE
+	}
+	return object.FALSE
+}
+
+// Array returns an array of elements.
+func Array(elements ...object.Object) object.Object {
+	return &object.Array{Elements: elements}
+}
+
+// Hash returns a hash of the keys and values that alternate in pairs.
+func Hash(line, column int, pairs ...object.Object) object.Object {
+	hash := object.NewHash(len(pairs) / 2)
+	for i := 0; i < len(pairs); i += 2 {
+		if _, ok := pairs[i].(object.Hashable); !ok {
+			fail(line, column, "unusable as hash key: %s", pairs[i].Type())
+		}
+		hash.Set(pairs[i], pairs[i+1])
+	}
+	return hash
+}
+
+// Template joins the parts of a template literal, writing values other
+// than strings as they are inspected.
+func Template(parts ...object.Object) object.Object {
+	var out bytes.Buffer
+	for _, part := range parts {
+		if str, ok := part.(*object.String); ok {
+			out.WriteString(str.Value)
+		} else {
+			out.WriteString(part.Inspect())
+		}
+	}
+	return &object.String{Value: out.String()}
+}
+
+// Index returns left[index].
+func Index(line, column int, left, index object.Object) object.Object {
+	return check(evaluator.Index(left, index), line, column)
+}
+
+// Slice returns left[start:end], where a missing bound is null.
+func Slice(line, column int, left, start, end object.Object) object.Object {
+	result, err := object.Slice(left, start, end)
+	if err != nil {
+		fail(line, column, "%s", err)
+	}
+	return result
+}
+
+// SetIndex stores value in the array or hash left and returns value.
+func SetIndex(line, column int, left, index, value object.Object) object.Object {
+	if err := object.SetIndex(left, index, value); err != nil {
+		fail(line, column, "%s", err)
+	}
+	return value
+}
+
+// Unpack returns the n elements of the array value, for `let [a, b] =`.
+func Unpack(line, column int, value object.Object, n int) []object.Object {
+	array, ok := value.(*object.Array)
+	if !ok {
+		fail(line, column, "cannot destructure %s as an array", value.Type())
+	}
+	if len(array.Elements) != n {
+		fail(line, column, "cannot destructure array of %d elements into %d names",
+			len(array.Elements), n)
+	}
+	return array.Elements
+}
+
+// Fields returns the values of the hash value for the string keys names,
+// for `let {a, b} =`.
+func Fields(line, column int, value object.Object, names ...string) []object.Object {
+	hash, ok := value.(*object.Hash)
+	if !ok {
+		fail(line, column, "cannot destructure %s as a hash", value.Type())
+	}
+	values := make([]object.Object, len(names))
+	for i, name := range names {
+		key := &object.String{Value: name}
+		pair, ok := hash.Pairs[key.HashKey()]
+		if !ok {
+			fail(line, column, "key not found in hash: %s", name)
+		}
+		values[i] = pair.Value
+	}
+	return values
+}
+
+// Iterator steps through what a for loop iterates over: the elements of
+// an array, the integers of a range, the characters of a string or the
+// keys of a hash. Key is the index, or the key of a hash.
+type Iterator struct {
+	Key, Value object.Object
+
+	i      int
+	rng    *object.Range
+	keys   []object.Object // nil for indexes
+	values []object.Object
+}
+
+// Iterate returns an Iterator over value. The values of a hash are its
+// keys unless withKey is set.
+func Iterate(line, column int, value object.Object, withKey bool) *Iterator {
+	it := &Iterator{}
+	switch value := value.(type) {
+	case *object.Array:
+		it.values = value.Elements
+	case *object.Range:
+		it.rng = value
+	case *object.String:
+		for _, r := range value.Value {
+			it.values = append(it.values, &object.String{Value: string(r)})
+		}
+	case *object.Hash:
+		for _, pair := range value.Ordered() {
+			it.keys = append(it.keys, pair.Key)
+			it.values = append(it.values, pair.Value)
+		}
+		if !withKey {
+			it.values = it.keys
+		}
+	default:
+		fail(line, column, "cannot iterate over %s", value.Type())
+	}
+	return it
+}
+
+// Next moves to the next element, reporting whether there was one.
+func (it *Iterator) Next() bool {
+	i := int64(it.i)
+	if it.rng != nil {
+		n, ok := it.rng.At(i)
+		if !ok {
+			return false
+		}
+		it.Key, it.Value = object.NewInt(i), object.NewInt(n)
+	} else {
+		if it.i >= len(it.values) {
+			return false
+		}
+		it.Key, it.Value = object.NewInt(i), it.values[i]
+		if it.keys != nil {
+			it.Key = it.keys[i]
+		}
+	}
+	it.i++
+	return true
+}
+
+// check panics with result if it is an error, stamping it with the
+// position of the expression that failed unless it has one already.
+func check(result object.Object, line, column int) object.Object {
+	if err, ok := result.(*object.Error); ok {
+		if err.Line == 0 {
+			err.Line, err.Column = line, column
+		}
+		panic(err)
+	}
+	return result
+}
+
+func fail(line, column int, format string, a ...interface{}) {
+	panic(&object.Error{Message: fmt.Sprintf(format, a...), Line: line, Column: column})
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
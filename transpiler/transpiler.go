@@ -0,0 +1,829 @@
+// Package transpiler translates Monkey programs to Go. The Go program
+// keeps every value as an object.Object, as the evaluator does, but runs
+// as native code: variables are Go variables, functions are Go closures
+// and control flow is Go's own, with operators and builtins provided by
+// package rt. Built with the Go toolchain, it runs several times faster
+// than the same program on the evaluator or the VM.
+//
+// Functions are builtins to the translated program, so they print as
+// "builtin function", and calls in tail position are not eliminated.
+// Method calls, field access, structs, spawn and import are not supported,
+// and neither are return, break and continue inside try blocks or inside
+// an if or match whose value is used in the middle of an expression.
+package transpiler
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"monkey/ast"
+	"monkey/resolver"
+	"strconv"
+	"strings"
+)
+
+// Generate returns the source of a Go main package that runs program. The
+// package imports monkey/object and monkey/transpiler/rt, so it must be
+// built in a module that can import those packages.
+func Generate(program *ast.Program) (src []byte, err error) {
+	g := &generator{
+		info:        resolver.Resolve(program),
+		vars:        map[*resolver.Declaration]*variable{},
+		scopes:      map[*resolver.Scope][]*variable{},
+		consts:      map[*ast.Identifier]bool{},
+		taken:       map[string]bool{},
+		literals:    map[string]string{},
+		builtins:    map[string]string{},
+		initialized: map[*variable]bool{},
+		out:         &bytes.Buffer{},
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			u, ok := r.(unsupported)
+			if !ok {
+				panic(r)
+			}
+			src, err = nil, u.err
+		}
+	}()
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		if let, ok := node.(*ast.LetStatement); ok && let.IsConst() {
+			g.consts[let.Name] = true
+			if let.Pattern != nil {
+				for _, name := range let.Pattern.Names {
+					g.consts[name] = true
+				}
+			}
+		}
+		return true
+	})
+	g.declare(g.info.Global)
+
+	g.scope(g.info.Global)
+	g.block(program.Statements, discard, true)
+
+	return g.output()
+}
+
+// unsupported is what the generator panics with when it meets a construct
+// it cannot translate.
+type unsupported struct{ err error }
+
+func (g *generator) unsupported(node ast.Node, format string, args ...interface{}) {
+	tok := ast.Pos(node)
+	panic(unsupported{fmt.Errorf("%d:%d: %s", tok.Line, tok.Column, fmt.Sprintf(format, args...))})
+}
+
+type generator struct {
+	info *resolver.Info
+
+	// vars maps each declaration to its Go variable, which it shares
+	// with the other declarations of its name in the same scope, and
+	// scopes lists the variables each scope declares.
+	vars   map[*resolver.Declaration]*variable
+	scopes map[*resolver.Scope][]*variable
+
+	// consts holds the names declared by const statements.
+	consts map[*ast.Identifier]bool
+
+	// taken holds the Go names in use, and literals and builtins the
+	// package-level variables holding literal values and builtins.
+	taken    map[string]bool
+	literals map[string]string
+	builtins map[string]string
+	globals  []string
+
+	// initialized holds the variables certain to be set at the point
+	// being generated, which are read without checking.
+	initialized map[*variable]bool
+
+	out        *bytes.Buffer
+	inFunction bool // whether a function body is being generated
+	loops      int  // the loops around the code being generated in its function
+}
+
+type variable struct {
+	name   string // in Go
+	monkey string
+
+	used bool // whether any declaration is read
+
+	// isConst is set when a declaration is a const statement, and
+	// constDeclared once one has been generated.
+	isConst       bool
+	constDeclared bool
+}
+
+// reserved are the names Go or the generated code use, which variables
+// must not take.
+var reserved = map[string]bool{
+	"break": true, "case": true, "chan": true, "const": true, "continue": true,
+	"default": true, "defer": true, "else": true, "fallthrough": true, "for": true,
+	"func": true, "go": true, "goto": true, "if": true, "import": true,
+	"interface": true, "map": true, "package": true, "range": true, "return": true,
+	"select": true, "struct": true, "switch": true, "type": true, "var": true,
+
+	"_": true, "init": true, "main": true, "run": true, "object": true, "rt": true,
+	"args": true, "it": true, "message": true,
+}
+
+// newName returns a Go name based on base that is not taken yet.
+func (g *generator) newName(base string) string {
+	name := base
+	for i := 2; reserved[name] || g.taken[name]; i++ {
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+	g.taken[name] = true
+	return name
+}
+
+// declare gives the declarations of s and the scopes inside it their
+// variables.
+func (g *generator) declare(s *resolver.Scope) {
+	byName := map[string]*variable{}
+	for _, decl := range s.Declarations {
+		v, ok := byName[decl.Name]
+		if !ok {
+			v = &variable{name: g.newName(decl.Name), monkey: decl.Name}
+			byName[decl.Name] = v
+			g.scopes[s] = append(g.scopes[s], v)
+		}
+		if len(decl.Uses) > 0 {
+			v.used = true
+		}
+		if g.consts[decl.Ident] {
+			v.isConst = true
+		}
+		g.vars[decl] = v
+	}
+
+	for _, inner := range s.Inner {
+		g.declare(inner)
+	}
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(g.out, format, args...)
+}
+
+// scope declares the variables of s at the start of the Go block for it.
+func (g *generator) scope(s *resolver.Scope) {
+	vars := g.scopes[s]
+	if len(vars) == 0 {
+		return
+	}
+
+	names := make([]string, len(vars))
+	for i, v := range vars {
+		names[i] = v.name
+	}
+	g.printf("var %s object.Object\n", strings.Join(names, ", "))
+	for _, v := range vars {
+		if !v.used {
+			g.printf("_ = %s\n", v.name)
+		}
+	}
+}
+
+func (g *generator) variable(ident *ast.Identifier) *variable {
+	return g.vars[g.info.Declarations[ident]]
+}
+
+// A target says what becomes of the value of a block or expression.
+type target struct {
+	kind int
+	name string // the variable assigned
+}
+
+const (
+	discardKind = iota
+	returnKind
+	assignKind
+)
+
+var (
+	discard = target{kind: discardKind}
+	ret     = target{kind: returnKind}
+)
+
+func assignTo(name string) target {
+	return target{kind: assignKind, name: name}
+}
+
+// finish gives t the value code.
+func (g *generator) finish(t target, code string) {
+	switch t.kind {
+	case returnKind:
+		g.printf("return %s\n", code)
+	case assignKind:
+		g.printf("%s = %s\n", t.name, code)
+	default:
+		g.printf("_ = %s\n", code)
+	}
+}
+
+// block generates stmts, whose value is that of the last one. top is set
+// for the statements directly in a program, function or loop body, which
+// are certain to run in order.
+func (g *generator) block(stmts []ast.Statement, t target, top bool) {
+	if len(stmts) == 0 {
+		if t.kind != discardKind {
+			g.finish(t, "object.NULL")
+		}
+		return
+	}
+
+	for _, stmt := range stmts[:len(stmts)-1] {
+		g.statement(stmt, top)
+	}
+
+	last := stmts[len(stmts)-1]
+	if es, ok := last.(*ast.ExpressionStatement); ok {
+		g.value(es.Expression, t)
+		return
+	}
+	g.statement(last, top)
+	switch last.(type) {
+	case *ast.ReturnStatement, *ast.BreakStatement, *ast.ContinueStatement:
+	default:
+		if t.kind != discardKind {
+			g.finish(t, "object.NULL")
+		}
+	}
+}
+
+func (g *generator) statement(stmt ast.Statement, top bool) {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		g.value(stmt.Expression, discard)
+
+	case *ast.LetStatement:
+		g.let(stmt, top)
+
+	case *ast.ReturnStatement:
+		switch {
+		case !g.inFunction:
+			// a return ends the program
+			if stmt.ReturnValue != nil {
+				g.value(stmt.ReturnValue, discard)
+			}
+			g.printf("return\n")
+		case stmt.ReturnValue == nil:
+			g.printf("return object.NULL\n")
+		default:
+			g.value(stmt.ReturnValue, ret)
+		}
+
+	case *ast.BreakStatement:
+		if g.loops == 0 {
+			g.unsupported(stmt, "break outside of loop")
+		}
+		g.printf("break\n")
+
+	case *ast.ContinueStatement:
+		if g.loops == 0 {
+			g.unsupported(stmt, "continue outside of loop")
+		}
+		g.printf("continue\n")
+
+	case *ast.ForInStatement:
+		g.forIn(stmt)
+
+	case *ast.BlockStatement:
+		g.block(stmt.Statements, discard, false)
+	}
+}
+
+func (g *generator) let(ls *ast.LetStatement, top bool) {
+	names := []*ast.Identifier{ls.Name}
+	if ls.Pattern != nil {
+		names = ls.Pattern.Names
+	}
+
+	for _, name := range names {
+		if g.variable(name).constDeclared {
+			g.printf("rt.Fail(%d, %d, %s)\n", name.Token.Line, name.Token.Column,
+				strconv.Quote("cannot redeclare constant: "+name.Value))
+			return
+		}
+	}
+
+	switch {
+	case ls.Pattern == nil:
+		g.value(ls.Value, assignTo(g.variable(ls.Name).name))
+
+	case ls.Pattern.IsHash():
+		vals := g.newName("vals")
+		quoted := make([]string, len(names))
+		for i, name := range names {
+			quoted[i] = strconv.Quote(name.Value)
+		}
+		g.printf("%s := rt.Fields(%s, %s, %s)\n", vals, g.pos(ls.Pattern.Token.Line, ls.Pattern.Token.Column),
+			g.expression(ls.Value), strings.Join(quoted, ", "))
+		g.unpack(vals, names)
+
+	default:
+		vals := g.newName("vals")
+		g.printf("%s := rt.Unpack(%s, %s, %d)\n", vals, g.pos(ls.Pattern.Token.Line, ls.Pattern.Token.Column),
+			g.expression(ls.Value), len(names))
+		g.unpack(vals, names)
+	}
+
+	for _, name := range names {
+		v := g.variable(name)
+		if top {
+			g.initialized[v] = true
+		}
+		if ls.IsConst() {
+			v.constDeclared = true
+		}
+	}
+}
+
+func (g *generator) unpack(vals string, names []*ast.Identifier) {
+	for i, name := range names {
+		g.printf("%s = %s[%d]\n", g.variable(name).name, vals, i)
+	}
+}
+
+// forIn generates a loop whose body is a Go block of its own, so that
+// closures made in different iterations see different variables, as they
+// do on the evaluator.
+func (g *generator) forIn(fs *ast.ForInStatement) {
+	g.printf("for it := rt.Iterate(%s, %s, %t); it.Next(); {\n",
+		g.pos(fs.Token.Line, fs.Token.Column), g.expression(fs.Iterable), fs.Key != nil)
+
+	g.scope(g.info.Scopes[fs])
+	if fs.Key != nil {
+		key := g.variable(fs.Key)
+		g.printf("%s = it.Key\n", key.name)
+		g.initialized[key] = true
+	}
+	value := g.variable(fs.Value)
+	g.printf("%s = it.Value\n", value.name)
+	g.initialized[value] = true
+
+	g.loops++
+	g.block(fs.Body.Statements, discard, true)
+	g.loops--
+
+	g.printf("}\n")
+}
+
+// value generates exp for t. The control flow of if, match and try is
+// generated as statements for t, rather than as an expression.
+func (g *generator) value(exp ast.Expression, t target) {
+	switch exp := exp.(type) {
+	case *ast.IfExpression:
+		g.ifExpression(exp, t)
+
+	case *ast.MatchExpression:
+		g.match(exp, t)
+
+	case *ast.TryExpression:
+		code := g.try(exp)
+		if t.kind == discardKind {
+			g.printf("%s\n", code)
+		} else {
+			g.finish(t, code)
+		}
+
+	case *ast.AssignExpression:
+		if t.kind != discardKind {
+			g.finish(t, g.expression(exp))
+			return
+		}
+		v, failure := g.assignable(exp)
+		if v == nil {
+			g.printf("%s\n", failure)
+			return
+		}
+		g.printf("%s = %s\n", v.name, g.expression(exp.Value))
+
+	default:
+		g.finish(t, g.expression(exp))
+	}
+}
+
+func (g *generator) ifExpression(ie *ast.IfExpression, t target) {
+	g.printf("if rt.Truthy(%s) {\n", g.expression(ie.Condition))
+	g.block(ie.Consequence.Statements, t, false)
+	switch {
+	case ie.Alternative != nil:
+		g.printf("} else {\n")
+		g.block(ie.Alternative.Statements, t, false)
+	case t.kind != discardKind:
+		g.printf("} else {\n")
+		g.finish(t, "object.NULL")
+	}
+	g.printf("}\n")
+}
+
+func (g *generator) match(me *ast.MatchExpression, t target) {
+	subject := g.expression(me.Subject)
+	if len(me.Arms) == 0 || me.Arms[0].Pattern == nil {
+		g.printf("_ = %s\n", subject)
+		if len(me.Arms) == 0 {
+			g.finish(t, "object.NULL")
+		} else {
+			g.value(me.Arms[0].Body, t)
+		}
+		return
+	}
+
+	name := g.newName("subject")
+	g.printf("%s := %s\n", name, subject)
+
+	wildcard := false
+	for i, arm := range me.Arms {
+		if arm.Pattern == nil {
+			g.printf("} else {\n")
+			g.value(arm.Body, t)
+			wildcard = true
+			break
+		}
+
+		if i > 0 {
+			g.printf("} else ")
+		}
+		g.printf("if rt.Matches(%s, %s) {\n", name, g.expression(arm.Pattern))
+		g.value(arm.Body, t)
+	}
+	if !wildcard && t.kind != discardKind {
+		g.printf("} else {\n")
+		g.finish(t, "object.NULL")
+	}
+	g.printf("}\n")
+}
+
+// try returns a call of rt.Try with the block and the handler as
+// closures.
+func (g *generator) try(te *ast.TryExpression) string {
+	if jumpsOut(te.Block) || jumpsOut(te.Handler) {
+		g.unsupported(te, "return, break and continue inside try are not supported")
+	}
+
+	block := g.closure(func() {
+		g.block(te.Block.Statements, ret, false)
+	})
+
+	param := g.variable(te.Param)
+	wasInitialized := g.initialized[param]
+	g.initialized[param] = true
+	handler := g.closure(func() {
+		g.printf("%s = message\n", param.name)
+		g.block(te.Handler.Statements, ret, false)
+	})
+	g.initialized[param] = wasInitialized
+
+	return fmt.Sprintf("rt.Try(func() object.Object {\n%s}, func(message object.Object) object.Object {\n%s})",
+		block, handler)
+}
+
+// closure returns the code generate writes, for the body of a Go function
+// literal.
+func (g *generator) closure(generate func()) string {
+	out, loops := g.out, g.loops
+	g.out, g.loops = &bytes.Buffer{}, 0
+	defer func() { g.out, g.loops = out, loops }()
+
+	generate()
+	return g.out.String()
+}
+
+// jumpsOut reports whether node holds a return, or a break or continue
+// outside the loops in it, that would leave a Go function literal made
+// for it. Function literals in node are not searched.
+func jumpsOut(node ast.Node) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FunctionLiteral:
+			return false
+		case *ast.ReturnStatement, *ast.BreakStatement, *ast.ContinueStatement:
+			found = true
+		case *ast.ForInStatement:
+			found = found || jumpsOut(n.Iterable) || returns(n.Body)
+			return false
+		}
+		return !found
+	})
+	return found
+}
+
+// returns reports whether node holds a return outside the function
+// literals in it.
+func returns(node ast.Node) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.FunctionLiteral:
+			return false
+		case *ast.ReturnStatement:
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+func (g *generator) pos(line, column int) string {
+	return fmt.Sprintf("%d, %d", line, column)
+}
+
+// infixFuncs are the rt functions for the operators that have one.
+var infixFuncs = map[string]string{
+	"+":  "rt.Add",
+	"-":  "rt.Sub",
+	"*":  "rt.Mul",
+	"<":  "rt.Less",
+	">":  "rt.Greater",
+	"<=": "rt.LessEqual",
+	">=": "rt.GreaterEqual",
+	"==": "rt.Equal",
+	"!=": "rt.NotEqual",
+}
+
+// expression returns the Go expression for exp.
+func (g *generator) expression(exp ast.Expression) string {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return g.literal(fmt.Sprintf("object.NewInt(%d)", exp.Value))
+
+	case *ast.FloatLiteral:
+		return g.literal(fmt.Sprintf("&object.Float{Value: %s}", strconv.FormatFloat(exp.Value, 'g', -1, 64)))
+
+	case *ast.StringLiteral:
+		return g.literal(fmt.Sprintf("&object.String{Value: %s}", strconv.Quote(exp.Value)))
+
+	case *ast.Boolean:
+		if exp.Value {
+			return "object.TRUE"
+		}
+		return "object.FALSE"
+
+	case *ast.Identifier:
+		return g.identifier(exp)
+
+	case *ast.PrefixExpression:
+		right := g.expression(exp.Right)
+		if exp.Operator == "!" {
+			return fmt.Sprintf("rt.Not(%s)", right)
+		}
+		return fmt.Sprintf("rt.Prefix(%s, %q, %s)", g.pos(exp.Token.Line, exp.Token.Column), exp.Operator, right)
+
+	case *ast.InfixExpression:
+		return g.infix(exp)
+
+	case *ast.IfExpression, *ast.MatchExpression:
+		if jumpsOut(exp) {
+			g.unsupported(exp, "return, break and continue inside an if or match used as a value are not supported")
+		}
+		return fmt.Sprintf("func() object.Object {\n%s}()", g.closure(func() {
+			g.value(exp, ret)
+		}))
+
+	case *ast.TryExpression:
+		return g.try(exp)
+
+	case *ast.AssignExpression:
+		v, failure := g.assignable(exp)
+		if v == nil {
+			return failure
+		}
+		return fmt.Sprintf("rt.Store(&%s, %s)", v.name, g.expression(exp.Value))
+
+	case *ast.IndexAssignExpression:
+		return fmt.Sprintf("rt.SetIndex(%s, %s, %s, %s)", g.pos(exp.Token.Line, exp.Token.Column),
+			g.expression(exp.Left), g.expression(exp.Index), g.expression(exp.Value))
+
+	case *ast.ArrayLiteral:
+		return fmt.Sprintf("rt.Array(%s)", g.expressions(exp.Elements))
+
+	case *ast.IndexExpression:
+		return fmt.Sprintf("rt.Index(%s, %s, %s)", g.pos(exp.Token.Line, exp.Token.Column),
+			g.expression(exp.Left), g.expression(exp.Index))
+
+	case *ast.SliceExpression:
+		start, end := "object.NULL", "object.NULL"
+		if exp.Start != nil {
+			start = g.expression(exp.Start)
+		}
+		if exp.End != nil {
+			end = g.expression(exp.End)
+		}
+		return fmt.Sprintf("rt.Slice(%s, %s, %s, %s)", g.pos(exp.Token.Line, exp.Token.Column),
+			g.expression(exp.Left), start, end)
+
+	case *ast.HashLiteral:
+		pairs := make([]string, 0, 2*len(exp.Pairs))
+		for _, pair := range exp.Pairs {
+			pairs = append(pairs, g.expression(pair.Key), g.expression(pair.Value))
+		}
+		return fmt.Sprintf("rt.Hash(%s, %s)", g.pos(exp.Token.Line, exp.Token.Column), strings.Join(pairs, ", "))
+
+	case *ast.TemplateLiteral:
+		return fmt.Sprintf("rt.Template(%s)", g.expressions(exp.Parts))
+
+	case *ast.FunctionLiteral:
+		return g.function(exp)
+
+	case *ast.CallExpression:
+		return g.call(exp)
+
+	case *ast.SpreadExpression:
+		return fmt.Sprintf("rt.Fail(%s, %s)", g.pos(exp.Token.Line, exp.Token.Column),
+			strconv.Quote("'...' can only spread the last argument of a call"))
+
+	case *ast.MethodCallExpression:
+		g.unsupported(exp, "method calls are not supported")
+	case *ast.FieldExpression:
+		g.unsupported(exp, "field access is not supported")
+	case *ast.StructLiteral:
+		g.unsupported(exp, "structs are not supported")
+	case *ast.SpawnExpression:
+		g.unsupported(exp, "spawn is not supported")
+	case *ast.ImportExpression:
+		g.unsupported(exp, "import is not supported")
+	}
+
+	g.unsupported(exp, "%T is not supported", exp)
+	return ""
+}
+
+func (g *generator) expressions(exps []ast.Expression) string {
+	codes := make([]string, len(exps))
+	for i, exp := range exps {
+		codes[i] = g.expression(exp)
+	}
+	return strings.Join(codes, ", ")
+}
+
+// literal returns the package-level variable holding the value code
+// creates.
+func (g *generator) literal(code string) string {
+	name, ok := g.literals[code]
+	if !ok {
+		name = fmt.Sprintf("lit%d", len(g.literals))
+		g.literals[code] = name
+		g.globals = append(g.globals, fmt.Sprintf("%s = %s", name, code))
+	}
+	return name
+}
+
+func (g *generator) identifier(ident *ast.Identifier) string {
+	decl := g.info.Refs[ident]
+	switch decl.Kind {
+	case resolver.Builtin:
+		name, ok := g.builtins[ident.Value]
+		if !ok {
+			name = g.newName("builtin_" + ident.Value)
+			g.builtins[ident.Value] = name
+			g.globals = append(g.globals, fmt.Sprintf("%s = rt.Builtin(%q)", name, ident.Value))
+		}
+		return name
+
+	case resolver.Unresolved:
+		return fmt.Sprintf("rt.Fail(%s, %s)", g.pos(ident.Token.Line, ident.Token.Column),
+			strconv.Quote("identifier not found: "+ident.Value))
+	}
+
+	v := g.vars[decl]
+	if g.initialized[v] {
+		return v.name
+	}
+	return fmt.Sprintf("rt.Load(%s, %s, %q)", g.pos(ident.Token.Line, ident.Token.Column), v.name, ident.Value)
+}
+
+// assignable returns the variable ae assigns to. Assignments to constants
+// and to names that are not variables fail when they run, so for them it
+// returns the code that fails instead.
+func (g *generator) assignable(ae *ast.AssignExpression) (v *variable, failure string) {
+	decl := g.info.Refs[ae.Name]
+	message := ""
+	switch {
+	case decl.Kind == resolver.Builtin || decl.Kind == resolver.Unresolved:
+		message = "cannot assign to undeclared identifier: " + ae.Name.Value
+	case g.vars[decl].isConst:
+		message = "cannot assign to constant: " + ae.Name.Value
+	default:
+		return g.vars[decl], ""
+	}
+
+	return nil, fmt.Sprintf("rt.Fail(%s, %s, %s)", g.pos(ae.Token.Line, ae.Token.Column),
+		strconv.Quote(message), g.expression(ae.Value))
+}
+
+func (g *generator) infix(ie *ast.InfixExpression) string {
+	left, right := g.expression(ie.Left), g.expression(ie.Right)
+	pos := g.pos(ie.Token.Line, ie.Token.Column)
+
+	switch ie.Operator {
+	case "&&":
+		return fmt.Sprintf("rt.Bool(rt.Truthy(%s) && rt.Truthy(%s))", left, right)
+	case "||":
+		return fmt.Sprintf("rt.Bool(rt.Truthy(%s) || rt.Truthy(%s))", left, right)
+	case "??":
+		return fmt.Sprintf("rt.Coalesce(%s, func() object.Object {\nreturn %s\n})", left, right)
+	}
+
+	if fn, ok := infixFuncs[ie.Operator]; ok {
+		return fmt.Sprintf("%s(%s, %s, %s)", fn, pos, left, right)
+	}
+	return fmt.Sprintf("rt.Infix(%s, %q, %s, %s)", pos, ie.Operator, left, right)
+}
+
+// function returns a call of rt.Func with the function's body as a Go
+// function literal, whose variables are those of the body's scope.
+func (g *generator) function(fl *ast.FunctionLiteral) string {
+	inFunction := g.inFunction
+	g.inFunction = true
+	defer func() { g.inFunction = inFunction }()
+
+	body := g.closure(func() {
+		g.scope(g.info.Scopes[fl])
+		for i, param := range fl.Parameters {
+			v := g.variable(param)
+			g.printf("%s = args[%d]\n", v.name, i)
+			g.initialized[v] = true
+		}
+		g.block(fl.Body.Statements, ret, true)
+	})
+
+	return fmt.Sprintf("rt.Func(%d, %t, func(args []object.Object) object.Object {\n%s})",
+		len(fl.Parameters), fl.Variadic, body)
+}
+
+func (g *generator) call(ce *ast.CallExpression) string {
+	fn := g.expression(ce.Function)
+	pos := g.pos(ce.Token.Line, ce.Token.Column)
+
+	spreads := false
+	for _, arg := range ce.Arguments {
+		if _, ok := arg.(*ast.SpreadExpression); ok {
+			spreads = true
+		}
+	}
+	if !spreads {
+		if len(ce.Arguments) == 0 {
+			return fmt.Sprintf("rt.Call(%s, %s)", pos, fn)
+		}
+		return fmt.Sprintf("rt.Call(%s, %s, %s)", pos, fn, g.expressions(ce.Arguments))
+	}
+
+	// the arguments are passed in groups, each a spread array or a run of
+	// single arguments
+	var groups, single []string
+	flush := func() {
+		if len(single) > 0 {
+			groups = append(groups, fmt.Sprintf("[]object.Object{%s}", strings.Join(single, ", ")))
+			single = nil
+		}
+	}
+	for _, arg := range ce.Arguments {
+		spread, ok := arg.(*ast.SpreadExpression)
+		if !ok {
+			single = append(single, g.expression(arg))
+			continue
+		}
+		flush()
+		groups = append(groups, fmt.Sprintf("rt.Spread(%s, %s)",
+			g.pos(spread.Token.Line, spread.Token.Column), g.expression(spread.Value)))
+	}
+	flush()
+
+	return fmt.Sprintf("rt.Call(%s, %s, rt.Args(%s)...)", pos, fn, strings.Join(groups, ", "))
+}
+
+// output assembles the package and formats it.
+func (g *generator) output() ([]byte, error) {
+	body := g.out.String()
+
+	var out bytes.Buffer
+	out.WriteString("// Code generated by monkey build -target=go. DO NOT EDIT.\n\n")
+	out.WriteString("package main\n\n")
+	out.WriteString("import (\n")
+	if strings.Contains(body, "object.") || len(g.literals) > 0 {
+		out.WriteString("\t\"monkey/object\"\n")
+	}
+	out.WriteString("\t\"monkey/transpiler/rt\"\n)\n\n")
+
+	if len(g.globals) > 0 {
+		out.WriteString("var (\n")
+		for _, global := range g.globals {
+			out.WriteString(global + "\n")
+		}
+		out.WriteString(")\n\n")
+	}
+
+	out.WriteString("func main() {\n\trt.Main(run)\n}\n\n")
+	out.WriteString("func run() {\n" + body + "}\n")
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated invalid Go: %s", err)
+	}
+	return src, nil
+}
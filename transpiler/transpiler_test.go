@@ -0,0 +1,232 @@
+package transpiler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+// TestGenerate builds the Go programs generated for the inputs and checks
+// that they print what the inputs print on the evaluator, and fail the
+// same way.
+func TestGenerate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds Go programs")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+
+	inputs := []string{
+		`let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+		puts(fib(15));`,
+
+		// closures keep their own variables
+		`let counter = fn() { let n = 0; fn() { n += 1; n } };
+		let a = counter(); let b = counter();
+		a(); a(); b();
+		puts(a(), b());`,
+		`let fns = [];
+		for (i in 0..3) { fns = push(fns, fn() { i * 10 }) }
+		puts(map(fns, fn(f) { f() }));`,
+
+		`let total = 0;
+		for (x in [1, 2, 3, 4, 5, 6]) {
+			if (x == 2) { continue }
+			if (x == 5) { break }
+			total += x;
+		}
+		puts(total);
+		for (i, c in "héllo") { puts(i, c) }
+		let h = {"a": 1, "b": 2};
+		for (k, v in h) { puts(k, v) }
+		for (k in h) { puts(k) }`,
+
+		`let a = [1, 2, 3, 4];
+		a[0] = 10;
+		let h = {"x": [1, 2], 3: "three", true: 1.5};
+		h["y"] = a[1:3];
+		puts(a, a[-1], a[10], h["x"][1], h[3], h[true], h["y"], len(a[:2]));
+		puts("ab" + "c", 7 / 2, 7.0 / 2, 2 ** 10, -3 % 2, "a" < "b", !true, !0, -2.5);
+		let null = first([]);
+		puts(1 == 1.0, [1] == [1], null ?? 2, 1 ?? 2, true && 0, false || null);
+		puts("x=${a[0]} and ${h}");`,
+
+		`let classify = fn(n) {
+			match (n % 3) {
+				0 => "fizz",
+				1 => if (n > 5) { "big" } else { "small" },
+				_ => n
+			}
+		};
+		puts(map([3, 4, 7, 8], classify));
+		let grade = fn(n) {
+			let g = if (n > 90) { "A" } else { if (n > 50) { "B" } else { "C" } };
+			if (n < 0) { return "?" }
+			g + "!"
+		};
+		puts(grade(95), grade(60), grade(1), grade(-1));
+		puts(if (false) { 1 }, match (1) { 2 => 3 });`,
+
+		`let r = try { 1 / 0 } catch (e) { "caught: " + e };
+		puts(r);
+		puts(try { 1 } catch (e) { 2 });
+		let f = fn(x) { if (x > 2) { 1 + "a" } else { x } };
+		puts(try { f(3) } catch (e) { e });`,
+
+		`let [a, b] = [1, 2];
+		let {name, age} = {"name": "Ada", "age": 36};
+		puts(a + b, name, age);
+		let sum = fn(first, rest...) { reduce(rest, first, fn(acc, x) { acc + x }) };
+		puts(sum(1), sum(1, 2, 3), sum([4, 5, 6]...), sum(1, [2, 3]...));
+		const limit = 3;
+		puts(limit);`,
+
+		// variables named like Go keywords and shadowing
+		`let type = 1; let func = 2; let range = type + func;
+		let x = 1;
+		let f = fn() { let y = x; let x = 2; [x, y] };
+		let x = 3;
+		puts(range, f(), x);
+		let len = fn(a) { 42 };
+		puts(len([1]));`,
+
+		// runtime errors stop the program where they happen
+		`puts("before");
+		let f = fn(x) { x + true };
+		f(1);
+		puts("after");`,
+		`let f = fn() { g };
+		f();`,
+		`let f = fn() { later };
+		let later = 1;
+		puts(f());
+		let g = fn() { undeclared() };
+		g();`,
+		`const c = 1;
+		c = 2;`,
+		`let f = fn(a, b) { a };
+		f(1);`,
+		`let f = fn(n) { 1 + f(n + 1) };
+		f(0);`,
+		`for (x in 5) { x }`,
+		`puts(1); exit(3); puts(2);`,
+	}
+
+	dir, err := os.MkdirTemp(".", "testgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var packages []string
+	for i, input := range inputs {
+		src, err := Generate(parse(t, input))
+		if err != nil {
+			t.Fatalf("Generate(%q) failed: %s", input, err)
+		}
+
+		pkg := filepath.Join(dir, fmt.Sprintf("p%d", i))
+		if err := os.Mkdir(pkg, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(pkg, "main.go"), src, 0644); err != nil {
+			t.Fatal(err)
+		}
+		packages = append(packages, "./"+filepath.ToSlash(pkg))
+	}
+
+	bin := filepath.Join(dir, "bin")
+	build := exec.Command("go", append([]string{"build", "-o", bin + string(filepath.Separator)}, packages...)...)
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("go build failed: %s\n%s", err, out)
+	}
+
+	for i, input := range inputs {
+		var want bytes.Buffer
+		result := evaluator.EvalWithConfig(context.Background(), parse(t, input),
+			object.NewEnvironment(), evaluator.Config{Stdout: &want, AllowExit: true})
+
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(filepath.Join(bin, fmt.Sprintf("p%d", i)))
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		err := cmd.Run()
+
+		if stdout.String() != want.String() {
+			t.Errorf("wrong output for %q.\nwant=%q\ngot=%q", input, want.String(), stdout.String())
+		}
+
+		errObj, failed := result.(*object.Error)
+		switch {
+		case !failed && err != nil:
+			t.Errorf("program %q failed: %s\n%s", input, err, stderr.String())
+		case failed && errObj.Exit != nil:
+			exit, ok := err.(*exec.ExitError)
+			if !ok || exit.ExitCode() != errObj.Exit.Code {
+				t.Errorf("program %q exited with %v, want status %d", input, err, errObj.Exit.Code)
+			}
+		case failed && !strings.HasSuffix(stderr.String(), ": "+errObj.Inspect()+"\n"):
+			t.Errorf("wrong error for %q.\nwant=%q\ngot=%q", input, errObj.Inspect(), stderr.String())
+		}
+	}
+}
+
+func TestGenerateUnsupported(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let p = struct { x };", "1:9: structs are not supported"},
+		{"[1].len()", "1:4: method calls are not supported"},
+		{`import("x")`, "1:1: import is not supported"},
+		{"spawn(fn() { 1 })", "1:1: spawn is not supported"},
+		{"fn() { try { return 1 } catch (e) { 2 } }",
+			"1:8: return, break and continue inside try are not supported"},
+		{"fn(x) { 1 + if (x) { return 2 } else { 3 } }",
+			"1:13: return, break and continue inside an if or match used as a value are not supported"},
+	}
+
+	for _, tt := range tests {
+		_, err := Generate(parse(t, tt.input))
+		if err == nil {
+			t.Errorf("Generate(%q) did not fail", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestGenerateNames(t *testing.T) {
+	src, err := Generate(parse(t, "let map = 1; let x = 2; let f = fn() { let x = 3; x }; puts(map, f());"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"var map_2, x, f object.Object", "var x_2 object.Object", `builtin_puts = rt.Builtin("puts")`} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, src)
+		}
+	}
+}
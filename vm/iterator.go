@@ -0,0 +1,102 @@
+package vm
+
+import (
+	"fmt"
+	"monkey/object"
+	"unicode/utf8"
+)
+
+const ITERATOR_OBJ = "ITERATOR"
+
+// iterator walks the elements of an array, the integers of a range, the
+// characters of a string or the keys of a hash for a for-in loop. It only
+// ever lives on the stack and in the hidden variable the compiler
+// allocates for each loop.
+//
+// Ranges and strings are walked as the loop goes, so that a loop over a
+// huge range starts at once and can be stopped by the VM's limits.
+type iterator struct {
+	// the elements of an array, or the values of a hash and its keys
+	values []object.Object
+	keys   []object.Object
+
+	rng *object.Range
+
+	str    *object.String
+	offset int // the byte offset of the next character of str
+
+	// the number of iterations so far, which is the index of the next
+	// element
+	pos int64
+
+	// withKey makes next produce the index or key as well as the value
+	withKey bool
+}
+
+func (it *iterator) Type() object.ObjectType { return ITERATOR_OBJ }
+func (it *iterator) Inspect() string         { return "iterator" }
+
+func newIterator(iterable object.Object, withKey bool) (*iterator, error) {
+	it := &iterator{withKey: withKey}
+
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		it.values = iterable.Elements
+
+	case *object.Range:
+		it.rng = iterable
+
+	case *object.String:
+		it.str = iterable
+
+	case *object.Hash:
+		for _, pair := range iterable.Ordered() {
+			it.keys = append(it.keys, pair.Key)
+			it.values = append(it.values, pair.Value)
+		}
+		if !withKey {
+			it.values = it.keys
+		}
+
+	default:
+		return nil, fmt.Errorf("cannot iterate over %s", iterable.Type())
+	}
+
+	return it, nil
+}
+
+// next advances the iterator, reporting false once it is exhausted.
+func (it *iterator) next() (key, value object.Object, ok bool) {
+	switch {
+	case it.rng != nil:
+		n, ok := it.rng.At(it.pos)
+		if !ok {
+			return nil, nil, false
+		}
+		value = object.NewInt(n)
+
+	case it.str != nil:
+		if it.offset >= len(it.str.Value) {
+			return nil, nil, false
+		}
+		r, size := utf8.DecodeRuneInString(it.str.Value[it.offset:])
+		it.offset += size
+		value = &object.String{Value: string(r)}
+
+	default:
+		if it.pos >= int64(len(it.values)) {
+			return nil, nil, false
+		}
+		value = it.values[it.pos]
+	}
+
+	switch {
+	case !it.withKey:
+	case it.keys != nil:
+		key = it.keys[it.pos]
+	default:
+		key = object.NewInt(it.pos)
+	}
+	it.pos++
+	return key, value, true
+}
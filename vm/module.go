@@ -0,0 +1,109 @@
+package vm
+
+import (
+	"fmt"
+	"monkey/compiler"
+	"monkey/module"
+	"monkey/object"
+	"path/filepath"
+	"strings"
+)
+
+// SetDir sets the directory relative imports are resolved against. It
+// defaults to the working directory.
+func (vm *VM) SetDir(dir string) {
+	vm.dir = dir
+}
+
+// importModule compiles the module at path and runs it in a VM of its
+// own, sharing this VM's constants and module cache. The module's globals
+// stay separate: closures it creates carry them along, so they keep
+// working when called from the importing program.
+func (vm *VM) importModule(pathObj object.Object) (object.Object, error) {
+	str, ok := pathObj.(*object.String)
+	if !ok {
+		return nil, fmt.Errorf("import path must be STRING, got %s", pathObj.Type())
+	}
+
+	path, err := module.Resolve(vm.dir, str.Value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot import %q: %s", str.Value, err)
+	}
+	if !module.IsStd(path) && !vm.allowFS {
+		return nil, fmt.Errorf("cannot import %q: file system access is disabled", str.Value)
+	}
+
+	if mod, ok := vm.modules[path]; ok {
+		// a nil entry is a module that is still being run
+		if mod == nil {
+			return nil, fmt.Errorf("import cycle: %s", path)
+		}
+		return mod, nil
+	}
+
+	program, err := module.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot import %q: %s", str.Value, err)
+	}
+
+	symbolTable := compiler.NewSymbolTable()
+	comp := compiler.NewWithState(symbolTable, vm.constants)
+	if err := comp.Compile(program); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	machine := New(comp.Bytecode(),
+		WithStackSize(len(vm.stack)),
+		WithMaxFrames(len(vm.frames)),
+		WithGlobalsSize(len(vm.globals)))
+	machine.dir = filepath.Dir(path)
+	machine.modules = vm.modules
+	machine.bigIntegers = vm.bigIntegers
+	machine.strictBool = vm.strictBool
+	machine.strictIndexing = vm.strictIndexing
+	machine.stdout, machine.stderr, machine.stdin = vm.stdout, vm.stderr, vm.stdin
+	machine.allowFS, machine.allowNet = vm.allowFS, vm.allowNet
+	machine.allowEnv, machine.allowExec, machine.allowExit = vm.allowEnv, vm.allowExec, vm.allowExit
+	machine.args = vm.args
+	machine.rng = vm.Rand()
+	machine.hook = vm.hook
+
+	// the module's instructions and values count against the budgets of
+	// the importing run
+	machine.ctx = vm.ctx
+	machine.steps, machine.maxSteps = vm.steps, vm.maxSteps
+	machine.allocated, machine.maxMemObjects = vm.allocated, vm.maxMemObjects
+
+	vm.modules[path] = nil
+	err = machine.run(0)
+	vm.steps, vm.allocated = machine.steps, machine.allocated
+	if err != nil {
+		delete(vm.modules, path)
+		return nil, err
+	}
+	vm.constants = machine.constants
+
+	mod := &object.Module{Path: path, Members: map[string]object.Object{}}
+	for _, s := range symbolTable.Symbols() {
+		// skip hidden variables such as a loop's iterator
+		if strings.HasPrefix(s.Name, "$") {
+			continue
+		}
+		mod.Members[s.Name] = machine.globals[s.Index]
+	}
+	vm.modules[path] = mod
+
+	return mod, nil
+}
+
+func (vm *VM) executeModuleIndex(mod, index object.Object) error {
+	moduleObject := mod.(*object.Module)
+	name := index.(*object.String).Value
+
+	member, ok := moduleObject.Members[name]
+	if !ok {
+		return fmt.Errorf("module has no member: %s", name)
+	}
+
+	return vm.push(member)
+}
@@ -0,0 +1,42 @@
+package vm
+
+import "monkey/object"
+
+// An Option configures a VM created by New.
+type Option func(*VM)
+
+// WithStackSize sets the number of values the stack holds before running
+// fails with ErrStackOverflow. It defaults to StackSize.
+func WithStackSize(n int) Option {
+	return func(vm *VM) {
+		vm.stack = make([]object.Object, n)
+	}
+}
+
+// WithMaxFrames limits how deeply function calls may nest, including the
+// main program, before running fails with ErrStackOverflow. It defaults
+// to MaxFrames.
+func WithMaxFrames(n int) Option {
+	return func(vm *VM) {
+		frames := make([]*Frame, n)
+		copy(frames, vm.frames[:vm.framesIndex])
+		vm.frames = frames
+	}
+}
+
+// WithGlobalsSize sets the number of global variables the program may
+// define before running fails with ErrGlobalsExhausted. It defaults to
+// GlobalsSize.
+func WithGlobalsSize(n int) Option {
+	return WithGlobals(make([]object.Object, n))
+}
+
+// WithGlobals makes the VM use globals, and share them with previous runs
+// that used them, as the REPL does between lines. Their length limits the
+// number of global variables like WithGlobalsSize.
+func WithGlobals(globals []object.Object) Option {
+	return func(vm *VM) {
+		vm.globals = globals
+		vm.frames[0].cl.Globals = globals
+	}
+}
@@ -0,0 +1,36 @@
+package vm
+
+import "monkey/object"
+
+// handler is a try block being run: the frame and stack height it started
+// with, and where its catch handler begins.
+type handler struct {
+	framesIndex int
+	sp          int
+	catchPos    int
+}
+
+// catch unwinds to the innermost try block started by the run that stops
+// at stop, and resumes at its handler with err's message on the stack. It
+// reports false when there is no such block, or when running was
+// cancelled, ran out of budget or memory or the program called exit, which
+// no handler may recover from.
+func (vm *VM) catch(err error, stop int) bool {
+	if len(vm.handlers) == 0 || vm.ctx.Err() != nil || vm.overBudget() || vm.overMemory() {
+		return false
+	}
+	if _, ok := err.(*object.ExitError); ok {
+		return false
+	}
+	h := vm.handlers[len(vm.handlers)-1]
+	if h.framesIndex <= stop {
+		return false
+	}
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	vm.framesIndex = h.framesIndex
+	vm.sp = h.sp
+	vm.currentFrame().ip = h.catchPos - 1
+
+	return vm.push(&object.String{Value: err.Error()}) == nil
+}
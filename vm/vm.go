@@ -0,0 +1,1355 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/object"
+	"os"
+	"strings"
+	"time"
+)
+
+// The sizes of a VM unless New is given options like WithStackSize.
+const StackSize = 2048
+const GlobalsSize = 65536
+const MaxFrames = 1024
+
+var (
+	// ErrStackOverflow is returned by a run that nests calls more deeply
+	// than WithMaxFrames allows, or holds more values than fit on the
+	// stack set with WithStackSize.
+	ErrStackOverflow = errors.New("stack overflow")
+
+	// ErrGlobalsExhausted is returned by a run that uses more global
+	// variables than WithGlobalsSize allows.
+	ErrGlobalsExhausted = errors.New("globals exhausted")
+)
+
+// cancelCheckInterval is how many instructions RunContext executes
+// between checks of its context.
+const cancelCheckInterval = 1024
+
+var True = object.TRUE
+var False = object.FALSE
+var Null = object.NULL
+
+type VM struct {
+	constants []object.Object
+
+	stack []object.Object
+	sp    int // Always points to the next value. Top of stack is stack[sp-1]
+
+	globals []object.Object
+
+	frames      []*Frame
+	framesIndex int
+
+	// handlers are the try blocks being run, innermost last
+	handlers []handler
+
+	// dir is the directory relative imports are resolved against, and
+	// modules caches imported modules by resolved path
+	dir     string
+	modules map[string]*object.Module
+
+	// ctx is the context of the current RunContext call
+	ctx context.Context
+
+	// bigIntegers promotes integer results that overflow int64 to big
+	// integers instead of wrapping around
+	bigIntegers bool
+
+	// strictBool makes conditions fail unless they are booleans
+	strictBool bool
+
+	// strictIndexing makes out-of-bounds array indexes fail instead of
+	// giving null
+	strictIndexing bool
+
+	// the streams of builtins like puts, eputs and readLine
+	stdout io.Writer
+	stderr io.Writer
+	stdin  io.Reader
+
+	// allowFS lets builtins use the file system, allowNet the network,
+	// allowEnv read environment variables, allowExec run commands and
+	// allowExit stop the program
+	allowFS   bool
+	allowNet  bool
+	allowEnv  bool
+	allowExec bool
+	allowExit bool
+
+	// args are the command-line arguments returned by args
+	args []string
+
+	// hook, if set, is called before every instruction
+	hook Hook
+
+	// rng is the generator of builtins like random, created on first use
+	rng *rand.Rand
+
+	// steps counts the instructions executed by the current run, which
+	// fails once there are more than maxSteps of them, if it is set
+	steps    int
+	maxSteps int
+
+	// allocated is the size of the values created by the current run,
+	// which fails once it exceeds maxMemObjects, if that is set
+	allocated     int
+	maxMemObjects int
+}
+
+// ErrBudgetExceeded is returned by a run that executed more instructions
+// than SetMaxSteps allows.
+var ErrBudgetExceeded = errors.New("execution budget exceeded")
+
+// ErrMemoryLimitExceeded is returned by a run that created more values
+// than SetMaxMemObjects allows.
+var ErrMemoryLimitExceeded = errors.New("memory limit exceeded")
+
+// A Hook follows a run instruction by instruction, for tools like
+// profilers. It is called with the function about to execute an
+// instruction, the instruction's offset in the function's instructions
+// and its opcode. Running stops with an error if the context is done once
+// the hook returns.
+type Hook func(fn *object.CompiledFunction, ip int, op code.Opcode)
+
+// New creates a VM that runs bytecode, configured by opts.
+func New(bytecode *compiler.Bytecode, opts ...Option) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	globals := make([]object.Object, GlobalsSize)
+	mainClosure := &object.Closure{Fn: mainFn, Globals: globals}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
+	vm := &VM{
+		constants: bytecode.Constants,
+
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		globals: globals,
+
+		frames:      frames,
+		framesIndex: 1,
+
+		modules: map[string]*object.Module{},
+
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		stdin:  os.Stdin,
+	}
+
+	for _, opt := range opts {
+		opt(vm)
+	}
+	return vm
+}
+
+// NewWithGlobalsStore creates a VM that shares globals with previous runs,
+// as the REPL does between lines. It is New with WithGlobals(s) added to
+// opts.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object, opts ...Option) *VM {
+	return New(bytecode, append([]Option{WithGlobals(s)}, opts...)...)
+}
+
+// SetBigIntegers makes integer arithmetic that overflows int64 produce
+// big integers instead of wrapping around.
+func (vm *VM) SetBigIntegers(enabled bool) {
+	vm.bigIntegers = enabled
+}
+
+// SetStrictBool makes the conditions of if and the operands of !, && and
+// || fail with an error unless they are booleans.
+func (vm *VM) SetStrictBool(enabled bool) {
+	vm.strictBool = enabled
+}
+
+// SetStrictIndexing makes out-of-bounds array indexing fail with an error
+// instead of giving null.
+func (vm *VM) SetStrictIndexing(enabled bool) {
+	vm.strictIndexing = enabled
+}
+
+// SetStdout, SetStderr and SetStdin set the streams of builtins like
+// puts, eputs and readLine. They default to os.Stdout, os.Stderr and
+// os.Stdin.
+func (vm *VM) SetStdout(w io.Writer) { vm.stdout = w }
+func (vm *VM) SetStderr(w io.Writer) { vm.stderr = w }
+func (vm *VM) SetStdin(r io.Reader)  { vm.stdin = r }
+
+func (vm *VM) Stdout() io.Writer { return vm.stdout }
+func (vm *VM) Stderr() io.Writer { return vm.stderr }
+func (vm *VM) Stdin() io.Reader  { return vm.stdin }
+
+// SetAllowFS lets builtins like readFile and writeFile use the file
+// system, which they refuse to by default.
+func (vm *VM) SetAllowFS(allowed bool) { vm.allowFS = allowed }
+
+func (vm *VM) AllowFS() bool { return vm.allowFS }
+
+// SetAllowNet, SetAllowEnv, SetAllowExec and SetAllowExit let builtins
+// use the network, read environment variables, run commands and stop the
+// program with exit, all of which they refuse to by default.
+func (vm *VM) SetAllowNet(allowed bool)  { vm.allowNet = allowed }
+func (vm *VM) SetAllowEnv(allowed bool)  { vm.allowEnv = allowed }
+func (vm *VM) SetAllowExec(allowed bool) { vm.allowExec = allowed }
+func (vm *VM) SetAllowExit(allowed bool) { vm.allowExit = allowed }
+
+func (vm *VM) AllowNet() bool  { return vm.allowNet }
+func (vm *VM) AllowEnv() bool  { return vm.allowEnv }
+func (vm *VM) AllowExec() bool { return vm.allowExec }
+func (vm *VM) AllowExit() bool { return vm.allowExit }
+
+// SetArgs sets the command-line arguments returned by args.
+func (vm *VM) SetArgs(args []string) { vm.args = args }
+
+func (vm *VM) Args() []string { return vm.args }
+
+// SetRand sets the random number generator of builtins like random. By
+// default each VM seeds its own from the clock.
+func (vm *VM) SetRand(rng *rand.Rand) { vm.rng = rng }
+
+func (vm *VM) Rand() *rand.Rand {
+	if vm.rng == nil {
+		vm.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return vm.rng
+}
+
+func (vm *VM) Context() context.Context {
+	if vm.ctx == nil {
+		return context.Background()
+	}
+	return vm.ctx
+}
+
+// SetHook makes hook be called before every instruction, including those
+// of imported modules.
+func (vm *VM) SetHook(hook Hook) { vm.hook = hook }
+
+// SetMaxSteps limits each run to n instructions, after which it fails
+// with ErrBudgetExceeded. Unlike a context's deadline, the budget does not
+// depend on how fast the machine is. Zero, the default, means no limit.
+func (vm *VM) SetMaxSteps(n int) {
+	vm.maxSteps = n
+}
+
+func (vm *VM) overBudget() bool {
+	return vm.maxSteps != 0 && vm.steps > vm.maxSteps
+}
+
+// SetMaxMemObjects limits the size of the arrays, hashes and strings each
+// run creates, as measured by object.Size, after which it fails with
+// ErrMemoryLimitExceeded. Values are counted when they are created and
+// never discounted, so the limit bounds what a program allocates over its
+// run rather than what it holds at once. Zero, the default, means no
+// limit.
+func (vm *VM) SetMaxMemObjects(n int) {
+	vm.maxMemObjects = n
+}
+
+// allocate counts obj, a value the program just created, against the
+// memory limit.
+func (vm *VM) allocate(obj object.Object) error {
+	return vm.charge(object.Size(obj))
+}
+
+// charge counts size more against the memory limit.
+func (vm *VM) charge(size int) error {
+	if vm.maxMemObjects == 0 {
+		return nil
+	}
+	vm.allocated += size
+	if vm.overMemory() {
+		return ErrMemoryLimitExceeded
+	}
+	return nil
+}
+
+func (vm *VM) overMemory() bool {
+	return vm.maxMemObjects != 0 && vm.allocated > vm.maxMemObjects
+}
+
+// Constants returns the constant pool, including the constants of any
+// modules imported while running.
+func (vm *VM) Constants() []object.Object {
+	return vm.constants
+}
+
+// LastPoppedStackElem returns the value of the last expression statement.
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+
+	// try blocks that a return leaves are done
+	for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].framesIndex > vm.framesIndex {
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	}
+	return vm.frames[vm.framesIndex]
+}
+
+// Run runs the bytecode. The VM keeps no source positions, so unlike the
+// errors of the evaluator, the errors it fails with say neither where the
+// program failed nor which calls it was in.
+func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext runs the bytecode like Run, but stops with ctx's error once
+// ctx is done, so that runaway programs can be stopped.
+func (vm *VM) RunContext(ctx context.Context) error {
+	vm.ctx = ctx
+	vm.steps = 0
+	vm.allocated = 0
+	return vm.run(0)
+}
+
+// Call calls fn with args from Go, running it to completion on top of the
+// current frames. Builtins use it to call the functions they are given.
+func (vm *VM) Call(fn object.Object, args ...object.Object) object.Object {
+	if vm.ctx == nil {
+		vm.ctx = context.Background()
+	}
+	base, sp := vm.framesIndex, vm.sp
+
+	err := vm.call(fn, args, base)
+	if err != nil {
+		// leave the frames and stack as they were, in case the caller
+		// carries on regardless
+		vm.framesIndex, vm.sp = base, sp
+		exit, _ := err.(*object.ExitError)
+		return &object.Error{Message: err.Error(), Exit: exit}
+	}
+	return vm.pop()
+}
+
+func (vm *VM) call(fn object.Object, args []object.Object, base int) error {
+	for _, obj := range append([]object.Object{fn}, args...) {
+		if err := vm.push(obj); err != nil {
+			return err
+		}
+	}
+
+	if err := vm.executeCall(len(args)); err != nil {
+		return err
+	}
+	return vm.run(base)
+}
+
+// run executes instructions until no more than stop frames are left, or
+// until the main program ends when stop is 0. Errors inside a try block
+// started by this run resume at the block's handler.
+func (vm *VM) run(stop int) error {
+	for {
+		err := vm.execute(stop)
+		if err == nil || !vm.catch(err, stop) {
+			return err
+		}
+	}
+}
+
+func (vm *VM) execute(stop int) error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+	var cycles int
+
+	ctx := vm.ctx
+
+	for vm.framesIndex > stop && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		cycles++
+		if cycles%cancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		if vm.maxSteps != 0 {
+			vm.steps++
+			if vm.overBudget() {
+				return ErrBudgetExceeded
+			}
+		}
+
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		if vm.hook != nil {
+			vm.hook(vm.currentFrame().cl.Fn, ip, op)
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.push(vm.constants[constIndex])
+			if err != nil {
+				return err
+			}
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPow:
+			err := vm.executeBinaryOperation(op)
+			if err != nil {
+				return err
+			}
+
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterThanOrEqual:
+			err := vm.executeComparison(op)
+			if err != nil {
+				return err
+			}
+
+		case code.OpBang:
+			err := vm.executeBangOperator()
+			if err != nil {
+				return err
+			}
+
+		case code.OpMinus:
+			err := vm.executeMinusOperator()
+			if err != nil {
+				return err
+			}
+
+		case code.OpTrue:
+			err := vm.push(True)
+			if err != nil {
+				return err
+			}
+
+		case code.OpFalse:
+			err := vm.push(False)
+			if err != nil {
+				return err
+			}
+
+		case code.OpNull:
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpIter:
+			numVars := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			it, err := newIterator(vm.pop(), numVars == 2)
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(it)
+			if err != nil {
+				return err
+			}
+
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			it := vm.pop().(*iterator)
+			key, value, ok := it.next()
+			if !ok {
+				vm.currentFrame().ip = pos - 1
+				break
+			}
+
+			if it.withKey {
+				err := vm.push(key)
+				if err != nil {
+					return err
+				}
+			}
+
+			err := vm.push(value)
+			if err != nil {
+				return err
+			}
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			holds, err := vm.condition(vm.pop())
+			if err != nil {
+				return err
+			}
+			if !holds {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpJumpNotNull:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if vm.stack[vm.sp-1] != Null {
+				vm.currentFrame().ip = pos - 1
+			} else {
+				vm.pop()
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			globals := vm.currentFrame().cl.Globals
+			if int(globalIndex) >= len(globals) {
+				return ErrGlobalsExhausted
+			}
+			globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			globals := vm.currentFrame().cl.Globals
+			if int(globalIndex) >= len(globals) {
+				return ErrGlobalsExhausted
+			}
+
+			err := vm.push(globals[globalIndex])
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			err := vm.push(vm.stack[frame.basePointer+int(localIndex)])
+			if err != nil {
+				return err
+			}
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure.Free[freeIndex])
+			if err != nil {
+				return err
+			}
+
+		case code.OpGetBuiltin:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			name := vm.constants[constIndex].(*object.String).Value
+			builtin, ok := evaluator.LookupBuiltin(name)
+			if !ok {
+				return fmt.Errorf("unknown builtin: %s", name)
+			}
+
+			err := vm.push(builtin)
+			if err != nil {
+				return err
+			}
+
+		case code.OpCurrentClosure:
+			err := vm.push(vm.currentFrame().cl)
+			if err != nil {
+				return err
+			}
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			err := vm.allocate(array)
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(array)
+			if err != nil {
+				return err
+			}
+
+		case code.OpInterpolate:
+			numParts := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			str := vm.buildString(vm.sp-numParts, vm.sp)
+			vm.sp = vm.sp - numParts
+
+			err := vm.allocate(str)
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(str)
+			if err != nil {
+				return err
+			}
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+
+			err = vm.allocate(hash)
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(hash)
+			if err != nil {
+				return err
+			}
+
+		case code.OpUnpackArray:
+			numNames := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			err := vm.unpackArray(vm.pop(), numNames)
+			if err != nil {
+				return err
+			}
+
+		case code.OpUnpackHash:
+			numNames := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			keys := make([]object.Object, numNames)
+			copy(keys, vm.stack[vm.sp-numNames:vm.sp])
+			vm.sp = vm.sp - numNames
+
+			err := vm.unpackHash(vm.pop(), keys)
+			if err != nil {
+				return err
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeIndexExpression(left, index)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			// a new key grows a hash
+			size := object.Size(left)
+			err := object.SetIndex(left, index, value)
+			if err != nil {
+				return err
+			}
+
+			err = vm.charge(object.Size(left) - size)
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(value)
+			if err != nil {
+				return err
+			}
+
+		case code.OpRange:
+			end := vm.pop()
+			start := vm.pop()
+
+			r, err := object.NewRange(start, end)
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(r)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSlice:
+			end := vm.pop()
+			start := vm.pop()
+			left := vm.pop()
+
+			result, err := object.Slice(left, start, end)
+			if err != nil {
+				return err
+			}
+
+			err = vm.allocate(result)
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(result)
+			if err != nil {
+				return err
+			}
+
+		case code.OpImport:
+			mod, err := vm.importModule(vm.pop())
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(mod)
+			if err != nil {
+				return err
+			}
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err := vm.executeCall(int(numArgs))
+			if err != nil {
+				return err
+			}
+
+		case code.OpCallSpread:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+
+			n, err := vm.spreadArgument()
+			if err != nil {
+				return err
+			}
+
+			err = vm.executeCall(numArgs - 1 + n)
+			if err != nil {
+				return err
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			// returning from the main program ends it, leaving the
+			// value behind as the last popped element
+			if vm.framesIndex == 1 {
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			err := vm.push(returnValue)
+			if err != nil {
+				return err
+			}
+
+		case code.OpReturn:
+			if vm.framesIndex == 1 {
+				vm.stack[vm.sp] = Null
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
+
+		case code.OpTry:
+			catchPos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			vm.handlers = append(vm.handlers, handler{
+				framesIndex: vm.framesIndex,
+				sp:          vm.sp,
+				catchPos:    catchPos,
+			})
+
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			err := vm.pushClosure(int(constIndex), int(numFree))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= len(vm.stack) {
+		return ErrStackOverflow
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	leftType := left.Type()
+	rightType := right.Type()
+
+	switch {
+	case object.IsInteger(left) && object.IsInteger(right):
+		return vm.executeBinaryIntegerOperation(op, left, right)
+	case isNumber(left) && isNumber(right):
+		return vm.executeBinaryFloatOperation(op, left, right)
+	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
+		return vm.executeBinaryStringOperation(op, left, right)
+	default:
+		return fmt.Errorf("unsupported types for binary operation: %s %s",
+			leftType, rightType)
+	}
+}
+
+func (vm *VM) executeBinaryIntegerOperation(
+	op code.Opcode,
+	left, right object.Object,
+) error {
+	var operator string
+
+	switch op {
+	case code.OpAdd:
+		operator = "+"
+	case code.OpSub:
+		operator = "-"
+	case code.OpMul:
+		operator = "*"
+	case code.OpDiv:
+		operator = "/"
+	case code.OpMod:
+		operator = "%"
+	case code.OpPow:
+		operator = "**"
+	default:
+		return fmt.Errorf("unknown integer operator: %d", op)
+	}
+
+	result, err := object.IntegerArithmetic(operator, left, right, vm.bigIntegers)
+	if err != nil {
+		return err
+	}
+	return vm.push(result)
+}
+
+func (vm *VM) executeBinaryFloatOperation(
+	op code.Opcode,
+	left, right object.Object,
+) error {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+
+	var result float64
+
+	switch op {
+	case code.OpAdd:
+		result = leftValue + rightValue
+	case code.OpSub:
+		result = leftValue - rightValue
+	case code.OpMul:
+		result = leftValue * rightValue
+	case code.OpDiv:
+		result = leftValue / rightValue
+	case code.OpMod:
+		result = math.Mod(leftValue, rightValue)
+	case code.OpPow:
+		result = math.Pow(leftValue, rightValue)
+	default:
+		return fmt.Errorf("unknown float operator: %d", op)
+	}
+
+	return vm.push(&object.Float{Value: result})
+}
+
+func (vm *VM) executeBinaryStringOperation(
+	op code.Opcode,
+	left, right object.Object,
+) error {
+	if op != code.OpAdd {
+		return fmt.Errorf("unknown string operator: %d", op)
+	}
+
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	result := &object.String{Value: leftValue + rightValue}
+	if err := vm.allocate(result); err != nil {
+		return err
+	}
+	return vm.push(result)
+}
+
+func (vm *VM) executeComparison(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	if object.IsInteger(left) && object.IsInteger(right) {
+		return vm.executeIntegerComparison(op, left, right)
+	}
+
+	if isNumber(left) && isNumber(right) {
+		return vm.executeFloatComparison(op, left, right)
+	}
+
+	if left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ {
+		return vm.executeStringComparison(op, left, right)
+	}
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(object.Equal(left, right)))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(!object.Equal(left, right)))
+	default:
+		return fmt.Errorf("unknown operator: %d (%s %s)",
+			op, left.Type(), right.Type())
+	}
+}
+
+func (vm *VM) executeIntegerComparison(
+	op code.Opcode,
+	left, right object.Object,
+) error {
+	cmp := object.CompareIntegers(left, right)
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(cmp == 0))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(cmp != 0))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(cmp > 0))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(cmp >= 0))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
+func (vm *VM) executeFloatComparison(
+	op code.Opcode,
+	left, right object.Object,
+) error {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
+func (vm *VM) executeStringComparison(
+	op code.Opcode,
+	left, right object.Object,
+) error {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	default:
+		return fmt.Errorf("unknown string operator: %d", op)
+	}
+}
+
+func (vm *VM) executeBangOperator() error {
+	holds, err := vm.condition(vm.pop())
+	if err != nil {
+		return err
+	}
+	return vm.push(nativeBoolToBooleanObject(!holds))
+}
+
+func (vm *VM) executeMinusOperator() error {
+	operand := vm.pop()
+
+	switch operand := operand.(type) {
+	case *object.Integer, *object.BigInteger:
+		return vm.push(object.NegateInteger(operand, vm.bigIntegers))
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
+		return fmt.Errorf("unsupported type for negation: %s", operand.Type())
+	}
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+// buildString concatenates the values on the stack between startIndex and
+// endIndex, using Inspect for everything that isn't already a string.
+func (vm *VM) buildString(startIndex, endIndex int) object.Object {
+	var out strings.Builder
+
+	for i := startIndex; i < endIndex; i++ {
+		if str, ok := vm.stack[i].(*object.String); ok {
+			out.WriteString(str.Value)
+		} else {
+			out.WriteString(vm.stack[i].Inspect())
+		}
+	}
+
+	return &object.String{Value: out.String()}
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hash := object.NewHash((endIndex - startIndex) / 2)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		if _, ok := key.(object.Hashable); !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+
+		hash.Set(key, value)
+	}
+
+	return hash, nil
+}
+
+// unpackArray pushes the elements of array in reverse, so that the first is
+// on top, after checking that it has numNames of them.
+func (vm *VM) unpackArray(array object.Object, numNames int) error {
+	arrayObject, ok := array.(*object.Array)
+	if !ok {
+		return fmt.Errorf("cannot destructure %s as an array", array.Type())
+	}
+	if len(arrayObject.Elements) != numNames {
+		return fmt.Errorf("cannot destructure array of %d elements into %d names",
+			len(arrayObject.Elements), numNames)
+	}
+
+	for i := numNames - 1; i >= 0; i-- {
+		err := vm.push(arrayObject.Elements[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unpackHash pushes the values of hash for keys in reverse, so that the
+// value of the first key is on top.
+func (vm *VM) unpackHash(hash object.Object, keys []object.Object) error {
+	hashObject, ok := hash.(*object.Hash)
+	if !ok {
+		return fmt.Errorf("cannot destructure %s as a hash", hash.Type())
+	}
+
+	for i := len(keys) - 1; i >= 0; i-- {
+		key := keys[i].(*object.String)
+		pair, ok := hashObject.Pairs[key.HashKey()]
+		if !ok {
+			return fmt.Errorf("key not found in hash: %s", key.Value)
+		}
+
+		err := vm.push(pair.Value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return vm.executeHashIndex(left, index)
+	case left.Type() == object.MODULE_OBJ && index.Type() == object.STRING_OBJ:
+		return vm.executeModuleIndex(left, index)
+	default:
+		return fmt.Errorf("index operator not supported: %s", left.Type())
+	}
+}
+
+func (vm *VM) executeArrayIndex(array, index object.Object) error {
+	arrayObject := array.(*object.Array)
+	i := index.(*object.Integer).Value
+	max := int64(len(arrayObject.Elements) - 1)
+
+	if i < 0 || i > max {
+		if vm.strictIndexing {
+			return fmt.Errorf("index out of range: %d (length %d)",
+				i, len(arrayObject.Elements))
+		}
+		return vm.push(Null)
+	}
+
+	return vm.push(arrayObject.Elements[i])
+}
+
+func (vm *VM) executeHashIndex(hash, index object.Object) error {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return fmt.Errorf("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(pair.Value)
+}
+
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("calling non-function")
+	}
+}
+
+// callBuiltin calls a Go function, turning an error it returns into a
+// runtime error of the VM.
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	var result object.Object
+	if builtin.RuntimeFn != nil {
+		result = builtin.RuntimeFn(vm, args...)
+	} else {
+		result = builtin.Fn(args...)
+	}
+
+	created := vm.maxMemObjects != 0 && object.IsNew(result, args)
+	vm.sp = vm.sp - numArgs - 1
+
+	if errObj, ok := result.(*object.Error); ok {
+		if errObj.Exit != nil {
+			return errObj.Exit
+		}
+		return fmt.Errorf("%s", errObj.Message)
+	}
+	if result == nil {
+		result = Null
+	}
+	if created {
+		if err := vm.allocate(result); err != nil {
+			return err
+		}
+	}
+	return vm.push(result)
+}
+
+// spreadArgument replaces the array on top of the stack with its elements
+// and returns how many there are.
+func (vm *VM) spreadArgument() (int, error) {
+	arg := vm.pop()
+	array, ok := arg.(*object.Array)
+	if !ok {
+		return 0, fmt.Errorf("cannot spread %s, want ARRAY", arg.Type())
+	}
+
+	for _, el := range array.Elements {
+		err := vm.push(el)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(array.Elements), nil
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if cl.Fn.Variadic {
+		var err error
+		numArgs, err = vm.collectRest(cl.Fn, numArgs)
+		if err != nil {
+			return err
+		}
+	} else if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
+			cl.Fn.NumParameters, numArgs)
+	}
+
+	if vm.framesIndex >= len(vm.frames) {
+		return ErrStackOverflow
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs)
+	vm.pushFrame(frame)
+
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	if vm.sp >= len(vm.stack) {
+		return ErrStackOverflow
+	}
+
+	return nil
+}
+
+// collectRest replaces the arguments of a call to the variadic fn that are
+// not bound by its other parameters with an array holding them, and returns
+// the new number of arguments.
+func (vm *VM) collectRest(fn *object.CompiledFunction, numArgs int) (int, error) {
+	fixed := fn.NumParameters - 1
+	if numArgs < fixed {
+		return 0, fmt.Errorf("wrong number of arguments: want at least %d, got=%d",
+			fixed, numArgs)
+	}
+
+	rest := make([]object.Object, numArgs-fixed)
+	copy(rest, vm.stack[vm.sp-len(rest):vm.sp])
+	vm.sp = vm.sp - len(rest)
+
+	err := vm.push(&object.Array{Elements: rest})
+	if err != nil {
+		return 0, err
+	}
+	return fn.NumParameters, nil
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{
+		Fn:      function,
+		Free:    free,
+		Globals: vm.currentFrame().cl.Globals,
+	}
+	return vm.push(closure)
+}
+
+func isNumber(obj object.Object) bool {
+	return object.IsInteger(obj) || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInteger:
+		return obj.Float64()
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
+
+func isTruthy(obj object.Object) bool {
+	return object.IsTruthy(obj)
+}
+
+// condition returns whether cond, the value of a condition, holds. Unless
+// strictBool is set, any value can be a condition.
+func (vm *VM) condition(cond object.Object) (bool, error) {
+	if vm.strictBool && cond.Type() != object.BOOLEAN_OBJ {
+		return false, fmt.Errorf("non-boolean condition: %s", cond.Type())
+	}
+	return isTruthy(cond), nil
+}
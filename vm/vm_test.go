@@ -0,0 +1,1413 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"monkey/ast"
+	"monkey/bench"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"2", 2},
+		{"1 + 2", 3},
+		{"1 - 2", -1},
+		{"1 * 2", 2},
+		{"4 / 2", 2},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-5", -5},
+		{"-50 + 100 + -50", 0},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"10 % 3", 1},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"5 / 2.0", 2.5},
+		{"-2.5", -2.5},
+		{"5.5 % 2", 1.5},
+		{"2 ** -1", 0.5},
+		{"1.5 < 2", true},
+		{"2.0 == 2", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1", true},
+		{"1 != 2", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"1.5 >= 1", true},
+		{`"a" < "b"`, true},
+		{`"b" <= "a"`, false},
+		{`"abc" >= "abc"`, true},
+		{"true == false", false},
+		{"(1 < 2) == true", true},
+		{"!true", false},
+		{"!5", false},
+		{"!!5", true},
+		{"!(if (false) { 5; })", true},
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{"[1, [2, 3]] == [1, [2, 3]]", true},
+		{"[1, 2] != [1, 2, 3]", true},
+		{`{"a": 1, "b": 2} == {"b": 2, "a": 1}`, true},
+		{"fn() { 1 } == fn() { 1 }", false},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (true) { 10 } else { 20 }", 10},
+		{"if (false) { 10 } else { 20 } ", 20},
+		{"if (1) { 10 }", 10},
+		{"if (1 > 2) { 10 }", Null},
+		{"if (false) { 10 }", Null},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = 2; one + two", 3},
+		{"let one = 1; let two = one + one; one + two", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 5; x = x + 1; x;", 6},
+		{"let a = 1; let b = 2; a = b = 3; a + b;", 6},
+		{"let x = 1; let f = fn() { x = x + 1; }; f(); f(); x;", 3},
+		{"let f = fn() { let y = 1; y = y + 1; y }; f();", 2},
+		{"let x = 5; x += 2; x -= 1; x *= 3; x /= 2; x", 9},
+		{"let f = fn() { let n = 0; for (i in 1..4) { n += i }; n }; f()", 6},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"true || false", true},
+		{"1 && 2", true},
+		{"1 < 2 && 2 < 3", true},
+		{"let x = 0; false && (x = 1); x == 0", true},
+		{"let x = 0; true || (x = 1); x == 0", true},
+		{"let x = 0; true && (x = 1); x == 1", true},
+		{"let x = 0; false || (x = 1); x == 1", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCoalesceOperator(t *testing.T) {
+	tests := []vmTestCase{
+		{`{"a": 1}["a"] ?? 2`, 1},
+		{`{"a": 1}["b"] ?? 2`, 2},
+		{"false ?? 1", false},
+		{"[][0] ?? [][1] ?? 3", 3},
+		{"[][0] ?? [][1]", Null},
+		{"let x = 0; 1 ?? (x = 1); x", 0},
+		{"let f = fn(h) { h[0] ?? -1 }; f({0: 7}) * 10 + f({})", 69},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"monkey"`, "monkey"},
+		{`"mon" + "key"`, "monkey"},
+		{`"mon" + "key" + "banana"`, "monkeybanana"},
+		{`let name = "monkey"; "Hello, ${name}!"`, "Hello, monkey!"},
+		{`"${1 + 2} ${[1, true]} ${"s"}"`, "3 [1, true] s"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestArrayLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"[]", []int{}},
+		{"[1, 2, 3]", []int{1, 2, 3}},
+		{"[1 + 2, 3 * 4, 5 + 6]", []int{3, 12, 11}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			"{}", map[object.HashKey]int64{},
+		},
+		{
+			"{1: 2, 2: 3}",
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 1}).HashKey(): 2,
+				(&object.Integer{Value: 2}).HashKey(): 3,
+			},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3][1]", 2},
+		{"[[1, 1, 1]][0][0]", 1},
+		{"[][0]", Null},
+		{"[1, 2, 3][99]", Null},
+		{"[1][-1]", Null},
+		{"{1: 1, 2: 2}[1]", 1},
+		{"{1: 1}[0]", Null},
+		{"{}[0]", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRangesAndSlices(t *testing.T) {
+	tests := []vmTestCase{
+		{"let sum = 0; for (i in 1..5) { sum = sum + i }; sum", 10},
+		{"let n = 0; for (i, x in 10..13) { n = n + i * x }; n", 35},
+		{"let n = 0; for (x in 3..1) { n = n + 1 }; n", 0},
+		{"[1, 2, 3, 4, 5][1:3]", []int{2, 3}},
+		{"[1, 2, 3, 4, 5][:2]", []int{1, 2}},
+		{"[1, 2, 3, 4, 5][-2:]", []int{4, 5}},
+		{"[1, 2, 3][:]", []int{1, 2, 3}},
+		{"[1, 2, 3][1:99]", []int{2, 3}},
+		{"[1, 2, 3][2:1]", []int{}},
+		{`"héllo"[1:3]`, "él"},
+		{`"hello"[-3:]`, "llo"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIndexAssignExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = [1, 2, 3]; a[0] = 5; a", []int{5, 2, 3}},
+		{"let a = [1, 2, 3]; a[1] = 7", 7},
+		{"let a = [1, 2]; let b = a; b[0] = 9; a", []int{9, 2}},
+		{"let f = fn() { let a = [0, 0]; for (i in 0..2) { a[i] += i + 1 }; a }; f()", []int{1, 2}},
+		{`let h = {"a": 1}; h["a"] = 2; h["b"] = 3; h["a"] * 10 + h["b"]`, 23},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let fivePlusTen = fn() { 5 + 10; };
+			fivePlusTen();
+			`,
+			expected: 15,
+		},
+		{
+			input: `
+			let a = fn() { 1 };
+			let b = fn() { a() + 1 };
+			let c = fn() { b() + 1 };
+			c();
+			`,
+			expected: 3,
+		},
+		{
+			input: `
+			let noReturn = fn() { };
+			noReturn();
+			`,
+			expected: Null,
+		},
+		{
+			input: `
+			let sum = fn(a, b) {
+				let c = a + b;
+				c;
+			};
+			let outer = fn() {
+				sum(1, 2) + sum(3, 4);
+			};
+			outer();
+			`,
+			expected: 10,
+		},
+		{
+			input: `
+			let countDown = fn(x) {
+				if (x == 0) { 0 } else { countDown(x - 1) }
+			};
+			countDown(10);
+			`,
+			expected: 0,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let earlyExit = fn() { return 99; 100; };
+			earlyExit();
+			`,
+			expected: 99,
+		},
+		{
+			input: `
+			let f = fn(x) { if (x > 5) { return x; } 0 };
+			f(10) + f(1);
+			`,
+			expected: 10,
+		},
+		{
+			input: `
+			let bare = fn() { return; 1 };
+			bare();
+			`,
+			expected: Null,
+		},
+		{input: "return 10; 9;", expected: 10},
+		{input: "1; return; 9;", expected: Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestForInStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let sum = 0; for (x in [1, 2, 3]) { sum = sum + x }; sum", 6},
+		{"let sum = 0; for (i, x in [10, 20]) { sum = sum + i * x }; sum", 20},
+		{`let s = ""; for (c in "héllo") { s = c + s }; s`, "olléh"},
+		{`let n = 0; for (i, c in "ab") { n = n + i }; n`, 1},
+		{`let s = ""; for (i, c in "hé!") { s = s + "${i}" + c }; s`, "0h1é2!"},
+		{`let n = 0; for (i in 5..8) { n = n * 10 + i }; n`, 567},
+		// ranges longer than the largest INTEGER
+		{"len(-9223372036854775808..9223372036854775807)", 9223372036854775807},
+		{"let n = 0; for (x in -9223372036854775808..9223372036854775807) { n = x; break }; n", -9223372036854775808},
+		{"let n = 0; for (i, x in -9223372036854775808..9223372036854775807) { if (i == 2) { n = x; break } }; n", -9223372036854775806},
+		{"let n = 0; for (x in 9223372036854775805..9223372036854775807) { n = n + 1 }; n", 2},
+		{"let n = 0; for (x in 9223372036854775807..-9223372036854775808) { n = n + 1 }; n", 0},
+		{`let n = 0; for (i, x in 5..8) { n = n * 10 + i }; n`, 12},
+		{`let sum = 0; for (k in {1: 10, 2: 20}) { sum = sum + k }; sum`, 3},
+		{`let sum = 0; for (k, v in {1: 10, 2: 20}) { sum = sum + k * v }; sum`, 50},
+		{`let s = ""; for (k, v in {"b": 1, "a": 2, "c": 3}) { s = s + k + "${v}" }; s`, "b1a2c3"},
+		{"let n = 0; for (x in []) { n = n + 1 }; n", 0},
+		{
+			`
+			let total = fn(arr) {
+				let sum = 0;
+				for (row in arr) {
+					for (x in row) { sum = sum + x }
+				}
+				sum
+			};
+			total([[1, 2], [3], []]);
+			`,
+			6,
+		},
+		{
+			`
+			let find = fn(arr, target) {
+				for (i, x in arr) {
+					if (x == target) { return i; }
+				}
+				-1
+			};
+			find([5, 6, 7], 7) * 10 + find([1], 9);
+			`,
+			19,
+		},
+		{"let f = fn() { for (x in [1]) { x } }; f()", Null},
+		{"let sum = 0; for (x in [1, 2, 3, 4]) { if (x == 3) { break }; sum = sum + x }; sum", 3},
+		{"let sum = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue }; sum = sum + x }; sum", 8},
+		{
+			`
+			let f = fn() {
+				let n = 0;
+				for (row in [[1, 2], [3, 4]]) {
+					for (x in row) {
+						if (x % 2 == 0) { break }
+						n = n + x;
+					}
+					n = n * 10;
+				}
+				n
+			};
+			f();
+			`,
+			130,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let [a, b] = [1, 2]; a * 10 + b", 12},
+		{`let {name, age} = {"age": 3, "name": "ann"}; name + " is ${age}"`, "ann is 3"},
+		{"let f = fn(p) { let [x, y] = p; x - y }; f([5, 2])", 3},
+		{"let f = fn(p) { let {x} = p; fn() { x } }; f({\"x\": 7})()", 7},
+		{"let [a, b, c] = [1, 2, 3]; [c, b, a]", []int{3, 2, 1}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`match (1) { 1 => "one", 2 => "two", _ => "other" }`, "one"},
+		{`match (2) { 1 => "one", 2 => "two", _ => "other" }`, "two"},
+		{`match (3) { 1 => "one", 2 => "two", _ => "other" }`, "other"},
+		{`match (3) { 1 => "one" }`, Null},
+		{`match ("b") { "a" => 1, "b" => 2 }`, 2},
+		{`match (1) { "1" => "string", 1.0 => "float" }`, "float"},
+		{`let x = 5; match (x * 2) { x => "x", x + x => "twice x" }`, "twice x"},
+		{`match (1) { 1 => "first", 1 => "second", 1 / 0 => "boom" }`, "first"},
+		{`let f = fn(n) { match (n % 2) { 0 => "even", _ => "odd" } }; [f(2), f(7)]`, []string{"even", "odd"}},
+		{`match (1) { 1 => match (2) { 2 => "inner" } }`, "inner"},
+		{`let r = match (1) { 1 => 10 }; let s = match (2) { 2 => 20 }; r + s`, 30},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"try { 1 / 0 } catch (e) { e }", "division by zero"},
+		{"try { 5 } catch (e) { 0 }", 5},
+		{"try { let x = 1; } catch (e) { 0 }", Null},
+		{"try {} catch (e) {}", Null},
+		{"try { 1 / 0 } catch (e) {}", Null},
+		{"1 + try { 2 * [] } catch (e) { 10 }", 11},
+		{`try { try { 1 / 0 } catch (e) { 1 % 0 } } catch (e) { "outer: " + e }`, "outer: modulo by zero"},
+		{"let f = fn(x) { 10 / x }; try { f(2) + f(0) } catch (e) { -1 }", -1},
+		{"let f = fn() { try { return 1 / 0 } catch (e) { 2 } }; f()", 2},
+		{"let f = fn(n) { if (n == 0) { 1 / 0 } else { f(n - 1) } }; try { f(5) } catch (e) { e }", "division by zero"},
+		{"let f = fn() { try { 1 } catch (e) { 2 } }; let g = fn() { [f(), f()] }; g()", []int{1, 1}},
+		{"let x = 0; for (i in [1, 0, 2]) { try { x = x + 10 / i } catch (e) { continue } }; x", 15},
+		{"let x = 0; for (i in [1, 2, 3]) { try { if (i == 2) { break } x = x + i } catch (e) { x = 100 } }; x", 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestUncaughtErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"try { 1 / 0 } catch (e) { e + 1 }", "unsupported types for binary operation: STRING INTEGER"},
+		{"let [a, b] = [1, 2, 3];", "cannot destructure array of 3 elements into 2 names"},
+		{"let [a] = 5;", "cannot destructure INTEGER as an array"},
+		{`let {name, age} = {"name": "ann"};`, "key not found in hash: age"},
+		{`let f = fn() { let {a} = "a"; a }; f()`, "cannot destructure STRING as a hash"},
+		{"1..true", "range bounds must be INTEGER, got INTEGER..BOOLEAN"},
+		{"5[1:2]", "slice operator not supported: INTEGER"},
+		{"let a = [1]; a[1] = 2", "index out of range: 1 (length 1)"},
+		{"len(1)", "argument to `len` not supported, got INTEGER"},
+		{`let f = fn(xs) { first(xs) }; f("abc")`, "argument to `first` must be ARRAY, got STRING"},
+		{"let a = [0]; a[0] = a; jsonEncode(a)", "cannot encode cyclic value as JSON"},
+		// nothing else runs to send or receive
+		{"recv(chan())", "deadlock: all tasks are waiting"},
+		{"let c = chan(); send(c, 1)", "deadlock: all tasks are waiting"},
+		// handlers do not outlive the try blocks that break or return
+		// leaves
+		{"for (x in [1]) { try { break } catch (e) { 0 } }; 1 / 0", "division by zero"},
+		{"for (x in [1, 2]) { try { continue } catch (e) { 0 } }; 1 / 0", "division by zero"},
+		{"let f = fn() { try { return 1 } catch (e) { 0 } }; f(); 1 / 0", "division by zero"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+		if err == nil {
+			t.Fatalf("%s: expected VM error but resulted in none.", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong VM error: want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestIterateNonIterable(t *testing.T) {
+	program := parse("for (x in 5) { x }")
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+
+	if err.Error() != "cannot iterate over INTEGER" {
+		t.Fatalf("wrong VM error: want=%q, got=%q", "cannot iterate over INTEGER", err)
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	tests := []vmTestCase{
+		{"10 / 0", "division by zero"},
+		{"10 % 0", "modulo by zero"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	tests := []struct {
+		input       string
+		wrapped     string
+		bigIntegers string
+	}{
+		{"9223372036854775807 + 1", "-9223372036854775808", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "9223372036854775807", "-9223372036854775809"},
+		{"let min = -9223372036854775807 - 1; -min", "-9223372036854775808", "9223372036854775808"},
+		{"-9223372036854775808 == -9223372036854775807 - 1", "true", "true"},
+		{"-9223372036854775808 - 1", "9223372036854775807", "-9223372036854775809"},
+		{"2 ** 64", "0", "18446744073709551616"},
+		{"9223372036854775807 * 3 > 9223372036854775807", "false", "true"},
+		{"9223372036854775807 * 3 < 9223372036854775807", "true", "false"},
+		{"(9223372036854775807 + 1) - 1", "9223372036854775807", "9223372036854775807"},
+		{"let f = fn(n) { n * n }; f(4294967296)", "0", "18446744073709551616"},
+	}
+
+	for _, tt := range tests {
+		for _, bigIntegers := range []bool{false, true} {
+			expected := tt.wrapped
+			if bigIntegers {
+				expected = tt.bigIntegers
+			}
+
+			comp := compiler.New()
+			if err := comp.Compile(parse(tt.input)); err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+
+			vm := New(comp.Bytecode())
+			vm.SetBigIntegers(bigIntegers)
+			if err := vm.Run(); err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+
+			got := vm.LastPoppedStackElem().Inspect()
+			if got != expected {
+				t.Errorf("%q (bigIntegers=%t): want %s, got %s",
+					tt.input, bigIntegers, expected, got)
+			}
+		}
+	}
+}
+
+func TestStrictBool(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (1 < 2) { 1 } else { 2 }", "1"},
+		{"!true || (false && true)", "false"},
+		{"if (0) { 1 }", "non-boolean condition: INTEGER"},
+		{`!""`, "non-boolean condition: STRING"},
+		{"[] && true", "non-boolean condition: ARRAY"},
+		{"[] || true", "non-boolean condition: ARRAY"},
+		{"false || 1", "non-boolean condition: INTEGER"},
+		{"match ([1]) { [1] => 2, _ => 3 }", "2"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		vm.SetStrictBool(true)
+		var got string
+		if err := vm.Run(); err != nil {
+			got = err.Error()
+		} else {
+			got = vm.LastPoppedStackElem().Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("%q: want %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestStrictIndexing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3][2]", "3"},
+		{"[1, 2, 3][3]", "index out of range: 3 (length 3)"},
+		{"[1, 2, 3][-1]", "index out of range: -1 (length 3)"},
+		{"[][0]", "index out of range: 0 (length 0)"},
+		{`{"a": 1}["b"]`, "null"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		vm.SetStrictIndexing(true)
+		var got string
+		if err := vm.Run(); err != nil {
+			got = err.Error()
+		} else {
+			got = vm.LastPoppedStackElem().Inspect()
+		}
+		if got != tt.expected {
+			t.Errorf("%q: want %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestCallingFunctionsWithWrongArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input:    `fn() { 1; }(1);`,
+			expected: `wrong number of arguments: want=0, got=1`,
+		},
+		{
+			input:    `fn(a, b) { a + b; }(1);`,
+			expected: `wrong number of arguments: want=2, got=1`,
+		},
+		{
+			input:    `fn(a, b, rest...) { a + b; }(1);`,
+			expected: `wrong number of arguments: want at least 2, got=1`,
+		},
+		{
+			input:    `fn(a) { a; }([1, 2]...);`,
+			expected: `wrong number of arguments: want=1, got=2`,
+		},
+		{
+			input:    `fn(a) { a; }("a"...);`,
+			expected: `cannot spread STRING, want ARRAY`,
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestVariadicFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let f = fn(x, rest...) { rest }; f(1, 2, 3)", []int{2, 3}},
+		{"let f = fn(x, rest...) { x }; f(1)", 1},
+		{"let f = fn(args...) { args }; f()", []int{}},
+		{"let add = fn(a, b, c) { a + b + c }; add(1, [2, 3]...)", 6},
+		{"let add = fn(a, b) { a + b }; let xs = [1, 2]; add(xs...)", 3},
+		{"let f = fn(xs...) { xs }; let g = fn(xs...) { f(0, xs...) }; g(1, 2)", []int{0, 1, 2}},
+		{"let f = fn(a, rest...) { fn() { a + rest[0] } }; f(1, 2)()", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let newClosure = fn(a) {
+				fn() { a; };
+			};
+			let closure = newClosure(99);
+			closure();
+			`,
+			expected: 99,
+		},
+		{
+			input: `
+			let newAdderOuter = fn(a, b) {
+				let c = a + b;
+				fn(d) {
+					let e = d + c;
+					fn(f) { e + f; };
+				};
+			};
+			let newAdderInner = newAdderOuter(1, 2)
+			let adder = newAdderInner(3);
+			adder(8);
+			`,
+			expected: 14,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRecursiveClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let countDown = fn(x) { if (x == 0) { return 0; } countDown(x - 1); };
+			countDown(3);
+			`,
+			expected: 0,
+		},
+		{
+			input: `
+			let wrapper = fn() {
+				let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } };
+				fact(5);
+			};
+			wrapper();
+			`,
+			expected: 120,
+		},
+		{
+			input: `
+			let wrapper = fn(step) {
+				let sum = fn(n) {
+					if (n == 0) { return 0; }
+					let inner = fn() { sum(n - 1) };
+					n * step + inner()
+				};
+				sum(3);
+			};
+			wrapper(2);
+			`,
+			expected: 12,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len([1, 2, 3])`, 3},
+		{`first([1, 2, 3])`, 1},
+		{`last([1, 2, 3])`, 3},
+		{`first([])`, Null},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`push([], 1)`, []int{1}},
+		{`let f = fn(xs) { len(xs) * 2 }; f([1, 2])`, 4},
+		{`fn() { fn() { len("ab") } }()()`, 2},
+		// builtins call back into the VM
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`let k = 10; reduce([1, 2, 3], 0, fn(acc, x) { acc + x + k })`, 36},
+		// variables shadow builtins
+		{`let len = fn(x) { 42 }; len("a")`, 42},
+		{`let f = fn(first) { first }; f(5)`, 5},
+		// values that contain themselves
+		{`let a = [0]; a[0] = a; "${a}"`, "[[...]]"},
+		{`let h = {}; h["self"] = h; "${h}"`, "{self: {...}}"},
+		{"let x = [1]; jsonEncode([x, x])", "[[1],[1]]"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinOutput(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(`puts("a", 1); eputs("b")`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	vm := New(comp.Bytecode())
+	vm.SetStdout(&stdout)
+	vm.SetStderr(&stderr)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if stdout.String() != "a\n1\n" || stderr.String() != "b\n" {
+		t.Errorf("wrong output. stdout=%q, stderr=%q", stdout.String(), stderr.String())
+	}
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		stackElem := vm.LastPoppedStackElem()
+
+		testExpectedObject(t, tt.expected, stackElem)
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testExpectedObject(
+	t *testing.T,
+	expected interface{},
+	actual object.Object,
+) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		err := testIntegerObject(int64(expected), actual)
+		if err != nil {
+			t.Errorf("testIntegerObject failed: %s", err)
+		}
+
+	case float64:
+		result, ok := actual.(*object.Float)
+		if !ok {
+			t.Errorf("object is not Float. got=%T (%+v)", actual, actual)
+			return
+		}
+		if result.Value != expected {
+			t.Errorf("object has wrong value. got=%g, want=%g",
+				result.Value, expected)
+		}
+
+	case bool:
+		err := testBooleanObject(expected, actual)
+		if err != nil {
+			t.Errorf("testBooleanObject failed: %s", err)
+		}
+
+	case string:
+		err := testStringObject(expected, actual)
+		if err != nil {
+			t.Errorf("testStringObject failed: %s", err)
+		}
+
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object not Array: %T (%+v)", actual, actual)
+			return
+		}
+
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d",
+				len(expected), len(array.Elements))
+			return
+		}
+
+		for i, expectedElem := range expected {
+			err := testIntegerObject(int64(expectedElem), array.Elements[i])
+			if err != nil {
+				t.Errorf("testIntegerObject failed: %s", err)
+			}
+		}
+
+	case map[object.HashKey]int64:
+		hash, ok := actual.(*object.Hash)
+		if !ok {
+			t.Errorf("object is not Hash. got=%T (%+v)", actual, actual)
+			return
+		}
+
+		if len(hash.Pairs) != len(expected) {
+			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d",
+				len(expected), len(hash.Pairs))
+			return
+		}
+
+		for expectedKey, expectedValue := range expected {
+			pair, ok := hash.Pairs[expectedKey]
+			if !ok {
+				t.Errorf("no pair for given key in Pairs")
+			}
+
+			err := testIntegerObject(expectedValue, pair.Value)
+			if err != nil {
+				t.Errorf("testIntegerObject failed: %s", err)
+			}
+		}
+
+	case *object.Null:
+		if actual != Null {
+			t.Errorf("object is not Null: %T (%+v)", actual, actual)
+		}
+	}
+}
+
+func testIntegerObject(expected int64, actual object.Object) error {
+	result, ok := actual.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("object is not Integer. got=%T (%+v)",
+			actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%d, want=%d",
+			result.Value, expected)
+	}
+
+	return nil
+}
+
+func testBooleanObject(expected bool, actual object.Object) error {
+	result, ok := actual.(*object.Boolean)
+	if !ok {
+		return fmt.Errorf("object is not Boolean. got=%T (%+v)",
+			actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%t, want=%t",
+			result.Value, expected)
+	}
+
+	return nil
+}
+
+func testStringObject(expected string, actual object.Object) error {
+	result, ok := actual.(*object.String)
+	if !ok {
+		return fmt.Errorf("object is not String. got=%T (%+v)",
+			actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%q, want=%q",
+			result.Value, expected)
+	}
+
+	return nil
+}
+
+func TestImportExpression(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"lib/math.monkey":    `let pi = 3; let sq = fn(x) { x * x }; let area = fn(r) { pi * sq(r) };`,
+		"lib/util.monkey":    `let math = import("math.monkey"); let cube = fn(x) { x * math["sq"](x) };`,
+		"lib/loop.monkey":    `let sum = 0; for (x in [1, 2, 3]) { sum = sum + x };`,
+		"lib/cycle.monkey":   `let again = import("cycle.monkey");`,
+		"lib/failing.monkey": `let x = 1 + true;`,
+	})
+
+	tests := []vmTestCase{
+		{`let m = import("lib/math.monkey"); m["area"](2)`, 12},
+		{`let pi = 10; import("lib/math.monkey")["area"](1)`, 3},
+		{`import("lib/util.monkey")["cube"](3)`, 27},
+		{`import("lib/math.monkey") == import("lib/" + "math.monkey")`, true},
+		{`import("lib/util.monkey")["math"] == import("lib/math.monkey")`, true},
+		{`import("lib/loop.monkey")["sum"]`, 6},
+		{`import("lib/loop.monkey")["$iter"]`, &object.Error{Message: "module has no member: $iter"}},
+		{`import("lib/math.monkey")["nope"]`, &object.Error{Message: "module has no member: nope"}},
+		{`import(1)`, &object.Error{Message: "import path must be STRING, got INTEGER"}},
+		{
+			`import("lib/cycle.monkey")`,
+			&object.Error{Message: "import cycle: " + filepath.Join(dir, "lib/cycle.monkey")},
+		},
+		{`import("lib/failing.monkey")`, &object.Error{Message: "unsupported types for binary operation: INTEGER BOOLEAN"}},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		vm.SetDir(dir)
+		vm.SetAllowFS(true)
+		err = vm.Run()
+
+		if expected, ok := tt.expected.(*object.Error); ok {
+			if err == nil || err.Error() != expected.Message {
+				t.Errorf("wrong VM error for %q: want=%q, got=%v", tt.input, expected.Message, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+// TestImportStrictness checks that modules run with the settings of the
+// importing VM.
+func TestImportStrictness(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"cond.monkey":  `let x = if (1) { "truthy" } else { "falsy" };`,
+		"index.monkey": `let x = type([1, 2][5]);`,
+	})
+
+	tests := []struct {
+		input    string
+		setup    func(vm *VM)
+		expected string
+	}{
+		{`import("cond.monkey")["x"]`, func(vm *VM) {}, "truthy"},
+		{`import("cond.monkey")["x"]`, func(vm *VM) { vm.SetStrictBool(true) }, "non-boolean condition: INTEGER"},
+		{`import("index.monkey")["x"]`, func(vm *VM) {}, "NULL"},
+		{`import("index.monkey")["x"]`, func(vm *VM) { vm.SetStrictIndexing(true) }, "index out of range: 5 (length 2)"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		vm.SetDir(dir)
+		vm.SetAllowFS(true)
+		tt.setup(vm)
+		var got string
+		if err := vm.Run(); err != nil {
+			got = err.Error()
+		} else {
+			got = vm.LastPoppedStackElem().(*object.String).Value
+		}
+		if got != tt.expected {
+			t.Errorf("%q: want %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// writeModules writes the given files, keyed by relative path, to a
+// temporary directory and returns it.
+func writeModules(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRunContextCancelled(t *testing.T) {
+	program := parse(`
+	let countdown = fn(n) { if (n == 0) { 0 } else { countdown(n - 1) } };
+	countdown(500);
+	`)
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	vm := New(comp.Bytecode())
+	err = vm.RunContext(ctx)
+	if err != context.Canceled {
+		t.Fatalf("wrong VM error: want=%q, got=%v", context.Canceled, err)
+	}
+}
+
+func TestMaxSteps(t *testing.T) {
+	tests := []struct {
+		input    string
+		maxSteps int
+		expected error
+	}{
+		{"let x = 1; x + 1", 0, nil},
+		{"let x = 1; x + 1", 100, nil},
+		{"let x = 1; x + 1", 3, ErrBudgetExceeded},
+		{"let f = fn() { f() }; f()", 1000, ErrBudgetExceeded},
+		{`try { let f = fn() { f() }; f() } catch (e) { "caught" }`, 1000, ErrBudgetExceeded},
+		// ranges are iterated lazily, so a huge one starts at once
+		{"for (i in 0..1000000000000) { }", 1000, ErrBudgetExceeded},
+		{"for (i, x in 0..1000000000000) { }", 1000, ErrBudgetExceeded},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		vm.SetMaxSteps(tt.maxSteps)
+		if err := vm.Run(); err != tt.expected {
+			t.Errorf("%s with %d steps: want %v, got %v", tt.input, tt.maxSteps, tt.expected, err)
+		}
+	}
+}
+
+func TestImportSharesLimits(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"spin.monkey": `let f = fn(n) { if (n > 0) { f(n - 1) } }; f(100);`,
+		"big.monkey":  `let xs = [1, 2, 3, 4, 5, 6, 7, 8, 9, 10];`,
+	})
+
+	tests := []struct {
+		input         string
+		maxSteps      int
+		maxMemObjects int
+		expected      error
+	}{
+		{`import("spin.monkey")`, 10000, 0, nil},
+		{`import("spin.monkey")`, 500, 0, ErrBudgetExceeded},
+		{`import("big.monkey")`, 0, 20, nil},
+		{`import("big.monkey")`, 0, 10, ErrMemoryLimitExceeded},
+		{`let xs = [1, 2, 3, 4, 5, 6, 7, 8, 9]; import("big.monkey")`, 0, 20, ErrMemoryLimitExceeded},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		vm.SetDir(dir)
+		vm.SetAllowFS(true)
+		vm.SetMaxSteps(tt.maxSteps)
+		vm.SetMaxMemObjects(tt.maxMemObjects)
+		if err := vm.Run(); err != tt.expected {
+			t.Errorf("%s: want %v, got %v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestMaxMemObjects(t *testing.T) {
+	tests := []struct {
+		input         string
+		maxMemObjects int
+		expected      error
+	}{
+		{"[1, 2, 3]", 0, nil},
+		{"[1, 2, 3]", 4, nil},
+		{"[1, 2, 3]", 3, ErrMemoryLimitExceeded},
+		{`let s = ""; let f = fn(n) { if (n > 0) { s = s + "abcdefgh"; f(n - 1) } }; f(500)`, 100,
+			ErrMemoryLimitExceeded},
+		{"let h = {}; let f = fn(n) { if (n > 0) { h[n] = n; f(n - 1) } }; f(500)", 100,
+			ErrMemoryLimitExceeded},
+		{"let h = {}; let f = fn(n) { if (n > 0) { h[1] = n; f(n - 1) } }; f(500)", 100, nil},
+		{"[1, 2, 3, 4][1:]", 9, nil},
+		{"[1, 2, 3, 4][1:]", 8, ErrMemoryLimitExceeded},
+		{`try { [1, 2, 3] } catch (e) { "caught" }`, 3, ErrMemoryLimitExceeded},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		vm.SetMaxMemObjects(tt.maxMemObjects)
+		if err := vm.Run(); err != tt.expected {
+			t.Errorf("%s with %d objects: want %v, got %v", tt.input, tt.maxMemObjects, tt.expected, err)
+		}
+	}
+}
+
+func TestHook(t *testing.T) {
+	program := parse(`
+	let double = fn(x) { x * 2 };
+	double(1) + double(2);
+	`)
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	ops := map[code.Opcode]int{}
+	inFunction := 0
+	main := comp.Bytecode().Instructions
+
+	vm := New(comp.Bytecode())
+	vm.SetHook(func(fn *object.CompiledFunction, ip int, op code.Opcode) {
+		ops[op]++
+		if &fn.Instructions[0] != &main[0] {
+			inFunction++
+		}
+		if code.Opcode(fn.Instructions[ip]) != op {
+			t.Errorf("wrong opcode at %d. want=%d, got=%d", ip, fn.Instructions[ip], op)
+		}
+	})
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 6, vm.LastPoppedStackElem())
+
+	if ops[code.OpCall] != 2 || ops[code.OpMul] != 2 || ops[code.OpAdd] != 1 {
+		t.Errorf("wrong instructions seen: %v", ops)
+	}
+	// each call runs OpGetLocal, OpConstant, OpMul and OpReturnValue
+	if inFunction != 8 {
+		t.Errorf("wrong number of instructions seen in double. want=8, got=%d", inFunction)
+	}
+}
+
+func TestStackLimits(t *testing.T) {
+	tests := []struct {
+		input     string
+		maxFrames int
+		stackSize int
+		expected  interface{}
+	}{
+		{"f(9)", 11, 0, 9},
+		{"f(10)", 11, 0, ErrStackOverflow},
+		{"f(2000)", 0, 0, ErrStackOverflow},
+		{"f(100)", 0, 50, ErrStackOverflow},
+	}
+
+	for _, tt := range tests {
+		input := "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } };" + tt.input
+
+		comp := compiler.New()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		opts := []Option{}
+		if tt.maxFrames != 0 {
+			opts = append(opts, WithMaxFrames(tt.maxFrames))
+		}
+		if tt.stackSize != 0 {
+			opts = append(opts, WithStackSize(tt.stackSize))
+		}
+		vm := New(comp.Bytecode(), opts...)
+		err = vm.Run()
+
+		if expected, ok := tt.expected.(error); ok {
+			if err != expected {
+				t.Errorf("wrong VM error for %q: want=%v, got=%v", tt.input, expected, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func TestGlobalsSize(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse("let a = 1; let b = 2; let c = a + b; c")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode(), WithGlobalsSize(3))
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 3, vm.LastPoppedStackElem())
+
+	vm = New(comp.Bytecode(), WithGlobalsSize(2))
+	if err := vm.Run(); err != ErrGlobalsExhausted {
+		t.Errorf("wrong VM error: want=%v, got=%v", ErrGlobalsExhausted, err)
+	}
+
+	// globals given to the VM keep the values it defines
+	globals := make([]object.Object, 3)
+	if err := New(comp.Bytecode(), WithGlobals(globals)).Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 3, globals[2])
+}
+
+func TestRunDecodedBytecode(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`
+	let greet = fn(name) { "hi " + name };
+	let scale = fn(x) { fn(y) { x * y } };
+	greet("monkey") + " " + "${scale(2.5)(len("ab"))}";
+	`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := compiler.Encode(&buf, comp.Bytecode()); err != nil {
+		t.Fatalf("Encode failed: %s", err)
+	}
+	bytecode, err := compiler.Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+
+	vm := New(bytecode)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, "hi monkey 5.0", vm.LastPoppedStackElem())
+}
+
+func TestCallFromBuiltin(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	apply := symbolTable.Define("apply")
+	globals := make([]object.Object, GlobalsSize)
+	globals[apply.Index] = &object.Builtin{
+		RuntimeFn: func(rt object.Runtime, args ...object.Object) object.Object {
+			return rt.Call(args[0], args[1:]...)
+		},
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"apply(fn(x) { x * 2 }, 21)", 42},
+		{"let k = 1; apply(fn(x) { apply(fn(y) { y + k }, x) * 2 }, 20) + 1", 43},
+		{"[apply(fn() { 1 }), apply(fn(a, b) { a - b }, 5, 3)]", []int{1, 2}},
+		{"apply(fn(x) { 1 / x }, 0)", fmt.Errorf("division by zero")},
+		{"apply(fn(x) { x }, 1, 2)", fmt.Errorf("wrong number of arguments: want=1, got=2")},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.NewWithState(symbolTable, nil)
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := NewWithGlobalsStore(comp.Bytecode(), globals)
+		err := vm.Run()
+		if want, ok := tt.expected.(error); ok {
+			if err == nil || err.Error() != want.Error() {
+				t.Errorf("%s: wrong error. want=%q, got=%v", tt.input, want, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: vm error: %s", tt.input, err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func BenchmarkRun(b *testing.B) {
+	for _, program := range bench.Programs() {
+		b.Run(program.Name, func(b *testing.B) {
+			comp := compiler.New()
+			if err := comp.Compile(parse(program.Source)); err != nil {
+				b.Fatalf("compiler error: %s", err)
+			}
+			bytecode := comp.Bytecode()
+
+			for i := 0; i < b.N; i++ {
+				if err := New(bytecode).Run(); err != nil {
+					b.Fatalf("vm error: %s", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+//go:build js && wasm
+
+package main
+
+import "syscall/js"
+
+func main() {
+	js.Global().Set("runMonkey", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) != 1 || args[0].Type() != js.TypeString {
+			return promise(func() result {
+				return result{errors: []string{"runMonkey takes the source of a program"}}
+			})
+		}
+		src := args[0].String()
+		return promise(func() result { return run(src) })
+	}))
+
+	// keep the exported function alive
+	select {}
+}
+
+// promise returns a JavaScript Promise of the result of f, which runs in
+// its own goroutine. A callback that blocks would hold up the event loop
+// of the page, and with it the timers that end a program waiting on a
+// channel.
+func promise(f func() result) js.Value {
+	var executor js.Func
+	executor = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		resolve := args[0]
+		go func() {
+			resolve.Invoke(f().value())
+			executor.Release()
+		}()
+		return nil
+	})
+	return js.Global().Get("Promise").New(executor)
+}
+
+// value converts r to a JavaScript object.
+func (r result) value() js.Value {
+	errs := make([]interface{}, len(r.errors))
+	for i, err := range r.errors {
+		errs[i] = err
+	}
+	return js.ValueOf(map[string]interface{}{
+		"output": r.output,
+		"errors": errs,
+	})
+}
@@ -0,0 +1,80 @@
+// Command wasm is the Monkey interpreter for web browsers. Built with
+//
+//	GOOS=js GOARCH=wasm go build -o monkey.wasm ./wasm
+//
+// and started with the wasm_exec.js that comes with Go, as index.html
+// does, it defines a global JavaScript function
+//
+//	runMonkey(src) // a Promise of {output: "...", errors: ["..."]}
+//
+// that runs a program on the evaluator and resolves to what it printed,
+// together with its parse errors or the error it failed with.
+//
+// Programs run in the sandbox of monkey.Options: builtins that need files,
+// the environment or other processes fail, standard input is empty and
+// exit is refused. They are also stopped after maxSteps steps, since a
+// program that never ends would freeze the page, once they have allocated
+// maxMemObjects, before they exhaust the memory of the page, and after
+// timeout, which also counts the time they spend waiting on channels,
+// where they take no steps.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"monkey"
+	"strings"
+	"time"
+)
+
+// maxSteps bounds how long a program may run, to a few seconds in a
+// browser, and maxMemObjects what it may allocate, as object.Size counts.
+const (
+	maxSteps      = 2_000_000
+	maxMemObjects = 10_000_000
+)
+
+// timeout bounds how long a program may run, counting the time it waits
+// in recv or send.
+var timeout = 5 * time.Second
+
+type result struct {
+	output string
+	errors []string
+}
+
+func run(src string) result {
+	var out bytes.Buffer
+	script := monkey.NewWithOptions(monkey.EngineEval, monkey.Options{
+		MaxSteps:      maxSteps,
+		MaxMemObjects: maxMemObjects,
+	})
+	script.SetStdout(&out)
+	script.SetStderr(&out)
+	script.SetStdin(strings.NewReader(""))
+
+	if err := script.Compile(src); err != nil {
+		// parse errors come joined
+		var errs []string
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, err := range joined.Unwrap() {
+				errs = append(errs, err.Error())
+			}
+		} else {
+			errs = append(errs, err.Error())
+		}
+		return result{errors: errs}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if _, err := script.Run(ctx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("time limit of %s exceeded", timeout)
+		}
+		return result{output: out.String(), errors: []string{err.Error()}}
+	}
+	return result{output: out.String()}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		input  string
+		output string
+		errors []string
+	}{
+		{`puts("hello", 1 + 2)`, "hello\n3\n", nil},
+		{"let x = 1 +;", "", []string{"no prefix parse function for ; found at line 1, column 12"}},
+		{"let x = ;\nlet = 2;", "", []string{
+			"no prefix parse function for ; found at line 1, column 9",
+			"expected next token to be 'IDENT', got '=' instead at line 2, column 5",
+		}},
+		{`puts(1); 1 + "a"; puts(2)`, "1\n", []string{"type mismatch: INTEGER + STRING at line 1, column 12"}},
+		// the sandbox
+		{`readFile("/etc/passwd")`, "", []string{
+			"`readFile` is not allowed: file system access is disabled at line 1, column 9",
+		}},
+		{`exit(1)`, "", []string{"`exit` is not allowed: exiting is disabled at line 1, column 5"}},
+		{`puts(readLine())`, "null\n", nil},
+		{"for (x in 0..100000000) {}", "", []string{"execution budget exceeded"}},
+		{`puts("waiting"); recv(chan())`, "waiting\n", []string{
+			"deadlock: all tasks are waiting at line 1, column 22",
+		}},
+	}
+
+	// the step budget, not the clock, must stop the loop, however slowly
+	// the tests run
+	defer func(d time.Duration) { timeout = d }(timeout)
+	timeout = time.Minute
+
+	for _, tt := range tests {
+		r := run(tt.input)
+		if r.output != tt.output {
+			t.Errorf("wrong output for %q. want=%q, got=%q", tt.input, tt.output, r.output)
+		}
+		if strings.Join(r.errors, "\n") != strings.Join(tt.errors, "\n") {
+			t.Errorf("wrong errors for %q. want=%q, got=%q", tt.input, tt.errors, r.errors)
+		}
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	defer func(d time.Duration) { timeout = d }(timeout)
+	timeout = 10 * time.Millisecond
+
+	// programs waiting on a channel take no steps, though the tasks they
+	// wait for may
+	tests := []struct {
+		input  string
+		output string
+	}{
+		{`puts("waiting"); let c = chan(); spawn fn() { for (i in 0..1000000000) {} }; recv(c)`, "waiting\n"},
+		{`let c = chan(); spawn fn() { for (i in 0..1000000000) {} }; send(c, 1)`, ""},
+	}
+
+	for _, tt := range tests {
+		r := run(tt.input)
+		if r.output != tt.output {
+			t.Errorf("wrong output for %q. want=%q, got=%q", tt.input, tt.output, r.output)
+		}
+		want := "time limit of 10ms exceeded"
+		if len(r.errors) != 1 || r.errors[0] != want {
+			t.Errorf("wrong errors for %q. want=%q, got=%q", tt.input, want, r.errors)
+		}
+	}
+}